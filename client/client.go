@@ -0,0 +1,546 @@
+// Package client is a Go client for math-serv.  It's a thin wrapper around the HTTP API that handles
+// encoding operands, retrying requests that failed for reasons that might not last, and decoding
+// error responses into Errors
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"math-serv/server"
+)
+
+// The content types the client can send operands as
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeForm = "application/x-www-form-urlencoded"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	defaultBackoff = 100 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+)
+
+// Vars names an operation's operands, for operations that don't just take x and y
+type Vars map[string]interface{}
+
+// Client calls a math-serv instance.  It's safe for concurrent use
+type Client struct {
+	baseURL     string
+	contentType string
+	httpClient  *http.Client
+	timeout     time.Duration // for each attempt, 0 for none
+	retries     int
+	backoff     time.Duration
+	options     url.Values
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithContentType sets the content type operands are sent as, ContentTypeJSON by default.  Form
+// encoding can only send numbers, strings, and lists of them
+func WithContentType(contentType string) Option {
+	return func(c *Client) {
+		c.contentType = contentType
+	}
+}
+
+// WithHTTPClient sets the http.Client requests are made with, http.DefaultClient by default
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout limits how long each attempt at a request can take, 30 seconds by default.  Zero
+// leaves it up to the context
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries sets how many times a request is retried after a network error, a 429, or a 5xx
+// other than an only-if-cached miss.  Each retry waits twice as long as the last, starting at
+// backoff, with some jitter.  Requests aren't retried by default
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithOption sets a query parameter on every request, like "mode" or "places"
+func WithOption(name, value string) Option {
+	return func(c *Client) {
+		c.options.Set(name, value)
+	}
+}
+
+// New creates a Client for the server at baseURL, like "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		contentType: ContentTypeJSON,
+		httpClient:  http.DefaultClient,
+		timeout:     defaultTimeout,
+		backoff:     defaultBackoff,
+		options:     make(url.Values),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is an error response from the server
+type Error struct {
+	Status  int    // the HTTP status, 0 for errors in a Batch
+	Code    string // one of the server's error codes, like "invalid_argument" or "domain_error"
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	if e.Status == 0 {
+		// batch errors don't have a status of their own
+		return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+	}
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+}
+
+// Add returns x + y
+func (c *Client) Add(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "add", x, y)
+}
+
+// Subtract returns x - y
+func (c *Client) Subtract(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "subtract", x, y)
+}
+
+// Multiply returns x * y
+func (c *Client) Multiply(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "multiply", x, y)
+}
+
+// Divide returns x / y
+func (c *Client) Divide(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "divide", x, y)
+}
+
+// Mod returns the remainder of x / y
+func (c *Client) Mod(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "mod", x, y)
+}
+
+// Pow returns x to the y power
+func (c *Client) Pow(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "pow", x, y)
+}
+
+// Root returns the yth root of x
+func (c *Client) Root(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "root", x, y)
+}
+
+// Log returns log x base y
+func (c *Client) Log(ctx context.Context, x, y float64) (float64, error) {
+	return c.binary(ctx, "log", x, y)
+}
+
+// Eval returns the value of an infix expression like "2^10 + 1"
+func (c *Client) Eval(ctx context.Context, expression string) (float64, error) {
+	res, err := c.Do(ctx, "eval", Vars{"expression": expression})
+	if err != nil {
+		return 0, err
+	}
+	return floatAnswer(res)
+}
+
+// binary calls one of the original binary operations, which are the ones MathRequest describes
+func (c *Client) binary(ctx context.Context, op string, x, y float64) (float64, error) {
+	res, err := c.post(ctx, op, server.MathRequest{X: x, Y: y})
+	if err != nil {
+		return 0, err
+	}
+	return floatAnswer(res)
+}
+
+// Do calls op with args and returns the whole response.  Plain args are x and y, in that order, and
+// Vars name operands outright: Do(ctx, "add", 1, 2) and Do(ctx, "factorial", Vars{"n": 20})
+func (c *Client) Do(ctx context.Context, op string, args ...interface{}) (*server.MathOKResponse, error) {
+	vars := make(Vars)
+	positional := []string{"x", "y"}
+	for _, arg := range args {
+		if named, ok := arg.(Vars); ok {
+			for name, value := range named {
+				vars[name] = value
+			}
+			continue
+		}
+
+		if len(positional) == 0 {
+			return nil, fmt.Errorf("%s: at most 2 positional args, use Vars for more", op)
+		}
+		vars[positional[0]] = arg
+		positional = positional[1:]
+	}
+
+	return c.post(ctx, op, vars)
+}
+
+// Request is a single request in a Batch
+type Request struct {
+	Op   string
+	Vars Vars
+}
+
+// Result is the outcome of a single request in a Batch.  Exactly one of Answer and Err is set
+type Result struct {
+	Answer interface{}
+	Err    error
+}
+
+// Batch sends every request in a single JSON-RPC call (see /rpc) and returns their results in the
+// same order.  The error is only for failures of the batch as a whole
+func (c *Client) Batch(ctx context.Context, requests []Request) ([]Result, error) {
+	type rpcCall struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  Vars   `json:"params,omitempty"`
+		ID      int    `json:"id"`
+	}
+	type rpcReply struct {
+		Result interface{} `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    *struct {
+				Code    string                 `json:"code"`
+				Details map[string]interface{} `json:"details"`
+			} `json:"data"`
+		} `json:"error"`
+		ID *int `json:"id"`
+	}
+
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	calls := make([]rpcCall, len(requests))
+	for i, req := range requests {
+		calls[i] = rpcCall{JSONRPC: "2.0", Method: req.Op, Params: req.Vars, ID: i}
+	}
+	body, err := json.Marshal(calls)
+	if err != nil {
+		return nil, errors.Wrap(err, "json encode failed")
+	}
+
+	resBody, err := c.send(ctx, "rpc", ContentTypeJSON, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var replies []rpcReply
+	err = json.Unmarshal(resBody, &replies)
+	if err != nil {
+		return nil, errors.Wrap(err, "json decode failed")
+	}
+
+	results := make([]Result, len(requests))
+	answered := make([]bool, len(requests))
+	for _, reply := range replies {
+		if reply.ID == nil || *reply.ID < 0 || *reply.ID >= len(requests) {
+			continue
+		}
+
+		i := *reply.ID
+		answered[i] = true
+		if reply.Error == nil {
+			results[i].Answer = reply.Result
+			continue
+		}
+		rpcErr := &Error{Message: reply.Error.Message}
+		if reply.Error.Data != nil {
+			rpcErr.Code = reply.Error.Data.Code
+			rpcErr.Details = reply.Error.Data.Details
+		}
+		results[i].Err = rpcErr
+	}
+	for i := range results {
+		if !answered[i] {
+			results[i].Err = fmt.Errorf("no response for request %d", i)
+		}
+	}
+
+	return results, nil
+}
+
+// Operation describes one of the server's operations
+type Operation struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Arity       int      `json:"arity"`
+	Params      []string `json:"params"`
+	Optional    []string `json:"optional"`
+}
+
+// Operations lists the server's operations, by way of its GraphQL endpoint
+func (c *Client) Operations(ctx context.Context) ([]Operation, error) {
+	body, err := json.Marshal(map[string]string{
+		"query": "{ operations { name description arity params optional } }",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "json encode failed")
+	}
+
+	resBody, err := c.send(ctx, "graphql", ContentTypeJSON, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			Operations []Operation `json:"operations"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	err = json.Unmarshal(resBody, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "json decode failed")
+	}
+	if len(res.Errors) > 0 {
+		return nil, fmt.Errorf("list operations failed: %s", res.Errors[0].Message)
+	}
+	return res.Data.Operations, nil
+}
+
+// post encodes body in the client's content type, sends it to /op, and decodes the response
+func (c *Client) post(ctx context.Context, op string, body interface{}) (*server.MathOKResponse, error) {
+	var encoded []byte
+	var err error
+	switch c.contentType {
+	case ContentTypeJSON:
+		encoded, err = json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "json encode failed")
+		}
+	case ContentTypeForm:
+		encoded, err = formEncode(body)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content type: %q", c.contentType)
+	}
+
+	resBody, err := c.send(ctx, op, c.contentType, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var res server.MathOKResponse
+	err = json.Unmarshal(resBody, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "json decode failed")
+	}
+	return &res, nil
+}
+
+// send POSTs body to path, retrying as configured, and returns the body of the first successful
+// response.  Error responses are returned as *Error
+func (c *Client) send(ctx context.Context, path, contentType string, body []byte) ([]byte, error) {
+	target := c.baseURL + "/" + path
+	if len(c.options) > 0 {
+		target += "?" + c.options.Encode()
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var resBody []byte
+		var retry bool
+		resBody, retry, err = c.attempt(ctx, target, contentType, body)
+		if err == nil {
+			return resBody, nil
+		}
+		if !retry || attempt >= c.retries {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(c.wait(attempt)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// attempt makes a single request.  retry is true if the request failed in a way that's worth
+// trying again
+func (c *Client) attempt(ctx context.Context, target, contentType string, body []byte) (resBody []byte, retry bool, err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, errors.Wrap(err, "create request failed")
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		// a timed out attempt is worth retrying, a cancelled request isn't
+		return nil, ctx.Err() == nil || ctx.Err() == context.DeadlineExceeded, errors.Wrap(err, "request failed")
+	}
+	defer res.Body.Close()
+
+	resBody, err = io.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, errors.Wrap(err, "read response failed")
+	}
+
+	if res.StatusCode/100 == 2 {
+		return resBody, false, nil
+	}
+
+	var errRes server.MathErrorResponse
+	if json.Unmarshal(resBody, &errRes) != nil || errRes.Code == "" {
+		errRes = server.MathErrorResponse{
+			Status: res.StatusCode,
+			Code:   "internal",
+			Error:  strings.TrimSpace(string(resBody)),
+		}
+	}
+	mathErr := &Error{
+		Status:  res.StatusCode,
+		Code:    errRes.Code,
+		Message: errRes.Error,
+		Details: errRes.Details,
+	}
+
+	retry = res.StatusCode == http.StatusTooManyRequests ||
+		(res.StatusCode >= 500 && res.StatusCode != http.StatusInternalServerError && errRes.Code != "not_cached")
+	return nil, retry, mathErr
+}
+
+// wait is how long to wait before retrying after the given attempt
+func (c *Client) wait(attempt int) time.Duration {
+	wait := c.backoff << uint(attempt)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	// up to 20% jitter keeps clients that failed together from retrying together
+	return wait - time.Duration(rand.Int63n(int64(wait)/5+1))
+}
+
+// formEncode encodes a MathRequest or Vars as a form
+func formEncode(body interface{}) ([]byte, error) {
+	form := make(url.Values)
+	switch body := body.(type) {
+	case server.MathRequest:
+		form.Set("x", strconv.FormatFloat(body.X, 'g', -1, 64))
+		form.Set("y", strconv.FormatFloat(body.Y, 'g', -1, 64))
+	case Vars:
+		for name, value := range body {
+			values, err := formValues(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "form encode %s failed", name)
+			}
+			form[name] = values
+		}
+	}
+	return []byte(form.Encode()), nil
+}
+
+// formValues writes a number, string, or list of them as form values, which can also be given as
+// JSON
+func formValues(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		return []string{value}, nil
+	case float64:
+		return []string{strconv.FormatFloat(value, 'g', -1, 64)}, nil
+	case float32:
+		return []string{strconv.FormatFloat(float64(value), 'g', -1, 32)}, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return []string{fmt.Sprint(value)}, nil
+	case bool:
+		return []string{strconv.FormatBool(value)}, nil
+	case []float64:
+		values := make([]string, len(value))
+		for i, v := range value {
+			values[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return values, nil
+	case []int:
+		values := make([]string, len(value))
+		for i, v := range value {
+			values[i] = strconv.Itoa(v)
+		}
+		return values, nil
+	case []string:
+		return value, nil
+	case json.Number:
+		return []string{value.String()}, nil
+	case json.RawMessage:
+		// numbers stay as they were written rather than going through float64
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		var decoded interface{}
+		err := decoder.Decode(&decoded)
+		if err != nil {
+			return nil, errors.Wrap(err, "json decode failed")
+		}
+		return formValues(decoded)
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			more, err := formValues(v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, more...)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%T can't be form encoded, use JSON", value)
+}
+
+// floatAnswer returns the response's answer as a float64
+func floatAnswer(res *server.MathOKResponse) (float64, error) {
+	switch answer := res.Answer.(type) {
+	case float64:
+		return answer, nil
+	case string:
+		// precise and rational mode answers
+		f, err := strconv.ParseFloat(answer, 64)
+		if err == nil {
+			return f, nil
+		}
+		if r, ok := new(big.Rat).SetString(answer); ok {
+			f, _ := r.Float64()
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("answer isn't a number: %v", res.Answer)
+}
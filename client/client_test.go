@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"math-serv/server"
+)
+
+// newTestClient serves server.GetRouter() and returns a client for it
+func newTestClient(t *testing.T, opts ...Option) *Client {
+	srv := httptest.NewServer(server.GetRouter())
+	t.Cleanup(srv.Close)
+	return New(srv.URL, opts...)
+}
+
+// TestBinary checks the typed binary operations with both content types
+func TestBinary(t *testing.T) {
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeForm} {
+		t.Run(contentType, func(t *testing.T) {
+			c := newTestClient(t, WithContentType(contentType))
+			ctx := context.Background()
+
+			testCases := []struct {
+				fn       func(context.Context, float64, float64) (float64, error)
+				x, y     float64
+				expected float64
+			}{
+				{c.Add, 3, 4, 7},
+				{c.Subtract, 3, 4, -1},
+				{c.Multiply, 3, 4, 12},
+				{c.Divide, 3, 4, 0.75},
+				{c.Mod, 7, 4, 3},
+				{c.Pow, 2, 10, 1024},
+				{c.Root, 16, 2, 4},
+				{c.Log, 8, 2, 3},
+			}
+
+			for _, testCase := range testCases {
+				actual, err := testCase.fn(ctx, testCase.x, testCase.y)
+				if err != nil {
+					t.Logf("unexpected error for %g, %g: %s\n", testCase.x, testCase.y, err)
+					t.Fail()
+					continue
+				}
+				if actual != testCase.expected {
+					t.Logf("unexpected answer for %g, %g: (actual %g != expected %g)\n", testCase.x, testCase.y, actual, testCase.expected)
+					t.Fail()
+				}
+			}
+		})
+	}
+}
+
+// TestDo checks positional args, Vars, query options, and Eval
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	res, err := c.Do(ctx, "factor", Vars{"n": 12})
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	factors, ok := res.Answer.([]interface{})
+	if !ok || len(factors) != 3 || factors[2] != "3" || res.Action != "factor" {
+		t.Logf("unexpected response: %+v\n", res)
+		t.Fail()
+	}
+
+	formClient := newTestClient(t, WithContentType(ContentTypeForm))
+	res, err = formClient.Do(ctx, "mean", Vars{"data": []float64{1, 2, 3, 4}})
+	if err != nil || res.Answer != 2.5 {
+		t.Logf("unexpected form response: %+v %v\n", res, err)
+		t.Fail()
+	}
+	res, err = formClient.Do(ctx, "mean", Vars{"data": json.RawMessage("[1, 2, 3, 4]")})
+	if err != nil || res.Answer != 2.5 {
+		t.Logf("unexpected form response for JSON operands: %+v %v\n", res, err)
+		t.Fail()
+	}
+
+	rational := newTestClient(t, WithOption("mode", "rational"))
+	res, err = rational.Do(ctx, "divide", 1, 3)
+	if err != nil || res.Answer != "1/3" || res.Mode != "rational" {
+		t.Logf("unexpected rational response: %+v %v\n", res, err)
+		t.Fail()
+	}
+
+	_, err = c.Do(ctx, "add", 1, 2, 3)
+	if err == nil {
+		t.Log("expecting error for 3 positional args, none received")
+		t.Fail()
+	}
+
+	answer, err := c.Eval(ctx, "2^10 + 1")
+	if err != nil || answer != 1025 {
+		t.Logf("unexpected eval answer: (actual %g %v != expected 1025)\n", answer, err)
+		t.Fail()
+	}
+}
+
+// TestErrors checks that error responses come back as *Error
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	testCases := []struct {
+		op             string
+		args           []interface{}
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"nope", []interface{}{1, 2}, http.StatusBadRequest, "unsupported_operation"},
+		{"factorial", []interface{}{Vars{"n": -1}}, http.StatusUnprocessableEntity, "domain_error"},
+		{"add", []interface{}{Vars{"x": "a", "y": 1}}, http.StatusBadRequest, "invalid_argument"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := c.Do(ctx, testCase.op, testCase.args...)
+		var mathErr *Error
+		if !errors.As(err, &mathErr) {
+			t.Logf("unexpected error for %s: (actual %v != expected *Error)\n", testCase.op, err)
+			t.Fail()
+			continue
+		}
+		if mathErr.Status != testCase.expectedStatus || mathErr.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s: (actual %d %s != expected %d %s)\n", testCase.op, mathErr.Status, mathErr.Code, testCase.expectedStatus, testCase.expectedCode)
+			t.Fail()
+		}
+	}
+}
+
+// TestBatch checks that batches come back in order with their own errors
+func TestBatch(t *testing.T) {
+	c := newTestClient(t)
+
+	results, err := c.Batch(context.Background(), []Request{
+		{Op: "add", Vars: Vars{"x": 1, "y": 2}},
+		{Op: "factorial", Vars: Vars{"n": -1}},
+		{Op: "percentile", Vars: Vars{"data": []int{1, 2, 3, 4}, "p": 50}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("unexpected result count: (actual %d != expected 3)\n", len(results))
+	}
+
+	if results[0].Answer != 3.0 || results[0].Err != nil {
+		t.Logf("unexpected first result: %+v\n", results[0])
+		t.Fail()
+	}
+	var mathErr *Error
+	if !errors.As(results[1].Err, &mathErr) || mathErr.Code != "domain_error" {
+		t.Logf("unexpected second result: %+v\n", results[1])
+		t.Fail()
+	}
+	if results[2].Answer != 2.5 {
+		t.Logf("unexpected third result: %+v\n", results[2])
+		t.Fail()
+	}
+}
+
+// TestOperations checks that the operations come back with their params
+func TestOperations(t *testing.T) {
+	c := newTestClient(t)
+
+	operations, err := c.Operations(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	var convert *Operation
+	for i := range operations {
+		if operations[i].Name == "convert" {
+			convert = &operations[i]
+		}
+	}
+	if convert == nil || convert.Arity != 3 || len(convert.Params) != 3 || convert.Params[1] != "from" || convert.Description == "" {
+		t.Logf("unexpected convert operation: %+v\n", convert)
+		t.Fail()
+	}
+}
+
+// TestRetries checks that retryable failures are retried and that others aren't
+func TestRetries(t *testing.T) {
+	var calls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		server.GetRouter().ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	c := New(flaky.URL, WithRetries(2, time.Millisecond))
+	answer, err := c.Add(context.Background(), 1, 2)
+	if err != nil || answer != 3 || atomic.LoadInt32(&calls) != 3 {
+		t.Logf("unexpected retried answer: (actual %g %v after %d calls != expected 3 after 3 calls)\n", answer, err, calls)
+		t.Fail()
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	c = New(flaky.URL, WithRetries(1, time.Millisecond))
+	_, err = c.Add(context.Background(), 1, 2)
+	var mathErr *Error
+	if !errors.As(err, &mathErr) || mathErr.Status != http.StatusServiceUnavailable {
+		t.Logf("unexpected error after retries ran out: %v\n", err)
+		t.Fail()
+	}
+
+	// domain errors aren't going anywhere, so they aren't retried
+	atomic.StoreInt32(&calls, 3)
+	c = New(flaky.URL, WithRetries(5, time.Millisecond))
+	_, err = c.Do(context.Background(), "factorial", Vars{"n": -1})
+	if atomic.LoadInt32(&calls) != 4 || err == nil {
+		t.Logf("unexpected calls for a domain error: (actual %d != expected 4)\n", atomic.LoadInt32(&calls))
+		t.Fail()
+	}
+}
+
+// TestTimeout checks that a slow server fails the attempt rather than hanging
+func TestTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	c := New(slow.URL, WithTimeout(20*time.Millisecond))
+	start := time.Now()
+	_, err := c.Add(context.Background(), 1, 2)
+	if err == nil || time.Since(start) > 150*time.Millisecond {
+		t.Logf("unexpected timeout result: %v after %s\n", err, time.Since(start))
+		t.Fail()
+	}
+}
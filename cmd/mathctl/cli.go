@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"math-serv/client"
+	"math-serv/server"
+)
+
+// maxBatchRequests is the most requests the server takes in a single batch, bigger batches are sent
+// in pieces
+const maxBatchRequests = 1000
+
+// maxLineBytes limits the length of a batch or REPL line
+const maxLineBytes = 1 << 20
+
+// namedOperand matches operands given as name=value
+var namedOperand = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+
+// routedParams are the params of the operations that have routes of their own, which don't show up
+// in the server's list of operations
+var routedParams = map[string][]string{
+	"convert/base": {"value", "to", "from"},
+}
+
+// cli runs commands against a server and prints what comes back
+type cli struct {
+	client *client.Client
+	format format
+	stdout io.Writer
+	stderr io.Writer
+
+	operations map[string]client.Operation // loaded the first time they're needed
+
+	// the REPL's last answer, which operands and expressions can refer to as ans
+	ans    interface{}
+	hasAns bool
+}
+
+// result is the outcome of a single request
+type result struct {
+	id       json.RawMessage // only for batches
+	op       string
+	response *server.MathOKResponse // only for requests that aren't part of a batch
+	answer   interface{}
+	err      error
+}
+
+// call calls op with the given operands
+func (c *cli) call(ctx context.Context, op string, operands []string) result {
+	vars := make(client.Vars, len(operands))
+	var positional []string
+	for _, operand := range operands {
+		if match := namedOperand.FindStringSubmatch(operand); match != nil {
+			vars[match[1]] = c.operandValue(match[2])
+			continue
+		}
+		positional = append(positional, operand)
+	}
+
+	if len(positional) > 0 {
+		names, err := c.params(ctx, op)
+		if err != nil {
+			return result{op: op, err: err}
+		}
+		if len(positional) > len(names) {
+			return result{op: op, err: fmt.Errorf("%s takes at most %d operands, got %d", op, len(names), len(positional))}
+		}
+		for i, operand := range positional {
+			vars[names[i]] = c.operandValue(operand)
+		}
+	}
+
+	return c.do(ctx, op, vars)
+}
+
+// eval evaluates expression, with name=value operands for its variables
+func (c *cli) eval(ctx context.Context, expression string, operands []string) result {
+	at := make(client.Vars, len(operands))
+	for _, operand := range operands {
+		match := namedOperand.FindStringSubmatch(operand)
+		if match == nil {
+			return result{op: "eval", err: fmt.Errorf("variables are given as name=value, got %q", operand)}
+		}
+		at[match[1]] = c.operandValue(match[2])
+	}
+	if _, ok := c.ans.(float64); ok && at["ans"] == nil && strings.Contains(expression, "ans") {
+		at["ans"] = c.ans
+	}
+
+	vars := client.Vars{"expression": expression}
+	if len(at) > 0 {
+		vars["at"] = at
+	}
+	return c.do(ctx, "eval", vars)
+}
+
+// do sends a single request
+func (c *cli) do(ctx context.Context, op string, vars client.Vars) result {
+	res, err := c.client.Do(ctx, op, vars)
+	if err != nil {
+		return result{op: op, err: err}
+	}
+	return result{op: op, response: res, answer: res.Answer}
+}
+
+// operandValue reads an operand as JSON if it can be and as a string otherwise.  In the REPL, ans is
+// the last answer
+func (c *cli) operandValue(operand string) interface{} {
+	if operand == "ans" && c.hasAns {
+		return c.ans
+	}
+	if json.Valid([]byte(operand)) {
+		return json.RawMessage(operand)
+	}
+	return operand
+}
+
+// params returns the names that op's positional operands are given to
+func (c *cli) params(ctx context.Context, op string) ([]string, error) {
+	if names, ok := routedParams[op]; ok {
+		return names, nil
+	}
+
+	operation, ok, err := c.operation(ctx, op)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported operation: %q", op)
+	}
+	return append(append([]string{}, operation.Params...), operation.Optional...), nil
+}
+
+// operation looks op up in the server's operations
+func (c *cli) operation(ctx context.Context, op string) (client.Operation, bool, error) {
+	if c.operations == nil {
+		operations, err := c.client.Operations(ctx)
+		if err != nil {
+			return client.Operation{}, false, err
+		}
+		c.operations = make(map[string]client.Operation, len(operations))
+		for _, operation := range operations {
+			c.operations[operation.Name] = operation
+		}
+	}
+
+	operation, ok := c.operations[op]
+	return operation, ok, nil
+}
+
+// listOperations prints the server's operations and what they take
+func (c *cli) listOperations(ctx context.Context) int {
+	_, _, err := c.operation(ctx, "")
+	if err != nil {
+		fmt.Fprintf(c.stderr, "mathctl: %s\n", err)
+		return exitFailed
+	}
+
+	names := make([]string, 0, len(c.operations))
+	for name := range c.operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	operations := make([]client.Operation, len(names))
+	for i, name := range names {
+		operations[i] = c.operations[name]
+	}
+	c.format.operations(c.stdout, operations)
+	return exitOK
+}
+
+// batchLine is a single line of batch input
+type batchLine struct {
+	ID   json.RawMessage            `json:"id"`
+	Op   string                     `json:"op"`
+	Args map[string]json.RawMessage `json:"args"`
+}
+
+// batch runs the JSON lines read from r, one request per line, like
+//
+//	{"id": 1, "op": "add", "args": {"x": 3, "y": 4}}
+//
+// ids are optional and default to the line number.  Blank lines and lines starting with # are
+// skipped, and a line that can't be read fails on its own without holding up the rest
+func (c *cli) batch(ctx context.Context, r io.Reader) int {
+	var results []result
+	var pending []int // the results still waiting on the server
+	var requests []client.Request
+
+	flush := func() error {
+		if len(requests) == 0 {
+			return nil
+		}
+		answers, err := c.client.Batch(ctx, requests)
+		if err != nil {
+			return err
+		}
+		for i, answer := range answers {
+			results[pending[i]].answer = answer.Answer
+			results[pending[i]].err = answer.Err
+		}
+		pending, requests = pending[:0], requests[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineBytes)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var line batchLine
+		err := json.Unmarshal([]byte(text), &line)
+		if err == nil && line.Op == "" {
+			err = fmt.Errorf("missing op")
+		}
+		if len(line.ID) == 0 || string(line.ID) == "null" {
+			line.ID = json.RawMessage(fmt.Sprint(number))
+		}
+		if err != nil {
+			results = append(results, result{id: line.ID, op: line.Op, err: fmt.Errorf("line %d: %s", number, err)})
+			continue
+		}
+
+		pending = append(pending, len(results))
+		results = append(results, result{id: line.ID, op: line.Op})
+		// the args are passed along as they were written, so big numbers don't go through float64
+		vars := make(client.Vars, len(line.Args))
+		for name, value := range line.Args {
+			vars[name] = value
+		}
+		requests = append(requests, client.Request{Op: line.Op, Vars: vars})
+		if len(requests) == maxBatchRequests {
+			err = flush()
+			if err != nil {
+				fmt.Fprintf(c.stderr, "mathctl: %s\n", err)
+				return exitFailed
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(c.stderr, "mathctl: read failed: %s\n", err)
+		return exitUsage
+	}
+	if err := flush(); err != nil {
+		fmt.Fprintf(c.stderr, "mathctl: %s\n", err)
+		return exitFailed
+	}
+
+	return c.print(results...)
+}
+
+// print prints results in the cli's format and returns the exit status they add up to
+func (c *cli) print(results ...result) int {
+	c.format.results(c.stdout, results)
+
+	for _, res := range results {
+		if res.err != nil {
+			return exitFailed
+		}
+	}
+	return exitOK
+}
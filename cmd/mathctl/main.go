@@ -0,0 +1,166 @@
+// mathctl is a command line client for math-serv.  It calls a single operation, evaluates an
+// expression, runs a batch of requests read as JSON lines, or starts a REPL:
+//
+//	mathctl add 3 4
+//	mathctl factorial n=20
+//	mathctl eval "2^10"
+//	mathctl batch < jobs.jsonl
+//	mathctl repl
+//
+// Operands are matched up with the operation's params and then its optional params, the same as
+// the line protocol, unless they're given as name=value.  Each is read as JSON if it can be and as a
+// string otherwise
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"math-serv/client"
+)
+
+const defaultServer string = "http://localhost:8080"
+const defaultOutput string = "text"
+const defaultTimeout time.Duration = time.Second * 30
+const defaultRetries int = 2
+const defaultBackoff time.Duration = time.Millisecond * 200
+
+// The environment variables that stand in for flags that weren't given
+const (
+	serverEnv  = "MATHCTL_SERVER"
+	outputEnv  = "MATHCTL_OUTPUT"
+	historyEnv = "MATHCTL_HISTORY"
+)
+
+// The exit statuses, which scripts can use to tell a bad answer from a bad invocation
+const (
+	exitOK     = 0
+	exitFailed = 1 // a request failed
+	exitUsage  = 2
+)
+
+const usage = `usage: mathctl [flags] <command>
+
+commands:
+  <op> [operand ...]      call an operation, operands are positional or name=value
+  eval <expression> [name=value ...]
+                          evaluate an expression, with values for its variables
+  batch [file]            run the JSON lines in file, or stdin, as a single batch
+  repl                    start a REPL, which is also what no command does
+  ops                     list the server's operations
+
+flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main without the process, so that it can be tested
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("mathctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	serverURL := flags.String("server", envOr(serverEnv, defaultServer), "base URL of the server, $"+serverEnv+" by default")
+	output := flags.String("output", envOr(outputEnv, defaultOutput), "output format: json, text, or table, $"+outputEnv+" by default")
+	mode := flags.String("mode", "", "numeric mode: float, precise, rational, or complex")
+	contentType := flags.String("content-type", client.ContentTypeJSON, "content type to send operands as")
+	timeout := flags.Duration("timeout", defaultTimeout, "timeout for each attempt")
+	retries := flags.Int("retries", defaultRetries, "how many times to retry requests that might succeed later")
+	history := flags.String("history", envOr(historyEnv, defaultHistoryFile()), "file the REPL keeps its history in, empty for none")
+	err := flags.Parse(args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	format, ok := formats[*output]
+	if !ok {
+		fmt.Fprintf(stderr, "mathctl: unsupported output format: %q\n", *output)
+		return exitUsage
+	}
+
+	opts := []client.Option{
+		client.WithContentType(*contentType),
+		client.WithTimeout(*timeout),
+		client.WithRetries(*retries, defaultBackoff),
+	}
+	if *mode != "" {
+		opts = append(opts, client.WithOption("mode", *mode))
+	}
+
+	cli := &cli{
+		client: client.New(*serverURL, opts...),
+		format: format,
+		stdout: stdout,
+		stderr: stderr,
+	}
+	ctx := context.Background()
+
+	if flags.NArg() == 0 {
+		return cli.repl(ctx, stdin, isTerminal(stdin), *history)
+	}
+
+	command, operands := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "repl":
+		return cli.repl(ctx, stdin, isTerminal(stdin), *history)
+	case "batch":
+		if len(operands) > 1 {
+			flags.Usage()
+			return exitUsage
+		}
+		if len(operands) == 0 || operands[0] == "-" {
+			return cli.batch(ctx, stdin)
+		}
+		file, err := os.Open(operands[0])
+		if err != nil {
+			fmt.Fprintf(stderr, "mathctl: %s\n", err)
+			return exitUsage
+		}
+		defer file.Close()
+		return cli.batch(ctx, file)
+	case "ops":
+		return cli.listOperations(ctx)
+	case "eval":
+		if len(operands) == 0 {
+			flags.Usage()
+			return exitUsage
+		}
+		return cli.print(cli.eval(ctx, operands[0], operands[1:]))
+	default:
+		return cli.print(cli.call(ctx, command, operands))
+	}
+}
+
+// envOr returns the environment variable name, or fallback if it isn't set
+func envOr(name, fallback string) string {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+	return value
+}
+
+// isTerminal reports whether r is a terminal, in which case the REPL prompts for each line
+func isTerminal(r io.Reader) bool {
+	file, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"math-serv/server"
+)
+
+// startServer serves server.GetRouter() and returns its URL
+func startServer(t *testing.T) string {
+	srv := httptest.NewServer(server.GetRouter())
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// runMathctl runs mathctl against serverURL with args and input, returning its exit status and
+// output
+func runMathctl(serverURL string, input string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-server", serverURL, "-history", ""}, args...)
+	status := run(args, strings.NewReader(input), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// TestCommands runs single operations and expressions in each output format
+func TestCommands(t *testing.T) {
+	serverURL := startServer(t)
+
+	testCases := []struct {
+		args     []string
+		status   int
+		expected string
+	}{
+		{[]string{"add", "3", "4"}, exitOK, "7\n"},
+		{[]string{"factorial", "n=20"}, exitOK, "2432902008176640000\n"},
+		{[]string{"convert", "5", "km", "m"}, exitOK, `{"unit":"m","value":5000}` + "\n"},
+		{[]string{"convert/base", "255", "16"}, exitOK, "ff\n"},
+		{[]string{"eval", "2^10"}, exitOK, "1024\n"},
+		{[]string{"eval", "x^2 + 1", "x=3"}, exitOK, "10\n"},
+		{[]string{"-mode", "rational", "divide", "1", "3"}, exitOK, "1/3\n"},
+		{[]string{"add", "1", "2", "3"}, exitFailed, "ERR client_error add takes at most 2 operands, got 3\n"},
+		{[]string{"factorial", "-1"}, exitFailed, "ERR domain_error factorial of a negative number\n"},
+		{[]string{"shout", "1"}, exitFailed, "ERR client_error unsupported operation: \"shout\"\n"},
+		{[]string{"-output", "json", "add", "3", "4"}, exitOK, `{"action":"add","mode":"float","x":3,"y":4,"answer":7,"cached":false,"source":"computed"}` + "\n"},
+		{[]string{"-output", "json", "factorial", "-1"}, exitFailed, `{"op":"factorial","error":{"code":"domain_error","error":"factorial of a negative number"}}` + "\n"},
+		{[]string{"-output", "table", "add", "3", "4"}, exitOK, "OP   MODE   SOURCE    ANSWER\nadd  float  computed  7\n"},
+		{[]string{"-output", "xml", "add", "3", "4"}, exitUsage, ""},
+		{[]string{"eval"}, exitUsage, ""},
+	}
+
+	for _, testCase := range testCases {
+		status, actual, _ := runMathctl(serverURL, "", testCase.args...)
+		if status != testCase.status {
+			t.Logf("unexpected status for %q: (actual %d != expected %d)\n", testCase.args, status, testCase.status)
+			t.Fail()
+		}
+		if actual != testCase.expected {
+			t.Logf("unexpected output for %q: (actual %q != expected %q)\n", testCase.args, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestBatch runs testdata/jobs.jsonl, which has a failing request in the middle
+func TestBatch(t *testing.T) {
+	serverURL := startServer(t)
+
+	expected := map[string]string{
+		"text": "7\n15511210043330985984000000\n1025\n" + `{"unit":"m","value":5000}` + "\nERR domain_error factorial of a negative number\n2.5\n",
+		"json": `{"id":"sum","op":"add","answer":7}
+{"id":3,"op":"factorial","answer":"15511210043330985984000000"}
+{"id":"pow","op":"eval","answer":1025}
+{"id":4,"op":"convert","answer":{"unit":"m","value":5000}}
+{"id":5,"op":"factorial","error":{"code":"domain_error","error":"factorial of a negative number"}}
+{"id":6,"op":"mean","answer":2.5}
+`,
+		"table": `ID     OP         ANSWER
+"sum"  add        7
+3      factorial  15511210043330985984000000
+"pow"  eval       1025
+4      convert    {"unit":"m","value":5000}
+5      factorial  ERR domain_error factorial of a negative number
+6      mean       2.5
+`,
+	}
+
+	for output, expectedOutput := range expected {
+		status, actual, stderr := runMathctl(serverURL, "", "-output", output, "batch", filepath.Join("testdata", "jobs.jsonl"))
+		if status != exitFailed {
+			t.Logf("unexpected %s status: (actual %d != expected %d) %s\n", output, status, exitFailed, stderr)
+			t.Fail()
+		}
+		if actual != expectedOutput {
+			t.Logf("unexpected %s output: (actual %s != expected %s) %s\n", output, actual, expectedOutput, stderr)
+			t.Fail()
+		}
+	}
+
+	t.Run("stdin", func(t *testing.T) {
+		input := "{\"op\": \"add\", \"args\": {\"x\": 1, \"y\": 1}}\n\nnot json\n{\"args\": {}}\n"
+		status, actual, _ := runMathctl(serverURL, input, "batch")
+		lines := strings.Split(strings.TrimSuffix(actual, "\n"), "\n")
+		if status != exitFailed || len(lines) != 3 || lines[0] != "2" ||
+			!strings.HasPrefix(lines[1], "ERR client_error line 3:") || lines[2] != "ERR client_error line 4: missing op" {
+			t.Logf("unexpected output: %d %q\n", status, actual)
+			t.Fail()
+		}
+	})
+}
+
+// TestREPL runs a REPL session, using ans and the history along the way
+func TestREPL(t *testing.T) {
+	serverURL := startServer(t)
+	historyFile := filepath.Join(t.TempDir(), "history")
+
+	input := strings.Join([]string{
+		"add 3 4",
+		"multiply ans 6",
+		"",
+		"ans / 2",
+		"!1",
+		"factor 360",
+		"mean [1, 2, 3, 4]",
+		"!9",
+		"x + 1",
+		"history",
+		"quit",
+		"add 1 1",
+	}, "\n")
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"-server", serverURL, "-history", historyFile, "repl"}, strings.NewReader(input), &stdout, &stderr)
+	if status != exitOK {
+		t.Logf("unexpected status: (actual %d != expected %d) %s\n", status, exitOK, stderr.String())
+		t.Fail()
+	}
+
+	expected := `7
+42
+21
+7
+["2","2","2","3","3","5"]
+2.5
+ERR client_error no history line 9
+ERR invalid_argument no value given for x
+    1  add 3 4
+    2  multiply ans 6
+    3  ans / 2
+    4  add 3 4
+    5  factor 360
+    6  mean [1, 2, 3, 4]
+    7  x + 1
+    8  history
+`
+	if stdout.String() != expected {
+		t.Logf("unexpected output: (actual %s != expected %s)\n", stdout.String(), expected)
+		t.Fail()
+	}
+
+	t.Run("historyFile", func(t *testing.T) {
+		data, err := os.ReadFile(historyFile)
+		if err != nil {
+			t.Fatalf("read history failed: %s\n", err)
+		}
+		h := loadHistory(historyFile)
+		if len(h.lines) != 8 || h.lines[3] != "add 3 4" || !strings.HasSuffix(string(data), "history\n") {
+			t.Logf("unexpected history: %q\n", data)
+			t.Fail()
+		}
+	})
+}
+
+func TestSplitFields(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected []string
+	}{
+		{"add 3 4", []string{"add", "3", "4"}},
+		{"mean\t[1, 2, 3]", []string{"mean", "[1, 2, 3]"}},
+		{`derive "x ^ 2" {"x": 1}`, []string{"derive", `"x ^ 2"`, `{"x": 1}`}},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := splitFields(testCase.line)
+		if err != nil || !reflect.DeepEqual(actual, testCase.expected) {
+			t.Logf("unexpected fields for %q: (actual %q != expected %q) %v\n", testCase.line, actual, testCase.expected, err)
+			t.Fail()
+		}
+	}
+
+	for _, line := range []string{`add "3`, "mean [1, 2", "mean 1]"} {
+		_, err := splitFields(line)
+		if err == nil {
+			t.Logf("expecting error for %q, none received\n", line)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"math-serv/client"
+)
+
+// format is an output format.  Every format prints a failed request where its answer would have
+// gone, so the results of a batch line up with its requests
+type format struct {
+	results    func(w io.Writer, results []result)
+	operations func(w io.Writer, operations []client.Operation)
+}
+
+var formats = map[string]format{
+	"json":  {results: jsonResults, operations: jsonOperations},
+	"text":  {results: textResults, operations: textOperations},
+	"table": {results: tableResults, operations: tableOperations},
+}
+
+// outputError is a failed request in JSON output, matching the server's MathErrorResponse
+type outputError struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"error"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// outputResult is a result in JSON output, for results that don't have a whole response to print
+type outputResult struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Op     string          `json:"op"`
+	Answer interface{}     `json:"answer,omitempty"`
+	Error  *outputError    `json:"error,omitempty"`
+}
+
+// jsonResults prints a JSON object per line: the whole response for a single request, and the id,
+// op, and answer or error for each request in a batch
+func jsonResults(w io.Writer, results []result) {
+	encoder := json.NewEncoder(w)
+	for _, res := range results {
+		var err error
+		switch {
+		case res.response != nil:
+			err = encoder.Encode(res.response)
+		case res.err != nil:
+			err = encoder.Encode(outputResult{ID: res.id, Op: res.op, Error: newOutputError(res.err)})
+		default:
+			err = encoder.Encode(outputResult{ID: res.id, Op: res.op, Answer: res.answer})
+		}
+		if err != nil {
+			fmt.Fprintf(w, "{\"error\":%q}\n", err)
+		}
+	}
+}
+
+// textResults prints each answer on a line of its own, strings as they are and anything else as
+// JSON, and each failure as "ERR <code> <message>", the same as the line protocol
+func textResults(w io.Writer, results []result) {
+	for _, res := range results {
+		fmt.Fprintln(w, answerText(res))
+	}
+}
+
+// tableResults prints a table with a row for each result
+func tableResults(w io.Writer, results []result) {
+	batch := len(results) > 0 && results[0].id != nil
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	if batch {
+		fmt.Fprintln(table, "ID\tOP\tANSWER")
+	} else {
+		fmt.Fprintln(table, "OP\tMODE\tSOURCE\tANSWER")
+	}
+	for _, res := range results {
+		switch {
+		case batch:
+			fmt.Fprintf(table, "%s\t%s\t%s\n", res.id, res.op, answerText(res))
+		case res.response != nil:
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", res.op, res.response.Mode, res.response.Source, answerText(res))
+		default:
+			fmt.Fprintf(table, "%s\t\t\t%s\n", res.op, answerText(res))
+		}
+	}
+	table.Flush()
+}
+
+func jsonOperations(w io.Writer, operations []client.Operation) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(operations)
+}
+
+// textOperations prints each operation the way it's called, like "convert value from to"
+func textOperations(w io.Writer, operations []client.Operation) {
+	for _, operation := range operations {
+		fmt.Fprintln(w, operationUsage(operation))
+	}
+}
+
+func tableOperations(w io.Writer, operations []client.Operation) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "OPERATION\tUSAGE\tDESCRIPTION")
+	for _, operation := range operations {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", operation.Name, operationUsage(operation), operation.Description)
+	}
+	table.Flush()
+}
+
+// operationUsage is the operation followed by its params, with the optional ones in brackets
+func operationUsage(operation client.Operation) string {
+	usage := append([]string{operation.Name}, operation.Params...)
+	for _, name := range operation.Optional {
+		usage = append(usage, "["+name+"]")
+	}
+	return strings.Join(usage, " ")
+}
+
+// answerText is a result's answer as text, or its error as "ERR <code> <message>"
+func answerText(res result) string {
+	if res.err != nil {
+		outErr := newOutputError(res.err)
+		return fmt.Sprintf("ERR %s %s", outErr.Code, strings.Join(strings.Fields(outErr.Message), " "))
+	}
+
+	if answer, ok := res.answer.(string); ok {
+		return answer
+	}
+	answer, err := json.Marshal(res.answer)
+	if err != nil {
+		return fmt.Sprint(res.answer)
+	}
+	return string(answer)
+}
+
+// newOutputError gets the code and message out of err.  Errors that never made it to the server
+// have the code "client_error"
+func newOutputError(err error) *outputError {
+	var mathErr *client.Error
+	if !errors.As(err, &mathErr) {
+		return &outputError{Code: "client_error", Message: err.Error()}
+	}
+	return &outputError{Code: mathErr.Code, Message: mathErr.Message, Details: mathErr.Details}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The REPL reads the same lines as the line protocol: an operation followed by its operands, like
+// "add 3 4", or an expression, like "2^10 + 1".  ans is the last answer, as an operand or, when it's
+// a number, in an expression.  Lines are kept in a history file between sessions, and "!!" and "!n"
+// run the last line and line n of the history again
+
+// maxHistory is the most lines of history the REPL keeps
+const maxHistory = 1000
+
+const replHelp = `  <op> [operand ...]   call an operation, like "add 3 4" or "factorial n=20"
+  <expression>         evaluate an expression, like "2^10 + 1" or "sqrt(ans)"
+  ans                  the last answer
+  ops                  list the server's operations
+  history              list the lines entered so far
+  !! or !n             run the last line, or line n, again
+  help                 show this
+  quit                 leave, as does end of input
+`
+
+// defaultHistoryFile is ~/.mathctl_history, or nothing if there's no home directory
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mathctl_history")
+}
+
+// history is the REPL's history, which is appended to historyFile as it goes
+type history struct {
+	lines []string
+	file  string
+	err   error // the first failure to save a line, after which we stop trying
+}
+
+// loadHistory reads the history in file, which doesn't have to exist yet
+func loadHistory(file string) *history {
+	h := &history{file: file}
+	if file == "" {
+		return h
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+	return h
+}
+
+// add appends line to the history
+func (h *history) add(line string) {
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[1:]
+	}
+
+	if h.file == "" || h.err != nil {
+		return
+	}
+	file, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = fmt.Fprintln(file, line)
+		file.Close()
+	}
+	h.err = err
+}
+
+// expand returns the line that "!!" or "!n" refers to
+func (h *history) expand(line string) (string, error) {
+	if line == "!!" {
+		if len(h.lines) == 0 {
+			return "", fmt.Errorf("no history yet")
+		}
+		return h.lines[len(h.lines)-1], nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(h.lines) {
+		return "", fmt.Errorf("no history line %s", line[1:])
+	}
+	return h.lines[n-1], nil
+}
+
+// repl runs lines read from r until it runs out or gets "quit".  It only prompts when interactive,
+// so that it can also be fed a script
+func (c *cli) repl(ctx context.Context, r io.Reader, interactive bool, historyFile string) int {
+	h := loadHistory(historyFile)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxLineBytes)
+
+	for {
+		if interactive {
+			fmt.Fprint(c.stdout, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			return exitOK
+		}
+
+		if strings.HasPrefix(line, "!") {
+			expanded, err := h.expand(line)
+			if err != nil {
+				c.print(result{err: err})
+				continue
+			}
+			line = expanded
+			if interactive {
+				fmt.Fprintln(c.stdout, line)
+			}
+		}
+		h.add(line)
+		if h.err != nil {
+			fmt.Fprintf(c.stderr, "mathctl: saving history failed: %s\n", h.err)
+			h.file = ""
+		}
+
+		switch line {
+		case "help":
+			fmt.Fprint(c.stdout, replHelp)
+		case "ops":
+			c.listOperations(ctx)
+		case "history":
+			for i, entry := range h.lines {
+				fmt.Fprintf(c.stdout, "%5d  %s\n", i+1, entry)
+			}
+		default:
+			res := c.evaluateLine(ctx, line)
+			if res.err == nil {
+				c.ans, c.hasAns = res.answer, true
+			}
+			c.print(res)
+		}
+	}
+
+	if interactive {
+		fmt.Fprintln(c.stdout)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(c.stderr, "mathctl: read failed: %s\n", err)
+		return exitUsage
+	}
+	return exitOK
+}
+
+// evaluateLine calls the operation line starts with, or evaluates it as an expression if it doesn't
+// start with one
+func (c *cli) evaluateLine(ctx context.Context, line string) result {
+	fields, err := splitFields(line)
+	if err != nil {
+		return result{err: err}
+	}
+
+	op := fields[0]
+	if _, ok := routedParams[op]; ok {
+		return c.call(ctx, op, fields[1:])
+	}
+	_, ok, err := c.operation(ctx, op)
+	if err != nil {
+		return result{op: op, err: err}
+	}
+	if ok {
+		return c.call(ctx, op, fields[1:])
+	}
+	return c.eval(ctx, line, nil)
+}
+
+// splitFields splits a line on whitespace, except for whitespace inside quotes, brackets, or braces,
+// so that JSON operands like [1, 2, 3] stay in one piece
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	depth := 0
+	quoted, escaped := false, false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced %c", c)
+			}
+		case depth == 0 && (c == ' ' || c == '\t'):
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteRune(c)
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced brackets")
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
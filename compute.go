@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"math-serv/server"
+)
+
+// compute and eval run an operation without a server, through server.Compute, so that what they
+// print is exactly the response body the server would have sent for the same request.  That makes
+// them handy for scripts and CI jobs that want the server's answers without starting it
+
+// The exit statuses for compute and eval
+const (
+	exitOK     = 0
+	exitFailed = 1 // the operation failed, the error response is still printed
+	exitUsage  = 2
+)
+
+// namedOperand matches operands given as name=value
+var namedOperand = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+
+// evalOptionFlags are the query parameters that compute and eval take as flags, with what they do
+var evalOptionFlags = []struct {
+	name  string
+	usage string
+}{
+	{"mode", "numeric mode: float, precise, rational, or complex"},
+	{"precision", "significant digits for precise mode"},
+	{"rounding", "rounding mode for precise mode"},
+	{"decimal", "whether rational answers are given as decimals"},
+	{"places", "decimal places to format answers with"},
+	{"sigfigs", "significant figures to format answers with"},
+	{"notation", "notation to format answers in: fixed, scientific, or engineering"},
+	{"locale", "locale to format answers for"},
+}
+
+// newComputeFlags creates the flags for compute or eval, returning them along with a function that
+// collects the options that were set
+func newComputeFlags(name string, stderr io.Writer) (*flag.FlagSet, func() map[string]string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	values := make(map[string]*string, len(evalOptionFlags))
+	for _, option := range evalOptionFlags {
+		values[option.name] = flags.String(option.name, "", option.usage)
+	}
+
+	return flags, func() map[string]string {
+		options := make(map[string]string)
+		for name, value := range values {
+			if *value != "" {
+				options[name] = *value
+			}
+		}
+		return options
+	}
+}
+
+// compute evaluates "<op> [operand ...]".  Operands are matched up with the operation's params and
+// then its optional params, the same as the line protocol, unless they're given as name=value, and
+// each is read as JSON if it can be and as a string otherwise
+func compute(args []string, stdout, stderr io.Writer) int {
+	flags, options := newComputeFlags("compute", stderr)
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	op, operands := flags.Arg(0), flags.Args()[1:]
+	vars := make(map[string]json.RawMessage, len(operands))
+	var positional []string
+	for _, operand := range operands {
+		if match := namedOperand.FindStringSubmatch(operand); match != nil {
+			vars[match[1]] = operandJSON(match[2])
+			continue
+		}
+		positional = append(positional, operand)
+	}
+
+	// an unsupported operation is left for server.Compute to turn away, so the error response is
+	// the server's
+	if names, ok := server.OperationParams(op); ok {
+		if len(positional) > len(names) {
+			fmt.Fprintf(stderr, "%s takes at most %d operands, got %d\n", op, len(names), len(positional))
+			return exitUsage
+		}
+		for i, operand := range positional {
+			vars[names[i]] = operandJSON(operand)
+		}
+	}
+
+	return printResponse(stdout, op, vars, options())
+}
+
+// evaluate evaluates "<expression> [name=value ...]" with eval
+func evaluate(args []string, stdout, stderr io.Writer) int {
+	flags, options := newComputeFlags("eval", stderr)
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	expression, operands := flags.Arg(0), flags.Args()[1:]
+	at := make(map[string]json.RawMessage, len(operands))
+	for _, operand := range operands {
+		match := namedOperand.FindStringSubmatch(operand)
+		if match == nil {
+			fmt.Fprintf(stderr, "variables are given as name=value, got %q\n", operand)
+			return exitUsage
+		}
+		at[match[1]] = operandJSON(match[2])
+	}
+
+	// neither can fail, they're a string and a map of valid JSON
+	vars := make(map[string]json.RawMessage, 2)
+	vars["expression"], _ = json.Marshal(expression)
+	if len(at) > 0 {
+		vars["at"], _ = json.Marshal(at)
+	}
+
+	return printResponse(stdout, "eval", vars, options())
+}
+
+// operandJSON is operand as JSON if it's valid JSON, or as a JSON string if it isn't
+func operandJSON(operand string) json.RawMessage {
+	if json.Valid([]byte(operand)) {
+		return json.RawMessage(operand)
+	}
+	// can't fail, it's a string
+	encoded, _ := json.Marshal(operand)
+	return encoded
+}
+
+// printResponse evaluates op and prints the response body, whether it's an answer or an error
+func printResponse(stdout io.Writer, op string, vars map[string]json.RawMessage, options map[string]string) int {
+	status, body := server.Compute(op, vars, options)
+	fmt.Fprintf(stdout, "%s\n", body)
+	if status != http.StatusOK {
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"math-serv/server"
+)
+
+// answerOf decodes a response body, leaving out whether it was cached, which depends on what ran
+// before it rather than on the request
+func answerOf(t *testing.T, body []byte) map[string]interface{} {
+	var res map[string]interface{}
+	err := json.Unmarshal(body, &res)
+	if err != nil {
+		t.Fatalf("json decode failed: %s %s\n", err, body)
+	}
+	delete(res, "cached")
+	delete(res, "source")
+	return res
+}
+
+// TestCompute checks that operands and flags become the request server.Compute would get for the
+// same op, vars, and options
+func TestCompute(t *testing.T) {
+	testCases := []struct {
+		args    []string
+		op      string
+		vars    string
+		options map[string]string
+		status  int
+	}{
+		{[]string{"add", "3", "4"}, "add", `{"x": 3, "y": 4}`, nil, exitOK},
+		{[]string{"factorial", "n=20"}, "factorial", `{"n": 20}`, nil, exitOK},
+		{[]string{"-mode", "rational", "divide", "1", "3"}, "divide", `{"x": 1, "y": 3}`, map[string]string{"mode": "rational"}, exitOK},
+		{[]string{"-places", "2", "divide", "y=3", "2"}, "divide", `{"x": 2, "y": 3}`, map[string]string{"places": "2"}, exitOK},
+		{[]string{"convert", "5", "km", "m"}, "convert", `{"value": 5, "from": "km", "to": "m"}`, nil, exitOK},
+		{[]string{"mean", "[1, 2, 3]"}, "mean", `{"data": [1, 2, 3]}`, nil, exitOK},
+		{[]string{"convert/base", "0xff", "2"}, "convert/base", `{"value": "0xff", "to": 2}`, nil, exitOK},
+		{[]string{"sequence", "prime", "5"}, "sequence", `{"kind": "prime", "count": 5}`, nil, exitOK},
+		{[]string{"series", "arithmetic", "4", "step=2"}, "series", `{"kind": "arithmetic", "count": 4, "step": 2}`, nil, exitOK},
+		{[]string{"factorial", "-1"}, "factorial", `{"n": -1}`, nil, exitFailed},
+		{[]string{"shout", "1"}, "shout", `{}`, nil, exitFailed},
+	}
+
+	for _, testCase := range testCases {
+		var stdout, stderr bytes.Buffer
+		status := compute(testCase.args, &stdout, &stderr)
+		if status != testCase.status {
+			t.Logf("unexpected status for %v: (actual %d != expected %d) %s\n", testCase.args, status, testCase.status, stderr.String())
+			t.Fail()
+			continue
+		}
+
+		var vars map[string]json.RawMessage
+		err := json.Unmarshal([]byte(testCase.vars), &vars)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+		_, expected := server.Compute(testCase.op, vars, testCase.options)
+
+		actual := answerOf(t, stdout.Bytes())
+		if !reflect.DeepEqual(actual, answerOf(t, expected)) {
+			t.Logf("unexpected response for %v: (actual %s != expected %s)\n", testCase.args, stdout.Bytes(), expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestComputeUsage checks the mistakes that are caught before anything is computed
+func TestComputeUsage(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "usage:"},
+		{[]string{"-bogus", "add", "1", "2"}, "flag provided but not defined"},
+		{[]string{"add", "1", "2", "3"}, "add takes at most 2 operands, got 3"},
+	}
+
+	for _, testCase := range testCases {
+		var stdout, stderr bytes.Buffer
+		status := compute(testCase.args, &stdout, &stderr)
+		if status != exitUsage || stdout.Len() != 0 || !strings.Contains(stderr.String(), testCase.expected) {
+			t.Logf("unexpected usage error for %v: (actual %d %q != expected %d %q)\n", testCase.args, status, stderr.String(), exitUsage, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestEvaluate checks that eval's name=value operands become the expression's at
+func TestEvaluate(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := evaluate([]string{"-places", "1", "x^2 + y", "x=3", "y=0.25"}, &stdout, &stderr)
+	_, expected := server.Compute("eval", map[string]json.RawMessage{
+		"expression": json.RawMessage(`"x^2 + y"`),
+		"at":         json.RawMessage(`{"x": 3, "y": 0.25}`),
+	}, map[string]string{"places": "1"})
+	if status != exitOK || !reflect.DeepEqual(answerOf(t, stdout.Bytes()), answerOf(t, expected)) {
+		t.Logf("unexpected response: (actual %d %s != expected %d %s)\n", status, stdout.Bytes(), exitOK, expected)
+		t.Fail()
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	status = evaluate([]string{"x^2", "3"}, &stdout, &stderr)
+	if status != exitUsage || !strings.Contains(stderr.String(), "name=value") {
+		t.Logf("unexpected usage error: (actual %d %q != expected %d)\n", status, stderr.String(), exitUsage)
+		t.Fail()
+	}
+}
@@ -1,30 +1,180 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"math-serv/server"
 )
 
 const defaultHost string = "127.0.0.1"
-const defaultPort string = ":8080"
+const defaultHTTPPort int = 8080
+const defaultGRPCPort int = 0 // off unless asked for
+const defaultTCPPort int = 0  // same for the line protocol
+
+const defaultTCPMaxConns int = 100
+const defaultTCPIdleTimeout time.Duration = time.Minute * 5
 
 const defaultReadTimeout time.Duration = time.Second * 10
 const defaultWriteTimeout time.Duration = time.Second * 10
 const defaultIdleTimeout time.Duration = time.Second * 60
 
+// shutdownTimeout is how long in-flight requests get to finish after an interrupt
+const shutdownTimeout time.Duration = time.Second * 10
+
+const usage string = `usage: math-serv [command] [flags] [args]
+
+commands:
+  serve                   run the server, which is what no command does
+  compute <op> [operand ...]
+                          evaluate an operation locally and print the response the server would send
+  eval <expression> [name=value ...]
+                          evaluate an expression locally, with values for its variables
+`
+
 func main() {
-	// setting server to default values, keeps door open to adding flags later
-	srv := &http.Server{
-		Addr:         defaultHost + defaultPort,
-		ReadTimeout:  defaultReadTimeout,
-		WriteTimeout: defaultWriteTimeout,
-		IdleTimeout:  defaultIdleTimeout,
-		Handler:      server.GetRouter(),
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(args)
+	case "compute":
+		os.Exit(compute(args, os.Stdout, os.Stderr))
+	case "eval":
+		os.Exit(evaluate(args, os.Stdout, os.Stderr))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %q\n%s", command, usage)
+		os.Exit(exitUsage)
+	}
+}
+
+// serve runs the listeners until one of them fails or the process is interrupted
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	host := flags.String("host", defaultHost, "address to listen on")
+	httpPort := flags.Int("http-port", defaultHTTPPort, "port for the HTTP listener, 0 to disable it")
+	grpcPort := flags.Int("grpc-port", defaultGRPCPort, "port for the gRPC listener, 0 to disable it")
+	tcpPort := flags.Int("tcp-port", defaultTCPPort, "port for the line protocol listener, 0 to disable it")
+	tcpMaxConns := flags.Int("tcp-max-conns", defaultTCPMaxConns, "most line protocol connections open at once")
+	tcpIdleTimeout := flags.Duration("tcp-idle-timeout", defaultTCPIdleTimeout, "how long a line protocol connection can go without sending a line")
+	docsAssets := flags.String("docs-assets", "", "directory with a copy of swagger-ui-dist for /docs to load, rather than unpkg")
+	flags.Parse(args)
+
+	if *httpPort == 0 && *grpcPort == 0 && *tcpPort == 0 {
+		log.Fatal("at least one of -http-port, -grpc-port, and -tcp-port is required")
+	}
+
+	// the listeners run until one of them fails, which takes the whole process down, or until we're
+	// interrupted, in which case they're shut down gracefully
+	errs := make(chan error, 3)
+	var shutdowns []func(context.Context)
+
+	if *httpPort != 0 {
+		if *docsAssets != "" {
+			server.ServeDocsAssets(*docsAssets)
+		}
+		srv := &http.Server{
+			Addr:         net.JoinHostPort(*host, strconv.Itoa(*httpPort)),
+			ReadTimeout:  defaultReadTimeout,
+			WriteTimeout: defaultWriteTimeout,
+			IdleTimeout:  defaultIdleTimeout,
+			Handler:      server.GetRouter(),
+		}
+		// Shutdown doesn't close WebSocket sessions and waits forever on event streams, so they
+		// have to be closed separately
+		srv.RegisterOnShutdown(server.CloseSessions)
+		srv.RegisterOnShutdown(server.CloseEventStreams)
+		shutdowns = append(shutdowns, func(ctx context.Context) {
+			err := srv.Shutdown(ctx)
+			if err != nil {
+				log.Printf("http shutdown failed: %s\n", err)
+			}
+		})
+
+		go func() {
+			log.Printf("Listening on %s\n", srv.Addr)
+			err := srv.ListenAndServe()
+			if err != http.ErrServerClosed {
+				errs <- err
+			}
+		}()
 	}
 
-	log.Printf("Listening on %s\n", srv.Addr)
-	log.Fatal(srv.ListenAndServe())
+	if *grpcPort != 0 {
+		addr := net.JoinHostPort(*host, strconv.Itoa(*grpcPort))
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		grpcServer := server.NewGRPCServer()
+		shutdowns = append(shutdowns, func(ctx context.Context) {
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				grpcServer.Stop()
+			}
+		})
+
+		go func() {
+			log.Printf("Listening for gRPC on %s\n", addr)
+			errs <- grpcServer.Serve(listener)
+		}()
+	}
+
+	if *tcpPort != 0 {
+		addr := net.JoinHostPort(*host, strconv.Itoa(*tcpPort))
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		lineServer := server.NewLineServer(*tcpMaxConns, *tcpIdleTimeout)
+		shutdowns = append(shutdowns, func(context.Context) {
+			err := lineServer.Close()
+			if err != nil {
+				log.Printf("line protocol shutdown failed: %s\n", err)
+			}
+		})
+
+		go func() {
+			log.Printf("Listening for the line protocol on %s\n", addr)
+			errs <- lineServer.Serve(listener)
+		}()
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case sig := <-interrupts:
+		log.Printf("Received %s, shutting down\n", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, shutdown := range shutdowns {
+		shutdown(ctx)
+	}
 }
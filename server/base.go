@@ -0,0 +1,168 @@
+package server
+
+import (
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// /convert/base rewrites a number from one base to another, anywhere from base 2 to base 36.
+// Fractional parts are converted exactly, so they either terminate or repeat, and the repeating
+// digits are written in parentheses the same way rational mode's decimals are.  0.1 in base 10 is
+// 0.0(0011) in base 2, which is exactly why it can't be a float64
+
+const (
+	minBase = 2
+	maxBase = 36
+)
+
+// baseParams and baseOptional are the variables /convert/base reads, in the order they're given
+// positionally in protocols that do that
+var (
+	baseParams   = []string{"value", "to"}
+	baseOptional = []string{"from"}
+)
+
+// baseHandler serves /convert/base, which doesn't fit under /{op} because of the extra path segment
+func baseHandler(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if r.Body == nil {
+			return
+		}
+		err := r.Body.Close()
+		if err != nil {
+			log.Printf("req body close failed: %s\n", err)
+		}
+	}()
+
+	vars, err := parseQueryOrRawVars(r)
+	if err != nil {
+		log.Printf("parse client vars failed: %s\n", err)
+		writeErrorResponse(w, newMathError(kindInvalidArgument, "%s", err))
+		return
+	}
+
+	serveEvaluation(w, r, "convert/base", vars)
+}
+
+// newBaseEvaluation parses value in the base from, which defaults to 10 unless value has a 0x, 0b,
+// or 0o prefix, and converts it to the base to.  Only base 10 answers are formatted, the digits of
+// any other base would be read as if they were decimal
+func newBaseEvaluation(vars clientVars, opts evalOptions) (*evaluation, error) {
+	value, err := vars.text("value")
+	if err != nil {
+		return nil, newMathError(kindInvalidArgument, "%s", err)
+	}
+
+	from := 10
+	if _, ok := vars["from"]; ok {
+		from, err = parseBase(vars, "from")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a prefix is only a prefix if it agrees with from, since 0b12 is a perfectly good base 16 number
+	sign, digits := "", value
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if len(digits) > 2 {
+		if base, ok := literalPrefixes[strings.ToLower(digits[:2])]; ok {
+			if _, explicit := vars["from"]; !explicit {
+				from = base
+			}
+			if base == from {
+				digits = digits[2:]
+			}
+		}
+	}
+
+	to, err := parseBase(vars, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := parseBaseDigits(sign+digits, from)
+	if err != nil {
+		return nil, err
+	}
+
+	eval := &evaluation{
+		op:   "convert/base",
+		mode: modeBase,
+		args: map[string]interface{}{
+			"value": value,
+			"from":  from,
+			"to":    to,
+		},
+		key:    createArgsCacheKey(string(modeBase), "convert/base", r.RatString(), strconv.Itoa(to)),
+		policy: noCachePolicy,
+		compute: func() (interface{}, error) {
+			return ratDigits(r, to), nil
+		},
+	}
+	if to == 10 {
+		eval.format = opts.format
+	}
+	return eval, nil
+}
+
+// parseBase returns the named variable as a base from 2 to 36
+func parseBase(vars clientVars, name string) (int, error) {
+	n, err := vars.integer(name)
+	if err != nil {
+		return 0, newMathError(kindInvalidArgument, "%s", err)
+	}
+	if !n.IsInt64() || n.Int64() < minBase || n.Int64() > maxBase {
+		return 0, newMathError(kindInvalidArgument, "%s must be a base from %d to %d, got %s", name, minBase, maxBase, n)
+	}
+
+	return int(n.Int64()), nil
+}
+
+// parseBaseDigits parses an optionally signed number with an optional fractional part, like
+// "-ff.8" in base 16.  Base 10 also accepts exponents and fractions like "1/3", as long as they
+// don't use big.Rat's own prefixes
+func parseBaseDigits(str string, base int) (*big.Rat, error) {
+	invalid := newMathError(kindInvalidArgument, "%q is not a base %d number", str, base)
+	if base == 10 && !strings.ContainsAny(strings.ToLower(str), "xbo") {
+		if r, ok := new(big.Rat).SetString(str); ok {
+			return r, nil
+		}
+		return nil, invalid
+	}
+
+	neg := false
+	if len(str) > 0 && (str[0] == '-' || str[0] == '+') {
+		neg, str = str[0] == '-', str[1:]
+	}
+	whole, frac, _ := strings.Cut(str, ".")
+	if whole == "" && frac == "" {
+		return nil, invalid
+	}
+
+	// big.Int accepts a sign of its own, which we've already dealt with
+	parse := func(digits string) (*big.Int, bool) {
+		if digits == "" {
+			return new(big.Int), true
+		}
+		if strings.ContainsAny(digits, "+-_") {
+			return nil, false
+		}
+		return new(big.Int).SetString(digits, base)
+	}
+
+	num, ok := parse(whole + frac)
+	if !ok {
+		return nil, invalid
+	}
+	if neg {
+		num.Neg(num)
+	}
+	den := new(big.Int).Exp(big.NewInt(int64(base)), big.NewInt(int64(len(frac))), nil)
+
+	return new(big.Rat).SetFrac(num, den), nil
+}
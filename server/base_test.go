@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestConvertBase sends conversions both as query-only GETs and as JSON bodies
+func TestConvertBase(t *testing.T) {
+	testCases := []struct {
+		method   string
+		target   string
+		body     string
+		expected string
+	}{
+		{http.MethodGet, "/convert/base?value=255&to=16", "", "ff"},
+		{http.MethodGet, "/convert/base?value=0xFF&to=2", "", "11111111"},
+		{http.MethodGet, "/convert/base?value=-0b101.1&to=10", "", "-5.5"},
+		{http.MethodGet, "/convert/base?value=z.i&from=36&to=10", "", "35.5"},
+		{http.MethodGet, "/convert/base?value=0b12&from=16&to=10", "", "2834"},
+		{http.MethodPost, "/convert/base", `{"value": 0.1, "to": 2}`, "0.0(0011)"},
+		{http.MethodPost, "/convert/base", `{"value": "1/3", "to": 3}`, "0.1"},
+		{http.MethodPost, "/convert/base", `{"value": "0.(3)", "from": 10, "to": 3}`, ""},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(testCase.method, "http://localhost:8080"+testCase.target, strings.NewReader(testCase.body))
+		if testCase.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		// an empty expectation means the value shouldn't parse
+		if testCase.expected == "" {
+			if resRecorder.Code != http.StatusBadRequest {
+				t.Logf("unexpected status for %s %s: (actual %d != expected %d)\n", testCase.target, testCase.body, resRecorder.Code, http.StatusBadRequest)
+				t.Fail()
+			}
+			continue
+		}
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if mathRes.Answer != testCase.expected {
+			t.Logf("unexpected answer for %s %s: (actual %v != expected %s)\n", testCase.target, testCase.body, mathRes.Answer, testCase.expected)
+			t.Fail()
+		}
+		if mathRes.Mode != string(modeBase) {
+			t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modeBase)
+			t.Fail()
+		}
+	}
+}
+
+// TestConvertBaseFormat checks that only base 10 answers are formatted, since the digits of any
+// other base aren't a decimal number
+func TestConvertBaseFormat(t *testing.T) {
+	testCases := []struct {
+		target    string
+		expected  string
+		formatted interface{}
+	}{
+		{"/convert/base?value=0xff&to=10&places=2", "255", "255.00"},
+		{"/convert/base?value=5&to=2&places=2", "101", nil},
+		{"/convert/base?value=255&to=16&locale=de", "ff", nil},
+		// formatting the binary digits as a decimal number used to take practically forever
+		{"/convert/base?value=1e999999&to=2&places=0", new(big.Int).Exp(big.NewInt(10), big.NewInt(999999), nil).Text(2), nil},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+testCase.target, nil)
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if mathRes.Answer != testCase.expected || mathRes.Formatted != testCase.formatted {
+			t.Logf("unexpected answer for %s: (actual %.20v %v != expected %.20s %v)\n", testCase.target, mathRes.Answer, mathRes.Formatted, testCase.expected, testCase.formatted)
+			t.Fail()
+		}
+	}
+}
+
+// TestConvertBaseErrors checks base ranges and digits that don't belong to the base
+func TestConvertBaseErrors(t *testing.T) {
+	targets := []string{
+		"/convert/base?value=12&to=1",
+		"/convert/base?value=12&to=37",
+		"/convert/base?value=12",
+		"/convert/base?value=12&from=2&to=10",
+		"/convert/base?value=0x1f&from=8&to=10",
+		"/convert/base?value=.&from=16&to=10",
+		"/convert/base?value=1-1&from=16&to=10",
+	}
+
+	for _, target := range targets {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+target, nil)
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != http.StatusBadRequest || errRes.Code != "invalid_argument" {
+			t.Logf("unexpected error for %s: (actual %d %s != expected %d invalid_argument)\n", target, resRecorder.Code, errRes.Code, http.StatusBadRequest)
+			t.Fail()
+		}
+	}
+}
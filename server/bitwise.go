@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// The bitwise operations treat their operands as fixed width bit patterns, the way firmware does.
+// The width defaults to 64 bits and the patterns are unsigned unless signed is set.  Operands can be
+// anything from the smallest signed value to the largest unsigned one, so -1 and 0xff are the same
+// 8 bit pattern, and signed only changes how answers are read and how shr fills in from the left
+
+var bitWidths = map[int64]uint{
+	8:  8,
+	16: 16,
+	32: 32,
+	64: 64,
+}
+
+const defaultBitWidth = 64
+
+// bitwiseOptional are the options shared by every bitwise operation
+var bitwiseOptional = []string{"width", "signed"}
+
+// bitwiseOperations are merged into supportedOperations in init
+var bitwiseOperations = map[string]*operation{
+	"and": {
+		description: "the bitwise and of x and y",
+		params:      binaryParams,
+		optional:    bitwiseOptional,
+		bitFn:       func(args []uint64, w bitWidth) interface{} { return bitPattern(args[0] & args[1]) },
+		cache:       noCachePolicy,
+	},
+	"or": {
+		description: "the bitwise or of x and y",
+		params:      binaryParams,
+		optional:    bitwiseOptional,
+		bitFn:       func(args []uint64, w bitWidth) interface{} { return bitPattern(args[0] | args[1]) },
+		cache:       noCachePolicy,
+	},
+	"xor": {
+		description: "the bitwise exclusive or of x and y",
+		params:      binaryParams,
+		optional:    bitwiseOptional,
+		bitFn:       func(args []uint64, w bitWidth) interface{} { return bitPattern(args[0] ^ args[1]) },
+		cache:       noCachePolicy,
+	},
+	"not": {
+		description: "the bitwise complement of x",
+		params:      []string{"x"},
+		optional:    bitwiseOptional,
+		bitFn:       func(args []uint64, w bitWidth) interface{} { return bitPattern(^args[0] & w.mask()) },
+		cache:       noCachePolicy,
+	},
+	"shl": {
+		description: "x shifted left by n bits",
+		params:      []string{"x", "n"},
+		optional:    bitwiseOptional,
+		bitFn:       func(args []uint64, w bitWidth) interface{} { return bitPattern(args[0] << args[1] & w.mask()) },
+		cache:       noCachePolicy,
+	},
+	"shr": {
+		description: "x shifted right by n bits",
+		params:      []string{"x", "n"},
+		optional:    bitwiseOptional,
+		bitFn:       bitShiftRight,
+		cache:       noCachePolicy,
+	},
+	"popcount": {
+		description: "the number of set bits in x",
+		params:      []string{"x"},
+		optional:    bitwiseOptional,
+		bitFn:       func(args []uint64, w bitWidth) interface{} { return bits.OnesCount64(args[0]) },
+		cache:       noCachePolicy,
+	},
+	"clz": {
+		description: "the number of leading zero bits in x",
+		params:      []string{"x"},
+		optional:    bitwiseOptional,
+		bitFn:       func(args []uint64, w bitWidth) interface{} { return bits.LeadingZeros64(args[0]) - (64 - int(w.bits)) },
+		cache:       noCachePolicy,
+	},
+}
+
+func init() {
+	for name, op := range bitwiseOperations {
+		supportedOperations[name] = op
+	}
+}
+
+// bitPattern marks a bitFn answer as a pattern rather than a count, so it's written as a BitPattern
+type bitPattern uint64
+
+// bitWidth is the width and signedness of a bitwise operation's operands
+type bitWidth struct {
+	bits   uint
+	signed bool
+}
+
+// mask has the low w.bits bits set
+func (w bitWidth) mask() uint64 {
+	if w.bits == 64 {
+		return ^uint64(0)
+	}
+	return 1<<w.bits - 1
+}
+
+// signExtend reads p as a w.bits wide two's complement number
+func (w bitWidth) signExtend(p uint64) int64 {
+	shift := 64 - w.bits
+	return int64(p<<shift) >> shift
+}
+
+// pattern converts n to a bit pattern, as long as it fits in w.bits bits either signed or unsigned
+func (w bitWidth) pattern(name string, n *big.Int) (uint64, error) {
+	min := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), w.bits-1))
+	max := new(big.Int).SetUint64(w.mask())
+	if n.Cmp(min) < 0 || n.Cmp(max) > 0 {
+		return 0, newMathError(kindInvalidArgument, "%s must fit in %d bits, got %s", name, w.bits, n)
+	}
+
+	if n.Sign() < 0 {
+		return uint64(n.Int64()) & w.mask(), nil
+	}
+	return n.Uint64(), nil
+}
+
+// text writes p in decimal, reading it as signed if w is
+func (w bitWidth) text(p uint64) string {
+	if w.signed {
+		return strconv.FormatInt(w.signExtend(p), 10)
+	}
+	return strconv.FormatUint(p, 10)
+}
+
+// model converts p to its response representation
+func (w bitWidth) model(p uint64) BitPattern {
+	hex := strconv.FormatUint(p, 16)
+	binary := strconv.FormatUint(p, 2)
+	return BitPattern{
+		Value:  w.text(p),
+		Hex:    "0x" + strings.Repeat("0", int(w.bits/4)-len(hex)) + hex,
+		Binary: "0b" + strings.Repeat("0", int(w.bits)-len(binary)) + binary,
+	}
+}
+
+// bitShiftRight is a logical shift for unsigned patterns and an arithmetic one for signed patterns
+func bitShiftRight(args []uint64, w bitWidth) interface{} {
+	if w.signed {
+		return bitPattern(uint64(w.signExtend(args[0])>>args[1]) & w.mask())
+	}
+	return bitPattern(args[0] >> args[1])
+}
+
+// newBitwiseEvaluation parses the width and signedness options, then the operands as bit patterns of
+// that width.  The shift amount n is a plain count from 0 to the width
+func newBitwiseEvaluation(op string, operation *operation, vars clientVars) (*evaluation, error) {
+	width := bitWidth{bits: defaultBitWidth}
+	if _, ok := vars["width"]; ok {
+		n, err := vars.integer("width")
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+		if !n.IsInt64() || bitWidths[n.Int64()] == 0 {
+			return nil, newMathError(kindInvalidArgument, "width must be 8, 16, 32, or 64, got %s", n)
+		}
+		width.bits = bitWidths[n.Int64()]
+	}
+	if _, ok := vars["signed"]; ok {
+		signed, err := vars.boolean("signed")
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+		width.signed = signed
+	}
+
+	args := make([]uint64, len(operation.params))
+	keyArgs := make([]string, len(operation.params))
+	echo := map[string]interface{}{
+		"width":  width.bits,
+		"signed": width.signed,
+	}
+	for i, param := range operation.params {
+		n, err := vars.integer(param)
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+
+		if param == "n" {
+			if n.Sign() < 0 || n.Cmp(big.NewInt(int64(width.bits))) > 0 {
+				return nil, newMathError(kindInvalidArgument, "n must be between 0 and %d, got %s", width.bits, n)
+			}
+			args[i] = n.Uint64()
+			keyArgs[i] = n.String()
+			echo[param] = n.Uint64()
+			continue
+		}
+
+		args[i], err = width.pattern(param, n)
+		if err != nil {
+			return nil, err
+		}
+		keyArgs[i] = width.text(args[i])
+		echo[param] = width.text(args[i])
+	}
+
+	settings := fmt.Sprintf("%s:%d:%t", modeBitwise, width.bits, width.signed)
+	return &evaluation{
+		op:     op,
+		mode:   modeBitwise,
+		args:   echo,
+		key:    createArgsCacheKey(settings, op, keyArgs...),
+		policy: operation.cache,
+		compute: func() (interface{}, error) {
+			ans := operation.bitFn(args, width)
+			if p, ok := ans.(bitPattern); ok {
+				return width.model(uint64(p)), nil
+			}
+			return ans, nil
+		},
+	}, nil
+}
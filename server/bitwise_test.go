@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestBitwiseOperations runs each bitwise operation through mathHandler with a JSON body
+func TestBitwiseOperations(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	pattern := func(value, hex, binary string) map[string]interface{} {
+		return map[string]interface{}{"value": value, "hex": hex, "binary": binary}
+	}
+
+	testCases := []struct {
+		op       string
+		body     string
+		expected interface{}
+	}{
+		{"and", `{"x": "0xf0", "y": "0b10101010", "width": 8}`, pattern("160", "0xa0", "0b10100000")},
+		{"or", `{"x": "0o17", "y": 240, "width": 8}`, pattern("255", "0xff", "0b11111111")},
+		{"or", `{"x": "0o17", "y": 240, "width": 8, "signed": true}`, pattern("-1", "0xff", "0b11111111")},
+		{"xor", `{"x": -1, "y": 1, "width": 16}`, pattern("65534", "0xfffe", "0b1111111111111110")},
+		{"not", `{"x": 0, "width": 8, "signed": "true"}`, pattern("-1", "0xff", "0b11111111")},
+		{"not", `{"x": 0}`, pattern("18446744073709551615", "0xffffffffffffffff", "0b"+strings.Repeat("1", 64))},
+		{"shl", `{"x": "0x81", "n": 1, "width": 8}`, pattern("2", "0x02", "0b00000010")},
+		{"shr", `{"x": "0x80", "n": 3, "width": 8}`, pattern("16", "0x10", "0b00010000")},
+		{"shr", `{"x": "0x80", "n": 3, "width": 8, "signed": true}`, pattern("-16", "0xf0", "0b11110000")},
+		{"shr", `{"x": -1, "n": 64, "signed": true}`, pattern("-1", "0xffffffffffffffff", "0b"+strings.Repeat("1", 64))},
+		{"popcount", `{"x": "0xff00ff", "width": 32}`, 16.0},
+		{"clz", `{"x": 1, "width": 32}`, 31.0},
+		{"clz", `{"x": 0, "width": 16}`, 16.0},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if !reflect.DeepEqual(mathRes.Answer, testCase.expected) {
+			t.Logf("unexpected answer for %s %s: (actual %v != expected %v)\n", testCase.op, testCase.body, mathRes.Answer, testCase.expected)
+			t.Fail()
+		}
+		if mathRes.Mode != string(modeBitwise) {
+			t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modeBitwise)
+			t.Fail()
+		}
+	}
+}
+
+// TestBitwiseErrors checks operand ranges, widths, and shift amounts
+func TestBitwiseErrors(t *testing.T) {
+	testCases := []struct {
+		op   string
+		body string
+	}{
+		{"and", `{"x": 256, "y": 1, "width": 8}`},
+		{"and", `{"x": -129, "y": 1, "width": 8}`},
+		{"not", `{"x": 1.5}`},
+		{"not", `{"x": 1, "width": 12}`},
+		{"not", `{"x": 1, "signed": "maybe"}`},
+		{"shl", `{"x": 1, "n": 9, "width": 8}`},
+		{"shr", `{"x": 1, "n": -1}`},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != http.StatusBadRequest || errRes.Code != "invalid_argument" {
+			t.Logf("unexpected error for %s %s: (actual %d %s != expected %d invalid_argument)\n", testCase.op, testCase.body, resRecorder.Code, errRes.Code, http.StatusBadRequest)
+			t.Fail()
+		}
+	}
+}
@@ -2,6 +2,10 @@ package server
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -12,22 +16,104 @@ import (
 // own package
 
 const defaultCacheExpiration time.Duration = time.Minute
+const longCacheExpiration time.Duration = time.Minute * 10
 const defaultCacheCleanUp time.Duration = time.Minute * 5
 
-// cacheExpiration allows use to directly change cache expiration time while testing (saves me a few minutes)
-var cacheExpiration = defaultCacheExpiration
+// cachePolicy describes whether an operation's answers are worth caching and for how long.
+// Cheap operations (add, subtract, etc) aren't worth the memory, so their zero value policy
+// simply skips the cache
+type cachePolicy struct {
+	cacheable  bool
+	expiration time.Duration
 
-// opCache stores all operation answers as interfaces with a timeout of one minute
+	// sliding restarts the expiration countdown every time a cached answer is served. Otherwise
+	// the expiration is fixed and the answer is dropped a set time after it was computed
+	sliding bool
+}
+
+// noCachePolicy is used by operations that are cheaper to compute than to look up
+var noCachePolicy = cachePolicy{}
+
+// defaultCachePolicy keeps answers for a minute from the time they were computed
+var defaultCachePolicy = cachePolicy{
+	cacheable:  true,
+	expiration: defaultCacheExpiration,
+}
+
+// longCachePolicy is for operations that are expensive enough to be worth keeping around for a while
+var longCachePolicy = cachePolicy{
+	cacheable:  true,
+	expiration: longCacheExpiration,
+}
+
+// cacheDirective is the client's say in how the cache is used for a single request
+type cacheDirective int
+
+const (
+	// cacheDefault follows the operation's cachePolicy
+	cacheDefault cacheDirective = iota
+	// cacheBypass recomputes the answer regardless of what's cached (the fresh answer is still cached)
+	cacheBypass
+	// cacheOnly returns a cached answer or an error, never computing anything
+	cacheOnly
+)
+
+// opCache stores all operation answers as interfaces with a timeout set by the operation's cachePolicy
 var opCache *cache.Cache
 
+// cacheCounters are running totals of how opCache has been used, for the cacheStats query (see
+// graphql.go).  They're only ever touched with sync/atomic
+var cacheCounters struct {
+	hits, misses, sets, evictions uint64
+}
+
 func init() {
 	opCache = cache.New(defaultCacheExpiration, defaultCacheCleanUp)
+	opCache.OnEvicted(func(string, interface{}) {
+		atomic.AddUint64(&cacheCounters.evictions, 1)
+	})
+}
+
+// parseCacheDirective checks the Cache-Control header and the 'nocache' query parameter for the
+// client's caching instructions. 'no-cache' and 'nocache' force recomputation, 'only-if-cached'
+// refuses to compute anything. If both are specified, we err on the side of not computing
+func parseCacheDirective(r *http.Request) cacheDirective {
+	values, ok := r.URL.Query()["nocache"]
+	if !ok {
+		return cacheDirectiveFrom(r.Header.Get("Cache-Control"), nil)
+	}
+	return cacheDirectiveFrom(r.Header.Get("Cache-Control"), &values[0])
+}
+
+// cacheDirectiveFrom is parseCacheDirective without the request.  noCache is nil if the 'nocache'
+// parameter wasn't given at all
+func cacheDirectiveFrom(cacheControl string, noCache *string) cacheDirective {
+	directive := cacheDefault
+
+	for _, value := range strings.Split(cacheControl, ",") {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "only-if-cached":
+			return cacheOnly
+		case "no-cache":
+			directive = cacheBypass
+		}
+	}
+
+	if noCache != nil {
+		// a bare '?nocache' counts as true, anything unparseable is ignored
+		bypass, err := strconv.ParseBool(*noCache)
+		if *noCache == "" || (err == nil && bypass) {
+			directive = cacheBypass
+		}
+	}
+
+	return directive
 }
 
 // retrieveFromCache checks to see if the math operation defined by the arguments has been performed
-// in the last minute and returns the cached answer and true if it has.  If not, it returns 0 and false
+// recently and returns the cached answer and true if it has.  If not, it returns 0 and false
 func retrieveFromCache(op string, x, y float64) (float64, bool) {
-	ans, inCache := opCache.Get(createCacheKey(op, x, y))
+	ans, inCache := cacheGet(createCacheKey(op, x, y))
 	if inCache {
 		return ans.(float64), true
 	}
@@ -35,14 +121,46 @@ func retrieveFromCache(op string, x, y float64) (float64, bool) {
 	return 0, false
 }
 
-// addToCache adds the math operation defined by the arguments to the cache and begins the one minute
-// countdown until it is removed from the cache
-func addToCache(op string, x, y, ans float64) {
-	opCache.Set(createCacheKey(op, x, y), ans, cacheExpiration)
+// addToCache adds the math operation defined by the arguments to the cache and begins the countdown
+// until it is removed from the cache
+func addToCache(op string, x, y, ans float64, expiration time.Duration) {
+	cacheSet(createCacheKey(op, x, y), ans, expiration)
+}
+
+// cacheGet retrieves any kind of answer by its cache key
+func cacheGet(key string) (interface{}, bool) {
+	ans, ok := opCache.Get(key)
+	if ok {
+		atomic.AddUint64(&cacheCounters.hits, 1)
+	} else {
+		atomic.AddUint64(&cacheCounters.misses, 1)
+	}
+	return ans, ok
+}
+
+// cacheSet stores any kind of answer under its cache key
+func cacheSet(key string, ans interface{}, expiration time.Duration) {
+	atomic.AddUint64(&cacheCounters.sets, 1)
+	opCache.Set(key, ans, expiration)
+}
+
+// readCacheStats takes a snapshot of opCache's size and counters, along with the number of
+// evaluations currently in flight
+func readCacheStats() CacheStats {
+	return CacheStats{
+		Items:     opCache.ItemCount(),
+		Hits:      atomic.LoadUint64(&cacheCounters.hits),
+		Misses:    atomic.LoadUint64(&cacheCounters.misses),
+		Sets:      atomic.LoadUint64(&cacheCounters.sets),
+		Evictions: atomic.LoadUint64(&cacheCounters.evictions),
+		InFlight:  inFlight.size(),
+	}
 }
 
-// createCacheKey just puts op, x, and y into infix notation and formats it as a string
+// createCacheKey just puts op, x, and y into infix notation and formats it as a string.  The
+// operands are written as the shortest decimals that round trip, so different operands never share
+// a key the way 1e-7 and 2e-7 did when they were both 0.000000
 // FIXME: if we ever need reverse lookup or start dealing with more than two vars, we'll need a new process
 func createCacheKey(op string, x, y float64) string {
-	return fmt.Sprintf("%f%s%f", x, op, y)
+	return fmt.Sprintf("%s %s %s", strconv.FormatFloat(x, 'g', -1, 64), op, strconv.FormatFloat(y, 'g', -1, 64))
 }
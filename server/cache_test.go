@@ -1,6 +1,9 @@
 package server
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -20,6 +23,53 @@ func TestRetrieveFromCache(t *testing.T) {
 	cleanUpCache()
 }
 
+// TestCacheExpiration checks that fixed expiration policies let answers expire on schedule while
+// sliding policies keep frequently requested answers around.  It goes through mathHandler because
+// that's where the policy is applied
+func TestCacheExpiration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits on cache expiration")
+	}
+
+	cleanUpCache()
+	t.Run("fixed", fixedExpiration)
+	cleanUpCache()
+	t.Run("sliding", slidingExpiration)
+	cleanUpCache()
+}
+
+func fixedExpiration(t *testing.T) {
+	operation := "log"
+	originalPolicy := supportedOperations[operation].cache
+	defer func() { supportedOperations[operation].cache = originalPolicy }()
+	supportedOperations[operation].cache = cachePolicy{cacheable: true, expiration: time.Millisecond * 100}
+
+	x, y := 81.0, 3.0
+	reqURL := fmt.Sprintf("http://localhost:8080/%s?x=%f&y=%f", operation, x, y)
+	for _, expectedCached := range []bool{false, true, true, false} {
+		req := httptest.NewRequest(http.MethodPost, reqURL, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		validRequest(t, operation, x, y, expectedCached, req)
+		time.Sleep(time.Millisecond * 40) // 120ms after first request, the answer has expired
+	}
+}
+
+func slidingExpiration(t *testing.T) {
+	operation := "log"
+	originalPolicy := supportedOperations[operation].cache
+	defer func() { supportedOperations[operation].cache = originalPolicy }()
+	supportedOperations[operation].cache = cachePolicy{cacheable: true, expiration: time.Millisecond * 100, sliding: true}
+
+	x, y := 81.0, 3.0
+	reqURL := fmt.Sprintf("http://localhost:8080/%s?x=%f&y=%f", operation, x, y)
+	for _, expectedCached := range []bool{false, true, true, true} {
+		req := httptest.NewRequest(http.MethodPost, reqURL, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		validRequest(t, operation, x, y, expectedCached, req)
+		time.Sleep(time.Millisecond * 40) // each hit restarts the countdown
+	}
+}
+
 func retrieveBeforeExpire(t *testing.T) {
 	op := "*"
 	x, y := -64.5227, 8.640
@@ -72,7 +122,7 @@ func TestAddToCache(t *testing.T) {
 	x, y := 9.5, -11.436
 	expectedAns := 20.936
 
-	addToCache(op, x, y, expectedAns)
+	addToCache(op, x, y, expectedAns, defaultCacheExpiration)
 
 	// NOTE: manual key retrieval will need to change if we update how addToCache() generates key values
 	actualAns, inCache := opCache.Get(createCacheKey(op, x, y))
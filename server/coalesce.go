@@ -0,0 +1,73 @@
+package server
+
+import (
+	"sync"
+)
+
+// These are the values of MathOKResponse.Source, describing where an answer came from
+const (
+	sourceComputed  = "computed"  // this request evaluated the operation itself
+	sourceCached    = "cached"    // the answer was already in opCache
+	sourceCoalesced = "coalesced" // an identical request was already evaluating the operation, so we waited on it
+)
+
+// inFlight deduplicates concurrent evaluations of the same operation, keyed by createCacheKey
+var inFlight = newFlightGroup()
+
+// flightCall is a single evaluation that any number of identical requests may be waiting on
+type flightCall struct {
+	wg  sync.WaitGroup
+	ans interface{}
+	err error
+}
+
+// flightGroup is a pared down version of golang.org/x/sync/singleflight. It only exists to keep
+// expensive operations from being computed several times over when a burst of identical requests
+// all miss the cache at once
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		calls: make(map[string]*flightCall),
+	}
+}
+
+// do calls fn and returns its results, unless a call for the same key is already in flight, in which
+// case it waits for that call to finish and returns its results instead. coalesced is true only for
+// callers that waited on someone else's call
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (ans interface{}, err error, coalesced bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.ans, call.err, true
+	}
+
+	// if fn panics, the panic carries on up the caller's stack, and this is what everyone waiting on
+	// it gets instead of an answer that was never computed
+	call := &flightCall{err: newMathError(kindInternal, "the evaluation this request was waiting on panicked")}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	// clean up even if fn panics so that later callers don't wait forever
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.ans, call.err = fn()
+	return call.ans, call.err, false
+}
+
+// size is the number of calls currently in flight
+func (g *flightGroup) size() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.calls)
+}
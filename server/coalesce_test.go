@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestFlightGroup starts a slow evaluation and piles identical calls on top of it. Only the first
+// call should do any work and every other call should report that it was coalesced
+func TestFlightGroup(t *testing.T) {
+	group := newFlightGroup()
+	key := createCacheKey("pow", 2, 10)
+	expectedAns := 1024.0
+	followers := 5
+
+	var evaluations int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowFn := func() (interface{}, error) {
+		atomic.AddInt32(&evaluations, 1)
+		close(started)
+		<-release
+		return expectedAns, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ans, err, coalesced := group.do(key, slowFn)
+		if err != nil || ans != expectedAns || coalesced {
+			t.Logf("unexpected leader result: (ans %v, err %v, coalesced %t)\n", ans, err, coalesced)
+			t.Fail()
+		}
+	}()
+	<-started
+
+	for i := 0; i < followers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ans, err, coalesced := group.do(key, slowFn)
+			if err != nil || ans != expectedAns || !coalesced {
+				t.Logf("unexpected follower result: (ans %v, err %v, coalesced %t)\n", ans, err, coalesced)
+				t.Fail()
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond * 20) // give the followers a chance to start waiting
+	close(release)
+	wg.Wait()
+
+	if evaluations != 1 {
+		t.Logf("unexpected evaluation count: (actual %d != expected 1)\n", evaluations)
+		t.Fail()
+	}
+
+	// once the call has landed, the key is free for a fresh evaluation
+	_, _, coalesced := group.do(key, func() (interface{}, error) { return expectedAns, nil })
+	if coalesced {
+		t.Log("unexpected coalesced value after call completed: (actual true != expected false)")
+		t.Fail()
+	}
+}
+
+// TestFlightGroupPanic checks that a call that panics panics for its caller and fails for everyone
+// waiting on it, rather than giving them a nil answer
+func TestFlightGroupPanic(t *testing.T) {
+	group := newFlightGroup()
+	key := createCacheKey("pow", 2, 10)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if recover() == nil {
+				t.Log("expecting the leader to panic, it didn't")
+				t.Fail()
+			}
+		}()
+		group.do(key, func() (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ans, err, coalesced := group.do(key, func() (interface{}, error) { return 1024.0, nil })
+		if ans != nil || err == nil || kindOf(err) != kindInternal || !coalesced {
+			t.Logf("unexpected follower result: (ans %v, err %v, coalesced %t)\n", ans, err, coalesced)
+			t.Fail()
+		}
+	}()
+
+	time.Sleep(time.Millisecond * 20) // give the follower a chance to start waiting
+	close(release)
+	wg.Wait()
+
+	if group.size() != 0 {
+		t.Logf("unexpected calls in flight: (actual %d != expected 0)\n", group.size())
+		t.Fail()
+	}
+}
+
+// TestUncacheableNotCoalesced checks that operations that aren't cached never wait on an identical
+// evaluation, since computing them is cheaper than waiting
+func TestUncacheableNotCoalesced(t *testing.T) {
+	eval, err := newEvaluation("add", clientVars{"x": json.RawMessage("1"), "y": json.RawMessage("2")}, defaultEvalOptions)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		inFlight.do(eval.key, func() (interface{}, error) {
+			close(started)
+			<-release
+			return 0.0, nil
+		})
+	}()
+	<-started
+	defer func() {
+		close(release)
+		<-done
+	}()
+
+	res, err := eval.run(cacheDefault)
+	if err != nil || res.Answer != 3.0 || res.Source != sourceComputed {
+		t.Logf("unexpected result: (answer %v, source %s, err %v)\n", res.Answer, res.Source, err)
+		t.Fail()
+	}
+}
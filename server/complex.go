@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The complex mode evaluates operations over complex128, so root(-8, 2) is 2.828i rather than NaN.
+// It's used when requested with mode=complex, when any operand is written as a complex number
+// ({"re": 1, "im": -2} or "1-2i"), and for the operations that only make sense for complex numbers
+
+// unaryParams are the params of operations that only take x
+var unaryParams = []string{"x"}
+
+// complexNoise is the relative size below which a component is considered floating point noise.
+// cmplx.Pow(-8, 0.5) is 1.7e-16+2.828i, which should really be 2.828i
+const complexNoise = 1e-15
+
+// bareImaginaryRegexp matches "i" with no coefficient, which strconv.ParseComplex doesn't accept
+var bareImaginaryRegexp = regexp.MustCompile(`(^\(?|[+-])i(\)?)$`)
+
+// complexOperations are merged into supportedOperations in init.  These are the operations that
+// only exist in the complex mode
+var complexOperations = map[string]*operation{
+	"abs": {
+		description: "the magnitude of the complex number x",
+		params:      unaryParams,
+		complexFn:   func(args []complex128) (interface{}, error) { return cmplx.Abs(args[0]), nil },
+		cache:       noCachePolicy,
+	},
+	"arg": {
+		description: "the phase of the complex number x",
+		params:      unaryParams,
+		complexFn:   func(args []complex128) (interface{}, error) { return cmplx.Phase(args[0]), nil },
+		cache:       noCachePolicy,
+	},
+	"conj": {
+		description: "the complex conjugate of x",
+		params:      unaryParams,
+		complexFn:   func(args []complex128) (interface{}, error) { return cmplx.Conj(args[0]), nil },
+		cache:       noCachePolicy,
+	},
+	"exp": {
+		description: "e to the power of the complex number x",
+		params:      unaryParams,
+		complexFn:   func(args []complex128) (interface{}, error) { return cmplx.Exp(args[0]), nil },
+		cache:       noCachePolicy,
+	},
+	"sqrt": {
+		description: "the principal square root of the complex number x",
+		params:      unaryParams,
+		complexFn:   func(args []complex128) (interface{}, error) { return cmplx.Sqrt(args[0]), nil },
+		cache:       noCachePolicy,
+	},
+}
+
+func init() {
+	for name, op := range complexOperations {
+		supportedOperations[name] = op
+	}
+}
+
+// usesComplex reports whether an evaluation of operation should happen in the complex mode
+func usesComplex(operation *operation, vars clientVars, opts evalOptions) bool {
+	if opts.mode == modeComplex || (operation.fn == nil && operation.complexFn != nil) {
+		return true
+	}
+	if opts.mode != modeFloat || operation.complexFn == nil {
+		return false
+	}
+
+	for _, param := range operation.params {
+		if isComplexLiteral(vars[param]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isComplexLiteral reports whether raw is written as a complex number rather than a real one
+func isComplexLiteral(raw json.RawMessage) bool {
+	var str string
+	if json.Unmarshal(raw, &str) == nil {
+		return strings.HasSuffix(strings.TrimSuffix(str, ")"), "i")
+	}
+
+	trimmed := strings.TrimSpace(string(raw))
+	return strings.HasPrefix(trimmed, "{")
+}
+
+// newComplexEvaluation parses the complex operands of operation
+func newComplexEvaluation(op string, operation *operation, vars clientVars) (*evaluation, error) {
+	if operation.complexFn == nil {
+		return nil, newMathError(kindUnsupportedOperation, "%s isn't defined for complex numbers", op)
+	}
+
+	args := make([]complex128, len(operation.params))
+	keyArgs := make([]string, len(operation.params))
+	for i, param := range operation.params {
+		c, err := vars.complex(param)
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+		args[i] = c
+		keyArgs[i] = strconv.FormatComplex(c, 'g', -1, 128)
+	}
+
+	eval := &evaluation{
+		op:     op,
+		mode:   modeComplex,
+		x:      newComplexNumber(args[0]),
+		key:    createArgsCacheKey(string(modeComplex), op, keyArgs...),
+		policy: operation.cache,
+		compute: func() (interface{}, error) {
+			ans, err := operation.complexFn(args)
+			if err != nil {
+				return nil, err
+			}
+
+			switch ans := ans.(type) {
+			case complex128:
+				if cmplx.IsNaN(ans) || cmplx.IsInf(ans) {
+					return nil, newMathError(kindDomain, "%s has no finite answer", op)
+				}
+				return newComplexNumber(cleanComplex(ans)), nil
+			case float64:
+				if math.IsNaN(ans) || math.IsInf(ans, 0) {
+					return nil, newMathError(kindDomain, "%s has no finite answer", op)
+				}
+			}
+			return ans, nil
+		},
+	}
+	if len(args) > 1 {
+		eval.y = newComplexNumber(args[1])
+	}
+
+	return eval, nil
+}
+
+// newComplexNumber converts c into its JSON representation
+func newComplexNumber(c complex128) ComplexNumber {
+	return ComplexNumber{
+		Re: real(c),
+		Im: imag(c),
+	}
+}
+
+// cleanComplex zeroes out a component that's negligible next to the other one
+func cleanComplex(c complex128) complex128 {
+	abs := cmplx.Abs(c)
+	if math.Abs(real(c)) < abs*complexNoise {
+		c = complex(0, imag(c))
+	}
+	if math.Abs(imag(c)) < abs*complexNoise {
+		c = complex(real(c), 0)
+	}
+	return c
+}
+
+func complexDivide(args []complex128) (interface{}, error) {
+	if args[1] == 0 {
+		return nil, newMathError(kindDomain, "division by zero")
+	}
+	return args[0] / args[1], nil
+}
+
+func complexRoot(args []complex128) (interface{}, error) {
+	if args[1] == 0 {
+		return nil, newMathError(kindDomain, "root of degree zero")
+	}
+	if args[1] == 2 {
+		return cmplx.Sqrt(args[0]), nil // more accurate than the general case
+	}
+	return cmplx.Pow(args[0], 1/args[1]), nil
+}
+
+func complexLog(args []complex128) (interface{}, error) {
+	if args[0] == 0 || args[1] == 0 {
+		return nil, newMathError(kindDomain, "log of zero")
+	}
+	if args[1] == 1 {
+		return nil, newMathError(kindDomain, "log base one")
+	}
+	return cmplx.Log(args[0]) / cmplx.Log(args[1]), nil
+}
+
+// complex returns the variable as a complex number.  It can be written as {"re": 1, "im": -2}, as a
+// string like "1-2i", or as a plain real number
+func (v clientVars) complex(name string) (complex128, error) {
+	raw, ok := v[name]
+	if !ok {
+		return 0, fmt.Errorf("missing %s", name)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "{") {
+		var obj ComplexNumber
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&obj); err != nil {
+			return 0, fmt.Errorf("parse %s failed: expected {\"re\": ..., \"im\": ...}, got %s", name, raw)
+		}
+		return complex(obj.Re, obj.Im), nil
+	}
+
+	text, err := v.text(name)
+	if err != nil {
+		return 0, err
+	}
+
+	// "i" and "-2+i" need an explicit coefficient for strconv
+	text = bareImaginaryRegexp.ReplaceAllString(strings.Replace(text, " ", "", -1), "${1}1i$2")
+
+	c, err := strconv.ParseComplex(text, 128)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s failed: %q is not a complex number", name, text)
+	}
+	return c, nil
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseComplex checks each of the ways a complex operand can be written
+func TestParseComplex(t *testing.T) {
+	testCases := map[string]complex128{
+		`{"re": 1, "im": -2}`: complex(1, -2),
+		`{"im": 3}`:           complex(0, 3),
+		`"1-2i"`:              complex(1, -2),
+		`"(1+2i)"`:            complex(1, 2),
+		`"i"`:                 complex(0, 1),
+		`"-2-i"`:              complex(-2, -1),
+		`"1e3 + 2.5i"`:        complex(1000, 2.5),
+		`-4.5`:                complex(-4.5, 0),
+	}
+
+	for raw, expected := range testCases {
+		vars := clientVars{"x": json.RawMessage(raw)}
+		actual, err := vars.complex("x")
+		if err != nil {
+			t.Logf("unexpected error for %s: %s\n", raw, err)
+			t.Fail()
+			continue
+		}
+
+		if actual != expected {
+			t.Logf("unexpected value for %s: (actual %v != expected %v)\n", raw, actual, expected)
+			t.Fail()
+		}
+	}
+
+	for _, raw := range []string{`{"re": 1, "imaginary": 2}`, `"1-2j"`, `[1, 2]`} {
+		vars := clientVars{"x": json.RawMessage(raw)}
+		_, err := vars.complex("x")
+		if err == nil {
+			t.Logf("expecting error for %s, none received\n", raw)
+			t.Fail()
+		}
+	}
+}
+
+// TestComplexRequest goes through mathHandler with complex operands in both content types
+func TestComplexRequest(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		reqURL      string
+		body        string
+		contentType string
+		expected    interface{}
+	}{
+		// real operands in complex mode
+		{"/root?x=-8&y=2&mode=complex", "", "application/x-www-form-urlencoded", map[string]interface{}{"re": 0.0, "im": 2.8284271247461903}},
+		// complex operands switch to complex mode on their own
+		{"/multiply?x=1-2i&y=i", "", "application/x-www-form-urlencoded", map[string]interface{}{"re": 2.0, "im": 1.0}},
+		{"/add", `{"x": {"re": 1, "im": 1}, "y": "2-3i"}`, "application/json", map[string]interface{}{"re": 3.0, "im": -2.0}},
+		// complex only operations
+		{"/abs?x=3%2B4i", "", "application/x-www-form-urlencoded", 5.0},
+		{"/conj", `{"x": "3+4i"}`, "application/json", map[string]interface{}{"re": 3.0, "im": -4.0}},
+		{"/sqrt?x=-4", "", "application/x-www-form-urlencoded", map[string]interface{}{"re": 0.0, "im": 2.0}},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080"+testCase.reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", testCase.contentType)
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if !reflect.DeepEqual(mathRes.Answer, testCase.expected) {
+			t.Logf("unexpected answer for %s %s: (actual %v != expected %v)\n", testCase.reqURL, testCase.body, mathRes.Answer, testCase.expected)
+			t.Fail()
+		}
+		if mathRes.Mode != string(modeComplex) {
+			t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modeComplex)
+			t.Fail()
+		}
+	}
+
+	// mod has no complex implementation, and division by zero has no answer
+	for _, query := range []string{"mod?x=1%2Bi&y=2", "divide?x=1%2Bi&y=0"} {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:8080/%s", query), nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		if resRecorder.Code == http.StatusOK {
+			t.Logf("unexpected status value for %s: (actual %d != expected error)\n", query, resRecorder.Code)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Compute and OperationParams are for evaluating operations without a server, like the binary's
+// compute and eval subcommands do.  Compute goes through the same evaluation and response building
+// as mathHandler, so the body it returns is exactly what a request to /{op} would have gotten back
+
+// Compute evaluates op with vars and returns the status and body of the response a request to /{op}
+// would have gotten.  options are the query parameters mathHandler reads, like "mode" and "places"
+func Compute(op string, vars map[string]json.RawMessage, options map[string]string) (int, []byte) {
+	res, err := computeRequest{op: op, vars: vars, options: options}.run()
+	if err != nil {
+		return createErrorResponse(err)
+	}
+
+	resBytes, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("Compute: json marshal failed: %s\n", err)
+		return createErrorResponse(err)
+	}
+	return http.StatusOK, resBytes
+}
+
+// OperationParams returns the names of op's params followed by its optional params, which is the
+// order positional operands are given in
+func OperationParams(op string) ([]string, bool) {
+	switch op {
+	case "convert/base":
+		return append(append([]string{}, baseParams...), baseOptional...), true
+	case "sequence", "series":
+		return append(append([]string{}, sequenceParams...), sequenceOptional...), true
+	}
+
+	operation := supportedOperations[op]
+	if operation == nil {
+		return nil, false
+	}
+	return append(append([]string{}, operation.params...), operation.optional...), true
+}
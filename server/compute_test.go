@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestCompute checks that Compute answers exactly the way a POST to the router does, for operations
+// and for every path with a handler of its own
+func TestCompute(t *testing.T) {
+	defer cleanUpCache()
+	router := GetRouter()
+
+	testCases := []struct {
+		op      string
+		body    string
+		options map[string]string
+		status  int
+	}{
+		{"add", `{"x": 3, "y": 4}`, nil, http.StatusOK},
+		{"divide", `{"x": 1, "y": 3}`, map[string]string{"mode": "rational"}, http.StatusOK},
+		{"divide", `{"x": 2, "y": 3}`, map[string]string{"places": "2"}, http.StatusOK},
+		{"factorial", `{"n": 25}`, nil, http.StatusOK},
+		{"eval", `{"expression": "x^2 + 1", "at": {"x": 3}}`, nil, http.StatusOK},
+		{"convert/base", `{"value": "255", "to": 16}`, nil, http.StatusOK},
+		{"convert/base", `{"value": "0.1", "to": 2}`, map[string]string{"places": "-1"}, http.StatusBadRequest},
+		{"sequence", `{"kind": "prime", "count": 20, "limit": 5}`, nil, http.StatusOK},
+		{"sequence", `{"kind": "triangular"}`, nil, http.StatusBadRequest},
+		{"series", `{"kind": "arithmetic", "count": 10, "step": 2}`, nil, http.StatusOK},
+		{"series", `{"kind": "geometric", "ratio": 1e10, "count": 100}`, nil, http.StatusUnprocessableEntity},
+		{"factorial", `{"n": -1}`, nil, http.StatusUnprocessableEntity},
+		{"add", `{"x": 3}`, nil, http.StatusBadRequest},
+		{"add", `{"x": 3, "y": 4}`, map[string]string{"mode": "abacus"}, http.StatusBadRequest},
+		{"shout", `{}`, nil, http.StatusBadRequest},
+	}
+
+	tested := make(map[string]bool)
+	for _, testCase := range testCases {
+		tested[testCase.op] = true
+		var vars map[string]json.RawMessage
+		err := json.Unmarshal([]byte(testCase.body), &vars)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		cleanUpCache()
+		status, actual := Compute(testCase.op, vars, testCase.options)
+
+		query := make(url.Values)
+		for name, value := range testCase.options {
+			query.Set(name, value)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/"+testCase.op+"?"+query.Encode(), bytes.NewBufferString(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		cleanUpCache()
+		router.ServeHTTP(rr, req)
+
+		if status != testCase.status || rr.Code != testCase.status {
+			t.Logf("unexpected status for %s %s: (actual %d, HTTP %d != expected %d)\n", testCase.op, testCase.body, status, rr.Code, testCase.status)
+			t.Fail()
+		}
+		if !bytes.Equal(actual, rr.Body.Bytes()) {
+			t.Logf("unexpected body for %s %s: (actual %s != HTTP %s)\n", testCase.op, testCase.body, actual, rr.Body.Bytes())
+			t.Fail()
+		}
+	}
+
+	for route := range routedEvaluations {
+		if !tested[route] {
+			t.Logf("expecting a test case for %s, none found\n", route)
+			t.Fail()
+		}
+	}
+}
+
+func TestOperationParams(t *testing.T) {
+	testCases := []struct {
+		op       string
+		expected []string
+		ok       bool
+	}{
+		{"add", []string{"x", "y"}, true},
+		{"convert", []string{"value", "from", "to"}, true},
+		{"convert/base", []string{"value", "to", "from"}, true},
+		{"eval", []string{"expression", "at"}, true},
+		{"series", []string{"kind", "count", "limit", "cursor"}, true},
+		{"shout", nil, false},
+	}
+
+	for _, testCase := range testCases {
+		actual, ok := OperationParams(testCase.op)
+		if ok != testCase.ok || len(actual) != len(testCase.expected) {
+			t.Logf("unexpected params for %s: (actual %v %t != expected %v %t)\n", testCase.op, actual, ok, testCase.expected, testCase.ok)
+			t.Fail()
+			continue
+		}
+		for i := range actual {
+			if actual[i] != testCase.expected[i] {
+				t.Logf("unexpected params for %s: (actual %v != expected %v)\n", testCase.op, actual, testCase.expected)
+				t.Fail()
+				break
+			}
+		}
+	}
+}
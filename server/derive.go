@@ -0,0 +1,320 @@
+package server
+
+import (
+	"math"
+	"time"
+)
+
+// derive differentiates an expression (see expression.go) with respect to one of its variables and
+// simplifies the result.  If values are given for the variables, the derivative is also evaluated.
+// eval just evaluates an expression, at the given values if it has any variables
+
+// maxDerivativeNodes limits the size of a derivative, which can be exponentially larger than the
+// expression it came from (x^x^x^x...)
+const maxDerivativeNodes = 20000
+
+// symbolicOperations are merged into supportedOperations in init
+var symbolicOperations = map[string]*operation{
+	"derive": {
+		description: "the derivative of expression with respect to variable",
+		params:      []string{"expression"},
+		optional:    []string{"at"},
+		exprFn:      exprDerive,
+		cache:       defaultCachePolicy,
+	},
+	"eval": {
+		description: "the value of expression, with at giving the values of its variables",
+		params:      []string{"expression"},
+		optional:    []string{"at"},
+		exprFn:      exprEval,
+		cache:       defaultCachePolicy,
+	},
+}
+
+func init() {
+	for name, op := range symbolicOperations {
+		supportedOperations[name] = op
+	}
+}
+
+func exprDerive(args exprArgs) (interface{}, error) {
+	budget := newExprBudget(time.Now().Add(args.timeout))
+	derivative, err := differentiate(args.expr, args.variable, budget)
+	if err != nil {
+		return nil, err
+	}
+	derivative, err = simplify(derivative, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := Derivative{
+		Expression: derivative.String(),
+		AST:        derivative.model(),
+	}
+	if args.at != nil {
+		value, err := derivative.eval(args.at)
+		if err != nil {
+			return nil, err
+		}
+		ans.Value = &value
+	}
+
+	return ans, nil
+}
+
+func exprEval(args exprArgs) (interface{}, error) {
+	return args.expr.eval(args.at)
+}
+
+// exprBudget bounds the work done building and simplifying a derivative, both in the size of the
+// trees it builds and in time
+type exprBudget struct {
+	deadline time.Time
+	steps    int
+}
+
+func newExprBudget(deadline time.Time) *exprBudget {
+	return &exprBudget{deadline: deadline}
+}
+
+// spend charges a step for building n, failing once n is too big or the deadline has passed
+func (b *exprBudget) spend(n *exprNode) error {
+	if n.size() > maxDerivativeNodes {
+		return newMathError(kindLimitExceeded, "derivative has more than %d nodes", maxDerivativeNodes)
+	}
+	if b.steps%deadlineCheckInterval == 0 && time.Now().After(b.deadline) {
+		return newMathError(kindLimitExceeded, "deadline exceeded after %d steps of the derivative", b.steps)
+	}
+	b.steps++
+	return nil
+}
+
+// differentiate returns the derivative of n with respect to the variable v, without simplifying it
+func differentiate(n *exprNode, v string, budget *exprBudget) (*exprNode, error) {
+	d, err := derivativeOf(n, v, budget)
+	if err != nil {
+		return nil, err
+	}
+	err = budget.spend(d)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// derivativeOf applies the rule for the root of n, differentiate checks what it builds
+func derivativeOf(n *exprNode, v string, budget *exprBudget) (*exprNode, error) {
+	if !n.dependsOn(v) {
+		return number(0), nil
+	}
+	if n.kind == exprVariable {
+		return number(1), nil
+	}
+
+	// these are rewritten in terms of other rules, so differentiating their args first is wasted,
+	// and doubles the work at every level they're nested
+	switch n.name {
+	case "root":
+		return differentiate(call("pow", n.args[0], call("divide", number(1), n.args[1])), v, budget)
+	case "log":
+		return differentiate(call("divide", call("ln", n.args[0]), call("ln", n.args[1])), v, budget)
+	}
+
+	a := n.args[0]
+	da, err := differentiate(a, v, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	var b, db *exprNode
+	if len(n.args) > 1 {
+		b = n.args[1]
+		db, err = differentiate(b, v, budget)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch n.name {
+	case "add", "subtract":
+		return call(n.name, da, db), nil
+	case "negate":
+		return call("negate", da), nil
+	case "multiply":
+		return call("add", call("multiply", da, b), call("multiply", a, db)), nil
+	case "divide":
+		return call("divide",
+			call("subtract", call("multiply", da, b), call("multiply", a, db)),
+			call("pow", b, number(2))), nil
+	case "pow":
+		if !b.dependsOn(v) {
+			// the power rule
+			return call("multiply", call("multiply", b, call("pow", a, call("subtract", b, number(1)))), da), nil
+		}
+		// a^b * (b' ln(a) + b a'/a), which is just a^b ln(a) b' when a is constant
+		return call("multiply", n, call("add",
+			call("multiply", db, call("ln", a)),
+			call("divide", call("multiply", b, da), a))), nil
+	case "abs":
+		return call("multiply", call("divide", a, n), da), nil
+	case "sqrt":
+		return call("divide", da, call("multiply", number(2), n)), nil
+	case "exp":
+		return call("multiply", n, da), nil
+	case "ln":
+		return call("divide", da, a), nil
+	case "sin":
+		return call("multiply", call("cos", a), da), nil
+	case "cos":
+		return call("multiply", call("negate", call("sin", a)), da), nil
+	case "tan":
+		return call("divide", da, call("pow", call("cos", a), number(2))), nil
+	}
+
+	return nil, newMathError(kindUnsupportedOperation, "%s can't be differentiated with respect to %s", n.name, v)
+}
+
+// simplify folds constants and eliminates identities (x + 0, x*1, x^1, etc) from the bottom up
+func simplify(n *exprNode, budget *exprBudget) (*exprNode, error) {
+	if n.kind != exprCall {
+		return n, nil
+	}
+
+	args := make([]*exprNode, len(n.args))
+	for i, arg := range n.args {
+		var err error
+		args[i], err = simplify(arg, budget)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return simplifyCall(call(n.name, args...), budget)
+}
+
+// simplifyCall simplifies a call whose args have already been simplified.  Rewrites only simplify
+// the nodes they build, never the subtrees they keep, so each node is simplified once
+func simplifyCall(n *exprNode, budget *exprBudget) (*exprNode, error) {
+	err := budget.spend(n)
+	if err != nil {
+		return nil, err
+	}
+
+	args := n.args
+	folded := true
+	for _, arg := range args {
+		folded = folded && arg.kind == exprNumber
+	}
+
+	if folded {
+		// answers like 1/3 and ln(2) are easier to read unfolded, unless the expression already had
+		// decimals in it
+		value, err := n.eval(nil)
+		exact := value == math.Trunc(value)
+		for _, arg := range args {
+			exact = exact || arg.value != math.Trunc(arg.value)
+		}
+		if err == nil && exact {
+			return number(value), nil
+		}
+	}
+
+	a := args[0]
+	isNumber := func(n *exprNode, value float64) bool {
+		return n.kind == exprNumber && n.value == value
+	}
+	// negated simplifies the negation of a call that still needs simplifying itself
+	negated := func(name string, args ...*exprNode) (*exprNode, error) {
+		inner, err := simplifyCall(call(name, args...), budget)
+		if err != nil {
+			return nil, err
+		}
+		return simplifyCall(call("negate", inner), budget)
+	}
+
+	switch {
+	case n.name == "negate" && a.kind == exprCall && a.name == "negate":
+		return a.args[0], nil
+	case n.name == "negate" && a.kind == exprCall && a.name == "multiply" && a.args[0].kind == exprNumber:
+		// -(3*x) is -3*x
+		return call("multiply", number(-a.args[0].value), a.args[1]), nil
+	case n.name == "ln" && a.kind == exprConstant && a.name == "e":
+		return number(1), nil
+	}
+	if len(args) < 2 {
+		return n, nil
+	}
+	b := args[1]
+
+	switch n.name {
+	case "add":
+		switch {
+		case isNumber(a, 0):
+			return b, nil
+		case isNumber(b, 0):
+			return a, nil
+		case b.kind == exprNumber && b.value < 0:
+			return call("subtract", a, number(-b.value)), nil
+		case b.kind == exprCall && b.name == "negate":
+			return simplifyCall(call("subtract", a, b.args[0]), budget)
+		}
+	case "subtract":
+		switch {
+		case isNumber(b, 0):
+			return a, nil
+		case isNumber(a, 0):
+			return simplifyCall(call("negate", b), budget)
+		case a.equal(b):
+			return number(0), nil
+		case b.kind == exprNumber && b.value < 0:
+			return call("add", a, number(-b.value)), nil
+		case b.kind == exprCall && b.name == "negate":
+			return simplifyCall(call("add", a, b.args[0]), budget)
+		}
+	case "multiply":
+		switch {
+		case isNumber(a, 0), isNumber(b, 0):
+			return number(0), nil
+		case isNumber(a, 1):
+			return b, nil
+		case isNumber(b, 1):
+			return a, nil
+		case isNumber(a, -1):
+			return simplifyCall(call("negate", b), budget)
+		case isNumber(b, -1):
+			return simplifyCall(call("negate", a), budget)
+		case b.kind == exprNumber:
+			// numbers go first, so x*2 is 2*x
+			return simplifyCall(call("multiply", b, a), budget)
+		case a.kind == exprNumber && b.kind == exprCall && b.name == "multiply" && b.args[0].kind == exprNumber:
+			// 2*(3*x) is 6*x
+			return simplifyCall(call("multiply", number(a.value*b.args[0].value), b.args[1]), budget)
+		case a.kind == exprCall && a.name == "negate":
+			return negated("multiply", a.args[0], b)
+		case b.kind == exprCall && b.name == "negate":
+			return negated("multiply", a, b.args[0])
+		case a.equal(b):
+			return call("pow", a, number(2)), nil
+		}
+	case "divide":
+		switch {
+		case isNumber(b, 1):
+			return a, nil
+		case isNumber(a, 0):
+			return number(0), nil
+		case a.equal(b):
+			return number(1), nil
+		case a.kind == exprCall && a.name == "negate":
+			return negated("divide", a.args[0], b)
+		}
+	case "pow":
+		switch {
+		case isNumber(b, 0), isNumber(a, 1):
+			return number(1), nil
+		case isNumber(b, 1):
+			return a, nil
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestDerive runs derive through mathHandler and checks the simplified derivative
+func TestDerive(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		body          string
+		expected      string
+		expectedValue *float64
+	}{
+		{`{"expression": "3*x^2 + 2*x + 1"}`, "6*x + 2", nil},
+		{`{"expression": "x^2", "at": 3}`, "2*x", floatPointer(6)},
+		{`{"expression": "sin(x)*cos(x)"}`, "cos(x)^2 - sin(x)^2", nil},
+		{`{"expression": "exp(2*t)", "variable": "t", "at": {"t": 0}}`, "2*exp(2*t)", floatPointer(2)},
+		{`{"expression": "x*y + y^2", "variable": "y", "at": {"x": 1, "y": 2}}`, "x + 2*y", floatPointer(5)},
+		{`{"expression": "1/x"}`, "-1/x^2", nil},
+		{`{"expression": "pow(x, 3) - multiply(4, x)"}`, "3*x^2 - 4", nil},
+		{`{"expression": "e^x + ln(x)"}`, "e^x + 1/x", nil},
+		{`{"expression": "42"}`, "0", nil},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/derive", strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes struct {
+			Mode   string     `json:"mode"`
+			Answer Derivative `json:"answer"`
+		}
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if mathRes.Answer.Expression != testCase.expected {
+			t.Logf("unexpected derivative of %s: (actual %s != expected %s)\n", testCase.body, mathRes.Answer.Expression, testCase.expected)
+			t.Fail()
+		}
+		if !floatPointersEqual(mathRes.Answer.Value, testCase.expectedValue) {
+			t.Logf("unexpected value of %s: (actual %v != expected %v)\n", testCase.body, mathRes.Answer.Value, testCase.expectedValue)
+			t.Fail()
+		}
+		if mathRes.Mode != string(modeSymbolic) {
+			t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modeSymbolic)
+			t.Fail()
+		}
+	}
+}
+
+// TestDeriveAST checks the syntax tree of a derivative sent as a form
+func TestDeriveAST(t *testing.T) {
+	form := url.Values{"expression": {"x^2 + y"}}
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/derive", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	var mathRes struct {
+		Answer Derivative `json:"answer"`
+	}
+	err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+
+	expected := `{"type":"call","name":"multiply","args":[{"type":"number","value":2},{"type":"variable","name":"x"}]}`
+	actual, _ := json.Marshal(mathRes.Answer.AST)
+	if string(actual) != expected {
+		t.Logf("unexpected ast value: (actual %s != expected %s)\n", actual, expected)
+		t.Fail()
+	}
+}
+
+// TestDeriveErrors checks parsing, differentiation, and evaluation errors
+func TestDeriveErrors(t *testing.T) {
+	testCases := []struct {
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{`{}`, http.StatusBadRequest, "invalid_argument"},
+		{`{"expression": "x +"}`, http.StatusBadRequest, "invalid_argument"},
+		{`{"expression": "x", "variable": "2x"}`, http.StatusBadRequest, "invalid_argument"},
+		{`{"expression": "mod(x, 2)"}`, http.StatusBadRequest, "unsupported_operation"},
+		{`{"expression": "x*y", "at": 1}`, http.StatusBadRequest, "invalid_argument"},
+		{`{"expression": "ln(x)", "at": 0}`, http.StatusUnprocessableEntity, "domain_error"},
+		{`{"expression": "` + strings.Repeat("x + ", maxExpressionNodes) + `x"}`, http.StatusUnprocessableEntity, "limit_exceeded"},
+		{`{"expression": "` + strings.Repeat("x*", 300) + `x"}`, http.StatusUnprocessableEntity, "limit_exceeded"},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/derive", strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != testCase.expectedStatus || errRes.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s: (actual %d %s != expected %d %s)\n", testCase.body, resRecorder.Code, errRes.Code, testCase.expectedStatus, testCase.expectedCode)
+			t.Fail()
+		}
+	}
+}
+
+// TestEval checks expressions with and without variables
+func TestEval(t *testing.T) {
+	testCases := []struct {
+		body           string
+		expectedStatus int
+		expected       string
+	}{
+		{`{"expression": "2^10"}`, http.StatusOK, "1024"},
+		{`{"expression": "(1 + 2) * sqrt(16) - log(100, 10)"}`, http.StatusOK, "10"},
+		{`{"expression": "x^2 + y", "at": {"x": 3, "y": 1}}`, http.StatusOK, "10"},
+		{`{"expression": "2*x", "at": 4}`, http.StatusOK, "8"},
+		{`{"expression": "x + 1"}`, http.StatusBadRequest, "invalid_argument"},
+		{`{"expression": "1/0"}`, http.StatusUnprocessableEntity, "domain_error"},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/eval", strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var res map[string]interface{}
+		err := json.NewDecoder(resRecorder.Body).Decode(&res)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		actual := fmt.Sprint(res["answer"])
+		if resRecorder.Code != http.StatusOK {
+			actual = fmt.Sprint(res["code"])
+		}
+		if resRecorder.Code != testCase.expectedStatus || actual != testCase.expected {
+			t.Logf("unexpected result for %s: (actual %d %s != expected %d %s)\n", testCase.body, resRecorder.Code, actual, testCase.expectedStatus, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+func floatPointer(value float64) *float64 {
+	return &value
+}
+
+func floatPointersEqual(x, y *float64) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return *x == *y
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"google.golang.org/grpc/codes"
+)
+
+// errorKind classifies the errors that can come out of evaluating an operation so that every way
+// of reaching the server can report them consistently
+type errorKind int
+
+const (
+	kindInternal errorKind = iota
+	kindInvalidArgument
+	kindUnsupportedOperation
+	kindDomain
+	kindNotCached
+	kindLimitExceeded
+	kindDimension
+	kindRateLimited
+)
+
+// errorCodes are the machine readable names sent in MathErrorResponse.Code
+var errorCodes = map[errorKind]string{
+	kindInternal:             "internal",
+	kindInvalidArgument:      "invalid_argument",
+	kindUnsupportedOperation: "unsupported_operation",
+	kindDomain:               "domain_error",
+	kindNotCached:            "not_cached",
+	kindLimitExceeded:        "limit_exceeded",
+	kindDimension:            "dimension_mismatch",
+	kindRateLimited:          "rate_limited",
+}
+
+// errorStatuses maps each errorKind to the HTTP status it's reported with. Unsupported operations
+// get a 400 rather than a 404 because that's what they've always returned
+var errorStatuses = map[errorKind]int{
+	kindInternal:             http.StatusInternalServerError,
+	kindInvalidArgument:      http.StatusBadRequest,
+	kindUnsupportedOperation: http.StatusBadRequest,
+	kindDomain:               http.StatusUnprocessableEntity,
+	kindNotCached:            http.StatusGatewayTimeout, // what RFC 7234 prescribes for an only-if-cached miss
+	kindLimitExceeded:        http.StatusUnprocessableEntity,
+	kindDimension:            http.StatusUnprocessableEntity,
+	kindRateLimited:          http.StatusTooManyRequests,
+}
+
+// errorGRPCCodes maps each errorKind to the status code gRPC calls fail with.  An only-if-cached
+// miss is a failed precondition, since there's no gateway to time out
+var errorGRPCCodes = map[errorKind]codes.Code{
+	kindInternal:             codes.Internal,
+	kindInvalidArgument:      codes.InvalidArgument,
+	kindUnsupportedOperation: codes.Unimplemented,
+	kindDomain:               codes.OutOfRange,
+	kindNotCached:            codes.FailedPrecondition,
+	kindLimitExceeded:        codes.ResourceExhausted,
+	kindDimension:            codes.InvalidArgument,
+	kindRateLimited:          codes.ResourceExhausted,
+}
+
+// These are the error codes the JSON-RPC 2.0 spec defines.  Kinds without a spec equivalent use
+// codes from -32000 to -32099, which the spec leaves for servers to define
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// errorRPCCodes maps each errorKind to the JSON-RPC error code it's reported with
+var errorRPCCodes = map[errorKind]int{
+	kindInternal:             rpcInternalError,
+	kindInvalidArgument:      rpcInvalidParams,
+	kindUnsupportedOperation: rpcMethodNotFound,
+	kindDomain:               -32000,
+	kindNotCached:            -32001,
+	kindLimitExceeded:        -32002,
+	kindDimension:            -32003,
+	kindRateLimited:          -32004,
+}
+
+// mathError is an error along with its classification
+type mathError struct {
+	kind    errorKind
+	msg     string
+	details map[string]interface{} // anything a client might want to inspect, sent as is
+}
+
+func (e *mathError) Error() string {
+	return e.msg
+}
+
+// newMathError formats an error message and tags it with kind
+func newMathError(kind errorKind, format string, args ...interface{}) error {
+	return &mathError{
+		kind: kind,
+		msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// panicError turns a recovered panic into an internal error, logging the stack so that whatever
+// caused it can be tracked down.  It's for servers that answer many requests over one connection,
+// where a single bad request shouldn't take the rest down with it
+func panicError(recovered interface{}) error {
+	log.Printf("recovered from panic: %v\n%s", recovered, debug.Stack())
+	return newMathError(kindInternal, "internal error: %v", recovered)
+}
+
+// detailsOf returns the details of err, if it has any
+func detailsOf(err error) map[string]interface{} {
+	if mathErr, ok := err.(*mathError); ok {
+		return mathErr.details
+	}
+	return nil
+}
+
+// kindOf returns the kind of err, defaulting to kindInternal for errors that didn't come from
+// newMathError
+func kindOf(err error) errorKind {
+	if mathErr, ok := err.(*mathError); ok {
+		return mathErr.kind
+	}
+	return kindInternal
+}
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// evalMode selects how operands are interpreted and how answers are computed
+type evalMode string
+
+const (
+	modeFloat      evalMode = "float"      // float64 operands and answers, the default
+	modePrecise    evalMode = "precise"    // decimal string operands and answers, see precise.go
+	modeRational   evalMode = "rational"   // exact fractions, see rational.go
+	modeComplex    evalMode = "complex"    // complex128 operands and answers, see complex.go
+	modeInteger    evalMode = "integer"    // integer operations, which ignore the requested mode
+	modeMatrix     evalMode = "matrix"     // vector and matrix operations, which also ignore it
+	modeStatistics evalMode = "statistics" // as do statistics operations
+	modeUnits      evalMode = "units"      // operands with units, see units.go
+	modeSymbolic   evalMode = "symbolic"   // operations on expressions, see expression.go
+	modeSequence   evalMode = "sequence"   // pages of /sequence and /series, see sequence.go
+	modeBitwise    evalMode = "bitwise"    // fixed width integer operations, see bitwise.go
+	modeBase       evalMode = "base"       // /convert/base, see base.go
+)
+
+var evalModes = map[evalMode]bool{
+	modeFloat:    true,
+	modePrecise:  true,
+	modeRational: true,
+	modeComplex:  true,
+}
+
+// evalOptions are the per-request settings that affect how an operation is evaluated
+type evalOptions struct {
+	mode     evalMode
+	digits   int          // significant digits, precise mode only
+	rounding roundingMode // precise mode and formatting
+	decimal  bool         // include a decimal expansion, rational mode only
+	format   formatOptions
+}
+
+var defaultEvalOptions = evalOptions{
+	mode:     modeFloat,
+	digits:   defaultPreciseDigits,
+	rounding: roundHalfEven,
+	format:   formatOptions{rounding: roundHalfEven},
+}
+
+// evaluation is an operation whose operands have been parsed and validated.  Splitting parsing from
+// computing lets mathHandler check things like ETags before doing any real work
+type evaluation struct {
+	op   string
+	mode evalMode
+	x, y interface{}            // operands as they're echoed back to the client
+	args map[string]interface{} // same, for operations that don't take x and y
+
+	key     string // opCache key, also the basis for ETags
+	policy  cachePolicy
+	compute func() (interface{}, error)
+
+	// finish, if set, fills in any response fields derived from the answer.  It runs after the
+	// cache so that only the answer itself has to be cached
+	finish    func(*MathOKResponse)
+	finishTag string // describes what finish adds, which ETags have to change along with
+
+	format formatOptions // the formatted field, which is also filled in after the cache
+}
+
+// newEvaluation looks up op and parses the operands it needs from vars according to opts, including
+// how the answer is formatted
+func newEvaluation(op string, vars clientVars, opts evalOptions) (*evaluation, error) {
+	eval, err := newOperationEvaluation(op, vars, opts)
+	if err != nil {
+		return nil, err
+	}
+	eval.format = opts.format
+	return eval, nil
+}
+
+// newOperationEvaluation is newEvaluation without the formatting
+func newOperationEvaluation(op string, vars clientVars, opts evalOptions) (*evaluation, error) {
+	operation := supportedOperations[op]
+	if operation == nil {
+		return nil, newMathError(kindUnsupportedOperation, "unsupported operation request: %q", op)
+	}
+	if operation.intFn != nil {
+		return newIntEvaluation(op, operation, vars)
+	}
+	if operation.linalgFn != nil {
+		return newLinalgEvaluation(op, operation, vars)
+	}
+	if operation.statsFn != nil {
+		return newStatsEvaluation(op, operation, vars)
+	}
+	if operation.exprFn != nil {
+		return newExprEvaluation(op, operation, vars)
+	}
+	if operation.bitFn != nil {
+		return newBitwiseEvaluation(op, operation, vars)
+	}
+	if usesUnits(operation, vars) {
+		return newUnitEvaluation(op, operation, vars)
+	}
+	if usesComplex(operation, vars, opts) {
+		return newComplexEvaluation(op, operation, vars)
+	}
+
+	eval := &evaluation{
+		op:     op,
+		mode:   opts.mode,
+		policy: operation.cache,
+	}
+
+	switch opts.mode {
+	case modePrecise, modeRational:
+		x, err := vars.rat("x")
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+		y, err := vars.rat("y")
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+
+		eval.key = createRatCacheKey(op, x, y, opts)
+		if opts.mode == modePrecise {
+			eval.x, eval.y = formatRat(x, opts.digits, opts.rounding), formatRat(y, opts.digits, opts.rounding)
+			eval.compute = func() (interface{}, error) {
+				return evaluatePrecise(operation, x, y, opts.digits, opts.rounding)
+			}
+			break
+		}
+
+		eval.x, eval.y = x.RatString(), y.RatString()
+		eval.compute = func() (interface{}, error) {
+			return evaluateRational(operation, x, y)
+		}
+		if opts.decimal {
+			eval.finish = func(res *MathOKResponse) {
+				ans, _ := new(big.Rat).SetString(res.Answer.(string))
+				res.Decimal = ratDecimal(ans)
+			}
+			eval.finishTag = "decimal"
+		}
+	default:
+		x, err := vars.float("x")
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+		y, err := vars.float("y")
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+
+		eval.x, eval.y = x, y
+		eval.key = createCacheKey(op, x, y)
+		eval.compute = func() (interface{}, error) {
+			return operation.fn(x, y), nil
+		}
+	}
+
+	return eval, nil
+}
+
+// routedEvaluations build the evaluations of the paths that have handlers of their own, keyed by
+// path without the leading slash.  Every other path is an operation in supportedOperations
+var routedEvaluations = map[string]func(route string, vars clientVars, opts evalOptions) (*evaluation, error){
+	"convert/base": func(route string, vars clientVars, opts evalOptions) (*evaluation, error) {
+		return newBaseEvaluation(vars, opts)
+	},
+	"sequence": newRoutedSequenceEvaluation,
+	"series":   newRoutedSequenceEvaluation,
+}
+
+// buildEvaluation builds the evaluation of a request to /{route}.  The handlers and computeRequest
+// all build their evaluations here, so that a request means the same thing wherever it comes from
+func buildEvaluation(route string, vars clientVars, opts evalOptions) (*evaluation, error) {
+	if build := routedEvaluations[route]; build != nil {
+		return build(route, vars, opts)
+	}
+	return newEvaluation(route, vars, opts)
+}
+
+// computeRequest is an operation request that didn't come through mathHandler, like a gRPC call.
+// options are what mathHandler reads from the query string, keyed by query parameter name, along
+// with "cache-control" and "nocache"
+type computeRequest struct {
+	op      string
+	vars    clientVars
+	options map[string]string
+}
+
+// run evaluates the request the same way mathHandler would, minus the HTTP caching
+func (c computeRequest) run() (MathOKResponse, error) {
+	opts, err := evalOptionsFrom(func(param, header string) string {
+		return c.options[param]
+	})
+	if err != nil {
+		return MathOKResponse{}, newMathError(kindInvalidArgument, "%s", err)
+	}
+
+	eval, err := buildEvaluation(c.op, c.vars, opts)
+	if err != nil {
+		return MathOKResponse{}, err
+	}
+
+	var noCache *string
+	if value, ok := c.options["nocache"]; ok {
+		noCache = &value
+	}
+	return eval.run(cacheDirectiveFrom(c.options["cache-control"], noCache))
+}
+
+// run produces the evaluation's answer, going through the cache and coalescing identical
+// evaluations according to the evaluation's cachePolicy and the client's cacheDirective
+func (e *evaluation) run(directive cacheDirective) (MathOKResponse, error) {
+	var answer interface{}
+	var inCache bool
+	if e.policy.cacheable && directive != cacheBypass {
+		answer, inCache = cacheGet(e.key)
+	}
+
+	if !inCache && directive == cacheOnly {
+		return MathOKResponse{}, newMathError(kindNotCached, "answer not cached: %q", e.op)
+	}
+
+	source := sourceCached
+	if !inCache && !e.policy.cacheable {
+		// operations that aren't worth caching aren't worth waiting on someone else for either
+		var err error
+		answer, err = e.computeFinite()
+		if err != nil {
+			return MathOKResponse{}, err
+		}
+		source = sourceComputed
+	} else if !inCache {
+		// identical requests that miss the cache at the same time share a single evaluation
+		var err error
+		var coalesced bool
+		answer, err, coalesced = inFlight.do(e.key, func() (interface{}, error) {
+			computed, err := e.computeFinite()
+			if err == nil {
+				cacheSet(e.key, computed, e.policy.expiration)
+			}
+			return computed, err
+		})
+		if err != nil {
+			return MathOKResponse{}, err
+		}
+
+		source = sourceComputed
+		if coalesced {
+			source = sourceCoalesced
+		}
+	} else if e.policy.sliding {
+		cacheSet(e.key, answer, e.policy.expiration) // restarts the countdown
+	}
+
+	res := MathOKResponse{
+		Action: e.op,
+		Mode:   string(e.mode),
+		X:      e.x,
+		Y:      e.y,
+		Args:   e.args,
+		Answer: answer,
+		Cached: inCache,
+		Source: source,
+	}
+	if e.finish != nil {
+		e.finish(&res)
+	}
+	if e.format.requested() {
+		res.Formatted = e.format.answer(answer)
+	}
+
+	return res, nil
+}
+
+// computeFinite computes the answer, which is a domain error if it's infinite or NaN.  Checking here
+// rather than when the answer is encoded means every protocol gets the same 422 for 1/0, and an
+// answer like that is never cached
+func (e *evaluation) computeFinite() (interface{}, error) {
+	answer, err := e.compute()
+	if err != nil {
+		return nil, err
+	}
+	return answer, checkFiniteAnswer(answer)
+}
+
+// checkFiniteAnswer is checkFinite for an answer of any of the float shapes operations answer with
+func checkFiniteAnswer(answer interface{}) error {
+	switch answer := answer.(type) {
+	case float64:
+		return checkFinite(answer)
+	case []float64:
+		return checkFinite(answer...)
+	case [][]float64:
+		for _, row := range answer {
+			if err := checkFinite(row...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createRatCacheKey builds a cache key for the precise and rational modes.  Precise mode's digits and
+// rounding are included because they change the answer, and exact rational forms mean "0.10" and
+// "0.1" share a key
+func createRatCacheKey(op string, x, y *big.Rat, opts evalOptions) string {
+	settings := string(opts.mode)
+	if opts.mode == modePrecise {
+		settings = fmt.Sprintf("%s(%d,%s)", opts.mode, opts.digits, opts.rounding)
+	}
+
+	return fmt.Sprintf("%s:%s%s%s", settings, x.RatString(), op, y.RatString())
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// /events is a Server-Sent Events feed of the answers mathHandler computes, for dashboards that want
+// to watch the server work.  writeEvaluation publishes a ComputeEvent to computeEvents for every
+// evaluation it runs, and each /events request subscribes to it, optionally filtered by operation.
+// Publishing never blocks: a subscriber that falls far enough behind to fill its buffer is dropped
+// and told so, rather than holding up the requests being published
+
+const (
+	// subscriberBuffer is how many events a subscriber can fall behind before it's dropped
+	subscriberBuffer = 64
+
+	// eventsHeartbeat is how often an idle feed gets a comment, to keep proxies from timing it out
+	eventsHeartbeat = 15 * time.Second
+)
+
+// routedOperations are the evaluations that have routes of their own rather than entries in
+// supportedOperations, which /events can also be filtered by
+var routedOperations = map[string]bool{
+	"convert/base": true,
+	"sequence":     true,
+	"series":       true,
+}
+
+// computeEvents is the bus that writeEvaluation publishes to
+var computeEvents = newEventBus()
+
+// subscriber is a single subscription to an eventBus
+type subscriber struct {
+	events chan ComputeEvent // closed when the subscriber is dropped or unsubscribes
+	ops    map[string]bool   // nil for every operation
+}
+
+// eventBus fans ComputeEvents out to its subscribers
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]bool
+	done        chan struct{} // closed when the server shuts down
+	closeOnce   sync.Once
+
+	seq uint64 // the last event id, only touched with sync/atomic
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: make(map[*subscriber]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// close ends every subscriber's stream for good
+func (b *eventBus) close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// CloseEventStreams ends every /events stream.  http.Server.Shutdown waits for responses to finish,
+// which an event stream never does on its own, so it's meant to be passed to
+// http.Server.RegisterOnShutdown
+func CloseEventStreams() {
+	computeEvents.close()
+}
+
+// subscribe starts a subscription to the events for ops, or to every event if ops is empty
+func (b *eventBus) subscribe(ops []string) *subscriber {
+	sub := &subscriber{
+		events: make(chan ComputeEvent, subscriberBuffer),
+	}
+	if len(ops) > 0 {
+		sub.ops = make(map[string]bool, len(ops))
+		for _, op := range ops {
+			sub.ops[op] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = true
+	b.mu.Unlock()
+	return sub
+}
+
+// unsubscribe ends a subscription, if it hasn't already been dropped
+func (b *eventBus) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[sub] {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// publish sends event to every subscriber that wants it, dropping any whose buffer is full
+func (b *eventBus) publish(event ComputeEvent) {
+	event.ID = atomic.AddUint64(&b.seq, 1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if sub.ops != nil && !sub.ops[event.Op] {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// size is the number of subscribers
+func (b *eventBus) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// publishEvaluation publishes the outcome of running eval
+func publishEvaluation(eval *evaluation, res MathOKResponse, err error, latency time.Duration) {
+	event := ComputeEvent{
+		Op:        eval.op,
+		Mode:      string(eval.mode),
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		Time:      time.Now().UTC(),
+	}
+	if err != nil {
+		event.Code = errorCodes[kindOf(err)]
+		event.Error = err.Error()
+	} else {
+		event.Answer = res.Answer
+		event.Cached = res.Cached
+		event.Source = res.Source
+	}
+
+	computeEvents.publish(event)
+}
+
+// eventsHandler serves /events.  The op query parameter, which can be repeated or comma separated,
+// limits the feed to those operations
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeErrorResponse(w, newMathError(kindInvalidArgument, "the event stream is only available with GET"))
+		return
+	}
+
+	var ops []string
+	for _, value := range r.URL.Query()["op"] {
+		for _, op := range strings.Split(value, ",") {
+			op = strings.TrimSpace(op)
+			if op == "" {
+				continue
+			}
+			if supportedOperations[op] == nil && !routedOperations[op] {
+				writeErrorResponse(w, newMathError(kindUnsupportedOperation, "unsupported operation request: %q", op))
+				return
+			}
+			ops = append(ops, op)
+		}
+	}
+
+	// the server's write timeout is meant for ordinary responses, not ones that last all day
+	controller := http.NewResponseController(w)
+	err := controller.SetWriteDeadline(time.Time{})
+	if err != nil && err != http.ErrNotSupported {
+		log.Printf("clear write deadline failed: %s\n", err)
+	}
+
+	sub := computeEvents.subscribe(ops)
+	defer computeEvents.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if controller.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				// we fell too far behind and were dropped, the client can reconnect if it wants
+				fmt.Fprintf(w, "event: dropped\ndata: {\"error\":\"subscriber fell more than %d events behind\"}\n\n", subscriberBuffer)
+				controller.Flush()
+				return
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				// the evaluation still happened, so subscribers hear that it failed rather than
+				// nothing at all
+				log.Printf("eventsHandler: json marshal failed: %s\n", err)
+				event.Answer, event.Cached, event.Source = nil, false, ""
+				event.Code = errorCodes[kindInternal]
+				event.Error = fmt.Sprintf("encode answer failed: %s", err)
+				data, _ = json.Marshal(event) // nothing left that can fail
+			}
+			fmt.Fprintf(w, "id: %d\nevent: compute\ndata: %s\n\n", event.ID, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		case <-computeEvents.done:
+			return
+		}
+
+		if controller.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEventsStream subscribes to pow events and checks that only they come through, with their
+// cached flags
+func TestEventsStream(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	srv := httptest.NewServer(GetRouter())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/events?op=pow,root")
+	if err != nil {
+		t.Fatalf("subscribe failed: %s\n", err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type: (actual %s != expected text/event-stream)\n", res.Header.Get("Content-Type"))
+	}
+
+	// the subscription is registered before the headers are flushed, so it's safe to publish now
+	for _, target := range []string{"/add?x=1&y=2", "/pow?x=2&y=3", "/pow?x=2&y=3", "/root?x=4&y=0.5&nocache", "/root?x=-8&y=2"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+target, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		computeRes, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %s\n", err)
+		}
+		computeRes.Body.Close()
+	}
+	// an answer that can't be encoded still gets an event, as an error
+	computeEvents.publish(ComputeEvent{Op: "pow", Answer: math.Inf(1)})
+
+	expected := []struct {
+		op     string
+		answer interface{}
+		cached bool
+		code   string
+	}{
+		{"pow", 8.0, false, ""},
+		{"pow", 8.0, true, ""},
+		{"root", 16.0, false, ""},
+		{"root", nil, false, "domain_error"},
+		{"pow", nil, false, "internal"},
+	}
+
+	reader := bufio.NewReader(res.Body)
+	for _, expectedEvent := range expected {
+		var event ComputeEvent
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read failed: %s\n", err)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+				if err != nil {
+					t.Fatalf("json decode failed: %s\n", err)
+				}
+				break
+			}
+		}
+
+		if event.Op != expectedEvent.op || event.Answer != expectedEvent.answer || event.Cached != expectedEvent.cached || event.Code != expectedEvent.code || event.LatencyMs < 0 {
+			t.Logf("unexpected event: (actual %+v != expected %+v)\n", event, expectedEvent)
+			t.Fail()
+		}
+	}
+}
+
+// TestEventsErrors checks the filter and method errors
+func TestEventsErrors(t *testing.T) {
+	testCases := []struct {
+		method         string
+		target         string
+		expectedStatus int
+	}{
+		{http.MethodGet, "/events?op=nope", http.StatusBadRequest},
+		{http.MethodPost, "/events", http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(testCase.method, "http://localhost:8080"+testCase.target, nil)
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+		if resRecorder.Code != testCase.expectedStatus {
+			t.Logf("unexpected status for %s %s: (actual %d != expected %d)\n", testCase.method, testCase.target, resRecorder.Code, testCase.expectedStatus)
+			t.Fail()
+		}
+	}
+}
+
+// TestEventBusDropsSlowSubscribers checks that publishing never waits on a full subscriber
+func TestEventBusDropsSlowSubscribers(t *testing.T) {
+	bus := newEventBus()
+	slow := bus.subscribe(nil)
+	filtered := bus.subscribe([]string{"pow"})
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i <= subscriberBuffer; i++ {
+			bus.publish(ComputeEvent{Op: "add"})
+		}
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+
+	received := 0
+	for range slow.events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Logf("unexpected buffered events: (actual %d != expected %d)\n", received, subscriberBuffer)
+		t.Fail()
+	}
+
+	// the filtered subscriber never saw an add, so it's still subscribed
+	if bus.size() != 1 || len(filtered.events) != 0 {
+		t.Logf("unexpected subscribers: (actual %d != expected 1)\n", bus.size())
+		t.Fail()
+	}
+	bus.unsubscribe(filtered)
+	bus.unsubscribe(slow) // already dropped, shouldn't panic
+	if bus.size() != 0 {
+		t.Logf("unexpected subscribers: (actual %d != expected 0)\n", bus.size())
+		t.Fail()
+	}
+}
+
+// TestCloseEventStreams checks that closing the bus ends a stream that's otherwise idle
+func TestCloseEventStreams(t *testing.T) {
+	defer func(bus *eventBus) {
+		computeEvents = bus
+	}(computeEvents)
+	computeEvents = newEventBus()
+
+	srv := httptest.NewServer(GetRouter())
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatalf("subscribe failed: %s\n", err)
+	}
+	defer res.Body.Close()
+
+	CloseEventStreams()
+
+	done := make(chan error)
+	go func() {
+		_, err := io.ReadAll(res.Body)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Logf("unexpected read error: %s\n", err)
+			t.Fail()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after CloseEventStreams")
+	}
+}
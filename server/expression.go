@@ -0,0 +1,648 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expressions are written in the usual infix notation with +, -, *, /, ^, and parentheses, and can
+// call any of the binary operations in supportedOperations by name (pow(x, 2), log(x, 10), etc) as
+// well as the functions in exprFunctions.  Operators are parsed into calls of the same names, so
+// "x + 1" and "add(x, 1)" are the same expression
+
+const maxExpressionLength = 10000
+const maxExpressionDepth = 200
+const maxExpressionNodes = 2000
+
+// defaultExprVariable is the variable that operations on expressions work with if none is given
+const defaultExprVariable = "x"
+
+// exprFunctions are the one argument functions that can be called in an expression
+var exprFunctions = map[string]func(float64) float64{
+	"negate": func(x float64) float64 { return -x },
+	"abs":    math.Abs,
+	"sqrt":   math.Sqrt,
+	"exp":    math.Exp,
+	"ln":     math.Log,
+	"sin":    math.Sin,
+	"cos":    math.Cos,
+	"tan":    math.Tan,
+}
+
+// exprConstants are the named constants that can be used in an expression
+var exprConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+type exprKind int
+
+const (
+	exprNumber exprKind = iota
+	exprConstant
+	exprVariable
+	exprCall
+)
+
+// exprNode is a single node of an expression's syntax tree
+type exprNode struct {
+	kind  exprKind
+	value float64 // numbers and constants
+	name  string  // constants, variables, and calls
+	args  []*exprNode
+	nodes int // calls, the number of nodes in the tree below and including this one
+}
+
+func number(value float64) *exprNode {
+	return &exprNode{kind: exprNumber, value: value}
+}
+
+func call(name string, args ...*exprNode) *exprNode {
+	nodes := 1
+	for _, arg := range args {
+		nodes += arg.size()
+	}
+	// derivatives share subtrees, so their sizes can grow exponentially
+	if nodes > math.MaxInt32 {
+		nodes = math.MaxInt32
+	}
+	return &exprNode{kind: exprCall, name: name, args: args, nodes: nodes}
+}
+
+// size is the number of nodes in n, counting shared subtrees every time they appear
+func (n *exprNode) size() int {
+	if n.kind != exprCall {
+		return 1
+	}
+	return n.nodes
+}
+
+// exprPrecedence is how tightly each operator binds, anything else is written as a function call
+var exprPrecedence = map[string]int{
+	"add":      1,
+	"subtract": 1,
+	"multiply": 2,
+	"divide":   2,
+	"negate":   3,
+	"pow":      4,
+}
+
+var exprOperators = map[string]string{
+	"add":      " + ",
+	"subtract": " - ",
+	"multiply": "*",
+	"divide":   "/",
+	"pow":      "^",
+}
+
+// precedence returns how tightly n binds when it's written out, atoms bind tightest of all
+func (n *exprNode) precedence() int {
+	if n.kind == exprNumber && n.value < 0 {
+		return exprPrecedence["negate"]
+	}
+	if prec, ok := exprPrecedence[n.name]; ok && n.kind == exprCall {
+		return prec
+	}
+	return math.MaxInt32
+}
+
+// String writes n in infix notation with as few parentheses as possible
+func (n *exprNode) String() string {
+	switch n.kind {
+	case exprNumber:
+		return strconv.FormatFloat(n.value, 'g', -1, 64)
+	case exprConstant, exprVariable:
+		return n.name
+	}
+
+	prec, isOperator := exprPrecedence[n.name]
+	if !isOperator {
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			args[i] = arg.String()
+		}
+		return fmt.Sprintf("%s(%s)", n.name, strings.Join(args, ", "))
+	}
+
+	// wrap writes an operand, in parentheses if it binds looser than the operator.  Operands on
+	// the side an operator doesn't associate with need parentheses when they bind the same
+	wrap := func(arg *exprNode, strict bool) string {
+		if arg.precedence() < prec || (strict && arg.precedence() == prec) {
+			return "(" + arg.String() + ")"
+		}
+		return arg.String()
+	}
+
+	if n.name == "negate" {
+		return "-" + wrap(n.args[0], false)
+	}
+	if n.name == "pow" {
+		return wrap(n.args[0], true) + exprOperators[n.name] + wrap(n.args[1], false)
+	}
+	return wrap(n.args[0], false) + exprOperators[n.name] + wrap(n.args[1], true)
+}
+
+// equal reports whether n and other are the same expression, node for node
+func (n *exprNode) equal(other *exprNode) bool {
+	if n == other {
+		return true
+	}
+	if n.kind != other.kind || n.name != other.name || n.value != other.value || len(n.args) != len(other.args) {
+		return false
+	}
+	for i := range n.args {
+		if !n.args[i].equal(other.args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// dependsOn reports whether n refers to the variable name
+func (n *exprNode) dependsOn(name string) bool {
+	if n.kind == exprVariable {
+		return n.name == name
+	}
+	for _, arg := range n.args {
+		if arg.dependsOn(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// variables returns the names of every variable in n
+func (n *exprNode) variables(names map[string]bool) map[string]bool {
+	if names == nil {
+		names = make(map[string]bool)
+	}
+	if n.kind == exprVariable {
+		names[n.name] = true
+	}
+	for _, arg := range n.args {
+		arg.variables(names)
+	}
+	return names
+}
+
+// eval evaluates n with the given variable values
+func (n *exprNode) eval(vars map[string]float64) (float64, error) {
+	switch n.kind {
+	case exprNumber, exprConstant:
+		return n.value, nil
+	case exprVariable:
+		value, ok := vars[n.name]
+		if !ok {
+			return 0, newMathError(kindInvalidArgument, "no value given for %s", n.name)
+		}
+		return value, nil
+	}
+
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		var err error
+		args[i], err = arg.eval(vars)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var value float64
+	if fn, ok := exprFunctions[n.name]; ok {
+		value = fn(args[0])
+	} else {
+		value = supportedOperations[n.name].fn(args[0], args[1])
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, newMathError(kindDomain, "%s is not finite at %v", n, vars)
+	}
+	return value, nil
+}
+
+// model returns n as it's sent to the client
+func (n *exprNode) model() *ExpressionNode {
+	switch n.kind {
+	case exprNumber:
+		value := n.value
+		return &ExpressionNode{Type: "number", Value: &value}
+	case exprConstant:
+		value := n.value
+		return &ExpressionNode{Type: "constant", Name: n.name, Value: &value}
+	case exprVariable:
+		return &ExpressionNode{Type: "variable", Name: n.name}
+	}
+
+	args := make([]*ExpressionNode, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.model()
+	}
+	return &ExpressionNode{Type: "call", Name: n.name, Args: args}
+}
+
+// exprArity returns how many arguments the function name takes, or 0 if there's no such function
+func exprArity(name string) int {
+	if _, ok := exprFunctions[name]; ok {
+		return 1
+	}
+	if op, ok := supportedOperations[name]; ok && op.fn != nil {
+		return 2
+	}
+	return 0
+}
+
+// exprParser is a recursive descent parser over the grammar
+//
+//	expression = term {("+" | "-") term}
+//	term       = unary {("*" | "/") unary}
+//	unary      = "-" unary | power
+//	power      = primary ["^" unary]
+//	primary    = number | name | name "(" expression {"," expression} ")" | "(" expression ")"
+type exprParser struct {
+	input string
+	pos   int
+	depth int
+}
+
+// parseExpression parses str into a syntax tree
+func parseExpression(str string) (*exprNode, error) {
+	if len(str) > maxExpressionLength {
+		return nil, newMathError(kindLimitExceeded, "expression is longer than %d characters", maxExpressionLength)
+	}
+
+	p := &exprParser{input: str}
+	n, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+	if n.size() > maxExpressionNodes {
+		return nil, newMathError(kindLimitExceeded, "expression has more than %d nodes", maxExpressionNodes)
+	}
+	return n, nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return newMathError(kindInvalidArgument, "parse expression failed at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// accept consumes c if it's the next character
+func (p *exprParser) accept(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expression() (*exprNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExpressionDepth {
+		return nil, newMathError(kindLimitExceeded, "expression is nested more than %d levels deep", maxExpressionDepth)
+	}
+
+	n, err := p.term()
+	for err == nil {
+		var right *exprNode
+		switch {
+		case p.accept('+'):
+			if right, err = p.term(); err == nil {
+				n = call("add", n, right)
+			}
+		case p.accept('-'):
+			if right, err = p.term(); err == nil {
+				n = call("subtract", n, right)
+			}
+		default:
+			return n, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *exprParser) term() (*exprNode, error) {
+	n, err := p.unary()
+	for err == nil {
+		var right *exprNode
+		switch {
+		case p.accept('*'):
+			if right, err = p.unary(); err == nil {
+				n = call("multiply", n, right)
+			}
+		case p.accept('/'):
+			if right, err = p.unary(); err == nil {
+				n = call("divide", n, right)
+			}
+		default:
+			return n, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *exprParser) unary() (*exprNode, error) {
+	if p.accept('-') {
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxExpressionDepth {
+			return nil, newMathError(kindLimitExceeded, "expression is nested more than %d levels deep", maxExpressionDepth)
+		}
+
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return call("negate", n), nil
+	}
+	return p.power()
+}
+
+func (p *exprParser) power() (*exprNode, error) {
+	n, err := p.primary()
+	if err != nil || !p.accept('^') {
+		return n, err
+	}
+
+	exp, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return call("pow", n, exp), nil
+}
+
+func (p *exprParser) primary() (*exprNode, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	start := p.pos
+	switch c := p.input[p.pos]; {
+	case c == '(':
+		p.pos++
+		n, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(')') {
+			return nil, p.errorf("expected %q", ')')
+		}
+		return n, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.number()
+	case unicode.IsLetter(rune(c)) || c == '_':
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '_') {
+			p.pos++
+		}
+		name := p.input[start:p.pos]
+
+		if p.accept('(') {
+			return p.call(name)
+		}
+		if value, ok := exprConstants[name]; ok {
+			return &exprNode{kind: exprConstant, value: value, name: name}, nil
+		}
+		return &exprNode{kind: exprVariable, name: name}, nil
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func (p *exprParser) number() (*exprNode, error) {
+	start := p.pos
+	digits := func() {
+		for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+			p.pos++
+		}
+	}
+
+	digits()
+	if p.pos < len(p.input) && p.input[p.pos] == '.' {
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.input) && (p.input[p.pos] == '+' || p.input[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+
+	text := p.input[start:p.pos]
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", text)
+	}
+	return number(value), nil
+}
+
+// call parses the arguments of a call to name, the opening parenthesis has already been consumed
+func (p *exprParser) call(name string) (*exprNode, error) {
+	arity := exprArity(name)
+	if arity == 0 {
+		return nil, newMathError(kindUnsupportedOperation, "unsupported function in expression: %q", name)
+	}
+
+	var args []*exprNode
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if p.accept(')') {
+			break
+		}
+		if !p.accept(',') {
+			return nil, p.errorf("expected %q or %q", ',', ')')
+		}
+	}
+
+	if len(args) != arity {
+		return nil, p.errorf("%s takes %d arguments, got %d", name, arity, len(args))
+	}
+	return call(name, args...), nil
+}
+
+// exprArgs are the parsed arguments of an operation on an expression.  Only the ones in the
+// operation's params and optional params are set
+type exprArgs struct {
+	expr     *exprNode
+	variable string
+	at       map[string]float64 // nil unless values were given
+
+	method        string // empty for the operation's default
+	a, b, x0      *float64
+	tolerance     float64
+	maxIterations int
+	timeout       time.Duration
+}
+
+// newExprEvaluation parses the expression and options of an operation on an expression
+func newExprEvaluation(op string, operation *operation, vars clientVars) (*evaluation, error) {
+	args := exprArgs{
+		variable:      defaultExprVariable,
+		tolerance:     defaultTolerance,
+		maxIterations: defaultMaxIterations,
+		timeout:       defaultNumericTimeout,
+	}
+	echo := make(map[string]interface{})
+	var keyArgs []string
+
+	// every operation on an expression takes an optional variable, which comes first so that at
+	// can use it
+	params := append([]string{"variable"}, operation.params...)
+	for _, param := range append(params, operation.optional...) {
+		if _, ok := vars[param]; !ok && !contains(operation.params, param) {
+			continue
+		}
+
+		var value interface{}
+		var err error
+		switch param {
+		case "expression":
+			var text string
+			text, err = vars.text(param)
+			if err == nil {
+				args.expr, err = parseExpression(text)
+				value = args.expr
+			}
+		case "variable":
+			args.variable, err = vars.text(param)
+			if err == nil && !isExprVariable(args.variable) {
+				err = fmt.Errorf("variable must be a name, got %s", vars[param])
+			}
+			value = args.variable
+		case "at":
+			args.at, err = vars.point(param, args.variable)
+			value = args.at
+		case "method":
+			args.method, err = vars.text(param)
+			value = args.method
+		case "a", "b", "x0":
+			var f float64
+			f, err = vars.float(param)
+			if err == nil {
+				err = checkFinite(f)
+			}
+			value = f
+			switch param {
+			case "a":
+				args.a = &f
+			case "b":
+				args.b = &f
+			default:
+				args.x0 = &f
+			}
+		case "tolerance":
+			args.tolerance, err = vars.float(param)
+			if err == nil && !(args.tolerance > 0) {
+				err = fmt.Errorf("tolerance must be positive, got %g", args.tolerance)
+			}
+			value = args.tolerance
+		case "maxiter":
+			var f float64
+			f, err = vars.float(param)
+			if err == nil && (f != math.Trunc(f) || f < 1 || f > maxNumericIterations) {
+				err = fmt.Errorf("maxiter must be an integer between 1 and %d", maxNumericIterations)
+			}
+			args.maxIterations = int(f)
+			value = args.maxIterations
+		case "timeout":
+			var text string
+			text, err = vars.text(param)
+			if err == nil {
+				args.timeout, err = time.ParseDuration(text)
+			}
+			if err != nil || args.timeout <= 0 || args.timeout > maxNumericTimeout {
+				return nil, newMathError(kindInvalidArgument, "timeout must be a duration between 0 and %s, like \"500ms\"", maxNumericTimeout)
+			}
+			echo[param] = args.timeout.String()
+			continue // the timeout doesn't change the answer, so it isn't part of the key
+		}
+		if err != nil {
+			if _, ok := err.(*mathError); !ok {
+				err = newMathError(kindInvalidArgument, "%s", err)
+			}
+			return nil, err
+		}
+
+		switch value := value.(type) {
+		case *exprNode:
+			echo[param] = value.String()
+		case map[string]float64:
+			echo[param] = value
+			keyArgs = append(keyArgs, param+"="+formatPoint(value))
+			continue
+		default:
+			echo[param] = value
+		}
+		keyArgs = append(keyArgs, fmt.Sprintf("%s=%v", param, echo[param]))
+	}
+
+	return &evaluation{
+		op:     op,
+		mode:   modeSymbolic,
+		args:   echo,
+		key:    createArgsCacheKey(string(modeSymbolic), op, keyArgs...),
+		policy: operation.cache,
+		compute: func() (interface{}, error) {
+			return operation.exprFn(args)
+		},
+	}, nil
+}
+
+// isExprVariable reports whether name can be used as a variable in an expression
+func isExprVariable(name string) bool {
+	n, err := parseExpression(name)
+	return err == nil && n.kind == exprVariable
+}
+
+// point returns the variable as a map of variable values.  A plain number is the value of the
+// variable named def
+func (v clientVars) point(name, def string) (map[string]float64, error) {
+	var value float64
+	if err := json.Unmarshal(v[name], &value); err == nil {
+		return map[string]float64{def: value}, nil
+	}
+
+	var values map[string]float64
+	if err := json.Unmarshal(v[name], &values); err != nil {
+		return nil, fmt.Errorf("parse %s failed: expected a number or an object of numbers, got %s", name, v[name])
+	}
+	return values, nil
+}
+
+// formatPoint writes values in a consistent order, for cache keys
+func formatPoint(values map[string]float64) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.FormatFloat(values[name], 'g', -1, 64)
+	}
+	return strings.Join(pairs, ";")
+}
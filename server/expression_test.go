@@ -0,0 +1,104 @@
+package server
+
+import (
+	"testing"
+)
+
+// TestParseExpression checks precedence and associativity by writing each parsed expression back out
+func TestParseExpression(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2*3", "1 + 2*3"},
+		{"(1 + 2)*3", "(1 + 2)*3"},
+		{"x - (y - z)", "x - (y - z)"},
+		{"(x - y) - z", "x - y - z"},
+		{"x / (y*z)", "x/(y*z)"},
+		{"2^3^2", "2^3^2"},
+		{"(2^3)^2", "(2^3)^2"},
+		{"-x^2", "-x^2"},
+		{"(-x)^2", "(-x)^2"},
+		{"2^-x", "2^(-x)"},
+		{"add(x, multiply(2, y))", "x + 2*y"},
+		{"log(x, 10) + sin(pi*x)", "log(x, 10) + sin(pi*x)"},
+		{"1.5e3 * .5", "1500*0.5"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.input, func(t *testing.T) {
+			n, err := parseExpression(testCase.input)
+			if err != nil {
+				t.Fatalf("parse expression failed: %s\n", err)
+			}
+
+			if n.String() != testCase.expected {
+				t.Logf("unexpected expression value: (actual %s != expected %s)\n", n, testCase.expected)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// TestParseExpressionErrors checks that malformed expressions are invalid arguments
+func TestParseExpressionErrors(t *testing.T) {
+	testCases := []struct {
+		input        string
+		expectedKind errorKind
+	}{
+		{"", kindInvalidArgument},
+		{"1 +", kindInvalidArgument},
+		{"(1 + 2", kindInvalidArgument},
+		{"1 2", kindInvalidArgument},
+		{"x $ y", kindInvalidArgument},
+		{"pow(x)", kindInvalidArgument},
+		{"gamma(x)", kindUnsupportedOperation},
+		{"factorial(x)", kindUnsupportedOperation},
+	}
+
+	for _, testCase := range testCases {
+		_, err := parseExpression(testCase.input)
+		if err == nil || kindOf(err) != testCase.expectedKind {
+			t.Logf("unexpected error for %q: (actual %v != expected %s)\n", testCase.input, err, errorCodes[testCase.expectedKind])
+			t.Fail()
+		}
+	}
+}
+
+// TestEvalExpression evaluates expressions with the same functions as supportedOperations
+func TestEvalExpression(t *testing.T) {
+	vars := map[string]float64{"x": 2, "y": 3}
+	testCases := []struct {
+		input    string
+		expected float64
+	}{
+		{"x^y - 1", 7},
+		{"mod(7, y) + root(8, 3)", 3},
+		{"-x^2", -4},
+		{"ln(e) + cos(0)", 2},
+	}
+
+	for _, testCase := range testCases {
+		n, err := parseExpression(testCase.input)
+		if err != nil {
+			t.Fatalf("parse expression failed: %s\n", err)
+		}
+
+		value, err := n.eval(vars)
+		if err != nil || value != testCase.expected {
+			t.Logf("unexpected value for %s: (actual %v %v != expected %v)\n", testCase.input, value, err, testCase.expected)
+			t.Fail()
+		}
+	}
+
+	n, _ := parseExpression("x/z")
+	if _, err := n.eval(vars); kindOf(err) != kindInvalidArgument {
+		t.Logf("unexpected error value for an unknown variable: %v\n", err)
+		t.Fail()
+	}
+	n, _ = parseExpression("1/(x - 2)")
+	if _, err := n.eval(vars); kindOf(err) != kindDomain {
+		t.Logf("unexpected error value for division by zero: %v\n", err)
+		t.Fail()
+	}
+}
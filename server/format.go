@@ -0,0 +1,295 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Formatting is purely cosmetic.  The answer is computed and cached exactly as it would be
+// otherwise, and the formatted version is added alongside it so that programs reading the answer
+// never have to parse "1.234,5" back into a number.  Only numeric answers (and lists of them) can be
+// formatted; anything else just doesn't get a formatted field
+
+// notation is how a formatted number is laid out
+type notation string
+
+const (
+	notationFixed       notation = "fixed"       // 1234.5, the default
+	notationScientific  notation = "scientific"  // 1.2345e+3
+	notationEngineering notation = "engineering" // 1.2345e+3, but with exponents in multiples of 3
+)
+
+var notations = map[notation]bool{
+	notationFixed:       true,
+	notationScientific:  true,
+	notationEngineering: true,
+}
+
+// defaultFormatFigures is how many significant figures are shown for answers that can't be written
+// exactly, like 1/3, when neither places nor sigfigs is given
+const defaultFormatFigures = 15
+
+// numberLocale holds the separators a locale writes numbers with
+type numberLocale struct {
+	decimal string
+	group   string // between each group of three integer digits
+}
+
+// numberLocales are looked up by lowercase language tag, and then by language alone, so "de-AT"
+// falls back to "de"
+var numberLocales = map[string]numberLocale{
+	"en":    {decimal: ".", group: ","},
+	"ja":    {decimal: ".", group: ","},
+	"zh":    {decimal: ".", group: ","},
+	"de":    {decimal: ",", group: "."},
+	"es":    {decimal: ",", group: "."},
+	"it":    {decimal: ",", group: "."},
+	"nl":    {decimal: ",", group: "."},
+	"pt":    {decimal: ",", group: "."},
+	"fr":    {decimal: ",", group: "\u202f"}, // narrow no-break space
+	"ru":    {decimal: ",", group: "\u00a0"}, // no-break space
+	"de-ch": {decimal: ".", group: "’"},
+}
+
+// formatOptions control the formatted field of a response.  The zero value asks for no formatting,
+// and places is only used when hasPlaces is set, since 0 places is a perfectly good request
+type formatOptions struct {
+	places    int // digits after the decimal point, or after the mantissa's point in exponent notations
+	hasPlaces bool
+	sigfigs   int
+	rounding  roundingMode
+	notation  notation
+	locale    string
+}
+
+// requested reports whether any formatting was asked for
+func (f formatOptions) requested() bool {
+	return f.hasPlaces || f.sigfigs > 0 || f.notation != "" || f.locale != ""
+}
+
+// String describes the options for ETags, which have to change when the formatted field does
+func (f formatOptions) String() string {
+	if !f.requested() {
+		return ""
+	}
+	return fmt.Sprintf("format(places=%d,sigfigs=%d,rounding=%s,notation=%s,locale=%s)", f.places, f.sigfigs, f.rounding, f.notation, f.locale)
+}
+
+// lookupLocale finds the numberLocale for a language tag like "de", "de-CH", or "de_CH"
+func lookupLocale(tag string) (numberLocale, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	if locale, ok := numberLocales[tag]; ok {
+		return locale, true
+	}
+
+	language, _, _ := strings.Cut(tag, "-")
+	locale, ok := numberLocales[language]
+	return locale, ok
+}
+
+// answer formats a response's answer, or returns nil if it isn't numeric
+func (f formatOptions) answer(answer interface{}) interface{} {
+	switch a := answer.(type) {
+	case float64:
+		if math.IsNaN(a) || math.IsInf(a, 0) {
+			return nil
+		}
+		// the shortest decimal that round trips is what the client sees in answer, so it's what we
+		// round.  Rounding the float64's exact binary value would turn 2.675 into 2.67
+		r, _ := new(big.Rat).SetString(strconv.FormatFloat(a, 'g', -1, 64))
+		return f.number(r)
+	case int:
+		return f.number(new(big.Rat).SetInt64(int64(a)))
+	case string:
+		// precise, rational, and integer answers
+		r, ok := new(big.Rat).SetString(a)
+		if !ok || strings.ContainsAny(strings.ToLower(a), "xbo") {
+			return nil
+		}
+		return f.number(r)
+	}
+
+	// vectors, matrices, lists of percentiles, and so on
+	value := reflect.ValueOf(answer)
+	if value.Kind() != reflect.Slice {
+		return nil
+	}
+	formatted := make([]interface{}, value.Len())
+	for i := range formatted {
+		formatted[i] = f.answer(value.Index(i).Interface())
+		if formatted[i] == nil {
+			return nil
+		}
+	}
+	return formatted
+}
+
+// number formats r.  The digits are decided first, as an integer mantissa and the number of them
+// after the decimal point, and then laid out according to the notation
+func (f formatOptions) number(r *big.Rat) string {
+	var mantissa *big.Int
+	var scale int
+	trim := false
+
+	switch {
+	case f.hasPlaces && f.notation == notationScientific:
+		mantissa, scale = roundFigures(r, f.places+1, f.rounding)
+	case f.hasPlaces && f.notation == notationEngineering:
+		mantissa, scale = roundEngineering(r, f.places, f.rounding)
+	case f.hasPlaces:
+		mantissa, scale = roundRat(new(big.Rat).Mul(r, pow10Rat(f.places)), f.rounding), f.places
+	case f.sigfigs > 0:
+		mantissa, scale = roundFigures(r, f.sigfigs, f.rounding)
+	default:
+		if exact, ok := terminatingScale(r); ok {
+			mantissa, scale = new(big.Int).Mul(r.Num(), new(big.Int).Quo(pow10Int(exact), r.Denom())), exact
+		} else {
+			mantissa, scale = roundFigures(r, defaultFormatFigures, f.rounding)
+			trim = true
+		}
+	}
+
+	ten := big.NewInt(10)
+	for trim && scale > 0 && new(big.Int).Rem(mantissa, ten).Sign() == 0 {
+		mantissa.Quo(mantissa, ten)
+		scale--
+	}
+
+	locale, _ := lookupLocale(f.locale)
+	if f.locale == "" {
+		locale = numberLocale{decimal: "."}
+	}
+
+	sign := ""
+	if mantissa.Sign() < 0 {
+		sign = "-"
+	}
+	digits := new(big.Int).Abs(mantissa).String()
+
+	if f.notation == notationScientific || f.notation == notationEngineering {
+		exp := 0
+		if mantissa.Sign() == 0 && scale > 0 {
+			digits = strings.Repeat("0", scale+1)
+		} else if mantissa.Sign() != 0 {
+			exp = len(digits) - 1 - scale
+		}
+		if !f.hasPlaces && f.sigfigs == 0 {
+			// without a requested precision, trailing zeros aren't significant
+			digits = strings.TrimRight(digits, "0")
+			if digits == "" {
+				digits = "0"
+			}
+		}
+
+		// the number of mantissa digits left of its point
+		whole := 1
+		if f.notation == notationEngineering {
+			whole = exp - floorDiv(exp, 3)*3 + 1
+		}
+		if len(digits) < whole {
+			digits += strings.Repeat("0", whole-len(digits))
+		}
+		return sign + layoutDigits(digits[:whole], digits[whole:], locale) + fmt.Sprintf("e%+d", exp-whole+1)
+	}
+
+	if scale <= 0 {
+		if mantissa.Sign() != 0 {
+			digits += strings.Repeat("0", -scale)
+		}
+		return sign + layoutDigits(digits, "", locale)
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + layoutDigits(digits[:len(digits)-scale], digits[len(digits)-scale:], locale)
+}
+
+// roundFigures rounds r to figures significant figures, returning the digits as an integer and the
+// number of them that belong after the decimal point (which is negative for large numbers)
+func roundFigures(r *big.Rat, figures int, mode roundingMode) (*big.Int, int) {
+	if r.Sign() == 0 {
+		return new(big.Int), figures - 1
+	}
+
+	scale := figures - 1 - decimalExponent(r)
+	mantissa := roundRat(new(big.Rat).Mul(r, pow10Rat(scale)), mode)
+	if new(big.Int).Abs(mantissa).Cmp(pow10Int(figures)) >= 0 {
+		// rounding carried into a new digit (9.99 -> 10.0)
+		mantissa.Quo(mantissa, big.NewInt(10))
+		scale--
+	}
+	return mantissa, scale
+}
+
+// roundEngineering rounds r so that its engineering mantissa has places digits after the point.
+// How many significant figures that is depends on the exponent, which rounding can change
+func roundEngineering(r *big.Rat, places int, mode roundingMode) (*big.Int, int) {
+	if r.Sign() == 0 {
+		return new(big.Int), places
+	}
+
+	exp := decimalExponent(r)
+	mantissa, scale := roundFigures(r, places+exp-floorDiv(exp, 3)*3+1, mode)
+	if carried := len(new(big.Int).Abs(mantissa).String()) - 1 - scale; carried != exp {
+		// 999.96 is 1000.0, which is written 1.0e+3, so it needs fewer figures
+		mantissa, scale = roundFigures(r, places+carried-floorDiv(carried, 3)*3+1, mode)
+	}
+	return mantissa, scale
+}
+
+// terminatingScale returns the number of decimal places r needs to be written exactly, if it can be
+func terminatingScale(r *big.Rat) (int, bool) {
+	den := new(big.Int).Set(r.Denom())
+	twos := den.TrailingZeroBits()
+	den.Rsh(den, twos)
+
+	five := big.NewInt(5)
+	fives := 0
+	rem := new(big.Int)
+	for {
+		quo, _ := new(big.Int).QuoRem(den, five, rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		den = quo
+		fives++
+	}
+	scale := int(twos)
+	if fives > scale {
+		scale = fives
+	}
+	if den.Cmp(big.NewInt(1)) != 0 || scale > maxPreciseDigits {
+		return 0, false
+	}
+
+	return scale, true
+}
+
+// layoutDigits joins the integer and fractional digits of a number with the locale's separators
+func layoutDigits(integer, fraction string, locale numberLocale) string {
+	var b strings.Builder
+	for i, digit := range integer {
+		if i > 0 && locale.group != "" && (len(integer)-i)%3 == 0 {
+			b.WriteString(locale.group)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(locale.decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// floorDiv divides, rounding toward negative infinity
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
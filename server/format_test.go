@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFormatNumber checks each notation with places, sigfigs, rounding modes, and locales
+func TestFormatNumber(t *testing.T) {
+	testCases := []struct {
+		rat      string
+		opts     formatOptions
+		expected string
+	}{
+		{"1234.5", formatOptions{}, "1234.5"},
+		{"1/3", formatOptions{}, "0.333333333333333"},
+		{"2.675", formatOptions{places: 2, hasPlaces: true, rounding: roundHalfUp}, "2.68"},
+		{"2.665", formatOptions{places: 2, hasPlaces: true, rounding: roundHalfEven}, "2.66"},
+		{"-2.661", formatOptions{places: 2, hasPlaces: true, rounding: roundFloor}, "-2.67"},
+		{"-2.669", formatOptions{places: 2, hasPlaces: true, rounding: roundCeil}, "-2.66"},
+		{"-0.001", formatOptions{places: 2, hasPlaces: true, rounding: roundHalfEven}, "0.00"},
+		{"12", formatOptions{places: 3, hasPlaces: true}, "12.000"},
+		{"123456", formatOptions{sigfigs: 2, rounding: roundHalfEven}, "120000"},
+		{"0.00012345", formatOptions{sigfigs: 3, rounding: roundHalfEven}, "0.000123"},
+		{"9.996", formatOptions{sigfigs: 3, rounding: roundHalfEven}, "10.0"},
+		{"0", formatOptions{sigfigs: 3}, "0.00"},
+		{"1234.5", formatOptions{notation: notationScientific}, "1.2345e+3"},
+		{"0.00012345", formatOptions{places: 2, hasPlaces: true, notation: notationScientific, rounding: roundHalfEven}, "1.23e-4"},
+		{"-9.99", formatOptions{sigfigs: 2, notation: notationScientific, rounding: roundHalfEven}, "-1.0e+1"},
+		{"0", formatOptions{notation: notationScientific}, "0e+0"},
+		{"12345", formatOptions{notation: notationEngineering}, "12.345e+3"},
+		{"0.00012345", formatOptions{sigfigs: 2, notation: notationEngineering, rounding: roundHalfEven}, "120e-6"},
+		{"999.96", formatOptions{places: 1, hasPlaces: true, notation: notationEngineering, rounding: roundHalfEven}, "1.0e+3"},
+		{"1234567.891", formatOptions{places: 2, hasPlaces: true, locale: "en", rounding: roundHalfEven}, "1,234,567.89"},
+		{"1234567.891", formatOptions{places: 2, hasPlaces: true, locale: "de-AT", rounding: roundHalfEven}, "1.234.567,89"},
+		{"-1234.5", formatOptions{locale: "fr"}, "-1 234,5"},
+		{"1234.5", formatOptions{locale: "de_CH"}, "1’234.5"},
+	}
+
+	for _, testCase := range testCases {
+		r, _ := new(big.Rat).SetString(testCase.rat)
+		actual := testCase.opts.number(r)
+		if actual != testCase.expected {
+			t.Logf("unexpected formatted value for %s %+v: (actual %q != expected %q)\n", testCase.rat, testCase.opts, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestFormattedResponse checks that formatted only shows up when it's asked for and leaves answer
+// alone when it does
+func TestFormattedResponse(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		target            string
+		expectedAnswer    interface{}
+		expectedFormatted interface{}
+	}{
+		{"/divide?x=2&y=3", 2.0 / 3.0, nil},
+		{"/divide?x=2&y=3&places=3", 2.0 / 3.0, "0.667"},
+		{"/divide?x=2&y=3&places=0", 2.0 / 3.0, "1"},
+		{"/divide?x=2&y=3&places=3&rounding=floor", 2.0 / 3.0, "0.666"},
+		{"/divide?x=2&y=3&mode=rational&sigfigs=2", "2/3", "0.67"},
+		{"/multiply?x=1234&y=1000&locale=de&notation=fixed", 1234000.0, "1.234.000"},
+		{"/multiply?x=1234&y=1000&notation=engineering", 1234000.0, "1.234e+6"},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+testCase.target, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if mathRes.Answer != testCase.expectedAnswer {
+			t.Logf("unexpected answer for %s: (actual %v != expected %v)\n", testCase.target, mathRes.Answer, testCase.expectedAnswer)
+			t.Fail()
+		}
+		if mathRes.Formatted != testCase.expectedFormatted {
+			t.Logf("unexpected formatted value for %s: (actual %v != expected %v)\n", testCase.target, mathRes.Formatted, testCase.expectedFormatted)
+			t.Fail()
+		}
+	}
+
+	// lists are formatted element by element
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/percentile?places=1", strings.NewReader(`{"data": [1, 2, 3, 4], "p": [25, 50]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	var mathRes MathOKResponse
+	err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+	expected := []interface{}{"1.8", "2.5"}
+	if !reflect.DeepEqual(mathRes.Formatted, expected) {
+		t.Logf("unexpected formatted value: (actual %v != expected %v)\n", mathRes.Formatted, expected)
+		t.Fail()
+	}
+}
+
+// TestFormatOptionErrors checks that bad formatting options are rejected before anything is computed
+func TestFormatOptionErrors(t *testing.T) {
+	targets := []string{
+		"/add?x=1&y=2&places=-1",
+		"/add?x=1&y=2&sigfigs=0",
+		"/add?x=1&y=2&places=2&sigfigs=3",
+		"/add?x=1&y=2&notation=roman",
+		"/add?x=1&y=2&locale=tlh",
+		"/convert/base?value=1&to=2&places=-1",
+	}
+
+	for _, target := range targets {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+target, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		if resRecorder.Code != http.StatusBadRequest {
+			t.Logf("unexpected status for %s: (actual %d != expected %d)\n", target, resRecorder.Code, http.StatusBadRequest)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,534 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+// /graphql serves the same operations as mathHandler to clients that would rather write one query
+// than make several requests.  compute and batch go through computeRequest, so they share the
+// evaluation core and the cache with every other endpoint.  operations describes what's in
+// supportedOperations, and admin has the cache's vital signs
+
+// graphqlSchemaText is the schema behind /graphql.  Operands and answers take whatever shape the
+// operation uses (numbers, strings, arrays, objects), so they're all the JSON scalar
+const graphqlSchemaText = `
+schema {
+	query: Query
+}
+
+# JSON is any JSON value, the same as an operand or answer in a JSON request or response.
+# Integer literals in a query are limited to 32 bits, so bigger ones need to be written as
+# floats (3000000000.0) or passed in variables
+scalar JSON
+
+type Query {
+	# compute evaluates a single operation.  Operations that don't take x and y read their
+	# operands from args, like {"n": 12}
+	compute(op: String!, x: JSON, y: JSON, args: JSON, options: Options): Result!
+
+	# batch evaluates every request, reporting failures in each result's error rather than
+	# failing the query
+	batch(requests: [ComputeInput!]!): [Result!]!
+
+	# operations lists the registered operations by name
+	operations: [Operation!]!
+
+	# operation describes a single operation, or is null if there's no such operation
+	operation(name: String!): Operation
+
+	admin: Admin!
+}
+
+# Options are the settings mathHandler reads from the query string
+input Options {
+	mode: String
+	precision: Int
+	rounding: String
+	decimal: Boolean
+	places: Int
+	sigfigs: Int
+	notation: String
+	locale: String
+	cacheControl: String
+}
+
+input ComputeInput {
+	id: String
+	op: String!
+	x: JSON
+	y: JSON
+	args: JSON
+	options: Options
+}
+
+type Result {
+	id: String
+	action: String!
+	mode: String
+	x: JSON
+	y: JSON
+	args: JSON
+	answer: JSON
+	decimal: String
+	formatted: JSON
+	cached: Boolean!
+	source: String
+	error: Error
+}
+
+type Error {
+	code: String!
+	message: String!
+	details: JSON
+}
+
+type Operation {
+	name: String!
+	description: String!
+	arity: Int!
+	params: [String!]!
+	optional: [String!]!
+	cache: CachePolicy!
+}
+
+type CachePolicy {
+	cacheable: Boolean!
+	expirationSeconds: Float!
+	sliding: Boolean!
+}
+
+type Admin {
+	cacheStats: CacheStats!
+}
+
+# CacheStats counts are totals since the server started
+type CacheStats {
+	items: Int!
+	hits: Float!
+	misses: Float!
+	sets: Float!
+	evictions: Float!
+	inFlight: Int!
+}
+`
+
+// maxGraphQLBodyBytes limits the size of a GraphQL request body
+const maxGraphQLBodyBytes = 1 << 20
+
+// maxGraphQLDepth keeps queries from nesting any deeper than the schema needs
+const maxGraphQLDepth = 10
+
+// graphqlSchema is graphqlSchemaText bound to its resolvers
+var graphqlSchema = graphql.MustParseSchema(graphqlSchemaText, &graphqlResolver{},
+	graphql.MaxDepth(maxGraphQLDepth),
+	graphql.UseFieldResolvers(),
+	graphql.PanicHandler(graphqlPanicHandler{}),
+)
+
+// graphqlRequest is the body of a POST to /graphql, and the query string of a GET
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlHandler serves /graphql.  Queries can be POSTed as JSON or sent as GET parameters, with the
+// variables as a JSON object
+func graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if r.Body == nil {
+			return
+		}
+		err := r.Body.Close()
+		if err != nil {
+			log.Printf("req body close failed: %s\n", err)
+		}
+	}()
+
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &req.Variables)
+			if err != nil {
+				writeErrorResponse(w, newMathError(kindInvalidArgument, "variables must be a JSON object: %s", err))
+				return
+			}
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGraphQLBodyBytes))
+		if err != nil {
+			writeErrorResponse(w, newMathError(kindInvalidArgument, "read request failed: %s", err))
+			return
+		}
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			writeErrorResponse(w, newMathError(kindInvalidArgument, "json decode failed: %s", err))
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeErrorResponse(w, newMathError(kindInvalidArgument, "graphql queries must be sent with GET or POST"))
+		return
+	}
+
+	res := graphqlSchema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	resBytes, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("graphqlHandler: json marshal failed: %s\n", err)
+		writeErrorResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resBytes)
+	if err != nil {
+		log.Printf("response write failed: %s\n", err)
+	}
+}
+
+// graphqlPanicHandler turns panics into query errors with the same extensions as graphqlError.
+// graphql-go parses integer literals as 32 bit Ints, even for the JSON scalar, and panics on bigger
+// ones before UnmarshalGraphQL ever sees them.  Those get an invalid_argument error saying how to
+// write them instead, since floats and variables don't have the limit
+type graphqlPanicHandler struct{}
+
+func (graphqlPanicHandler) MakePanicError(ctx context.Context, value interface{}) *gqlerrors.QueryError {
+	var err error
+	if numErr, ok := value.(*strconv.NumError); ok && numErr.Func == "ParseInt" && numErr.Err == strconv.ErrRange {
+		err = newMathError(kindInvalidArgument, "integer literal %s is out of range, write it as %s.0 or pass it in a variable", numErr.Num, numErr.Num)
+	} else {
+		err = panicError(value)
+	}
+
+	queryErr := gqlerrors.Errorf("%s", err)
+	queryErr.Extensions = graphqlError{err}.Extensions()
+	return queryErr
+}
+
+// jsonScalar is the JSON scalar.  value is whatever encoding/json would decode the JSON into
+type jsonScalar struct {
+	value interface{}
+}
+
+func (jsonScalar) ImplementsGraphQLType(name string) bool {
+	return name == "JSON"
+}
+
+func (j *jsonScalar) UnmarshalGraphQL(input interface{}) error {
+	j.value = input
+	return nil
+}
+
+func (j jsonScalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.value)
+}
+
+// newJSONScalar wraps v, leaving nil as a null field
+func newJSONScalar(v interface{}) *jsonScalar {
+	if v == nil {
+		return nil
+	}
+	return &jsonScalar{value: v}
+}
+
+// graphqlOptions are the Options input type
+type graphqlOptions struct {
+	Mode         *string
+	Precision    *int32
+	Rounding     *string
+	Decimal      *bool
+	Places       *int32
+	Sigfigs      *int32
+	Notation     *string
+	Locale       *string
+	CacheControl *string
+}
+
+// settings converts the options to computeRequest's query parameter names
+func (o *graphqlOptions) settings() map[string]string {
+	settings := make(map[string]string)
+	if o == nil {
+		return settings
+	}
+
+	strs := map[string]*string{
+		"mode":          o.Mode,
+		"rounding":      o.Rounding,
+		"notation":      o.Notation,
+		"locale":        o.Locale,
+		"cache-control": o.CacheControl,
+	}
+	for name, value := range strs {
+		if value != nil {
+			settings[name] = *value
+		}
+	}
+
+	ints := map[string]*int32{
+		"precision": o.Precision,
+		"places":    o.Places,
+		"sigfigs":   o.Sigfigs,
+	}
+	for name, value := range ints {
+		if value != nil {
+			settings[name] = strconv.FormatInt(int64(*value), 10)
+		}
+	}
+
+	if o.Decimal != nil && *o.Decimal {
+		settings["decimal"] = "true"
+	}
+	return settings
+}
+
+// graphqlComputeInput is the ComputeInput input type, and the arguments to compute
+type graphqlComputeInput struct {
+	ID      *string
+	Op      string
+	X       *jsonScalar
+	Y       *jsonScalar
+	Args    *jsonScalar
+	Options *graphqlOptions
+}
+
+// vars converts the operands to clientVars.  x and y take precedence over args
+func (in graphqlComputeInput) vars() (clientVars, error) {
+	vars := make(clientVars)
+	if in.Args != nil {
+		args, ok := in.Args.value.(map[string]interface{})
+		if !ok {
+			return nil, newMathError(kindInvalidArgument, "args must be an object")
+		}
+		for name, value := range args {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return nil, newMathError(kindInvalidArgument, "encode %s failed: %s", name, err)
+			}
+			vars[name] = raw
+		}
+	}
+
+	operands := map[string]*jsonScalar{"x": in.X, "y": in.Y}
+	for name, operand := range operands {
+		if operand == nil {
+			continue
+		}
+		raw, err := json.Marshal(operand)
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "encode %s failed: %s", name, err)
+		}
+		vars[name] = raw
+	}
+
+	return vars, nil
+}
+
+// run evaluates the input with computeRequest
+func (in graphqlComputeInput) run() (*graphqlResult, error) {
+	vars, err := in.vars()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := computeRequest{op: in.Op, vars: vars, options: in.Options.settings()}.run()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &graphqlResult{
+		ID:        in.ID,
+		Action:    res.Action,
+		Mode:      &res.Mode,
+		X:         newJSONScalar(res.X),
+		Y:         newJSONScalar(res.Y),
+		Answer:    newJSONScalar(res.Answer),
+		Formatted: newJSONScalar(res.Formatted),
+		Cached:    res.Cached,
+		Source:    &res.Source,
+	}
+	if res.Args != nil {
+		result.Args = newJSONScalar(res.Args)
+	}
+	if res.Decimal != "" {
+		result.Decimal = &res.Decimal
+	}
+	return result, nil
+}
+
+// graphqlResult is the Result type
+type graphqlResult struct {
+	ID        *string
+	Action    string
+	Mode      *string
+	X         *jsonScalar
+	Y         *jsonScalar
+	Args      *jsonScalar
+	Answer    *jsonScalar
+	Decimal   *string
+	Formatted *jsonScalar
+	Cached    bool
+	Source    *string
+	Error     *graphqlErrorResult
+}
+
+// graphqlErrorResult is the Error type, which reports a failure in a batch
+type graphqlErrorResult struct {
+	Code    string
+	Message string
+	Details *jsonScalar
+}
+
+// graphqlError is a failed compute query.  Its extensions have the same code and details as an
+// HTTP error response
+type graphqlError struct {
+	err error
+}
+
+func (e graphqlError) Error() string {
+	return e.err.Error()
+}
+
+func (e graphqlError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": errorCodes[kindOf(e.err)]}
+	if details := detailsOf(e.err); details != nil {
+		extensions["details"] = details
+	}
+	return extensions
+}
+
+// graphqlOperation is the Operation type
+type graphqlOperation struct {
+	name      string
+	operation *operation
+}
+
+func (o graphqlOperation) Name() string        { return o.name }
+func (o graphqlOperation) Description() string { return o.operation.description }
+func (o graphqlOperation) Arity() int32        { return int32(len(o.operation.params)) }
+func (o graphqlOperation) Params() []string    { return append([]string{}, o.operation.params...) }
+func (o graphqlOperation) Optional() []string  { return append([]string{}, o.operation.optional...) }
+
+func (o graphqlOperation) Cache() graphqlCachePolicy {
+	return graphqlCachePolicy{o.operation.cache}
+}
+
+// graphqlCachePolicy is the CachePolicy type
+type graphqlCachePolicy struct {
+	policy cachePolicy
+}
+
+func (p graphqlCachePolicy) Cacheable() bool            { return p.policy.cacheable }
+func (p graphqlCachePolicy) ExpirationSeconds() float64 { return p.policy.expiration.Seconds() }
+func (p graphqlCachePolicy) Sliding() bool              { return p.policy.sliding }
+
+// graphqlCacheStats is the CacheStats type.  GraphQL's Int is only 32 bits, so the running totals
+// are Floats, which are exact well past anything a counter will reach
+type graphqlCacheStats struct {
+	stats CacheStats
+}
+
+func (s graphqlCacheStats) Items() int32       { return clampInt32(s.stats.Items) }
+func (s graphqlCacheStats) Hits() float64      { return float64(s.stats.Hits) }
+func (s graphqlCacheStats) Misses() float64    { return float64(s.stats.Misses) }
+func (s graphqlCacheStats) Sets() float64      { return float64(s.stats.Sets) }
+func (s graphqlCacheStats) Evictions() float64 { return float64(s.stats.Evictions) }
+func (s graphqlCacheStats) InFlight() int32    { return clampInt32(s.stats.InFlight) }
+
+// graphqlAdmin is the Admin type
+type graphqlAdmin struct{}
+
+func (graphqlAdmin) CacheStats() graphqlCacheStats {
+	return graphqlCacheStats{readCacheStats()}
+}
+
+// graphqlResolver resolves the Query type
+type graphqlResolver struct{}
+
+func (*graphqlResolver) Compute(args graphqlComputeInput) (*graphqlResult, error) {
+	res, err := args.run()
+	if err != nil {
+		log.Printf("graphql compute %s failed: %s\n", args.Op, err)
+		return nil, graphqlError{err}
+	}
+	return res, nil
+}
+
+func (*graphqlResolver) Batch(ctx context.Context, args struct{ Requests []graphqlComputeInput }) ([]*graphqlResult, error) {
+	if len(args.Requests) > maxBatchRequests {
+		return nil, graphqlError{newMathError(kindLimitExceeded, "batches are limited to %d requests", maxBatchRequests)}
+	}
+
+	results := make([]*graphqlResult, len(args.Requests))
+	for i, in := range args.Requests {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		res, err := in.run()
+		if err != nil {
+			log.Printf("graphql batch %s failed: %s\n", in.Op, err)
+			res = &graphqlResult{
+				ID:     in.ID,
+				Action: in.Op,
+				Error: &graphqlErrorResult{
+					Code:    errorCodes[kindOf(err)],
+					Message: err.Error(),
+				},
+			}
+			if details := detailsOf(err); details != nil {
+				res.Error.Details = newJSONScalar(details)
+			}
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+func (*graphqlResolver) Operations() []graphqlOperation {
+	names := make([]string, 0, len(supportedOperations))
+	for name := range supportedOperations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	operations := make([]graphqlOperation, len(names))
+	for i, name := range names {
+		operations[i] = graphqlOperation{name, supportedOperations[name]}
+	}
+	return operations
+}
+
+func (*graphqlResolver) Operation(args struct{ Name string }) *graphqlOperation {
+	operation := supportedOperations[args.Name]
+	if operation == nil {
+		return nil
+	}
+	return &graphqlOperation{args.Name, operation}
+}
+
+func (*graphqlResolver) Admin() graphqlAdmin {
+	return graphqlAdmin{}
+}
+
+// clampInt32 converts n to an int32, saturating rather than wrapping
+func clampInt32(n int) int32 {
+	if n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int32(n)
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postGraphQL sends query and variables to /graphql and returns the response recorder
+func postGraphQL(t *testing.T, query string, variables map[string]interface{}) *httptest.ResponseRecorder {
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		t.Fatalf("json encode failed: %s\n", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+	return resRecorder
+}
+
+// TestGraphQLSchema checks the schema's query fields by introspection, so that changes to the
+// schema that clients would notice don't go unnoticed here
+func TestGraphQLSchema(t *testing.T) {
+	resRecorder := postGraphQL(t, `{ __schema { queryType { fields { name args { name type { kind name ofType { name } } } } } } }`, nil)
+	expected := `{"data":{"__schema":{"queryType":{"fields":[` +
+		`{"name":"compute","args":[{"name":"op","type":{"kind":"NON_NULL","name":null,"ofType":{"name":"String"}}},{"name":"x","type":{"kind":"SCALAR","name":"JSON","ofType":null}},{"name":"y","type":{"kind":"SCALAR","name":"JSON","ofType":null}},{"name":"args","type":{"kind":"SCALAR","name":"JSON","ofType":null}},{"name":"options","type":{"kind":"INPUT_OBJECT","name":"Options","ofType":null}}]},` +
+		`{"name":"batch","args":[{"name":"requests","type":{"kind":"NON_NULL","name":null,"ofType":{"name":null}}}]},` +
+		`{"name":"operations","args":[]},` +
+		`{"name":"operation","args":[{"name":"name","type":{"kind":"NON_NULL","name":null,"ofType":{"name":"String"}}}]},` +
+		`{"name":"admin","args":[]}` +
+		`]}}}}`
+
+	actual := strings.TrimSpace(resRecorder.Body.String())
+	if actual != expected {
+		t.Logf("unexpected schema: (actual %s != expected %s)\n", actual, expected)
+		t.Fail()
+	}
+
+	t.Run("types", func(t *testing.T) {
+		for _, name := range []string{"JSON", "Options", "ComputeInput", "Result", "Error", "Operation", "CachePolicy", "Admin", "CacheStats"} {
+			resRecorder := postGraphQL(t, `query($name: String!) { __type(name: $name) { name } }`, map[string]interface{}{"name": name})
+			expected := `{"data":{"__type":{"name":"` + name + `"}}}`
+			actual := strings.TrimSpace(resRecorder.Body.String())
+			if actual != expected {
+				t.Logf("unexpected type: (actual %s != expected %s)\n", actual, expected)
+				t.Fail()
+			}
+		}
+	})
+}
+
+// TestGraphQLCompute checks answers, options, and errors for the compute query
+func TestGraphQLCompute(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		query     string
+		variables map[string]interface{}
+		expected  string
+	}{
+		{`{ compute(op: "add", x: 1, y: 2) { action mode x y answer cached source } }`, nil, `{"data":{"compute":{"action":"add","mode":"float","x":1,"y":2,"answer":3,"cached":false,"source":"computed"}}}`},
+		{`{ compute(op: "divide", x: 1, y: 3, options: {mode: "rational", decimal: true}) { answer decimal } }`, nil, `{"data":{"compute":{"answer":"1/3","decimal":"0.(3)"}}}`},
+		{`{ compute(op: "divide", x: 2, y: 3, options: {places: 2}) { formatted } }`, nil, `{"data":{"compute":{"formatted":"0.67"}}}`},
+		{`{ compute(op: "factor", args: {n: 12}) { args answer } }`, nil, `{"data":{"compute":{"args":{"n":"12"},"answer":["2","2","3"]}}}`},
+		{`query($data: JSON) { compute(op: "mean", args: $data) { answer } }`, map[string]interface{}{"data": map[string]interface{}{"data": []int{1, 2, 3, 4}}}, `{"data":{"compute":{"answer":2.5}}}`},
+		{`{ compute(op: "convert/base", args: {value: "255", to: 16}) { answer } }`, nil, `{"data":{"compute":{"answer":"ff"}}}`},
+		{`{ compute(op: "nope", x: 1, y: 2) { answer } }`, nil, `{"errors":[{"message":"unsupported operation request: \"nope\"","path":["compute"],"extensions":{"code":"unsupported_operation"}}],"data":null}`},
+		{`{ compute(op: "factorial", args: {n: -1}) { answer } }`, nil, `{"errors":[{"message":"factorial of a negative number","path":["compute"],"extensions":{"code":"domain_error"}}],"data":null}`},
+		{`{ compute(op: "pow", x: 2, y: 8, options: {cacheControl: "only-if-cached"}) { answer } }`, nil, `{"errors":[{"message":"answer not cached: \"pow\"","path":["compute"],"extensions":{"code":"not_cached"}}],"data":null}`},
+		{`{ compute(op: "divide", x: 1, y: 0) { answer } }`, nil, `{"errors":[{"message":"answer is not finite","path":["compute"],"extensions":{"code":"domain_error"}}],"data":null}`},
+		{`{ compute(op: "add", x: 3000000000, y: 2) { answer } }`, nil, `{"errors":[{"message":"integer literal 3000000000 is out of range, write it as 3000000000.0 or pass it in a variable","extensions":{"code":"invalid_argument"}}]}`},
+		{`{ compute(op: "add", x: 3000000000.0, y: 2) { answer } }`, nil, `{"data":{"compute":{"answer":3000000002}}}`},
+		{`query($x: JSON) { compute(op: "add", x: $x, y: 2) { answer } }`, map[string]interface{}{"x": 3000000000}, `{"data":{"compute":{"answer":3000000002}}}`},
+		{`{ compute(op: "add", args: [1, 2]) { answer } }`, nil, `{"errors":[{"message":"args must be an object","path":["compute"],"extensions":{"code":"invalid_argument"}}],"data":null}`},
+	}
+
+	for _, testCase := range testCases {
+		resRecorder := postGraphQL(t, testCase.query, testCase.variables)
+		if resRecorder.Code != http.StatusOK {
+			t.Logf("unexpected status for %s: (actual %d != expected %d)\n", testCase.query, resRecorder.Code, http.StatusOK)
+			t.Fail()
+		}
+
+		actual := strings.TrimSpace(resRecorder.Body.String())
+		if actual != testCase.expected {
+			t.Logf("unexpected response for %s: (actual %s != expected %s)\n", testCase.query, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		query := url.Values{"query": {`{ compute(op: "multiply", x: 6, y: 7) { answer } }`}}
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/graphql?"+query.Encode(), nil)
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		expected := `{"data":{"compute":{"answer":42}}}`
+		actual := strings.TrimSpace(resRecorder.Body.String())
+		if actual != expected {
+			t.Logf("unexpected response: (actual %s != expected %s)\n", actual, expected)
+			t.Fail()
+		}
+	})
+}
+
+// TestGraphQLBatch checks that a failed request in a batch doesn't fail the others
+func TestGraphQLBatch(t *testing.T) {
+	query := `{ batch(requests: [
+		{id: "a", op: "add", x: 1, y: 2},
+		{id: "b", op: "gcd", x: 1.5, y: 2},
+		{id: "c", op: "divide", x: 1, y: 4, options: {mode: "precise"}},
+		{id: "d", op: "divide", x: 1, y: 0}
+	]) { id answer error { code } } }`
+	resRecorder := postGraphQL(t, query, nil)
+
+	expected := `{"data":{"batch":[` +
+		`{"id":"a","answer":3,"error":null},` +
+		`{"id":"b","answer":null,"error":{"code":"invalid_argument"}},` +
+		`{"id":"c","answer":"0.25","error":null},` +
+		`{"id":"d","answer":null,"error":{"code":"domain_error"}}` +
+		`]}}`
+	actual := strings.TrimSpace(resRecorder.Body.String())
+	if actual != expected {
+		t.Logf("unexpected response: (actual %s != expected %s)\n", actual, expected)
+		t.Fail()
+	}
+}
+
+// TestGraphQLOperations checks that every registered operation is listed with its arity and a
+// description
+func TestGraphQLOperations(t *testing.T) {
+	resRecorder := postGraphQL(t, `{ operations { name description arity params } }`, nil)
+
+	var res struct {
+		Data struct {
+			Operations []struct {
+				Name        string
+				Description string
+				Arity       int
+				Params      []string
+			}
+		}
+	}
+	err := json.NewDecoder(resRecorder.Body).Decode(&res)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+
+	operations := res.Data.Operations
+	if len(operations) != len(supportedOperations) {
+		t.Logf("unexpected operation count: (actual %d != expected %d)\n", len(operations), len(supportedOperations))
+		t.Fail()
+	}
+	for i, op := range operations {
+		if i > 0 && operations[i-1].Name >= op.Name {
+			t.Logf("operations out of order: %s before %s\n", operations[i-1].Name, op.Name)
+			t.Fail()
+		}
+
+		operation := supportedOperations[op.Name]
+		if operation == nil {
+			t.Logf("unexpected operation: %s\n", op.Name)
+			t.Fail()
+			continue
+		}
+		if op.Arity != len(operation.params) || len(op.Params) != op.Arity {
+			t.Logf("unexpected arity for %s: (actual %d != expected %d)\n", op.Name, op.Arity, len(operation.params))
+			t.Fail()
+		}
+		if op.Description == "" {
+			t.Logf("missing description for %s\n", op.Name)
+			t.Fail()
+		}
+	}
+
+	t.Run("single", func(t *testing.T) {
+		resRecorder := postGraphQL(t, `{ pow: operation(name: "pow") { arity cache { cacheable expirationSeconds sliding } } nope: operation(name: "nope") { arity } }`, nil)
+		expected := `{"data":{"pow":{"arity":2,"cache":{"cacheable":true,"expirationSeconds":60,"sliding":false}},"nope":null}}`
+		actual := strings.TrimSpace(resRecorder.Body.String())
+		if actual != expected {
+			t.Logf("unexpected response: (actual %s != expected %s)\n", actual, expected)
+			t.Fail()
+		}
+	})
+}
+
+// TestGraphQLCacheStats checks that the cache counters follow a miss and then a hit
+func TestGraphQLCacheStats(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	type stats struct {
+		Items, Hits, Misses, Sets, InFlight float64
+	}
+	readStats := func() stats {
+		resRecorder := postGraphQL(t, `{ admin { cacheStats { items hits misses sets inFlight } } }`, nil)
+		var res struct {
+			Data struct {
+				Admin struct {
+					CacheStats stats
+				}
+			}
+		}
+		err := json.NewDecoder(resRecorder.Body).Decode(&res)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+		return res.Data.Admin.CacheStats
+	}
+
+	before := readStats()
+	for i := 0; i < 2; i++ {
+		postGraphQL(t, `{ compute(op: "pow", x: 3, y: 4) { answer } }`, nil)
+	}
+	after := readStats()
+
+	expected := stats{
+		Items:    1,
+		Hits:     before.Hits + 1,
+		Misses:   before.Misses + 1,
+		Sets:     before.Sets + 1,
+		InFlight: 0,
+	}
+	if after != expected {
+		t.Logf("unexpected cache stats: (actual %+v != expected %+v)\n", after, expected)
+		t.Fail()
+	}
+}
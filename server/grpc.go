@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"math-serv/server/mathpb"
+)
+
+// The gRPC service (see mathpb/math.proto) is a thin layer over computeRequest, so it shares the
+// operation registry, the cache, and in-flight coalescing with the HTTP router.  Variables and
+// answers go through JSON on the way in and out, which keeps every operation's parsing in one place
+
+// maxBatchRequests limits the number of requests in a single Batch call
+const maxBatchRequests = 1000
+
+// mathService implements mathpb.MathServer
+type mathService struct {
+	mathpb.UnimplementedMathServer
+}
+
+// NewGRPCServer returns a gRPC server with the math service registered on it.  Panics in a call are
+// recovered and reported as codes.Internal rather than crashing the server
+func NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(recoverUnary), grpc.ChainStreamInterceptor(recoverStream))
+	srv := grpc.NewServer(opts...)
+	mathpb.RegisterMathServer(srv, &mathService{})
+	return srv
+}
+
+// recoverUnary ends a unary call that panics with codes.Internal
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			res, err = nil, grpcStatus(panicError(recovered))
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream ends a streaming call that panics with codes.Internal
+func recoverStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = grpcStatus(panicError(recovered))
+		}
+	}()
+	return handler(srv, stream)
+}
+
+func (s *mathService) Compute(ctx context.Context, req *mathpb.ComputeRequest) (*mathpb.ComputeResponse, error) {
+	res, err := computeProto(req)
+	if err != nil {
+		log.Printf("grpc compute %s failed: %s\n", req.GetOp(), err)
+		return nil, grpcStatus(err)
+	}
+	return res, nil
+}
+
+func (s *mathService) Batch(ctx context.Context, req *mathpb.BatchRequest) (*mathpb.BatchResponse, error) {
+	if len(req.GetRequests()) > maxBatchRequests {
+		return nil, grpcStatus(newMathError(kindLimitExceeded, "batches are limited to %d requests", maxBatchRequests))
+	}
+
+	responses := make([]*mathpb.ComputeResponse, len(req.GetRequests()))
+	for i, computeReq := range req.GetRequests() {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		responses[i] = computeProtoOrError(computeReq)
+	}
+
+	return &mathpb.BatchResponse{Responses: responses}, nil
+}
+
+func (s *mathService) ComputeStream(stream mathpb.Math_ComputeStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(computeProtoOrError(req))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// computeProtoOrError is computeProto with any error reported in the response, for calls where one
+// failure shouldn't end the whole call
+func computeProtoOrError(req *mathpb.ComputeRequest) *mathpb.ComputeResponse {
+	res, err := computeProto(req)
+	if err != nil {
+		log.Printf("grpc compute %s failed: %s\n", req.GetOp(), err)
+		return &mathpb.ComputeResponse{
+			Id:    req.GetId(),
+			Error: errorProto(err),
+		}
+	}
+	return res
+}
+
+// computeProto evaluates a single request and converts the answer to its protobuf equivalent
+func computeProto(req *mathpb.ComputeRequest) (*mathpb.ComputeResponse, error) {
+	vars := make(clientVars, len(req.GetArgs().GetFields()))
+	for name, value := range req.GetArgs().GetFields() {
+		raw, err := protojson.Marshal(value)
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "encode %s failed: %s", name, err)
+		}
+		vars[name] = raw
+	}
+
+	mathRes, err := computeRequest{op: req.GetOp(), vars: vars, options: req.GetOptions()}.run()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &mathpb.ComputeResponse{
+		Id:      req.GetId(),
+		Action:  mathRes.Action,
+		Mode:    mathRes.Mode,
+		Decimal: mathRes.Decimal,
+		Cached:  mathRes.Cached,
+		Source:  mathRes.Source,
+	}
+	res.X, err = protoValue(mathRes.X)
+	if err != nil {
+		return nil, err
+	}
+	res.Y, err = protoValue(mathRes.Y)
+	if err != nil {
+		return nil, err
+	}
+	res.Answer, err = protoValue(mathRes.Answer)
+	if err != nil {
+		return nil, err
+	}
+	res.Formatted, err = protoValue(mathRes.Formatted)
+	if err != nil {
+		return nil, err
+	}
+	if mathRes.Args != nil {
+		res.Args, err = protoStruct(mathRes.Args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// protoValue converts anything that can be marshalled to JSON into a structpb.Value.  nil stays
+// nil, so that unset fields are left out of the response like they are in JSON
+func protoValue(v interface{}) (*structpb.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "json marshal failed")
+	}
+
+	value := new(structpb.Value)
+	err = protojson.Unmarshal(b, value)
+	if err != nil {
+		return nil, errors.Wrap(err, "protojson unmarshal failed")
+	}
+
+	return value, nil
+}
+
+// protoStruct is protoValue for JSON objects
+func protoStruct(m map[string]interface{}) (*structpb.Struct, error) {
+	value, err := protoValue(m)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return value.GetStructValue(), nil
+}
+
+// errorProto describes err the same way a MathErrorResponse would
+func errorProto(err error) *mathpb.Error {
+	details, detailsErr := protoStruct(detailsOf(err))
+	if detailsErr != nil {
+		log.Printf("encode error details failed: %s\n", detailsErr)
+	}
+
+	return &mathpb.Error{
+		Code:    errorCodes[kindOf(err)],
+		Message: err.Error(),
+		Details: details,
+	}
+}
+
+// grpcStatus converts err to a gRPC status error, with its errorProto attached as a detail
+func grpcStatus(err error) error {
+	st := status.New(errorGRPCCodes[kindOf(err)], err.Error())
+	withDetails, detailsErr := st.WithDetails(errorProto(err))
+	if detailsErr != nil {
+		log.Printf("attach error details failed: %s\n", detailsErr)
+		return st.Err()
+	}
+	return withDetails.Err()
+}
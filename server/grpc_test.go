@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"math-serv/server/mathpb"
+)
+
+// newTestGRPCClient serves the math service over an in-memory connection and returns a client for it
+func newTestGRPCClient(t *testing.T) mathpb.MathClient {
+	listener := bufconn.Listen(1 << 20)
+	srv := NewGRPCServer()
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc dial failed: %s\n", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return mathpb.NewMathClient(conn)
+}
+
+func computeRequestProto(t *testing.T, id, op string, args map[string]interface{}, options map[string]string) *mathpb.ComputeRequest {
+	argStruct, err := structpb.NewStruct(args)
+	if err != nil {
+		t.Fatalf("build args failed: %s\n", err)
+	}
+	return &mathpb.ComputeRequest{Id: id, Op: op, Args: argStruct, Options: options}
+}
+
+// TestGRPCCompute checks answers, options, and error statuses for single requests
+func TestGRPCCompute(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+	client := newTestGRPCClient(t)
+
+	res, err := client.Compute(context.Background(), computeRequestProto(t, "a", "divide", map[string]interface{}{"x": 1, "y": 3}, map[string]string{"mode": "rational", "decimal": "true"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	if res.GetId() != "a" || res.GetAnswer().GetStringValue() != "1/3" || res.GetDecimal() != "0.(3)" || res.GetMode() != string(modeRational) {
+		t.Logf("unexpected response: %v\n", res)
+		t.Fail()
+	}
+
+	// answers and args from operations that don't take x and y
+	res, err = client.Compute(context.Background(), computeRequestProto(t, "", "factor", map[string]interface{}{"n": 12}, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	factors := res.GetAnswer().GetListValue().AsSlice()
+	if len(factors) != 3 || factors[2] != "3" || res.GetArgs().AsMap()["n"] != "12" || res.GetX() != nil {
+		t.Logf("unexpected response: %v\n", res)
+		t.Fail()
+	}
+
+	testCases := []struct {
+		req          *mathpb.ComputeRequest
+		expectedCode codes.Code
+		expectedKind string
+	}{
+		{computeRequestProto(t, "", "nope", nil, nil), codes.Unimplemented, "unsupported_operation"},
+		{computeRequestProto(t, "", "add", map[string]interface{}{"x": 1}, nil), codes.InvalidArgument, "invalid_argument"},
+		{computeRequestProto(t, "", "factorial", map[string]interface{}{"n": -1}, nil), codes.OutOfRange, "domain_error"},
+		{computeRequestProto(t, "", "factorial", map[string]interface{}{"n": 1e9}, nil), codes.ResourceExhausted, "limit_exceeded"},
+		{computeRequestProto(t, "", "add", map[string]interface{}{"x": 1, "y": 2}, map[string]string{"cache-control": "only-if-cached"}), codes.FailedPrecondition, "not_cached"},
+		{computeRequestProto(t, "", "add", map[string]interface{}{"x": 1, "y": 2}, map[string]string{"mode": "roman"}), codes.InvalidArgument, "invalid_argument"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := client.Compute(context.Background(), testCase.req)
+		st := status.Convert(err)
+		if st.Code() != testCase.expectedCode {
+			t.Logf("unexpected code for %s %v: (actual %s != expected %s)\n", testCase.req.GetOp(), testCase.req.GetArgs(), st.Code(), testCase.expectedCode)
+			t.Fail()
+			continue
+		}
+
+		details := st.Details()
+		if len(details) != 1 || details[0].(*mathpb.Error).GetCode() != testCase.expectedKind {
+			t.Logf("unexpected details for %s %v: (actual %v != expected %s)\n", testCase.req.GetOp(), testCase.req.GetArgs(), details, testCase.expectedKind)
+			t.Fail()
+		}
+	}
+}
+
+// TestGRPCBatch checks that a failed request in a batch doesn't fail the others
+func TestGRPCBatch(t *testing.T) {
+	client := newTestGRPCClient(t)
+
+	res, err := client.Batch(context.Background(), &mathpb.BatchRequest{
+		Requests: []*mathpb.ComputeRequest{
+			computeRequestProto(t, "1", "add", map[string]interface{}{"x": 1, "y": 2}, nil),
+			computeRequestProto(t, "2", "gcd", map[string]interface{}{"x": 1.5, "y": 2}, nil),
+			computeRequestProto(t, "3", "convert/base", map[string]interface{}{"value": "0xff", "to": 2}, nil),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	responses := res.GetResponses()
+	if len(responses) != 3 {
+		t.Fatalf("unexpected response count: (actual %d != expected 3)\n", len(responses))
+	}
+	if responses[0].GetAnswer().GetNumberValue() != 3 || responses[0].GetError() != nil {
+		t.Logf("unexpected first response: %v\n", responses[0])
+		t.Fail()
+	}
+	if responses[1].GetId() != "2" || responses[1].GetError().GetCode() != "invalid_argument" {
+		t.Logf("unexpected second response: %v\n", responses[1])
+		t.Fail()
+	}
+	if responses[2].GetAnswer().GetStringValue() != "11111111" {
+		t.Logf("unexpected third response: %v\n", responses[2])
+		t.Fail()
+	}
+}
+
+// TestGRPCComputeStream sends several requests on one stream and matches up the responses
+func TestGRPCComputeStream(t *testing.T) {
+	client := newTestGRPCClient(t)
+
+	stream, err := client.ComputeStream(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	expected := map[string]float64{"a": 12, "b": 0.5, "c": 1024}
+	requests := []*mathpb.ComputeRequest{
+		computeRequestProto(t, "a", "multiply", map[string]interface{}{"x": 3, "y": 4}, nil),
+		computeRequestProto(t, "b", "divide", map[string]interface{}{"x": 1, "y": 2}, nil),
+		computeRequestProto(t, "bad", "sqrt", map[string]interface{}{"x": "four"}, nil),
+		computeRequestProto(t, "c", "pow", map[string]interface{}{"x": 2, "y": 10}, nil),
+	}
+	for _, req := range requests {
+		err := stream.Send(req)
+		if err != nil {
+			t.Fatalf("stream send failed: %s\n", err)
+		}
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		t.Fatalf("stream close failed: %s\n", err)
+	}
+
+	for _, req := range requests {
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("stream receive failed: %s\n", err)
+		}
+		if res.GetId() != req.GetId() {
+			t.Logf("unexpected response id: (actual %s != expected %s)\n", res.GetId(), req.GetId())
+			t.Fail()
+		}
+		if req.GetId() == "bad" {
+			if res.GetError() == nil {
+				t.Log("expecting error, none received")
+				t.Fail()
+			}
+			continue
+		}
+		if res.GetAnswer().GetNumberValue() != expected[req.GetId()] {
+			t.Logf("unexpected answer for %s: (actual %v != expected %v)\n", req.GetId(), res.GetAnswer(), expected[req.GetId()])
+			t.Fail()
+		}
+	}
+}
+
+// TestGRPCPanic checks that a call that panics ends with codes.Internal and the server keeps serving
+func TestGRPCPanic(t *testing.T) {
+	addPanicOperation(t)
+	client := newTestGRPCClient(t)
+
+	_, err := client.Compute(context.Background(), computeRequestProto(t, "", "panic", map[string]interface{}{"x": 1, "y": 2}, nil))
+	if status.Code(err) != codes.Internal {
+		t.Logf("unexpected status: (actual %s != expected %s)\n", status.Code(err), codes.Internal)
+		t.Fail()
+	}
+
+	stream, err := client.ComputeStream(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	err = stream.Send(computeRequestProto(t, "", "panic", map[string]interface{}{"x": 1, "y": 2}, nil))
+	if err != nil {
+		t.Fatalf("stream send failed: %s\n", err)
+	}
+	_, err = stream.Recv()
+	if status.Code(err) != codes.Internal {
+		t.Logf("unexpected stream status: (actual %s != expected %s)\n", status.Code(err), codes.Internal)
+		t.Fail()
+	}
+
+	res, err := client.Compute(context.Background(), computeRequestProto(t, "", "add", map[string]interface{}{"x": 1, "y": 2}, nil))
+	if err != nil || res.GetAnswer().GetNumberValue() != 3 {
+		t.Logf("unexpected response after a panic: %v %v\n", res, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Math answers never change, so GET responses can be cached by browsers and CDNs the same way we
+// cache them in opCache.  These helpers deal with the HTTP side of that: ETags, Cache-Control, and
+// conditional requests
+
+// etagLength is the number of hex characters of the key hash used in an ETag. It's plenty to avoid
+// collisions without sending the full hash on every response
+const etagLength = 32
+
+// createETag derives a strong ETag from the same key we use for opCache, so the same operation and
+// operands always produce the same ETag regardless of which server instance answers
+func createETag(cacheKey string) string {
+	sum := sha256.Sum256([]byte(cacheKey))
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:])[:etagLength])
+}
+
+// etag is the ETag for the response eval produces.  The cache key only identifies the answer, so
+// the operands as they're echoed back and everything added to the answer after the cache go into it
+// as well: "0xff" and "255" are the same conversion, but not the same response
+func (e *evaluation) etag() string {
+	// the operands were all decoded from JSON, so they can be encoded again
+	echo, _ := json.Marshal([]interface{}{e.mode, e.x, e.y, e.args})
+	return createETag(strings.Join([]string{e.key, string(echo), e.finishTag, e.format.String()}, "\n"))
+}
+
+// etagMatches reports whether the request's If-None-Match header matches etag. If-None-Match uses
+// weak comparison, so a W/ prefix on the client's tag is ignored
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setCacheHeaders adds ETag and Cache-Control headers to a response. Operations we bother caching
+// can be cached publicly for as long as we'd keep them, everything else has to be revalidated (which
+// is cheap thanks to the ETag)
+func setCacheHeaders(w http.ResponseWriter, policy cachePolicy, etag string) {
+	w.Header().Set("ETag", etag)
+
+	if policy.cacheable {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(policy.expiration.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+}
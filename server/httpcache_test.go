@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestConditionalRequest checks the ETag and Cache-Control headers on GET responses and that a
+// matching If-None-Match gets a 304 with no body
+func TestConditionalRequest(t *testing.T) {
+	cleanUpCache()
+	t.Run("cacheable op", conditionalCacheableRequest)
+	t.Run("uncacheable op", conditionalUncacheableRequest)
+	t.Run("post request", conditionalPostRequest)
+	t.Run("error", conditionalErrorRequest)
+	t.Run("distinct responses", conditionalDistinctRequests)
+	cleanUpCache()
+}
+
+// etagFor is the ETag a GET of op with operands x and y gets
+func etagFor(t *testing.T, op string, x, y float64) string {
+	vars := clientVars{
+		"x": json.RawMessage(fmt.Sprint(x)),
+		"y": json.RawMessage(fmt.Sprint(y)),
+	}
+	eval, err := newEvaluation(op, vars, defaultEvalOptions)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	return eval.etag()
+}
+
+func conditionalCacheableRequest(t *testing.T) {
+	operation := "root"
+	reqURL := fmt.Sprintf("http://localhost:8080/%s?x=%f&y=%f", operation, 27.0, 3.0)
+	expectedETag := etagFor(t, operation, 27.0, 3.0)
+	expectedCacheControl := fmt.Sprintf("public, max-age=%d", int(supportedOperations[operation].cache.expiration.Seconds()))
+
+	req := httptest.NewRequest(http.MethodGet, reqURL, nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	if resRecorder.Code != http.StatusOK {
+		t.Logf("unexpected status value: (actual %d != expected %d)\n", resRecorder.Code, http.StatusOK)
+		t.Fail()
+	}
+	if etag := resRecorder.Header().Get("ETag"); etag != expectedETag {
+		t.Logf("unexpected etag value: (actual %s != expected %s)\n", etag, expectedETag)
+		t.Fail()
+	}
+	if cacheControl := resRecorder.Header().Get("Cache-Control"); cacheControl != expectedCacheControl {
+		t.Logf("unexpected cache-control value: (actual %s != expected %s)\n", cacheControl, expectedCacheControl)
+		t.Fail()
+	}
+
+	for _, ifNoneMatch := range []string{expectedETag, "W/" + expectedETag, `"abc", ` + expectedETag, "*"} {
+		req = httptest.NewRequest(http.MethodGet, reqURL, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		resRecorder = httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		if resRecorder.Code != http.StatusNotModified {
+			t.Logf("unexpected status value for %s: (actual %d != expected %d)\n", ifNoneMatch, resRecorder.Code, http.StatusNotModified)
+			t.Fail()
+		}
+		if resRecorder.Body.Len() != 0 {
+			t.Logf("unexpected body length: (actual %d != expected 0)\n", resRecorder.Body.Len())
+			t.Fail()
+		}
+	}
+
+	// different operands, different etag
+	req = httptest.NewRequest(http.MethodGet, reqURL, nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("If-None-Match", etagFor(t, operation, 27.0, 2.0))
+	validRequest(t, operation, 27.0, 3.0, true, req)
+}
+
+func conditionalUncacheableRequest(t *testing.T) {
+	reqURL := fmt.Sprintf("http://localhost:8080/add?x=%f&y=%f", 1.0, 2.0)
+
+	req := httptest.NewRequest(http.MethodGet, reqURL, nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	if cacheControl := resRecorder.Header().Get("Cache-Control"); cacheControl != "no-cache" {
+		t.Logf("unexpected cache-control value: (actual %s != expected no-cache)\n", cacheControl)
+		t.Fail()
+	}
+	if etag := resRecorder.Header().Get("ETag"); etag != etagFor(t, "add", 1.0, 2.0) {
+		t.Logf("unexpected etag value: (actual %s != expected %s)\n", etag, etagFor(t, "add", 1.0, 2.0))
+		t.Fail()
+	}
+}
+
+func conditionalPostRequest(t *testing.T) {
+	reqURL := fmt.Sprintf("http://localhost:8080/add?x=%f&y=%f", 1.0, 2.0)
+
+	req := httptest.NewRequest(http.MethodPost, reqURL, nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("If-None-Match", "*")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	if resRecorder.Code != http.StatusOK {
+		t.Logf("unexpected status value: (actual %d != expected %d)\n", resRecorder.Code, http.StatusOK)
+		t.Fail()
+	}
+	if etag := resRecorder.Header().Get("ETag"); etag != "" {
+		t.Logf("unexpected etag value: (actual %s != expected none)\n", etag)
+		t.Fail()
+	}
+}
+
+func conditionalErrorRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/factorial?n=-1", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	if resRecorder.Code != http.StatusUnprocessableEntity {
+		t.Logf("unexpected status value: (actual %d != expected %d)\n", resRecorder.Code, http.StatusUnprocessableEntity)
+		t.Fail()
+	}
+	if cacheControl := resRecorder.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Logf("unexpected cache-control value: (actual %s != expected no-store)\n", cacheControl)
+		t.Fail()
+	}
+	if etag := resRecorder.Header().Get("ETag"); etag != "" {
+		t.Logf("unexpected etag value: (actual %s != expected none)\n", etag)
+		t.Fail()
+	}
+
+	// errors are never a 304, whatever the tag
+	for _, ifNoneMatch := range []string{"*", etagFor(t, "divide", 1.0, 0.0)} {
+		req = httptest.NewRequest(http.MethodGet, "http://localhost:8080/divide?x=1&y=0", nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		resRecorder = httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		if resRecorder.Code != http.StatusUnprocessableEntity || resRecorder.Header().Get("ETag") != "" {
+			t.Logf("unexpected status value for %s: (actual %d != expected %d)\n", ifNoneMatch, resRecorder.Code, http.StatusUnprocessableEntity)
+			t.Fail()
+		}
+	}
+}
+
+// conditionalDistinctRequests checks that requests with different responses never share an ETag,
+// or an answer from the cache
+func conditionalDistinctRequests(t *testing.T) {
+	pairs := [][2]string{
+		{"/root?x=0.0000001&y=1", "/root?x=0.0000002&y=1"},
+		{"/divide?x=1&y=3&mode=rational", "/divide?x=1&y=3&mode=rational&decimal=true"},
+		{"/divide?x=2&y=3", "/divide?x=2&y=3&places=2"},
+		{"/divide?x=2&y=3&places=2", "/divide?x=2&y=3&places=2&locale=de"},
+		{"/convert/base?value=0xff&to=16", "/convert/base?value=255&to=16"},
+	}
+
+	get := func(target string) (string, []byte) {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+target, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		// whether it was cached doesn't matter, only what was answered
+		var mathRes MathOKResponse
+		json.Unmarshal(resRecorder.Body.Bytes(), &mathRes)
+		mathRes.Cached, mathRes.Source = false, ""
+		body, _ := json.Marshal(mathRes)
+		return resRecorder.Header().Get("ETag"), body
+	}
+
+	for _, pair := range pairs {
+		firstETag, firstBody := get(pair[0])
+		secondETag, secondBody := get(pair[1])
+		if firstETag == secondETag || string(firstBody) == string(secondBody) {
+			t.Logf("expecting different responses for %s and %s: (etags %s %s, bodies %s %s)\n", pair[0], pair[1], firstETag, secondETag, firstBody, secondBody)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// The integer operations work on big.Int, so factorial(50) is exact rather than a float64 with most
+// of its digits missing.  Every operand has to be an integer (though "1e3" is fine), and answers are
+// strings for the same reason as precise mode.  Each operation has an intLimit so that something
+// like factorial(10^9) is turned away before it ties up the server
+
+const defaultMaxIntBits = 8192
+
+// maxFactorRounds bounds Pollard's rho.  Anything within the factor operation's bit limit should
+// split long before this
+const maxFactorRounds = 1 << 20
+
+// intLimit is the work limit for an integer operation.  Zero values are unlimited
+type intLimit struct {
+	maxN    int64 // the largest value of the operation's first operand
+	maxBits int   // the largest bit length of any operand
+}
+
+// integerOperations are merged into supportedOperations in init
+var integerOperations = map[string]*operation{
+	"factorial": {
+		description: "n factorial",
+		params:      []string{"n"},
+		intFn:       intFactorial,
+		intLimit:    intLimit{maxN: 20000},
+		cache:       longCachePolicy,
+	},
+	"nCr": {
+		description: "the number of combinations of n things taken r at a time",
+		params:      []string{"n", "r"},
+		intFn:       intCombinations,
+		intLimit:    intLimit{maxN: 100000},
+		cache:       longCachePolicy,
+	},
+	"nPr": {
+		description: "the number of permutations of n things taken r at a time",
+		params:      []string{"n", "r"},
+		intFn:       intPermutations,
+		intLimit:    intLimit{maxN: 100000},
+		cache:       longCachePolicy,
+	},
+	"gcd": {
+		description: "the greatest common divisor of x and y",
+		params:      []string{"x", "y"},
+		intFn:       intGCD,
+		intLimit:    intLimit{maxBits: defaultMaxIntBits},
+		cache:       noCachePolicy,
+	},
+	"lcm": {
+		description: "the least common multiple of x and y",
+		params:      []string{"x", "y"},
+		intFn:       intLCM,
+		intLimit:    intLimit{maxBits: defaultMaxIntBits},
+		cache:       noCachePolicy,
+	},
+	"modpow": {
+		description: "a to the power of b, mod m",
+		params:      []string{"a", "b", "m"},
+		intFn:       intModPow,
+		intLimit:    intLimit{maxBits: defaultMaxIntBits},
+		cache:       defaultCachePolicy,
+	},
+	"modinv": {
+		description: "the inverse of a mod m",
+		params:      []string{"a", "m"},
+		intFn:       intModInverse,
+		intLimit:    intLimit{maxBits: defaultMaxIntBits},
+		cache:       noCachePolicy,
+	},
+	"isprime": {
+		description: "whether n is prime",
+		answer:      jsonObject{"type": "boolean", "description": "true if n is prime, which unlike the other integer answers isn't a string"},
+		params:      []string{"n"},
+		intFn:       intIsPrime,
+		intLimit:    intLimit{maxBits: 4096},
+		cache:       longCachePolicy,
+	},
+	"factor": {
+		description: "the prime factors of n",
+		params:      []string{"n"},
+		intFn:       intFactor,
+		intLimit:    intLimit{maxBits: 64},
+		cache:       longCachePolicy,
+	},
+}
+
+func init() {
+	for name, op := range integerOperations {
+		supportedOperations[name] = op
+	}
+}
+
+// newIntEvaluation parses and checks the integer operands of an integer operation.  The mode options
+// don't apply because integer answers are always exact
+func newIntEvaluation(op string, operation *operation, vars clientVars) (*evaluation, error) {
+	args := make([]*big.Int, len(operation.params))
+	keyArgs := make([]string, len(operation.params))
+	echo := make(map[string]interface{}, len(operation.params))
+	for i, param := range operation.params {
+		n, err := vars.integer(param)
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "%s", err)
+		}
+
+		limit := operation.intLimit
+		if limit.maxBits > 0 && n.BitLen() > limit.maxBits {
+			return nil, newMathError(kindLimitExceeded, "%s is limited to %d bit operands", op, limit.maxBits)
+		}
+		if i == 0 && limit.maxN > 0 && n.Cmp(big.NewInt(limit.maxN)) > 0 {
+			return nil, newMathError(kindLimitExceeded, "%s is limited to %s <= %d", op, param, limit.maxN)
+		}
+
+		args[i] = n
+		keyArgs[i] = n.String()
+		echo[param] = n.String()
+	}
+
+	return &evaluation{
+		op:     op,
+		mode:   modeInteger,
+		args:   echo,
+		key:    createArgsCacheKey(string(modeInteger), op, keyArgs...),
+		policy: operation.cache,
+		compute: func() (interface{}, error) {
+			return operation.intFn(args)
+		},
+	}, nil
+}
+
+// createArgsCacheKey builds a cache key for operations that don't fit createCacheKey's x op y format
+func createArgsCacheKey(settings, op string, args ...string) string {
+	return fmt.Sprintf("%s:%s(%s)", settings, op, strings.Join(args, ","))
+}
+
+func intFactorial(args []*big.Int) (interface{}, error) {
+	n := args[0]
+	if n.Sign() < 0 {
+		return nil, newMathError(kindDomain, "factorial of a negative number")
+	}
+	if n.Sign() == 0 {
+		return "1", nil
+	}
+	return new(big.Int).MulRange(1, n.Int64()).String(), nil
+}
+
+// intCombinations returns n choose r, which is zero when r > n
+func intCombinations(args []*big.Int) (interface{}, error) {
+	n, r := args[0], args[1]
+	if n.Sign() < 0 || r.Sign() < 0 {
+		return nil, newMathError(kindDomain, "nCr is only defined for non-negative n and r")
+	}
+	if r.Cmp(n) > 0 {
+		return "0", nil
+	}
+	return new(big.Int).Binomial(n.Int64(), r.Int64()).String(), nil
+}
+
+// intPermutations returns n!/(n-r)!, which is zero when r > n
+func intPermutations(args []*big.Int) (interface{}, error) {
+	n, r := args[0], args[1]
+	if n.Sign() < 0 || r.Sign() < 0 {
+		return nil, newMathError(kindDomain, "nPr is only defined for non-negative n and r")
+	}
+	if r.Cmp(n) > 0 {
+		return "0", nil
+	}
+	if r.Sign() == 0 {
+		return "1", nil
+	}
+	return new(big.Int).MulRange(n.Int64()-r.Int64()+1, n.Int64()).String(), nil
+}
+
+func intGCD(args []*big.Int) (interface{}, error) {
+	x, y := new(big.Int).Abs(args[0]), new(big.Int).Abs(args[1])
+	return new(big.Int).GCD(nil, nil, x, y).String(), nil
+}
+
+func intLCM(args []*big.Int) (interface{}, error) {
+	x, y := new(big.Int).Abs(args[0]), new(big.Int).Abs(args[1])
+	if x.Sign() == 0 || y.Sign() == 0 {
+		return "0", nil
+	}
+
+	gcd := new(big.Int).GCD(nil, nil, x, y)
+	lcm := new(big.Int).Quo(x, gcd)
+	return lcm.Mul(lcm, y).String(), nil
+}
+
+// intModPow returns a^b mod m.  Negative exponents use the modular inverse of a
+func intModPow(args []*big.Int) (interface{}, error) {
+	a, b, m := args[0], args[1], args[2]
+	if m.Sign() <= 0 {
+		return nil, newMathError(kindDomain, "modulus must be positive")
+	}
+
+	ans := new(big.Int).Exp(a, b, m)
+	if ans == nil {
+		return nil, newMathError(kindDomain, "%s has no inverse mod %s", a, m)
+	}
+	return ans.String(), nil
+}
+
+func intModInverse(args []*big.Int) (interface{}, error) {
+	a, m := args[0], args[1]
+	if m.Sign() <= 0 {
+		return nil, newMathError(kindDomain, "modulus must be positive")
+	}
+
+	ans := new(big.Int).ModInverse(a, m)
+	if ans == nil {
+		return nil, newMathError(kindDomain, "%s has no inverse mod %s", a, m)
+	}
+	return ans.String(), nil
+}
+
+// intIsPrime is exact for n < 2^64 and has a false positive probability of at most 4^-20 beyond that
+func intIsPrime(args []*big.Int) (interface{}, error) {
+	return args[0].ProbablyPrime(20), nil
+}
+
+// intFactor returns the prime factors of n in ascending order, with -1 as the first factor of
+// negative numbers
+func intFactor(args []*big.Int) (interface{}, error) {
+	n := new(big.Int).Set(args[0])
+	if n.Sign() == 0 {
+		return nil, newMathError(kindDomain, "zero has no prime factorization")
+	}
+
+	factors := []*big.Int{}
+	if n.Sign() < 0 {
+		factors = append(factors, big.NewInt(-1))
+		n.Neg(n)
+	}
+
+	// trial division takes care of small factors faster than rho would
+	for p := int64(2); p < 1000 && n.Cmp(big.NewInt(1)) > 0; p++ {
+		bigP := big.NewInt(p)
+		for new(big.Int).Mod(n, bigP).Sign() == 0 {
+			factors = append(factors, bigP)
+			n.Quo(n, bigP)
+		}
+	}
+
+	// whatever's left is split with rho until only primes remain
+	remaining := []*big.Int{}
+	if n.Cmp(big.NewInt(1)) > 0 {
+		remaining = append(remaining, n)
+	}
+	for len(remaining) > 0 {
+		m := remaining[len(remaining)-1]
+		remaining = remaining[:len(remaining)-1]
+
+		if m.ProbablyPrime(20) {
+			factors = append(factors, m)
+			continue
+		}
+
+		d := pollardRho(m)
+		if d == nil {
+			return nil, newMathError(kindLimitExceeded, "couldn't factor %s within %d rounds", m, maxFactorRounds)
+		}
+		remaining = append(remaining, d, new(big.Int).Quo(m, d))
+	}
+
+	sort.Slice(factors, func(i, j int) bool { return factors[i].Cmp(factors[j]) < 0 })
+	strs := make([]string, len(factors))
+	for i, factor := range factors {
+		strs[i] = factor.String()
+	}
+	return strs, nil
+}
+
+// pollardRho finds a nontrivial divisor of a composite n, trying successive polynomials x^2 + c
+// until one works. It returns nil if it runs out of rounds
+func pollardRho(n *big.Int) *big.Int {
+	one := big.NewInt(1)
+	rounds := 0
+	for c := int64(1); rounds < maxFactorRounds; c++ {
+		x, y, d := big.NewInt(2), big.NewInt(2), big.NewInt(1)
+		bigC := big.NewInt(c)
+		step := func(v *big.Int) {
+			v.Mul(v, v)
+			v.Add(v, bigC)
+			v.Mod(v, n)
+		}
+
+		for d.Cmp(one) == 0 && rounds < maxFactorRounds {
+			step(x)
+			step(y)
+			step(y)
+			d.Sub(x, y)
+			d.Abs(d)
+			d.GCD(nil, nil, d, n)
+			rounds++
+		}
+
+		if d.Cmp(one) != 0 && d.Cmp(n) != 0 {
+			return d
+		}
+	}
+
+	return nil
+}
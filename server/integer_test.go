@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestIntegerOperations runs each integer operation through mathHandler with a JSON body, since
+// several of them take more than the usual x and y
+func TestIntegerOperations(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		op       string
+		body     string
+		expected interface{}
+	}{
+		{"factorial", `{"n": 0}`, "1"},
+		{"factorial", `{"n": 25}`, "15511210043330985984000000"},
+		{"nCr", `{"n": 52, "r": 5}`, "2598960"},
+		{"nCr", `{"n": 5, "r": 6}`, "0"},
+		{"nPr", `{"n": 10, "r": 3}`, "720"},
+		{"gcd", `{"x": 462, "y": -1071}`, "21"},
+		{"lcm", `{"x": 4, "y": 6}`, "12"},
+		{"modpow", `{"a": 4, "b": 13, "m": 497}`, "445"},
+		{"modpow", `{"a": 3, "b": -1, "m": 11}`, "4"},
+		{"modinv", `{"a": 3, "m": 11}`, "4"},
+		{"isprime", `{"n": "170141183460469231731687303715884105727"}`, true},
+		{"isprime", `{"n": 1e3}`, false},
+		{"factor", `{"n": -360}`, []interface{}{"-1", "2", "2", "2", "3", "3", "5"}},
+		{"factor", `{"n": "18446744065119616769"}`, []interface{}{"4294967279", "4294967311"}},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if !reflect.DeepEqual(mathRes.Answer, testCase.expected) {
+			t.Logf("unexpected answer for %s %s: (actual %v != expected %v)\n", testCase.op, testCase.body, mathRes.Answer, testCase.expected)
+			t.Fail()
+		}
+		if mathRes.Mode != string(modeInteger) {
+			t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modeInteger)
+			t.Fail()
+		}
+	}
+}
+
+// TestIntegerErrors checks integrality validation, domain errors, and work limits
+func TestIntegerErrors(t *testing.T) {
+	testCases := []struct {
+		op             string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"factorial", `{"n": 2.5}`, http.StatusBadRequest, "invalid_argument"},
+		{"factorial", `{}`, http.StatusBadRequest, "invalid_argument"},
+		{"factorial", `{"n": -1}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"factorial", `{"n": 1e9}`, http.StatusUnprocessableEntity, "limit_exceeded"},
+		{"modinv", `{"a": 4, "m": 8}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"modpow", `{"a": 4, "b": 2, "m": 0}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"factor", `{"n": "340282366920938463463374607431768211297"}`, http.StatusUnprocessableEntity, "limit_exceeded"},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != testCase.expectedStatus || errRes.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s %s: (actual %d %s != expected %d %s)\n", testCase.op, testCase.body, resRecorder.Code, errRes.Code, testCase.expectedStatus, testCase.expectedCode)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// /rpc is a JSON-RPC 2.0 endpoint (https://www.jsonrpc.org/specification) where each method is an
+// operation from supportedOperations.  Params can be named, like {"x": 1, "y": 2}, or positional,
+// in which case they're matched up with the operation's params and then its optional params.  The
+// query string options and Cache-Control header apply to every call in the request, just as they
+// would for mathHandler
+
+const rpcVersion = "2.0"
+
+// maxRPCBodyBytes limits the size of a JSON-RPC request body, batches included
+const maxRPCBodyBytes = 1 << 20
+
+// rpcRequest is a single JSON-RPC call.  ID is nil for notifications, which get no response, and
+// json.RawMessage("null") for calls with a null id, which do
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// rpcResponse is the answer to a single JSON-RPC call.  Exactly one of Result and Error is set
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcError is a JSON-RPC error object.  Data carries the same code and details a
+// MathErrorResponse would
+type rpcError struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    *rpcErrorData `json:"data,omitempty"`
+}
+
+type rpcErrorData struct {
+	Code    string                 `json:"code"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// rpcHandler serves /rpc
+func rpcHandler(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if r.Body == nil {
+			return
+		}
+		err := r.Body.Close()
+		if err != nil {
+			log.Printf("req body close failed: %s\n", err)
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeRPCResponse(w, http.StatusMethodNotAllowed, newRPCErrorResponse(nil, rpcInvalidRequest, "json-rpc requests must be POSTed"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRPCBodyBytes))
+	if err != nil {
+		writeRPCResponse(w, http.StatusOK, newRPCErrorResponse(nil, rpcParseError, "read request failed: %s", err))
+		return
+	}
+	body = bytes.TrimSpace(body)
+
+	if !json.Valid(body) {
+		writeRPCResponse(w, http.StatusOK, newRPCErrorResponse(nil, rpcParseError, "parse error: invalid json"))
+		return
+	}
+
+	batch := body[0] == '['
+	messages := []json.RawMessage{body}
+	if batch {
+		// can't fail, the body is valid JSON and it's an array
+		_ = json.Unmarshal(body, &messages)
+	}
+	if batch && len(messages) == 0 {
+		writeRPCResponse(w, http.StatusOK, newRPCErrorResponse(nil, rpcInvalidRequest, "batch is empty"))
+		return
+	}
+	if len(messages) > maxBatchRequests {
+		writeRPCResponse(w, http.StatusOK, newRPCErrorResponse(nil, rpcInvalidRequest, "batches are limited to %d requests", maxBatchRequests))
+		return
+	}
+
+	opts, err := parseEvalOptions(r)
+	if err != nil {
+		writeRPCResponse(w, http.StatusOK, newRPCErrorResponse(nil, rpcInvalidRequest, "%s", err))
+		return
+	}
+	directive := parseCacheDirective(r)
+
+	var responses []*rpcResponse
+	for _, message := range messages {
+		res := callRPC(message, opts, directive)
+		if res != nil {
+			responses = append(responses, res)
+		}
+	}
+
+	switch {
+	case len(responses) == 0:
+		// nothing but notifications
+		w.WriteHeader(http.StatusNoContent)
+	case batch:
+		// each response is encoded on its own, so one that can't be doesn't take the batch with it
+		encoded := make([]json.RawMessage, len(responses))
+		for i, res := range responses {
+			encoded[i] = encodeRPCResponse(res)
+		}
+		writeRPCResponse(w, http.StatusOK, encoded)
+	default:
+		writeRPCResponse(w, http.StatusOK, encodeRPCResponse(responses[0]))
+	}
+}
+
+// callRPC evaluates a single JSON-RPC call, returning nil if it's a notification
+func callRPC(message json.RawMessage, opts evalOptions, directive cacheDirective) *rpcResponse {
+	var req rpcRequest
+	err := json.Unmarshal(message, &req)
+	if err != nil || req.JSONRPC != rpcVersion || req.Method == "" {
+		// a request this broken doesn't have an id we can trust, notification or not
+		return newRPCErrorResponse(nil, rpcInvalidRequest, "invalid request: expected an object with jsonrpc \"2.0\" and a method")
+	}
+
+	var id json.RawMessage
+	if req.ID != nil {
+		id = req.ID
+		if id[0] != '"' && id[0] != '-' && (id[0] < '0' || id[0] > '9') && string(id) != "null" {
+			return newRPCErrorResponse(nil, rpcInvalidRequest, "invalid request: id must be a string, number, or null")
+		}
+	}
+
+	answer, err := evaluateRPC(req, opts, directive)
+	if req.ID == nil {
+		if err != nil {
+			log.Printf("json-rpc notification %s failed: %s\n", req.Method, err)
+		}
+		return nil
+	}
+	if err != nil {
+		log.Printf("json-rpc %s failed: %s\n", req.Method, err)
+		res := newRPCErrorResponse(id, errorRPCCodes[kindOf(err)], "%s", err)
+		res.Error.Data = &rpcErrorData{
+			Code:    errorCodes[kindOf(err)],
+			Details: detailsOf(err),
+		}
+		return res
+	}
+
+	return &rpcResponse{
+		JSONRPC: rpcVersion,
+		Result:  answer,
+		ID:      id,
+	}
+}
+
+// evaluateRPC converts the call's params to clientVars and evaluates its method
+func evaluateRPC(req rpcRequest, opts evalOptions, directive cacheDirective) (interface{}, error) {
+	operation := supportedOperations[req.Method]
+	if operation == nil {
+		return nil, newMathError(kindUnsupportedOperation, "unsupported operation request: %q", req.Method)
+	}
+
+	vars := make(clientVars)
+	switch {
+	case len(req.Params) == 0:
+	case req.Params[0] == '{':
+		err := json.Unmarshal(req.Params, &vars)
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "params decode failed: %s", err)
+		}
+	case req.Params[0] == '[':
+		var positional []json.RawMessage
+		err := json.Unmarshal(req.Params, &positional)
+		if err != nil {
+			return nil, newMathError(kindInvalidArgument, "params decode failed: %s", err)
+		}
+
+		names := append(append([]string{}, operation.params...), operation.optional...)
+		if len(positional) > len(names) {
+			return nil, newMathError(kindInvalidArgument, "%s takes at most %d params, got %d", req.Method, len(names), len(positional))
+		}
+		for i, value := range positional {
+			vars[names[i]] = value
+		}
+	default:
+		return nil, newMathError(kindInvalidArgument, "params must be an array or an object")
+	}
+
+	eval, err := newEvaluation(req.Method, vars, opts)
+	if err != nil {
+		return nil, err
+	}
+	res, err := eval.run(directive)
+	if err != nil {
+		return nil, err
+	}
+	return res.Answer, nil
+}
+
+// newRPCErrorResponse builds an error response.  A nil id is written as null
+func newRPCErrorResponse(id json.RawMessage, code int, format string, args ...interface{}) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{
+		JSONRPC: rpcVersion,
+		Error: &rpcError{
+			Code:    code,
+			Message: fmt.Sprintf(format, args...),
+		},
+		ID: id,
+	}
+}
+
+// encodeRPCResponse marshals a single response, or an internal error with the same id if it can't
+func encodeRPCResponse(res *rpcResponse) json.RawMessage {
+	resBytes, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("encodeRPCResponse: json marshal failed: %s\n", err)
+		resBytes, _ = json.Marshal(newRPCErrorResponse(res.ID, rpcInternalError, "encode response failed"))
+	}
+	return resBytes
+}
+
+// writeRPCResponse writes a response or a batch of them
+func writeRPCResponse(w http.ResponseWriter, status int, res interface{}) {
+	resBytes, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("writeRPCResponse: json marshal failed: %s\n", err)
+		resBytes, _ = json.Marshal(newRPCErrorResponse(nil, rpcInternalError, "encode response failed"))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(resBytes)
+	if err != nil {
+		log.Printf("response write failed: %s\n", err)
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// postRPC sends body to /rpc and returns the response recorder
+func postRPC(target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080"+target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+	return resRecorder
+}
+
+// TestRPCCalls checks single calls with named and positional params, along with the spec's errors
+func TestRPCCalls(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		target   string
+		body     string
+		expected string
+	}{
+		{"/rpc", `{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 1}`, `{"jsonrpc":"2.0","result":3,"id":1}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "subtract", "params": {"y": 2, "x": 10}, "id": "a"}`, `{"jsonrpc":"2.0","result":8,"id":"a"}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "percentile", "params": [[1, 2, 3, 4], 50], "id": null}`, `{"jsonrpc":"2.0","result":2.5,"id":null}`},
+		{"/rpc?mode=rational", `{"jsonrpc": "2.0", "method": "divide", "params": [1, 3], "id": 2}`, `{"jsonrpc":"2.0","result":"1/3","id":2}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "and", "params": ["0xf0", 60, 8], "id": 3}`, `{"jsonrpc":"2.0","result":{"value":"48","hex":"0x30","binary":"0b00110000"},"id":3}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "nope", "params": [1, 2], "id": 4}`, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"unsupported operation request: \"nope\"","data":{"code":"unsupported_operation"}},"id":4}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "add", "params": [1, 2, 3], "id": 5}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"add takes at most 2 params, got 3","data":{"code":"invalid_argument"}},"id":5}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "add", "params": 1, "id": 6}`, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"params must be an array or an object","data":{"code":"invalid_argument"}},"id":6}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "factorial", "params": [-1], "id": 7}`, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"factorial of a negative number","data":{"code":"domain_error"}},"id":7}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "divide", "params": [1, 0], "id": 9}`, `{"jsonrpc":"2.0","error":{"code":-32000,"message":"answer is not finite","data":{"code":"domain_error"}},"id":9}`},
+		{"/rpc", `{"jsonrpc": "1.0", "method": "add", "id": 8}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request: expected an object with jsonrpc \"2.0\" and a method"},"id":null}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": {}}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request: id must be a string, number, or null"},"id":null}`},
+		{"/rpc", `{"jsonrpc": "2.0", "method": "add", "params": [1, 2]`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error: invalid json"},"id":null}`},
+		{"/rpc", `[]`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"batch is empty"},"id":null}`},
+	}
+
+	for _, testCase := range testCases {
+		resRecorder := postRPC(testCase.target, testCase.body)
+		if resRecorder.Code != http.StatusOK {
+			t.Logf("unexpected status for %s: (actual %d != expected %d)\n", testCase.body, resRecorder.Code, http.StatusOK)
+			t.Fail()
+		}
+
+		actual := strings.TrimSpace(resRecorder.Body.String())
+		if actual != testCase.expected {
+			t.Logf("unexpected response for %s: (actual %s != expected %s)\n", testCase.body, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestRPCBatch checks that batches answer every call but the notifications, and that a batch of
+// nothing but notifications gets no body at all
+func TestRPCBatch(t *testing.T) {
+	body := `[
+		{"jsonrpc": "2.0", "method": "multiply", "params": [6, 7], "id": 1},
+		{"jsonrpc": "2.0", "method": "add", "params": [1, 1]},
+		{"jsonrpc": "2.0", "method": "sqrt", "params": {"x": "nine"}, "id": 2},
+		1
+	]`
+	resRecorder := postRPC("/rpc", body)
+
+	var responses []map[string]interface{}
+	err := json.NewDecoder(resRecorder.Body).Decode(&responses)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("unexpected response count: (actual %d != expected 3)\n", len(responses))
+	}
+
+	if responses[0]["result"] != 42.0 || responses[0]["id"] != 1.0 {
+		t.Logf("unexpected first response: %v\n", responses[0])
+		t.Fail()
+	}
+	expectedError := map[string]interface{}{"code": -32602.0, "message": responses[1]["error"].(map[string]interface{})["message"], "data": map[string]interface{}{"code": "invalid_argument"}}
+	if !reflect.DeepEqual(responses[1]["error"], expectedError) || responses[1]["id"] != 2.0 {
+		t.Logf("unexpected second response: %v\n", responses[1])
+		t.Fail()
+	}
+	if responses[2]["error"].(map[string]interface{})["code"] != -32600.0 || responses[2]["id"] != nil {
+		t.Logf("unexpected third response: %v\n", responses[2])
+		t.Fail()
+	}
+
+	// an answer that can't be encoded fails its own call, not the batch
+	resRecorder = postRPC("/rpc", `[{"jsonrpc": "2.0", "method": "divide", "params": [1, 0], "id": 1}, {"jsonrpc": "2.0", "method": "divide", "params": [1, 4], "id": 2}]`)
+	responses = nil
+	err = json.NewDecoder(resRecorder.Body).Decode(&responses)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+	if len(responses) != 2 || responses[0]["error"] == nil || responses[1]["result"] != 0.25 {
+		t.Logf("unexpected non-finite batch responses: %v\n", responses)
+		t.Fail()
+	}
+
+	resRecorder = postRPC("/rpc", `[{"jsonrpc": "2.0", "method": "add", "params": [1, 1]}, {"jsonrpc": "2.0", "method": "nope"}]`)
+	if resRecorder.Code != http.StatusNoContent || resRecorder.Body.Len() != 0 {
+		t.Logf("unexpected notification response: (actual %d %q != expected %d \"\")\n", resRecorder.Code, resRecorder.Body.String(), http.StatusNoContent)
+		t.Fail()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/rpc", nil)
+	resRecorder = httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+	if resRecorder.Code != http.StatusMethodNotAllowed {
+		t.Logf("unexpected status for GET: (actual %d != expected %d)\n", resRecorder.Code, http.StatusMethodNotAllowed)
+		t.Fail()
+	}
+}
@@ -0,0 +1,595 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// The vector and matrix operations take JSON arrays (vectors) and arrays of arrays (matrices) as
+// operands.  Vectors can also be sent as repeated form values.  Everything is float64 and meant for
+// small matrices, so there are limits on sizes rather than anything clever about sparse storage
+
+const maxVectorLength = 10000
+const maxMatrixDim = 100
+
+// maxEigenDim is lower than maxMatrixDim because eigenvalues come from the roots of the characteristic
+// polynomial, which gets numerically unreliable quickly as the degree grows
+const maxEigenDim = 10
+
+// singularTolerance is the pivot size below which a matrix is treated as singular
+const singularTolerance = 1e-12
+
+// operandShape is the kind of value a linear algebra operation expects for each of its params
+type operandShape int
+
+const (
+	shapeVector operandShape = iota
+	shapeMatrix
+)
+
+// linalgOperand is a parsed vector or matrix operand, depending on its operandShape
+type linalgOperand struct {
+	vector []float64
+	matrix [][]float64
+}
+
+// linalgOperations are merged into supportedOperations in init
+var linalgOperations = map[string]*operation{
+	"dot": {
+		description: "the dot product of vectors x and y",
+		params:      binaryParams,
+		shapes:      []operandShape{shapeVector, shapeVector},
+		linalgFn:    linalgDot,
+		cache:       noCachePolicy,
+	},
+	"cross": {
+		description: "the cross product of 3 element vectors x and y",
+		params:      binaryParams,
+		shapes:      []operandShape{shapeVector, shapeVector},
+		linalgFn:    linalgCross,
+		cache:       noCachePolicy,
+	},
+	"norm": {
+		description: "the Euclidean length of vector x",
+		params:      unaryParams,
+		shapes:      []operandShape{shapeVector},
+		linalgFn:    linalgNorm,
+		cache:       noCachePolicy,
+	},
+	"matmul": {
+		description: "matrix x times matrix y",
+		params:      binaryParams,
+		shapes:      []operandShape{shapeMatrix, shapeMatrix},
+		linalgFn:    linalgMatmul,
+		cache:       defaultCachePolicy,
+	},
+	"transpose": {
+		description: "the transpose of matrix x",
+		params:      unaryParams,
+		shapes:      []operandShape{shapeMatrix},
+		linalgFn:    linalgTranspose,
+		cache:       noCachePolicy,
+	},
+	"det": {
+		description: "the determinant of square matrix x",
+		params:      unaryParams,
+		shapes:      []operandShape{shapeMatrix},
+		linalgFn:    linalgDet,
+		cache:       defaultCachePolicy,
+	},
+	"inverse": {
+		description: "the inverse of square matrix x",
+		params:      unaryParams,
+		shapes:      []operandShape{shapeMatrix},
+		linalgFn:    linalgInverse,
+		cache:       defaultCachePolicy,
+	},
+	"solve": {
+		description: "the vector x such that matrix a times x is vector b",
+		params:      []string{"a", "b"},
+		shapes:      []operandShape{shapeMatrix, shapeVector},
+		linalgFn:    linalgSolve,
+		cache:       defaultCachePolicy,
+	},
+	"eigenvalues": {
+		description: "the eigenvalues of square matrix x",
+		params:      unaryParams,
+		shapes:      []operandShape{shapeMatrix},
+		linalgFn:    linalgEigenvalues,
+		cache:       defaultCachePolicy,
+	},
+}
+
+func init() {
+	for name, op := range linalgOperations {
+		supportedOperations[name] = op
+	}
+}
+
+// newLinalgEvaluation parses the vector and matrix operands of operation.  Answers are cached by a
+// hash of the operands, since the operands themselves would make for some very long keys
+func newLinalgEvaluation(op string, operation *operation, vars clientVars) (*evaluation, error) {
+	args := make([]linalgOperand, len(operation.params))
+	echo := make(map[string]interface{}, len(operation.params))
+	for i, param := range operation.params {
+		var err error
+		switch operation.shapes[i] {
+		case shapeVector:
+			args[i].vector, err = vars.vector(param)
+			echo[param] = args[i].vector
+		case shapeMatrix:
+			args[i].matrix, err = vars.matrix(param)
+			echo[param] = args[i].matrix
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := json.Marshal(echo) // map keys are sorted, so this is deterministic
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+
+	return &evaluation{
+		op:     op,
+		mode:   modeMatrix,
+		args:   echo,
+		key:    createArgsCacheKey(string(modeMatrix), op, hex.EncodeToString(sum[:])),
+		policy: operation.cache,
+		compute: func() (interface{}, error) {
+			return operation.linalgFn(args)
+		},
+	}, nil
+}
+
+// vector returns the variable as a vector
+func (v clientVars) vector(name string) ([]float64, error) {
+	return v.numbers(name, maxVectorLength)
+}
+
+// matrix returns the variable as a rectangular matrix, indexed by row then column
+func (v clientVars) matrix(name string) ([][]float64, error) {
+	raw, ok := v[name]
+	if !ok {
+		return nil, newMathError(kindInvalidArgument, "missing %s", name)
+	}
+
+	var mat [][]float64
+	if err := json.Unmarshal(raw, &mat); err != nil || len(mat) == 0 || len(mat[0]) == 0 {
+		return nil, newMathError(kindInvalidArgument, "%s must be a non-empty array of arrays of numbers", name)
+	}
+	if len(mat) > maxMatrixDim || len(mat[0]) > maxMatrixDim {
+		return nil, newMathError(kindLimitExceeded, "%s is limited to %dx%d", name, maxMatrixDim, maxMatrixDim)
+	}
+	for i, row := range mat {
+		if len(row) != len(mat[0]) {
+			return nil, newMathError(kindInvalidArgument, "%s is not rectangular: row %d has %d columns, row 0 has %d", name, i, len(row), len(mat[0]))
+		}
+	}
+
+	return mat, nil
+}
+
+// checkSquare returns a shape error for non-square matrices
+func checkSquare(mat [][]float64) error {
+	if len(mat) != len(mat[0]) {
+		return newMathError(kindDimension, "matrix must be square, got %dx%d", len(mat), len(mat[0]))
+	}
+	return nil
+}
+
+// checkFinite makes sure an answer can be encoded as JSON
+func checkFinite(values ...float64) error {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return newMathError(kindDomain, "answer is not finite")
+		}
+	}
+	return nil
+}
+
+func linalgDot(args []linalgOperand) (interface{}, error) {
+	x, y := args[0].vector, args[1].vector
+	if len(x) != len(y) {
+		return nil, newMathError(kindDimension, "vectors must be the same length, got %d and %d", len(x), len(y))
+	}
+
+	var sum float64
+	for i := range x {
+		sum += x[i] * y[i]
+	}
+	return sum, checkFinite(sum)
+}
+
+func linalgCross(args []linalgOperand) (interface{}, error) {
+	x, y := args[0].vector, args[1].vector
+	if len(x) != 3 || len(y) != 3 {
+		return nil, newMathError(kindDimension, "cross product needs two 3-vectors, got %d and %d", len(x), len(y))
+	}
+
+	ans := []float64{
+		x[1]*y[2] - x[2]*y[1],
+		x[2]*y[0] - x[0]*y[2],
+		x[0]*y[1] - x[1]*y[0],
+	}
+	return ans, checkFinite(ans...)
+}
+
+// linalgNorm returns the Euclidean length of x
+func linalgNorm(args []linalgOperand) (interface{}, error) {
+	var norm float64
+	for _, value := range args[0].vector {
+		norm = math.Hypot(norm, value)
+	}
+	return norm, checkFinite(norm)
+}
+
+func linalgMatmul(args []linalgOperand) (interface{}, error) {
+	x, y := args[0].matrix, args[1].matrix
+	if len(x[0]) != len(y) {
+		return nil, newMathError(kindDimension, "can't multiply %dx%d by %dx%d", len(x), len(x[0]), len(y), len(y[0]))
+	}
+
+	ans := newMatrix(len(x), len(y[0]))
+	for i := range ans {
+		for j := range ans[i] {
+			for k := range y {
+				ans[i][j] += x[i][k] * y[k][j]
+			}
+			if err := checkFinite(ans[i][j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ans, nil
+}
+
+func linalgTranspose(args []linalgOperand) (interface{}, error) {
+	x := args[0].matrix
+	ans := newMatrix(len(x[0]), len(x))
+	for i := range x {
+		for j := range x[i] {
+			ans[j][i] = x[i][j]
+		}
+	}
+	return ans, nil
+}
+
+// linalgDet computes the determinant by LU decomposition
+func linalgDet(args []linalgOperand) (interface{}, error) {
+	x := args[0].matrix
+	if err := checkSquare(x); err != nil {
+		return nil, err
+	}
+
+	lu := copyMatrix(x)
+	det := 1.0
+	for col := range lu {
+		pivot := pivotRow(lu, col)
+		if lu[pivot][col] == 0 {
+			return 0.0, nil
+		}
+		if pivot != col {
+			lu[pivot], lu[col] = lu[col], lu[pivot]
+			det = -det
+		}
+
+		det *= lu[col][col]
+		for row := col + 1; row < len(lu); row++ {
+			factor := lu[row][col] / lu[col][col]
+			for k := col; k < len(lu); k++ {
+				lu[row][k] -= factor * lu[col][k]
+			}
+		}
+	}
+	return det, checkFinite(det)
+}
+
+func linalgInverse(args []linalgOperand) (interface{}, error) {
+	x := args[0].matrix
+	if err := checkSquare(x); err != nil {
+		return nil, err
+	}
+
+	identity := newMatrix(len(x), len(x))
+	for i := range identity {
+		identity[i][i] = 1
+	}
+	return gaussJordan(x, identity)
+}
+
+// linalgSolve solves a x = b for x
+func linalgSolve(args []linalgOperand) (interface{}, error) {
+	a, b := args[0].matrix, args[1].vector
+	if err := checkSquare(a); err != nil {
+		return nil, err
+	}
+	if len(b) != len(a) {
+		return nil, newMathError(kindDimension, "b must have %d elements to match a, got %d", len(a), len(b))
+	}
+
+	column := newMatrix(len(b), 1)
+	for i := range b {
+		column[i][0] = b[i]
+	}
+	solution, err := gaussJordan(a, column)
+	if err != nil {
+		return nil, err
+	}
+
+	ans := make([]float64, len(solution))
+	for i := range solution {
+		ans[i] = solution[i][0]
+	}
+	return ans, nil
+}
+
+// linalgEigenvalues returns the eigenvalues of x.  Symmetric matrices, which only have real
+// eigenvalues, use the Jacobi method.  Anything else uses the roots of the characteristic polynomial,
+// which is less accurate, especially for repeated eigenvalues.  Real eigenvalues are returned as
+// numbers in ascending order, but if any are complex, they're all returned as ComplexNumbers
+// (ordered by real part, then imaginary part)
+func linalgEigenvalues(args []linalgOperand) (interface{}, error) {
+	x := args[0].matrix
+	if err := checkSquare(x); err != nil {
+		return nil, err
+	}
+	if len(x) > maxEigenDim {
+		return nil, newMathError(kindLimitExceeded, "eigenvalues is limited to %dx%d matrices", maxEigenDim, maxEigenDim)
+	}
+
+	if isSymmetric(x) {
+		reals := jacobiEigenvalues(x)
+		sort.Float64s(reals)
+		return reals, checkFinite(reals...)
+	}
+
+	roots := polynomialRoots(characteristicPolynomial(x))
+
+	scale := 1.0
+	for _, root := range roots {
+		scale = math.Max(scale, cmplx.Abs(root))
+	}
+
+	reals := make([]float64, 0, len(roots))
+	for _, root := range roots {
+		// repeated roots are only found to about half of float64's precision, so this is generous
+		if math.Abs(imag(root)) > 1e-6*scale {
+			complexes := make([]ComplexNumber, len(roots))
+			for i, root := range roots {
+				complexes[i] = newComplexNumber(cleanComplex(root))
+			}
+			sort.Slice(complexes, func(i, j int) bool {
+				if complexes[i].Re != complexes[j].Re {
+					return complexes[i].Re < complexes[j].Re
+				}
+				return complexes[i].Im < complexes[j].Im
+			})
+			return complexes, nil
+		}
+		reals = append(reals, real(root))
+	}
+
+	sort.Float64s(reals)
+	return reals, checkFinite(reals...)
+}
+
+func isSymmetric(mat [][]float64) bool {
+	for i := range mat {
+		for j := 0; j < i; j++ {
+			if math.Abs(mat[i][j]-mat[j][i]) > singularTolerance*math.Max(1, math.Abs(mat[i][j])) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// jacobiEigenvalues diagonalizes a symmetric matrix with Jacobi rotations, each of which zeroes one
+// off-diagonal element, until the off-diagonal elements are negligible
+func jacobiEigenvalues(x [][]float64) []float64 {
+	a := copyMatrix(x)
+	n := len(a)
+
+	for sweep := 0; sweep < 100; sweep++ {
+		var off, total float64
+		for i := range a {
+			for j := range a[i] {
+				total += a[i][j] * a[i][j]
+				if i != j {
+					off += a[i][j] * a[i][j]
+				}
+			}
+		}
+		if off <= 1e-30*total {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < n; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = c*akp - s*akq
+					a[k][q] = s*akp + c*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = c*apk - s*aqk
+					a[q][k] = s*apk + c*aqk
+				}
+			}
+		}
+	}
+
+	eigenvalues := make([]float64, n)
+	for i := range a {
+		eigenvalues[i] = a[i][i]
+	}
+	return eigenvalues
+}
+
+// gaussJordan returns x^-1 b by row reducing the augmented matrix [x | b] with partial pivoting
+func gaussJordan(x, b [][]float64) ([][]float64, error) {
+	n := len(x)
+	aug := make([][]float64, n)
+	for i := range x {
+		aug[i] = append(append([]float64{}, x[i]...), b[i]...)
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := pivotRow(aug, col)
+		if math.Abs(aug[pivot][col]) < singularTolerance {
+			return nil, newMathError(kindDomain, "matrix is singular")
+		}
+		aug[pivot], aug[col] = aug[col], aug[pivot]
+
+		pivotValue := aug[col][col]
+		for k := range aug[col] {
+			aug[col][k] /= pivotValue
+		}
+		for row := range aug {
+			if row == col || aug[row][col] == 0 {
+				continue
+			}
+			factor := aug[row][col]
+			for k := range aug[row] {
+				aug[row][k] -= factor * aug[col][k]
+			}
+		}
+	}
+
+	ans := make([][]float64, n)
+	for i := range aug {
+		ans[i] = aug[i][n:]
+		if err := checkFinite(ans[i]...); err != nil {
+			return nil, err
+		}
+	}
+	return ans, nil
+}
+
+// pivotRow returns the row at or below col with the largest magnitude in col
+func pivotRow(mat [][]float64, col int) int {
+	pivot := col
+	for row := col + 1; row < len(mat); row++ {
+		if math.Abs(mat[row][col]) > math.Abs(mat[pivot][col]) {
+			pivot = row
+		}
+	}
+	return pivot
+}
+
+// characteristicPolynomial returns the coefficients of det(tI - x), highest degree first, using the
+// Faddeev-LeVerrier algorithm
+func characteristicPolynomial(x [][]float64) []float64 {
+	n := len(x)
+	coeffs := make([]float64, n+1)
+	coeffs[0] = 1
+
+	m := newMatrix(n, n) // M_0 = 0
+	for k := 1; k <= n; k++ {
+		// M_k = x M_{k-1} + c_{n-k+1} I
+		next := newMatrix(n, n)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				for l := 0; l < n; l++ {
+					next[i][j] += x[i][l] * m[l][j]
+				}
+			}
+			next[i][i] += coeffs[k-1]
+		}
+		m = next
+
+		// c_{n-k} = -tr(x M_k) / k
+		var trace float64
+		for i := 0; i < n; i++ {
+			for l := 0; l < n; l++ {
+				trace += x[i][l] * m[l][i]
+			}
+		}
+		coeffs[k] = -trace / float64(k)
+	}
+
+	return coeffs
+}
+
+// polynomialRoots finds every root of a monic polynomial (coefficients highest degree first) at
+// once with the Durand-Kerner method
+func polynomialRoots(coeffs []float64) []complex128 {
+	degree := len(coeffs) - 1
+	eval := func(z complex128) complex128 {
+		var ans complex128
+		for _, c := range coeffs {
+			ans = ans*z + complex(c, 0)
+		}
+		return ans
+	}
+
+	// the usual starting points are powers of a complex number that isn't a root of unity, scaled by
+	// a bound on the size of the roots
+	bound := 1.0
+	for _, c := range coeffs[1:] {
+		bound = math.Max(bound, 1+math.Abs(c))
+	}
+	roots := make([]complex128, degree)
+	for i := range roots {
+		roots[i] = cmplx.Pow(complex(0.4, 0.9), complex(float64(i), 0)) * complex(bound/2, 0)
+	}
+
+	for iteration := 0; iteration < 500; iteration++ {
+		var change float64
+		for i := range roots {
+			denom := complex(1, 0)
+			for j := range roots {
+				if i != j {
+					denom *= roots[i] - roots[j]
+				}
+			}
+			if denom == 0 {
+				denom = complex(1e-12, 0)
+			}
+			step := eval(roots[i]) / denom
+			roots[i] -= step
+			change = math.Max(change, cmplx.Abs(step))
+		}
+		if change < 1e-14 {
+			break
+		}
+	}
+
+	return roots
+}
+
+func newMatrix(rows, cols int) [][]float64 {
+	mat := make([][]float64, rows)
+	for i := range mat {
+		mat[i] = make([]float64, cols)
+	}
+	return mat
+}
+
+func copyMatrix(mat [][]float64) [][]float64 {
+	dup := make([][]float64, len(mat))
+	for i := range mat {
+		dup[i] = append([]float64{}, mat[i]...)
+	}
+	return dup
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLinalgOperations runs each vector and matrix operation through mathHandler.  Answers are
+// compared after rounding to 9 decimal places since most of them involve some floating point error
+func TestLinalgOperations(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		op       string
+		body     string
+		expected interface{}
+	}{
+		{"dot", `{"x": [1, 2, 3], "y": [4, -5, 6]}`, 12.0},
+		{"cross", `{"x": [1, 0, 0], "y": [0, 1, 0]}`, []interface{}{0.0, 0.0, 1.0}},
+		{"norm", `{"x": [3, 4]}`, 5.0},
+		{"matmul", `{"x": [[1, 2], [3, 4]], "y": [[5], [6]]}`, []interface{}{[]interface{}{17.0}, []interface{}{39.0}}},
+		{"transpose", `{"x": [[1, 2, 3]]}`, []interface{}{[]interface{}{1.0}, []interface{}{2.0}, []interface{}{3.0}}},
+		{"det", `{"x": [[0, 2], [3, 4]]}`, -6.0},
+		{"det", `{"x": [[1, 2], [2, 4]]}`, 0.0},
+		{"inverse", `{"x": [[4, 7], [2, 6]]}`, []interface{}{[]interface{}{0.6, -0.7}, []interface{}{-0.2, 0.4}}},
+		{"solve", `{"a": [[2, 1], [1, 3]], "b": [3, 5]}`, []interface{}{0.8, 1.4}},
+		{"eigenvalues", `{"x": [[2, 0, 0], [0, 3, 4], [0, 4, 9]]}`, []interface{}{1.0, 2.0, 11.0}},
+		{"eigenvalues", `{"x": [[0, -1], [1, 0]]}`, []interface{}{
+			map[string]interface{}{"re": 0.0, "im": -1.0},
+			map[string]interface{}{"re": 0.0, "im": 1.0},
+		}},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		actual := roundAnswer(mathRes.Answer)
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Logf("unexpected answer for %s %s: (actual %v != expected %v)\n", testCase.op, testCase.body, mathRes.Answer, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestLinalgErrors checks shape validation, size limits, and singular matrices
+func TestLinalgErrors(t *testing.T) {
+	testCases := []struct {
+		op           string
+		body         string
+		expectedCode string
+	}{
+		{"dot", `{"x": [1, 2, 3], "y": [4, 5]}`, "dimension_mismatch"},
+		{"cross", `{"x": [1, 2], "y": [3, 4]}`, "dimension_mismatch"},
+		{"matmul", `{"x": [[1, 2]], "y": [[1, 2]]}`, "dimension_mismatch"},
+		{"det", `{"x": [[1, 2], [3]]}`, "invalid_argument"},
+		{"det", `{"x": [[1, 2, 3], [4, 5, 6]]}`, "dimension_mismatch"},
+		{"transpose", `{"x": [1, 2]}`, "invalid_argument"},
+		{"solve", `{"a": [[1, 0], [0, 1]], "b": [1, 2, 3]}`, "dimension_mismatch"},
+		{"inverse", `{"x": [[1, 2], [2, 4]]}`, "domain_error"},
+		{"eigenvalues", fmt.Sprintf(`{"x": %s}`, identityJSON(maxEigenDim+1)), "limit_exceeded"},
+		{"transpose", fmt.Sprintf(`{"x": %s}`, identityJSON(maxMatrixDim+1)), "limit_exceeded"},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if errRes.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s: (actual %s != expected %s)\n", testCase.op, errRes.Code, testCase.expectedCode)
+			t.Fail()
+		}
+	}
+}
+
+// TestLinalgCacheKey checks that identical operands share a cache key regardless of formatting
+func TestLinalgCacheKey(t *testing.T) {
+	first, err := newEvaluation("det", clientVars{"x": json.RawMessage(`[[1,2],[3,4]]`)}, defaultEvalOptions)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+	second, err := newEvaluation("det", clientVars{"x": json.RawMessage(`[[1.0, 2], [3, 4e0]]`)}, defaultEvalOptions)
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n", err)
+	}
+
+	if first.key != second.key {
+		t.Logf("unexpected cache key mismatch: (%s != %s)\n", first.key, second.key)
+		t.Fail()
+	}
+}
+
+// roundAnswer rounds every number in a decoded JSON answer to 9 decimal places
+func roundAnswer(answer interface{}) interface{} {
+	switch answer := answer.(type) {
+	case float64:
+		rounded := math.Round(answer*1e9) / 1e9
+		if rounded == 0 {
+			return 0.0 // no negative zeros
+		}
+		return rounded
+	case []interface{}:
+		for i := range answer {
+			answer[i] = roundAnswer(answer[i])
+		}
+	case map[string]interface{}:
+		for key := range answer {
+			answer[key] = roundAnswer(answer[key])
+		}
+	}
+	return answer
+}
+
+// identityJSON writes an n by n identity matrix as JSON
+func identityJSON(n int) string {
+	mat := newMatrix(n, n)
+	for i := range mat {
+		mat[i][i] = 1
+	}
+	matBytes, _ := json.Marshal(mat)
+	return string(matBytes)
+}
@@ -2,10 +2,12 @@ package server
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"math"
+	"math/big"
+	"math/cmplx"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -14,22 +16,145 @@ import (
 // this package will want to create multiple routers with the same behavior
 var router *mux.Router
 
+// operation is a single entry in supportedOperations. It pairs the math itself with the policy
+// for caching its answers.  ratFn and bigFn back the precise mode (see precise.go): ratFn is exact
+// and returns errInexact when it can't be, in which case bigFn approximates the answer.  complexFn
+// backs the complex mode (see complex.go).  Integer operations (see integer.go) only have an intFn,
+// vector and matrix operations (see linalg.go) only have a linalgFn, statistics operations (see
+// statistics.go) only have a statsFn, and operations on expressions (see derive.go and numeric.go)
+// only have an exprFn.  unitFn handles operands with units (see units.go)
+type operation struct {
+	description string     // a short summary for the operations query and generated docs
+	answer      jsonObject // the answer's schema in the generated docs, for answers MathOKResponse doesn't describe
+
+	params   []string // the variables the operation reads, x and y unless otherwise specified
+	optional []string // variables the operation reads if they're given
+
+	fn    func(float64, float64) float64
+	ratFn func(x, y *big.Rat) (*big.Rat, error)
+	bigFn func(x, y *big.Float) (*big.Float, error)
+
+	complexFn func(args []complex128) (interface{}, error)
+
+	intFn    func(args []*big.Int) (interface{}, error)
+	intLimit intLimit
+
+	linalgFn func(args []linalgOperand) (interface{}, error)
+	shapes   []operandShape // one per param
+
+	statsFn func(args statsArgs) (interface{}, error)
+
+	unitFn func(x, y quantity) (quantity, error)
+
+	exprFn func(args exprArgs) (interface{}, error)
+
+	bitFn func(args []uint64, width bitWidth) interface{}
+
+	cache cachePolicy
+}
+
+// binaryParams are the params of the original binary operations
+var binaryParams = []string{"x", "y"}
+
 // supportedOperations defines a list of accepted endpoints and the associated math operations.
 // I'm a big supporter of maps of functions. They increase lookup time (on the part of anyone reading
 // the code), but they can considerably decrease code repetition and make extensibility easy
-var supportedOperations = map[string]func(float64, float64) float64{
-	"add":      func(x, y float64) float64 { return x + y },
-	"subtract": func(x, y float64) float64 { return x - y },
-	"multiply": func(x, y float64) float64 { return x * y },
-	"divide":   func(x, y float64) float64 { return x / y },
-	"mod":      func(x, y float64) float64 { return math.Mod(x, y) },
-	"pow":      func(x, y float64) float64 { return math.Pow(x, y) },
-	"root":     func(x, y float64) float64 { return math.Pow(x, 1/y) },
-	"log":      func(x, y float64) float64 { return math.Log(x) / math.Log(y) },
+var supportedOperations = map[string]*operation{
+	"add": {
+		description: "x plus y",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return x + y },
+		ratFn:       func(x, y *big.Rat) (*big.Rat, error) { return new(big.Rat).Add(x, y), nil },
+		complexFn:   func(args []complex128) (interface{}, error) { return args[0] + args[1], nil },
+		unitFn:      unitAdd,
+		cache:       noCachePolicy,
+	},
+	"subtract": {
+		description: "x minus y",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return x - y },
+		ratFn:       func(x, y *big.Rat) (*big.Rat, error) { return new(big.Rat).Sub(x, y), nil },
+		complexFn:   func(args []complex128) (interface{}, error) { return args[0] - args[1], nil },
+		unitFn:      unitSubtract,
+		cache:       noCachePolicy,
+	},
+	"multiply": {
+		description: "x times y",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return x * y },
+		ratFn:       func(x, y *big.Rat) (*big.Rat, error) { return new(big.Rat).Mul(x, y), nil },
+		complexFn:   func(args []complex128) (interface{}, error) { return args[0] * args[1], nil },
+		unitFn:      unitMultiply,
+		cache:       noCachePolicy,
+	},
+	"divide": {
+		description: "x divided by y",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return x / y },
+		ratFn:       ratDivide,
+		complexFn:   complexDivide,
+		unitFn:      unitDivide,
+		cache:       noCachePolicy,
+	},
+	"mod": {
+		description: "the remainder of x divided by y, with the sign of x",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return math.Mod(x, y) },
+		ratFn:       ratMod,
+		unitFn:      unitMod,
+		cache:       defaultCachePolicy,
+	},
+	"pow": {
+		description: "x to the power of y",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return math.Pow(x, y) },
+		ratFn:       ratPow,
+		bigFn:       bigPow,
+		complexFn:   func(args []complex128) (interface{}, error) { return cmplx.Pow(args[0], args[1]), nil },
+		unitFn:      unitPow,
+		cache:       defaultCachePolicy,
+	},
+	"root": {
+		description: "the yth root of x",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return math.Pow(x, 1/y) },
+		ratFn:       ratRoot,
+		bigFn:       bigRoot,
+		complexFn:   complexRoot,
+		unitFn:      unitRoot,
+		cache:       defaultCachePolicy,
+	},
+	"log": {
+		description: "the base y logarithm of x",
+		params:      binaryParams,
+		fn:          func(x, y float64) float64 { return math.Log(x) / math.Log(y) },
+		ratFn:       ratLog,
+		bigFn:       bigLogBase,
+		complexFn:   complexLog,
+		unitFn:      unitLog,
+		cache:       defaultCachePolicy,
+	},
+	"convert": {
+		description: "value in the unit from, converted to the unit to",
+		params:      []string{"value", "from", "to"},
+		unitFn:      unitConvert,
+		cache:       defaultCachePolicy,
+	},
 }
 
 func init() {
 	router = mux.NewRouter()
+	// these come first because /{op} would match them too
+	router.HandleFunc("/sequence", sequenceHandler)
+	router.HandleFunc("/series", sequenceHandler)
+	router.HandleFunc("/convert/base", baseHandler)
+	router.HandleFunc("/rpc", rpcHandler)
+	router.HandleFunc("/graphql", graphqlHandler)
+	router.HandleFunc("/ws", wsHandler)
+	router.HandleFunc("/events", eventsHandler)
+	router.HandleFunc("/openapi.json", openAPIHandler)
+	router.HandleFunc("/docs", docsHandler)
+	router.HandleFunc("/docs/{asset}", docsAssetHandler)
 	router.HandleFunc("/{op}", mathHandler)
 }
 
@@ -38,10 +163,9 @@ func GetRouter() *mux.Router {
 	return router
 }
 
-// mathHandler parses two arguments 'x' and 'y' from the client, applies the requested math operation,
-// builds a MathOKResponse struct, JSON encodes it, and returns it.
-// This functions sets off gocyclo for cyclomatic complexity (11), but I'm going to let it go considering
-// it's the only handler
+// mathHandler parses the operation's arguments ('x' and 'y' for most) from the client, applies the
+// requested math operation, builds a MathOKResponse struct, JSON encodes it, and returns it.  The math and caching itself is
+// handled by evaluation (see evaluate.go)
 func mathHandler(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		if r.Body == nil {
@@ -56,59 +180,78 @@ func mathHandler(w http.ResponseWriter, r *http.Request) {
 	muxVars := mux.Vars(r)
 	op := muxVars["op"]
 
-	x, y, err := parseClientVars(r)
+	vars, err := parseQueryOrRawVars(r)
 	if err != nil {
 		log.Printf("parse client vars failed: %s\n", err)
-		status, resBytes := createErrorResponse(http.StatusBadRequest, err)
-		w.WriteHeader(status)
-		_, err = w.Write(resBytes)
-		if err != nil {
-			// bummer, most we can do is log the error
-			log.Printf("response write failed: %s\n", err)
-		}
+		writeErrorResponse(w, newMathError(kindInvalidArgument, "%s", err))
 		return
 	}
 
-	if supportedOperations[op] == nil {
-		errStr := fmt.Sprintf("unsupported operation request: %q", op)
-		log.Printf(errStr)
-		status, resBytes := createErrorResponse(http.StatusBadRequest, fmt.Errorf(errStr))
-		w.WriteHeader(status)
-		_, err = w.Write(resBytes)
-		if err != nil {
-			log.Printf("response write failed: %s\n", err)
-		}
+	serveEvaluation(w, r, op, vars)
+}
+
+// serveEvaluation reads the request's options, builds the evaluation of route with buildEvaluation,
+// and writes it.  Every handler that answers with an evaluation ends up here, once it has the vars
+func serveEvaluation(w http.ResponseWriter, r *http.Request, route string, vars clientVars) {
+	opts, err := parseEvalOptions(r)
+	if err != nil {
+		log.Printf("parse eval options failed: %s\n", err)
+		writeErrorResponse(w, newMathError(kindInvalidArgument, "%s", err))
 		return
 	}
 
-	answer, inCache := retrieveFromCache(op, x, y)
-	if !inCache {
-		answer = supportedOperations[op](x, y)
+	eval, err := buildEvaluation(route, vars, opts)
+	if err != nil {
+		log.Printf("%s\n", err)
+		writeErrorResponse(w, err)
+		return
 	}
 
-	addToCache(op, x, y, answer)
+	writeEvaluation(w, r, eval)
+}
 
-	okResponse := MathOKResponse{
-		Action: op,
-		X:      x,
-		Y:      y,
-		Answer: answer,
-		Cached: inCache,
+// writeEvaluation runs eval and writes its MathOKResponse, handling conditional GET requests along
+// the way.  Only answers get cache headers, errors are sent with no-store so that nothing holds on
+// to a failure that might not happen next time
+func writeEvaluation(w http.ResponseWriter, r *http.Request, eval *evaluation) {
+	// only GET responses are cacheable over HTTP, POST requests always get a full answer
+	var etag string
+	if r.Method == http.MethodGet {
+		etag = eval.etag()
 	}
-	okResBytes, err := json.Marshal(okResponse)
-	if err != nil {
-		// included mathHandler in error log because we have the same error log description
-		// in createErrorResponse
-		log.Printf("mathHandler: json marshal failed: %s\n", err)
-		status, resBytes := createErrorResponse(http.StatusInternalServerError, err)
-		w.WriteHeader(status)
-		_, err = w.Write(resBytes)
+
+	// the ETag comes from the request, not the answer, so there's only something for it to match
+	// once we know there is an answer.  Otherwise 1/0 with If-None-Match: * would be a 304
+	start := time.Now()
+	okResponse, err := eval.run(parseCacheDirective(r))
+	latency := time.Since(start)
+
+	// the event is published once we know what the client gets, so an answer that couldn't be
+	// encoded is an error there too
+	var okResBytes []byte
+	if err == nil {
+		okResBytes, err = json.Marshal(okResponse)
 		if err != nil {
-			log.Printf("response write failed: %s\n", err)
+			// included writeEvaluation in error log because we have the same error log description
+			// in createErrorResponse
+			log.Printf("writeEvaluation: json marshal failed: %s\n", err)
 		}
+	}
+	publishEvaluation(eval, okResponse, err, latency)
+	if err != nil {
+		log.Printf("evaluate %s failed: %s\n", eval.op, err)
+		w.Header().Set("Cache-Control", "no-store")
+		writeErrorResponse(w, err)
 		return
 	}
 
+	if etag != "" {
+		setCacheHeaders(w, eval.policy, etag)
+		if etagMatches(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
 	w.WriteHeader(http.StatusOK) // don't need to call for 200 OK, but I prefer to be explicit
 	_, err = w.Write(okResBytes)
 	if err != nil {
@@ -116,16 +259,31 @@ func mathHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// createErrorResponse attempts to build a MathErrorResponse based upon the provided status and error.
+// writeErrorResponse builds an error response with createErrorResponse and writes it to the client
+func writeErrorResponse(w http.ResponseWriter, e error) {
+	status, resBytes := createErrorResponse(e)
+	w.WriteHeader(status)
+	_, err := w.Write(resBytes)
+	if err != nil {
+		// bummer, most we can do is log the error
+		log.Printf("response write failed: %s\n", err)
+	}
+}
+
+// createErrorResponse attempts to build a MathErrorResponse based upon the provided error's kind.
 // If there's an error marshalling the object, it returns a 500 Internal Server Error and an empty
 // body.
 // For errors, I'm attempting to send a representative JSON object back to the client, but that obviously
 // opens us up to json.Marshal() errors.  Not entirely sure what best practice is for returning errors to
 // the client, so I'm assuming JSON because that's the content-type that proper responses return in
-func createErrorResponse(status int, e error) (int, []byte) {
+func createErrorResponse(e error) (int, []byte) {
+	kind := kindOf(e)
+	status := errorStatuses[kind]
 	errResponse := MathErrorResponse{
-		Status: http.StatusBadRequest,
-		Error:  e.Error(),
+		Status:  status,
+		Code:    errorCodes[kind],
+		Error:   e.Error(),
+		Details: detailsOf(e),
 		// for simplicity's sake, we're trusting the client with the content of our error
 	}
 
@@ -135,5 +293,5 @@ func createErrorResponse(status int, e error) (int, []byte) {
 		return http.StatusInternalServerError, nil
 	}
 
-	return http.StatusBadRequest, resBytes
+	return status, resBytes
 }
@@ -26,6 +26,8 @@ func TestMathHandler(t *testing.T) {
 	cleanUpCache()
 	t.Run("json encoded", jsonRequest)
 	cleanUpCache()
+	t.Run("cache controls", cacheControlRequest)
+	cleanUpCache()
 }
 
 // formURLEncodedRequest tests a variety of requests with content-type application/x-www-form-urlencoded
@@ -35,9 +37,13 @@ func formURLEncodedRequest(t *testing.T) {
 	contentType := "application/x-www-form-urlencoded"
 
 	for operation := range supportedOperations {
+		if supportedOperations[operation].fn == nil {
+			// not a binary float64 operation, see integer_test.go and friends
+			continue
+		}
 		t.Log(operation)
 		expectedX, expectedY := 34.854, -0.935
-		if math.IsNaN(supportedOperations[operation](expectedX, expectedY)) {
+		if math.IsNaN(supportedOperations[operation].fn(expectedX, expectedY)) {
 			// make y more well-behaved for pow, root, and log
 			expectedY = 1.20034
 		}
@@ -48,22 +54,25 @@ func formURLEncodedRequest(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, reqURL, nil)
 		req.Header.Set("Content-Type", contentType)
 
-		cleanUpCache()                                               // not sure about best practice on borrowing this from cache_test.go
-		validRequest(t, operation, expectedX, expectedY, false, req) // first request w/o cached response
-		validRequest(t, operation, expectedX, expectedY, true, req)  // second expects cached response
+		// only operations with a caching policy should ever come back cached
+		cacheable := supportedOperations[operation].cache.cacheable
+
+		cleanUpCache()                                                   // not sure about best practice on borrowing this from cache_test.go
+		validRequest(t, operation, expectedX, expectedY, false, req)     // first request w/o cached response
+		validRequest(t, operation, expectedX, expectedY, cacheable, req) // second expects cached response
 
 		// this function waits the full answer expiration time for each operation
-		if !testing.Short() {
-			originalExpiration := cacheExpiration
-			cacheExpiration = time.Millisecond * 50
+		if !testing.Short() && cacheable {
+			originalExpiration := supportedOperations[operation].cache.expiration
+			supportedOperations[operation].cache.expiration = time.Millisecond * 50
 
 			cleanUpCache()
 			validRequest(t, operation, expectedX, expectedY, false, req)
 
-			time.Sleep(cacheExpiration)
+			time.Sleep(supportedOperations[operation].cache.expiration)
 			validRequest(t, operation, expectedX, expectedY, false, req)
 
-			cacheExpiration = originalExpiration
+			supportedOperations[operation].cache.expiration = originalExpiration
 		}
 
 		// missing content type
@@ -83,9 +92,13 @@ func jsonRequest(t *testing.T) {
 	contentType := "application/json"
 
 	for operation := range supportedOperations {
+		if supportedOperations[operation].fn == nil {
+			// not a binary float64 operation, see integer_test.go and friends
+			continue
+		}
 		t.Log(operation)
 		expectedX, expectedY := -44.444, 1.000001
-		if math.IsNaN(supportedOperations[operation](expectedX, expectedY)) {
+		if math.IsNaN(supportedOperations[operation].fn(expectedX, expectedY)) {
 			// make x and y more well-behaved for pow, root, and log
 			expectedX, expectedY = 26.8834, 7.00849
 		}
@@ -104,26 +117,28 @@ func jsonRequest(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, reqURL, bytes.NewReader(bodyBytes))
 		req.Header.Set("Content-Type", contentType)
 
+		cacheable := supportedOperations[operation].cache.cacheable
+
 		cleanUpCache()
 		validRequest(t, operation, expectedX, expectedY, false, req)
 
 		// easier than doing type assertion on req.Body then calling Reset()
 		req.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
-		validRequest(t, operation, expectedX, expectedY, true, req)
+		validRequest(t, operation, expectedX, expectedY, cacheable, req)
 
-		if !testing.Short() {
-			originalExpiration := cacheExpiration
-			cacheExpiration = time.Millisecond * 50
+		if !testing.Short() && cacheable {
+			originalExpiration := supportedOperations[operation].cache.expiration
+			supportedOperations[operation].cache.expiration = time.Millisecond * 50
 			cleanUpCache()
 
 			req.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
 			validRequest(t, operation, expectedX, expectedY, false, req)
 
-			time.Sleep(cacheExpiration)
+			time.Sleep(supportedOperations[operation].cache.expiration)
 			req.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
 			validRequest(t, operation, expectedX, expectedY, false, req)
 
-			cacheExpiration = originalExpiration
+			supportedOperations[operation].cache.expiration = originalExpiration
 		}
 
 		// missing content type
@@ -138,10 +153,50 @@ func jsonRequest(t *testing.T) {
 	}
 }
 
+// cacheControlRequest checks that clients can force recomputation or refuse it entirely.  It uses
+// pow because add and friends never touch the cache
+func cacheControlRequest(t *testing.T) {
+	contentType := "application/x-www-form-urlencoded"
+	operation := "pow"
+	expectedX, expectedY := 2.5, 3.0
+	reqURL := fmt.Sprintf("http://localhost:8080/%s?x=%f&y=%f", operation, expectedX, expectedY)
+
+	// only-if-cached with nothing in the cache
+	onlyCachedReq := httptest.NewRequest(http.MethodPost, reqURL, nil)
+	onlyCachedReq.Header.Set("Content-Type", contentType)
+	onlyCachedReq.Header.Set("Cache-Control", "only-if-cached")
+	errorRequest(t, http.StatusGatewayTimeout, onlyCachedReq)
+
+	req := httptest.NewRequest(http.MethodPost, reqURL, nil)
+	req.Header.Set("Content-Type", contentType)
+	validRequest(t, operation, expectedX, expectedY, false, req)
+
+	// only-if-cached now that it's in the cache
+	onlyCachedReq = httptest.NewRequest(http.MethodPost, reqURL, nil)
+	onlyCachedReq.Header.Set("Content-Type", contentType)
+	onlyCachedReq.Header.Set("Cache-Control", "only-if-cached")
+	validRequest(t, operation, expectedX, expectedY, true, onlyCachedReq)
+
+	// no-cache header
+	noCacheReq := httptest.NewRequest(http.MethodPost, reqURL, nil)
+	noCacheReq.Header.Set("Content-Type", contentType)
+	noCacheReq.Header.Set("Cache-Control", "max-age=0, no-cache")
+	validRequest(t, operation, expectedX, expectedY, false, noCacheReq)
+
+	// nocache query parameter
+	noCacheParamReq := httptest.NewRequest(http.MethodPost, reqURL+"&nocache", nil)
+	noCacheParamReq.Header.Set("Content-Type", contentType)
+	validRequest(t, operation, expectedX, expectedY, false, noCacheParamReq)
+
+	noCacheFalseReq := httptest.NewRequest(http.MethodPost, reqURL+"&nocache=false", nil)
+	noCacheFalseReq.Header.Set("Content-Type", contentType)
+	validRequest(t, operation, expectedX, expectedY, true, noCacheFalseReq)
+}
+
 // validRequest makes a correctly formatted request to the router and checks the response for errors.
 func validRequest(t *testing.T, expectedOp string, expectedX, expectedY float64, expectedCachedVal bool, req *http.Request) {
 	// can only create expectedAns this way because this test checks valid requests only
-	expectedAns := supportedOperations[expectedOp](expectedX, expectedY)
+	expectedAns := supportedOperations[expectedOp].fn(expectedX, expectedY)
 	resRecorder := httptest.NewRecorder()
 
 	GetRouter().ServeHTTP(resRecorder, req)
@@ -177,6 +232,15 @@ func validRequest(t *testing.T, expectedOp string, expectedX, expectedY float64,
 		t.Logf("unexpected cached value: (actual %t != expected %t)\n", mathRes.Cached, expectedCachedVal)
 		t.Fail()
 	}
+
+	expectedSource := sourceComputed
+	if expectedCachedVal {
+		expectedSource = sourceCached
+	}
+	if mathRes.Source != expectedSource {
+		t.Logf("unexpected source value: (actual %s != expected %s)\n", mathRes.Source, expectedSource)
+		t.Fail()
+	}
 }
 
 // errorRequest makes an incorrectly formatted request to the router and checks the returned status as
@@ -204,3 +268,36 @@ func errorRequest(t *testing.T, expectedStatus int, req *http.Request) {
 		t.Fail()
 	}
 }
+
+// TestNonFiniteAnswer checks that answers JSON can't hold are domain errors, whichever way they're
+// asked for, and that they aren't cached
+func TestNonFiniteAnswer(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	requests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodPost, "/divide", `{"x": 1, "y": 0}`},
+		{http.MethodGet, "/divide?x=1&y=0", ""},
+		{http.MethodPost, "/root", `{"x": -8, "y": 2}`},
+		{http.MethodPost, "/pow", `{"x": 10, "y": 400}`},
+		{http.MethodPost, "/pow", `{"x": 10, "y": 400}`}, // again, in case the first was cached
+	}
+
+	for _, request := range requests {
+		req := httptest.NewRequest(request.method, "http://localhost:8080"+request.target, bytes.NewBufferString(request.body))
+		if request.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		errorRequest(t, http.StatusUnprocessableEntity, req)
+	}
+
+	status, _ := Compute("divide", map[string]json.RawMessage{"x": json.RawMessage("1"), "y": json.RawMessage("0")}, nil)
+	if status != http.StatusUnprocessableEntity {
+		t.Logf("unexpected Compute status: (actual %d != expected %d)\n", status, http.StatusUnprocessableEntity)
+		t.Fail()
+	}
+}
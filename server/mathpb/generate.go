@@ -0,0 +1,5 @@
+// Package mathpb holds the protobuf messages and gRPC service definition for math-serv, generated
+// from math.proto
+package mathpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative math.proto
@@ -0,0 +1,232 @@
+// The gRPC interface to math-serv.  Requests carry the same variables and options as HTTP requests
+// do, so anything that works as a JSON body and query string works here too.  The Go code in this
+// directory is generated from this file with protoc-gen-go and protoc-gen-go-grpc
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: math.proto
+
+package mathpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Math_Compute_FullMethodName       = "/mathserv.Math/Compute"
+	Math_Batch_FullMethodName         = "/mathserv.Math/Batch"
+	Math_ComputeStream_FullMethodName = "/mathserv.Math/ComputeStream"
+)
+
+// MathClient is the client API for Math service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MathClient interface {
+	// Compute evaluates a single operation.  Errors are reported as gRPC statuses with an Error in
+	// their details
+	Compute(ctx context.Context, in *ComputeRequest, opts ...grpc.CallOption) (*ComputeResponse, error)
+	// Batch evaluates several operations.  One failure doesn't fail the batch, it's reported in that
+	// request's response instead
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// ComputeStream evaluates operations as they're sent, answering each with a response carrying
+	// the same id.  Responses are sent in the order their requests arrive
+	ComputeStream(ctx context.Context, opts ...grpc.CallOption) (Math_ComputeStreamClient, error)
+}
+
+type mathClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMathClient(cc grpc.ClientConnInterface) MathClient {
+	return &mathClient{cc}
+}
+
+func (c *mathClient) Compute(ctx context.Context, in *ComputeRequest, opts ...grpc.CallOption) (*ComputeResponse, error) {
+	out := new(ComputeResponse)
+	err := c.cc.Invoke(ctx, Math_Compute_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mathClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, Math_Batch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mathClient) ComputeStream(ctx context.Context, opts ...grpc.CallOption) (Math_ComputeStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Math_ServiceDesc.Streams[0], Math_ComputeStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &mathComputeStreamClient{stream}
+	return x, nil
+}
+
+type Math_ComputeStreamClient interface {
+	Send(*ComputeRequest) error
+	Recv() (*ComputeResponse, error)
+	grpc.ClientStream
+}
+
+type mathComputeStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *mathComputeStreamClient) Send(m *ComputeRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *mathComputeStreamClient) Recv() (*ComputeResponse, error) {
+	m := new(ComputeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MathServer is the server API for Math service.
+// All implementations must embed UnimplementedMathServer
+// for forward compatibility
+type MathServer interface {
+	// Compute evaluates a single operation.  Errors are reported as gRPC statuses with an Error in
+	// their details
+	Compute(context.Context, *ComputeRequest) (*ComputeResponse, error)
+	// Batch evaluates several operations.  One failure doesn't fail the batch, it's reported in that
+	// request's response instead
+	Batch(context.Context, *BatchRequest) (*BatchResponse, error)
+	// ComputeStream evaluates operations as they're sent, answering each with a response carrying
+	// the same id.  Responses are sent in the order their requests arrive
+	ComputeStream(Math_ComputeStreamServer) error
+	mustEmbedUnimplementedMathServer()
+}
+
+// UnimplementedMathServer must be embedded to have forward compatible implementations.
+type UnimplementedMathServer struct {
+}
+
+func (UnimplementedMathServer) Compute(context.Context, *ComputeRequest) (*ComputeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Compute not implemented")
+}
+func (UnimplementedMathServer) Batch(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Batch not implemented")
+}
+func (UnimplementedMathServer) ComputeStream(Math_ComputeStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ComputeStream not implemented")
+}
+func (UnimplementedMathServer) mustEmbedUnimplementedMathServer() {}
+
+// UnsafeMathServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MathServer will
+// result in compilation errors.
+type UnsafeMathServer interface {
+	mustEmbedUnimplementedMathServer()
+}
+
+func RegisterMathServer(s grpc.ServiceRegistrar, srv MathServer) {
+	s.RegisterService(&Math_ServiceDesc, srv)
+}
+
+func _Math_Compute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ComputeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MathServer).Compute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Math_Compute_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MathServer).Compute(ctx, req.(*ComputeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Math_Batch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MathServer).Batch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Math_Batch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MathServer).Batch(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Math_ComputeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MathServer).ComputeStream(&mathComputeStreamServer{stream})
+}
+
+type Math_ComputeStreamServer interface {
+	Send(*ComputeResponse) error
+	Recv() (*ComputeRequest, error)
+	grpc.ServerStream
+}
+
+type mathComputeStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *mathComputeStreamServer) Send(m *ComputeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *mathComputeStreamServer) Recv() (*ComputeRequest, error) {
+	m := new(ComputeRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Math_ServiceDesc is the grpc.ServiceDesc for Math service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Math_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mathserv.Math",
+	HandlerType: (*MathServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Compute",
+			Handler:    _Math_Compute_Handler,
+		},
+		{
+			MethodName: "Batch",
+			Handler:    _Math_Batch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ComputeStream",
+			Handler:       _Math_ComputeStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "math.proto",
+}
@@ -1,22 +1,141 @@
 package server
 
+import "time"
+
 // MathRequest is the standard request struct (and its various encodings)
 type MathRequest struct {
 	X float64 `json:"x"`
 	Y float64 `json:"y"`
 }
 
-// MathOKResponse is returned to the client after a request is properly handled (without errors)
+// MathOKResponse is returned to the client after a request is properly handled (without errors).
+// X, Y, and Answer are float64 in the default float mode, decimal strings in precise mode, fractions
+// in rational mode (so that JSON doesn't truncate them), and ComplexNumbers in complex mode.
+// Integer operations answer with decimal strings, except for isprime, whose answer is a boolean
 type MathOKResponse struct {
-	Action string  `json:"action"`
-	X      float64 `json:"x"` // in case our client gets any big ideas
-	Y      float64 `json:"y"`
-	Answer float64 `json:"answer"`
-	Cached bool    `json:"cached"`
+	Action    string                 `json:"action"`
+	Mode      string                 `json:"mode"`
+	X         interface{}            `json:"x,omitempty"` // in case our client gets any big ideas
+	Y         interface{}            `json:"y,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"` // instead of x and y for operations with other variables
+	Answer    interface{}            `json:"answer"`
+	Decimal   string                 `json:"decimal,omitempty"`   // rational mode's decimal expansion, if requested
+	Formatted interface{}            `json:"formatted,omitempty"` // the answer formatted as requested, see format.go
+	Cached    bool                   `json:"cached"`
+	Source    string                 `json:"source"` // one of "computed", "cached", or "coalesced"
+}
+
+// ComplexNumber is how complex operands and answers are encoded.  Operands can also be written as
+// strings like "1-2i"
+type ComplexNumber struct {
+	Re float64 `json:"re"`
+	Im float64 `json:"im"`
+}
+
+// Quantity is how unit-aware operands and answers are encoded, see units.go
+type Quantity struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// ExpressionNode is a single node of an expression's syntax tree.  Type is one of "number",
+// "constant", "variable", or "call", and operators are calls of the operation with the same name
+// (x + 1 is a call of add)
+type ExpressionNode struct {
+	Type  string            `json:"type"`
+	Name  string            `json:"name,omitempty"`
+	Value *float64          `json:"value,omitempty"` // a pointer so that zero isn't omitted
+	Args  []*ExpressionNode `json:"args,omitempty"`
+}
+
+// Derivative is the answer of the derive operation.  Value is only included if the derivative was
+// evaluated at a point
+type Derivative struct {
+	Expression string          `json:"expression"`
+	AST        *ExpressionNode `json:"ast"`
+	Value      *float64        `json:"value,omitempty"`
+}
+
+// NumericResult is the answer of the numerical methods.  Value is the root, the integral, or where
+// the minimum is, and F is the expression's value there (for roots and minimums)
+type NumericResult struct {
+	Value         float64  `json:"value"`
+	F             *float64 `json:"f,omitempty"`
+	Method        string   `json:"method"`
+	Iterations    int      `json:"iterations"`
+	Evaluations   int      `json:"evaluations"`
+	ErrorEstimate float64  `json:"errorEstimate"`
+	Converged     bool     `json:"converged"` // whether the error estimate got below the tolerance
+}
+
+// SequencePage is the answer of /sequence and /series.  Values are terms or partial sums, starting
+// with the one at Offset.  NextCursor is omitted from the last page
+type SequencePage struct {
+	Offset     int           `json:"offset"`
+	Count      int           `json:"count"` // the total number of terms, across every page
+	Values     []interface{} `json:"values"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// SequenceTerm is a single line of a sequence streamed as NDJSON
+type SequenceTerm struct {
+	Index int         `json:"index"`
+	Value interface{} `json:"value"`
+}
+
+// SequenceEnd is the last line of a sequence streamed as NDJSON, so that clients can tell a stream
+// that finished from one that was cut off
+type SequenceEnd struct {
+	Done  bool `json:"done"`
+	Count int  `json:"count"` // the total number of terms, the same as SequencePage's
+}
+
+// HistogramBucket is a single bucket of the histogram operation's answer
+type HistogramBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// BitPattern is the answer to a bitwise operation.  Value is the pattern read at the requested width
+// and signedness, while Hex and Binary are the raw bits padded to the full width
+type BitPattern struct {
+	Value  string `json:"value"`
+	Hex    string `json:"hex"`
+	Binary string `json:"binary"`
+}
+
+// CacheStats describes the answer cache: how many answers it holds, running totals of how it's been
+// used since the server started, and how many evaluations are in flight right now
+type CacheStats struct {
+	Items     int    `json:"items"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Sets      uint64 `json:"sets"`
+	Evictions uint64 `json:"evictions"` // expired answers that were cleaned up
+	InFlight  int    `json:"inFlight"`
+}
+
+// ComputeEvent is a single evaluation as it's sent on /events.  Failed evaluations have a Code and
+// an Error instead of an Answer
+type ComputeEvent struct {
+	ID        uint64      `json:"id"`
+	Op        string      `json:"op"`
+	Mode      string      `json:"mode"`
+	Answer    interface{} `json:"answer,omitempty"`
+	Cached    bool        `json:"cached"`
+	Source    string      `json:"source,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	LatencyMs float64     `json:"latencyMs"`
+	Time      time.Time   `json:"time"`
 }
 
 // MathErrorResponse is returned to the client if there was an error handling their request
 type MathErrorResponse struct {
 	Status int    `json:"status"`
+	Code   string `json:"code"` // machine readable version of Error, see errorCodes
 	Error  string `json:"error"`
+
+	Details map[string]interface{} `json:"details,omitempty"` // structured context for some errors, like the dimensions that didn't match
 }
@@ -0,0 +1,688 @@
+package server
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// The numerical methods find roots, definite integrals, and minimums of a one variable expression
+// (see expression.go).  Every answer includes how many iterations it took and an estimate of its
+// error, along with whether it converged to within the requested tolerance
+
+const defaultTolerance = 1e-10
+const defaultMaxIterations = 1000
+const maxNumericIterations = 100000
+const defaultNumericTimeout = time.Second
+const maxNumericTimeout = 10 * time.Second
+
+// maxSimpsonDepth keeps adaptive Simpson from recursing forever around a singularity
+const maxSimpsonDepth = 50
+
+// deadlineCheckInterval is how many evaluations happen between checks of the deadline, checking
+// the clock on every evaluation would be a noticeable share of the work
+const deadlineCheckInterval = 64
+
+// numericOperations are merged into supportedOperations in init
+var numericOperations = map[string]*operation{
+	"findroot": {
+		description: "a root of expression",
+		params:      []string{"expression"},
+		optional:    []string{"method", "a", "b", "x0", "tolerance", "maxiter", "timeout"},
+		exprFn:      exprFindRoot,
+		cache:       defaultCachePolicy,
+	},
+	"integrate": {
+		description: "the definite integral of expression from a to b",
+		params:      []string{"expression", "a", "b"},
+		optional:    []string{"method", "tolerance", "maxiter", "timeout"},
+		exprFn:      exprIntegrate,
+		cache:       defaultCachePolicy,
+	},
+	"minimize": {
+		description: "the minimum of expression between a and b",
+		params:      []string{"expression", "a", "b"},
+		optional:    []string{"method", "tolerance", "maxiter", "timeout"},
+		exprFn:      exprMinimize,
+		cache:       defaultCachePolicy,
+	},
+}
+
+func init() {
+	for name, op := range numericOperations {
+		supportedOperations[name] = op
+	}
+}
+
+// numericFunc evaluates an expression of a single variable, counting evaluations and enforcing
+// a deadline
+type numericFunc struct {
+	expr        *exprNode
+	vars        map[string]float64
+	variable    string
+	deadline    time.Time
+	evaluations int
+}
+
+func newNumericFunc(args exprArgs) (*numericFunc, error) {
+	for name := range args.expr.variables(nil) {
+		if name != args.variable {
+			return nil, newMathError(kindInvalidArgument, "expression can only depend on %s, found %s", args.variable, name)
+		}
+	}
+
+	return &numericFunc{
+		expr:     args.expr,
+		vars:     make(map[string]float64, 1),
+		variable: args.variable,
+		deadline: time.Now().Add(args.timeout),
+	}, nil
+}
+
+func (f *numericFunc) at(x float64) (float64, error) {
+	if f.evaluations%deadlineCheckInterval == 0 && time.Now().After(f.deadline) {
+		return 0, newMathError(kindLimitExceeded, "deadline exceeded after %d evaluations", f.evaluations)
+	}
+	f.evaluations++
+
+	f.vars[f.variable] = x
+	return f.expr.eval(f.vars)
+}
+
+// numericAnswer is what every numerical method returns.  Methods decide for themselves whether they
+// converged since some of them stop on criteria other than the error estimate
+type numericAnswer struct {
+	value         float64
+	iterations    int
+	errorEstimate float64
+	converged     bool
+}
+
+// numericMethod is the signature shared by every method of every numerical operation
+type numericMethod func(f *numericFunc, args exprArgs) (numericAnswer, error)
+
+// runNumeric looks up the requested method and builds a NumericResult from what it returns
+func runNumeric(op string, methods map[string]numericMethod, defaultMethod string, args exprArgs) (NumericResult, error) {
+	name := args.method
+	if name == "" {
+		name = defaultMethod
+	}
+	method, ok := methods[name]
+	if !ok {
+		names := make([]string, 0, len(methods))
+		for name := range methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return NumericResult{}, newMathError(kindInvalidArgument, "unsupported %s method %q, expected one of %v", op, name, names)
+	}
+
+	f, err := newNumericFunc(args)
+	if err != nil {
+		return NumericResult{}, err
+	}
+
+	ans, err := method(f, args)
+	if err != nil {
+		return NumericResult{}, err
+	}
+
+	return NumericResult{
+		Value:         ans.value,
+		Method:        name,
+		Iterations:    ans.iterations,
+		Evaluations:   f.evaluations,
+		ErrorEstimate: ans.errorEstimate,
+		Converged:     ans.converged,
+	}, nil
+}
+
+// requireInterval makes sure a and b were given and are in order
+func requireInterval(args exprArgs) (float64, float64, error) {
+	if args.a == nil || args.b == nil {
+		return 0, 0, newMathError(kindInvalidArgument, "an interval from a to b is required")
+	}
+	if *args.a >= *args.b {
+		return 0, 0, newMathError(kindInvalidArgument, "a must be less than b, got %g and %g", *args.a, *args.b)
+	}
+	return *args.a, *args.b, nil
+}
+
+var rootMethods = map[string]numericMethod{
+	"bisection": bisection,
+	"newton":    newton,
+	"brent":     brentRoot,
+}
+
+func exprFindRoot(args exprArgs) (interface{}, error) {
+	res, err := runNumeric("findroot", rootMethods, "brent", args)
+	if err != nil {
+		return nil, err
+	}
+
+	// f is evaluated separately so it doesn't count against the method's evaluations
+	fx, err := args.expr.eval(map[string]float64{args.variable: res.Value})
+	if err != nil {
+		return nil, err
+	}
+	res.F = &fx
+	return res, nil
+}
+
+// bracket evaluates f at both ends of the interval, which must have a sign change
+func bracket(f *numericFunc, args exprArgs) (a, b, fa, fb float64, err error) {
+	a, b, err = requireInterval(args)
+	if err != nil {
+		return
+	}
+	if fa, err = f.at(a); err != nil {
+		return
+	}
+	if fb, err = f.at(b); err != nil {
+		return
+	}
+	if fa*fb > 0 {
+		err = newMathError(kindDomain, "%s has the same sign at a and b, so they don't bracket a root", f.expr)
+	}
+	return
+}
+
+func bisection(f *numericFunc, args exprArgs) (numericAnswer, error) {
+	a, b, fa, _, err := bracket(f, args)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	var iterations int
+	for iterations = 1; iterations <= args.maxIterations; iterations++ {
+		m := a + (b-a)/2
+		fm, err := f.at(m)
+		if err != nil {
+			return numericAnswer{}, err
+		}
+		if fm == 0 {
+			return numericAnswer{m, iterations, 0, true}, nil
+		}
+
+		if (fm < 0) == (fa < 0) {
+			a, fa = m, fm
+		} else {
+			b = m
+		}
+		if (b-a)/2 <= args.tolerance {
+			break
+		}
+	}
+	if iterations > args.maxIterations {
+		iterations = args.maxIterations
+	}
+
+	return numericAnswer{a + (b-a)/2, iterations, (b - a) / 2, (b-a)/2 <= args.tolerance}, nil
+}
+
+// newton uses the symbolic derivative of the expression.  It starts from x0, or the middle of a to
+// b if x0 isn't given
+func newton(f *numericFunc, args exprArgs) (numericAnswer, error) {
+	var x float64
+	switch {
+	case args.x0 != nil:
+		x = *args.x0
+	case args.a != nil && args.b != nil:
+		x = *args.a + (*args.b-*args.a)/2
+	default:
+		return numericAnswer{}, newMathError(kindInvalidArgument, "newton needs a starting point x0")
+	}
+
+	// the derivative counts against the same deadline as the iterations, which it can take longer
+	// than for a big enough expression
+	budget := newExprBudget(f.deadline)
+	derivative, err := differentiate(f.expr, f.variable, budget)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+	derivative, err = simplify(derivative, budget)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+	df := &numericFunc{expr: derivative, vars: f.vars, variable: f.variable, deadline: f.deadline}
+
+	step := math.Inf(1)
+	var iterations int
+	for iterations = 1; iterations <= args.maxIterations; iterations++ {
+		fx, err := f.at(x)
+		if err != nil {
+			return numericAnswer{}, err
+		}
+		dfx, err := df.at(x)
+		if err != nil {
+			return numericAnswer{}, err
+		}
+		if dfx == 0 {
+			return numericAnswer{}, newMathError(kindDomain, "the derivative of %s is zero at %g", f.expr, x)
+		}
+
+		step = fx / dfx
+		x -= step
+		if math.Abs(step) <= args.tolerance {
+			break
+		}
+	}
+	if iterations > args.maxIterations {
+		iterations = args.maxIterations
+	}
+	f.evaluations += df.evaluations
+
+	if err := checkFinite(x); err != nil {
+		return numericAnswer{}, newMathError(kindDomain, "newton's method diverged")
+	}
+	return numericAnswer{x, iterations, math.Abs(step), math.Abs(step) <= args.tolerance}, nil
+}
+
+// brentRoot combines bisection, the secant method, and inverse quadratic interpolation.  b is the
+// best guess so far, a is the previous one, and c brackets the root along with b
+func brentRoot(f *numericFunc, args exprArgs) (numericAnswer, error) {
+	a, b, fa, fb, err := bracket(f, args)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	c, fc := b, fb
+	var d, e, xm float64
+	var iterations int
+	for iterations = 1; iterations <= args.maxIterations; iterations++ {
+		if (fb > 0) == (fc > 0) {
+			c, fc = a, fa
+			d = b - a
+			e = d
+		}
+		if math.Abs(fc) < math.Abs(fb) {
+			a, b, c = b, c, b
+			fa, fb, fc = fb, fc, fb
+		}
+
+		tol := 2*epsilon*math.Abs(b) + args.tolerance/2
+		xm = (c - b) / 2
+		if math.Abs(xm) <= tol || fb == 0 {
+			return numericAnswer{b, iterations, math.Abs(xm), true}, nil
+		}
+
+		if math.Abs(e) >= tol && math.Abs(fa) > math.Abs(fb) {
+			var p, q float64
+			s := fb / fa
+			if a == c {
+				// secant
+				p = 2 * xm * s
+				q = 1 - s
+			} else {
+				// inverse quadratic interpolation
+				q = fa / fc
+				r := fb / fc
+				p = s * (2*xm*q*(q-r) - (b-a)*(r-1))
+				q = (q - 1) * (r - 1) * (s - 1)
+			}
+			if p > 0 {
+				q = -q
+			}
+			p = math.Abs(p)
+
+			if 2*p < math.Min(3*xm*q-math.Abs(tol*q), math.Abs(e*q)) {
+				e = d
+				d = p / q
+			} else {
+				d = xm
+				e = d
+			}
+		} else {
+			d = xm
+			e = d
+		}
+
+		a, fa = b, fb
+		if math.Abs(d) > tol {
+			b += d
+		} else {
+			b += math.Copysign(tol, xm)
+		}
+		if fb, err = f.at(b); err != nil {
+			return numericAnswer{}, err
+		}
+	}
+
+	return numericAnswer{b, args.maxIterations, math.Abs(xm), false}, nil
+}
+
+// epsilon is the difference between 1 and the next float64
+var epsilon = math.Nextafter(1, 2) - 1
+
+var integrationMethods = map[string]numericMethod{
+	"simpson":       adaptiveSimpson,
+	"gauss-kronrod": gaussKronrod,
+}
+
+func exprIntegrate(args exprArgs) (interface{}, error) {
+	return runNumeric("integrate", integrationMethods, "gauss-kronrod", args)
+}
+
+// adaptiveSimpson splits intervals in half until Simpson's rule agrees with itself on both halves.
+// Each split counts as an iteration
+func adaptiveSimpson(f *numericFunc, args exprArgs) (numericAnswer, error) {
+	a, b, err := requireInterval(args)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	fa, err := f.at(a)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+	fm, err := f.at((a + b) / 2)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+	fb, err := f.at(b)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	iterations := 0
+	converged := true
+	var simpson func(a, b, fa, fm, fb, whole, tolerance float64, depth int) (float64, float64, error)
+	simpson = func(a, b, fa, fm, fb, whole, tolerance float64, depth int) (float64, float64, error) {
+		m := (a + b) / 2
+		flm, err := f.at((a + m) / 2)
+		if err != nil {
+			return 0, 0, err
+		}
+		frm, err := f.at((m + b) / 2)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		left := (m - a) / 6 * (fa + 4*flm + fm)
+		right := (b - m) / 6 * (fm + 4*frm + fb)
+		delta := left + right - whole
+		iterations++
+
+		// Richardson extrapolation, the error of the halves is about delta/15
+		if math.Abs(delta) <= 15*tolerance {
+			return left + right + delta/15, math.Abs(delta) / 15, nil
+		}
+		if depth == 0 || iterations >= args.maxIterations {
+			converged = false
+			return left + right + delta/15, math.Abs(delta) / 15, nil
+		}
+
+		leftValue, leftError, err := simpson(a, m, fa, flm, fm, left, tolerance/2, depth-1)
+		if err != nil {
+			return 0, 0, err
+		}
+		rightValue, rightError, err := simpson(m, b, fm, frm, fb, right, tolerance/2, depth-1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return leftValue + rightValue, leftError + rightError, nil
+	}
+
+	whole := (b - a) / 6 * (fa + 4*fm + fb)
+	value, errorEstimate, err := simpson(a, b, fa, fm, fb, whole, args.tolerance, maxSimpsonDepth)
+	return numericAnswer{value, iterations, errorEstimate, converged}, err
+}
+
+// The 15 point Kronrod rule and the 7 point Gauss rule it extends.  Nodes are the positive half of
+// [-1, 1], and every other Kronrod node is a Gauss node
+var (
+	kronrodNodes = [8]float64{
+		0.991455371120812639206854697526329, 0.949107912342758524526189684047851,
+		0.864864423359769072789712788640926, 0.741531185599394439863864773280788,
+		0.586087235467691130294144845693013, 0.405845151377397166906606412076961,
+		0.207784955007898467600689403773245, 0,
+	}
+	kronrodWeights = [8]float64{
+		0.022935322010529224963732008058970, 0.063092092629978553290700663189204,
+		0.104790010322250183839876322541518, 0.140653259715525918745189590510238,
+		0.169004726639267902826583426598550, 0.190350578064785409913256402421014,
+		0.204432940075298892414161999234649, 0.209482141084727828012999174891714,
+	}
+	gaussWeights = [4]float64{
+		0.129484966168869693270611432679082, 0.279705391489276667901467771423780,
+		0.381830050505118944950369775488975, 0.417959183673469387755102040816327,
+	}
+)
+
+// kronrodInterval is a piece of the integral and the difference between its two estimates
+type kronrodInterval struct {
+	a, b, value, err float64
+}
+
+// gaussKronrod applies the 15 point Gauss-Kronrod rule, then repeatedly splits whichever interval
+// has the largest error.  Each split counts as an iteration
+func gaussKronrod(f *numericFunc, args exprArgs) (numericAnswer, error) {
+	a, b, err := requireInterval(args)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	whole, err := kronrod(f, a, b)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+	intervals := []kronrodInterval{whole}
+	value, errorEstimate := whole.value, whole.err
+
+	iterations := 0
+	for errorEstimate > args.tolerance && iterations < args.maxIterations {
+		worst := 0
+		for i := range intervals {
+			if intervals[i].err > intervals[worst].err {
+				worst = i
+			}
+		}
+
+		split := intervals[worst]
+		m := (split.a + split.b) / 2
+		left, err := kronrod(f, split.a, m)
+		if err != nil {
+			return numericAnswer{}, err
+		}
+		right, err := kronrod(f, m, split.b)
+		if err != nil {
+			return numericAnswer{}, err
+		}
+
+		intervals[worst] = left
+		intervals = append(intervals, right)
+		value += left.value + right.value - split.value
+		errorEstimate += left.err + right.err - split.err
+		iterations++
+	}
+
+	// the running sums pick up rounding errors, so the answer is summed from scratch
+	value, errorEstimate = 0, 0
+	for _, interval := range intervals {
+		value += interval.value
+		errorEstimate += interval.err
+	}
+	return numericAnswer{value, iterations, errorEstimate, errorEstimate <= args.tolerance}, nil
+}
+
+func kronrod(f *numericFunc, a, b float64) (kronrodInterval, error) {
+	center := (a + b) / 2
+	half := (b - a) / 2
+
+	fc, err := f.at(center)
+	if err != nil {
+		return kronrodInterval{}, err
+	}
+	k := kronrodWeights[7] * fc
+	g := gaussWeights[3] * fc
+	for i := 0; i < 7; i++ {
+		dx := half * kronrodNodes[i]
+		f1, err := f.at(center - dx)
+		if err != nil {
+			return kronrodInterval{}, err
+		}
+		f2, err := f.at(center + dx)
+		if err != nil {
+			return kronrodInterval{}, err
+		}
+
+		k += kronrodWeights[i] * (f1 + f2)
+		if i%2 == 1 {
+			g += gaussWeights[i/2] * (f1 + f2)
+		}
+	}
+
+	return kronrodInterval{a: a, b: b, value: k * half, err: math.Abs((k - g) * half)}, nil
+}
+
+var minimizationMethods = map[string]numericMethod{
+	"golden": goldenSection,
+	"brent":  brentMinimize,
+}
+
+func exprMinimize(args exprArgs) (interface{}, error) {
+	res, err := runNumeric("minimize", minimizationMethods, "brent", args)
+	if err != nil {
+		return nil, err
+	}
+
+	fx, err := args.expr.eval(map[string]float64{args.variable: res.Value})
+	if err != nil {
+		return nil, err
+	}
+	res.F = &fx
+	return res, nil
+}
+
+// goldenRatio is the fraction of an interval that golden section search keeps each iteration
+var goldenRatio = (math.Sqrt(5) - 1) / 2
+
+// goldenSection narrows a to b around a minimum, reusing one of its two interior points each time
+func goldenSection(f *numericFunc, args exprArgs) (numericAnswer, error) {
+	a, b, err := requireInterval(args)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	c, d := b-goldenRatio*(b-a), a+goldenRatio*(b-a)
+	fc, err := f.at(c)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+	fd, err := f.at(d)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	var iterations int
+	for iterations = 1; iterations <= args.maxIterations && (b-a)/2 > args.tolerance; iterations++ {
+		if fc < fd {
+			b, d, fd = d, c, fc
+			c = b - goldenRatio*(b-a)
+			fc, err = f.at(c)
+		} else {
+			a, c, fc = c, d, fd
+			d = a + goldenRatio*(b-a)
+			fd, err = f.at(d)
+		}
+		if err != nil {
+			return numericAnswer{}, err
+		}
+	}
+
+	return numericAnswer{a + (b-a)/2, iterations - 1, (b - a) / 2, (b-a)/2 <= args.tolerance}, nil
+}
+
+// brentMinimize combines golden section search with parabolic interpolation through the three best
+// points so far: x (the best), w (the second best), and v (the previous w)
+func brentMinimize(f *numericFunc, args exprArgs) (numericAnswer, error) {
+	a, b, err := requireInterval(args)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+
+	goldenStep := 1 - goldenRatio
+	x := a + goldenStep*(b-a)
+	w, v := x, x
+	fx, err := f.at(x)
+	if err != nil {
+		return numericAnswer{}, err
+	}
+	fw, fv := fx, fx
+
+	var d, e float64
+	sqrtEpsilon := math.Sqrt(epsilon)
+	var iterations int
+	for iterations = 1; iterations <= args.maxIterations; iterations++ {
+		xm := (a + b) / 2
+		tol := sqrtEpsilon*math.Abs(x) + args.tolerance/3
+		if math.Abs(x-xm) <= 2*tol-(b-a)/2 {
+			return numericAnswer{x, iterations, (b - a) / 2, true}, nil
+		}
+
+		parabolic := false
+		if math.Abs(e) > tol {
+			r := (x - w) * (fx - fv)
+			q := (x - v) * (fx - fw)
+			p := (x-v)*q - (x-w)*r
+			q = 2 * (q - r)
+			if q > 0 {
+				p = -p
+			}
+			q = math.Abs(q)
+
+			// only accept the parabola's minimum if it's inside the interval and the step is
+			// shrinking
+			if math.Abs(p) < math.Abs(q*e/2) && p > q*(a-x) && p < q*(b-x) {
+				e = d
+				d = p / q
+				parabolic = true
+				if u := x + d; u-a < 2*tol || b-u < 2*tol {
+					d = math.Copysign(tol, xm-x)
+				}
+			}
+		}
+		if !parabolic {
+			if x < xm {
+				e = b - x
+			} else {
+				e = a - x
+			}
+			d = goldenStep * e
+		}
+
+		u := x + d
+		if math.Abs(d) < tol {
+			u = x + math.Copysign(tol, d)
+		}
+		fu, err := f.at(u)
+		if err != nil {
+			return numericAnswer{}, err
+		}
+
+		if fu <= fx {
+			if u < x {
+				b = x
+			} else {
+				a = x
+			}
+			v, w, x = w, x, u
+			fv, fw, fx = fw, fx, fu
+			continue
+		}
+
+		if u < x {
+			a = u
+		} else {
+			b = u
+		}
+		if fu <= fw || w == x {
+			v, w = w, u
+			fv, fw = fw, fu
+		} else if fu <= fv || v == x || v == w {
+			v, fv = u, fu
+		}
+	}
+
+	return numericAnswer{x, args.maxIterations, (b - a) / 2, false}, nil
+}
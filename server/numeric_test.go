@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestNumericMethods runs every method of every numerical operation through mathHandler
+func TestNumericMethods(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		name      string
+		op        string
+		body      string
+		expected  float64
+		tolerance float64
+	}{
+		{"bisection", "findroot", `{"expression": "x^2 - 2", "method": "bisection", "a": 0, "b": 2}`, math.Sqrt2, 1e-9},
+		{"newton", "findroot", `{"expression": "x^2 - 2", "method": "newton", "x0": 1}`, math.Sqrt2, 1e-12},
+		{"newtonMidpoint", "findroot", `{"expression": "cos(t) - t", "variable": "t", "method": "newton", "a": 0, "b": 1}`, 0.7390851332151607, 1e-12},
+		{"brent", "findroot", `{"expression": "x^3 - 2*x - 5", "a": 2, "b": 3}`, 2.0945514815423265, 1e-12},
+		{"simpson", "integrate", `{"expression": "sin(x)", "method": "simpson", "a": 0, "b": 3.141592653589793}`, 2, 1e-9},
+		{"gaussKronrod", "integrate", `{"expression": "exp(-x^2)", "a": -5, "b": 5}`, math.Sqrt(math.Pi), 1e-9},
+		{"gaussKronrodSqrt", "integrate", `{"expression": "sqrt(x)", "a": 0, "b": 1, "tolerance": 1e-8}`, 2.0 / 3, 1e-8},
+		{"golden", "minimize", `{"expression": "(x - 1)^2 + 3", "method": "golden", "a": -4, "b": 4}`, 1, 1e-7},
+		{"brentMinimize", "minimize", `{"expression": "x^4 - 3*x^3 + 2", "a": 0, "b": 5}`, 2.25, 1e-7},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/"+testCase.op, strings.NewReader(testCase.body))
+			req.Header.Set("Content-Type", "application/json")
+			resRecorder := httptest.NewRecorder()
+			GetRouter().ServeHTTP(resRecorder, req)
+
+			var mathRes struct {
+				Answer NumericResult `json:"answer"`
+			}
+			err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+			if err != nil {
+				t.Fatalf("json decode failed: %s\n", err)
+			}
+
+			ans := mathRes.Answer
+			if math.Abs(ans.Value-testCase.expected) > testCase.tolerance {
+				t.Logf("unexpected answer value: (actual %v != expected %v)\n", ans.Value, testCase.expected)
+				t.Fail()
+			}
+			if !ans.Converged || ans.Iterations < 1 || ans.Evaluations < ans.Iterations {
+				t.Logf("unexpected diagnostics: %+v\n", ans)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// TestNumericLimits checks that running out of iterations is reported rather than hidden
+func TestNumericLimits(t *testing.T) {
+	body := `{"expression": "x^2 - 2", "method": "bisection", "a": 0, "b": 2, "maxiter": 5}`
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/findroot", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	var mathRes struct {
+		Answer NumericResult `json:"answer"`
+	}
+	err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+
+	ans := mathRes.Answer
+	if ans.Converged || ans.Iterations != 5 || ans.ErrorEstimate != 2.0/64 {
+		t.Logf("unexpected diagnostics: %+v\n", ans)
+		t.Fail()
+	}
+}
+
+// TestNumericErrors checks argument validation and failures of the methods themselves
+func TestNumericErrors(t *testing.T) {
+	testCases := []struct {
+		op             string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"findroot", `{"expression": "x^2 + 1", "a": -1, "b": 1}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"findroot", `{"expression": "x^2 - 1", "method": "newton", "x0": 0}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"findroot", `{"expression": "x^2 - 1", "method": "newton"}`, http.StatusBadRequest, "invalid_argument"},
+		{"findroot", `{"expression": "` + strings.Repeat("x*", 300) + `x", "method": "newton", "x0": 1}`, http.StatusUnprocessableEntity, "limit_exceeded"},
+		{"findroot", `{"expression": "x - 1", "method": "secant", "a": 0, "b": 2}`, http.StatusBadRequest, "invalid_argument"},
+		{"findroot", `{"expression": "x - y", "a": 0, "b": 2}`, http.StatusBadRequest, "invalid_argument"},
+		{"integrate", `{"expression": "x", "a": 1}`, http.StatusBadRequest, "invalid_argument"},
+		{"integrate", `{"expression": "x", "a": 1, "b": 0}`, http.StatusBadRequest, "invalid_argument"},
+		{"integrate", `{"expression": "1/x", "a": -1, "b": 1, "method": "simpson"}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"integrate", `{"expression": "x", "a": 0, "b": 1, "tolerance": -1}`, http.StatusBadRequest, "invalid_argument"},
+		{"integrate", `{"expression": "x", "a": 0, "b": 1, "maxiter": 1e9}`, http.StatusBadRequest, "invalid_argument"},
+		{"integrate", `{"expression": "x", "a": 0, "b": 1, "timeout": "1h"}`, http.StatusBadRequest, "invalid_argument"},
+		{"integrate", `{"expression": "sin(1/x)", "a": 1e-9, "b": 1, "tolerance": 1e-300, "maxiter": 100000, "timeout": "1ms"}`, http.StatusUnprocessableEntity, "limit_exceeded"},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/"+testCase.op, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != testCase.expectedStatus || errRes.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s %s: (actual %d %s != expected %d %s)\n", testCase.op, testCase.body, resRecorder.Code, errRes.Code, testCase.expectedStatus, testCase.expectedCode)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,834 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// /openapi.json is an OpenAPI 3 description of the API, and /docs is Swagger UI pointed at it.
+// Rather than being written by hand, the document is built from the same things the handlers use:
+// an operation's path and body come from its entry in supportedOperations, the request content types
+// from acceptedContentTypes, the query parameters from what evalOptionsFrom asks for, and the schemas
+// from the models in models.go.  Adding an operation is enough to document it
+
+const openAPIVersion = "3.0.3"
+
+// swaggerUIVersion is the swagger-ui-dist release /docs loads from unpkg
+const swaggerUIVersion = "5.17.14"
+
+// swaggerUIAssets are the files from swagger-ui-dist that /docs uses, which are all that
+// /docs/{asset} will serve
+var swaggerUIAssets = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+// docsAssetsDir is a directory with a copy of swagger-ui-dist, set by ServeDocsAssets.  unpkg serves
+// files by version, but the tags that load them don't carry integrity hashes, since there's no
+// working them out here without fetching the files.  So when the docs shouldn't depend on trusting
+// a CDN, vendor swagger-ui-dist and serve it from here instead
+var docsAssetsDir string
+
+// ServeDocsAssets has /docs load Swagger UI from dir, a copy of swagger-ui-dist, rather than from
+// unpkg.  It has to be called before the router starts serving
+func ServeDocsAssets(dir string) {
+	docsAssetsDir = dir
+}
+
+// jsonObject is a JSON object of the OpenAPI document
+type jsonObject map[string]interface{}
+
+// openAPIModels are the models that get a schema in components, whether or not a path refers to them
+var openAPIModels = []interface{}{
+	MathRequest{},
+	MathOKResponse{},
+	MathErrorResponse{},
+	ComplexNumber{},
+	Quantity{},
+	ExpressionNode{},
+	Derivative{},
+	NumericResult{},
+	SequencePage{},
+	SequenceTerm{},
+	SequenceEnd{},
+	HistogramBucket{},
+	BitPattern{},
+	CacheStats{},
+	ComputeEvent{},
+}
+
+// evalOptionSchemas describe the options evalOptionsFrom reads, keyed by query parameter name
+var evalOptionSchemas = map[string]jsonObject{
+	"mode":      {"description": "the numeric mode to evaluate in", "schema": enumSchema(evalModes)},
+	"precision": {"description": "significant digits in precise mode", "schema": jsonObject{"type": "integer", "minimum": 1, "maximum": maxPreciseDigits}},
+	"rounding":  {"description": "how precise mode rounds", "schema": enumSchema(roundingModes)},
+	"decimal":   {"description": "include the decimal expansion of rational answers", "schema": jsonObject{"type": "boolean"}},
+	"places":    {"description": "digits after the decimal point in the formatted answer", "schema": jsonObject{"type": "integer", "minimum": 0, "maximum": maxPreciseDigits}},
+	"sigfigs":   {"description": "significant figures in the formatted answer", "schema": jsonObject{"type": "integer", "minimum": 1, "maximum": maxPreciseDigits}},
+	"notation":  {"description": "the notation of the formatted answer", "schema": enumSchema(notations)},
+	"locale":    {"description": "the locale of the formatted answer's separators, like de-DE", "schema": jsonObject{"type": "string"}},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+)
+
+// openAPIHandler serves /openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	openAPIOnce.Do(func() {
+		var err error
+		openAPIDoc, err = json.Marshal(buildOpenAPI())
+		if err != nil {
+			// the document is nothing but maps, slices, and strings, so this would be a bug
+			log.Printf("openAPIHandler: json marshal failed: %s\n", err)
+		}
+	})
+
+	if openAPIDoc == nil {
+		writeErrorResponse(w, newMathError(kindInternal, "the OpenAPI document couldn't be built"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(openAPIDoc)
+	if err != nil {
+		log.Printf("response write failed: %s\n", err)
+	}
+}
+
+// docsHandler serves /docs, a Swagger UI page for /openapi.json
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	assets := fmt.Sprintf("https://unpkg.com/swagger-ui-dist@%s/", swaggerUIVersion)
+	if docsAssetsDir != "" {
+		assets = "/docs/"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err := fmt.Fprintf(w, docsPage, assets)
+	if err != nil {
+		log.Printf("response write failed: %s\n", err)
+	}
+}
+
+// docsAssetHandler serves /docs/{asset} from docsAssetsDir, if there is one
+func docsAssetHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	asset := mux.Vars(r)["asset"]
+	for _, known := range swaggerUIAssets {
+		if asset == known && docsAssetsDir != "" {
+			http.ServeFile(w, r, filepath.Join(docsAssetsDir, asset))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// allowGet turns away anything but GET requests, returning whether the request was a GET
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet {
+		return true
+	}
+	w.Header().Set("Allow", http.MethodGet)
+	writeErrorResponse(w, newMathError(kindInvalidArgument, "%s is only available with GET", r.URL.Path))
+	return false
+}
+
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>math-serv</title>
+  <link rel="stylesheet" href="%[1]sswagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="%[1]sswagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function() {
+      window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+    };
+  </script>
+</body>
+</html>
+`
+
+// buildOpenAPI builds the OpenAPI document
+func buildOpenAPI() jsonObject {
+	schemas := make(jsonObject)
+	for _, model := range openAPIModels {
+		modelSchema(reflect.TypeOf(model), schemas)
+	}
+
+	paths := make(jsonObject)
+	for name, operation := range supportedOperations {
+		paths["/"+name] = operationPaths(name, operation)
+	}
+	for path, item := range routedPaths() {
+		paths[path] = item
+	}
+
+	return jsonObject{
+		"openapi": openAPIVersion,
+		"info": jsonObject{
+			"title":       "math-serv",
+			"version":     "1.0",
+			"description": "Math operations over HTTP.  Each operation is a POST to its own path, with its operands in the body, or a GET with them in the query string if they fit",
+		},
+		"paths": paths,
+		"components": jsonObject{
+			"schemas":    schemas,
+			"parameters": evalOptionParameters(),
+		},
+	}
+}
+
+// domain is the family an operation belongs to, which is how the document groups operations.
+// Operations that follow the requested mode are "arithmetic"
+func (o *operation) domain() string {
+	switch {
+	case o.intFn != nil:
+		return string(modeInteger)
+	case o.linalgFn != nil:
+		return string(modeMatrix)
+	case o.statsFn != nil:
+		return string(modeStatistics)
+	case o.exprFn != nil:
+		return string(modeSymbolic)
+	case o.bitFn != nil:
+		return string(modeBitwise)
+	case o.fn == nil && o.unitFn != nil:
+		return string(modeUnits)
+	case o.fn == nil && o.complexFn != nil:
+		return string(modeComplex)
+	}
+	return "arithmetic"
+}
+
+// operationPaths describes POST /{name}, and GET /{name} with the operands in the query string as
+// long as every required operand fits in one.  Matrices don't, so those operations are POST only,
+// and optional objects like eval's at are left out of the GET
+func operationPaths(name string, operation *operation) jsonObject {
+	properties := make(jsonObject)
+	for i, param := range operation.params {
+		properties[param] = paramSchema(operation, i, param)
+	}
+	for _, param := range operation.optional {
+		properties[param] = paramSchema(operation, -1, param)
+	}
+	body := jsonObject{"type": "object", "properties": properties}
+	if len(operation.params) > 0 {
+		body["required"] = operation.params
+	}
+
+	item := jsonObject{
+		"post": jsonObject{
+			"operationId": name,
+			"summary":     operation.description,
+			"tags":        []string{operation.domain()},
+			"x-arity":     len(operation.params),
+			"x-domain":    operation.domain(),
+			"parameters":  evalOptionRefs(),
+			"requestBody": jsonObject{"required": true, "content": requestContent(body)},
+			"responses":   answerResponses(mathResponses(excludedStatuses(kindRateLimited)), operation.answer),
+		},
+	}
+
+	queryProperties := make(jsonObject)
+	for param, schema := range properties {
+		if fitsQuery(schema.(jsonObject)) {
+			queryProperties[param] = schema
+		}
+	}
+	for _, param := range operation.params {
+		if queryProperties[param] == nil {
+			return item
+		}
+	}
+
+	item["get"] = jsonObject{
+		"operationId": name + "-get",
+		"summary":     operation.description,
+		"tags":        []string{operation.domain()},
+		"x-arity":     len(operation.params),
+		"x-domain":    operation.domain(),
+		"parameters":  conditionalParameters(queryParameters(queryProperties, operation.params), evalOptionRefs()...),
+		"responses":   conditionalResponses(answerResponses(mathResponses(excludedStatuses(kindRateLimited)), operation.answer)),
+	}
+	return item
+}
+
+// fitsQuery reports whether an operand can be written as query parameters.  Lists can, as repeated
+// parameters, but lists of lists and objects can't
+func fitsQuery(schema jsonObject) bool {
+	switch schema["type"] {
+	case "object":
+		return false
+	case "array":
+		return schema["items"].(jsonObject)["type"] != "array"
+	}
+	return true
+}
+
+// ifNoneMatchParameter is the header writeEvaluation compares with a GET's ETag
+var ifNoneMatchParameter = jsonObject{
+	"name":        "If-None-Match",
+	"in":          "header",
+	"description": "an ETag from an earlier response, to get a 304 rather than the same answer again",
+	"schema":      jsonObject{"type": "string"},
+}
+
+// conditionalParameters are a GET's query parameters, the given refs, and If-None-Match
+func conditionalParameters(parameters []jsonObject, refs ...jsonObject) []jsonObject {
+	return append(append(parameters, refs...), ifNoneMatchParameter)
+}
+
+// conditionalResponses are the responses to a GET that goes through writeEvaluation: the same as
+// responses, but with ETag and Cache-Control headers on the 200 and a 304 for a matching
+// If-None-Match
+func conditionalResponses(responses jsonObject) jsonObject {
+	headers := jsonObject{
+		"ETag":          jsonObject{"description": "identifies the answer, for If-None-Match", "schema": jsonObject{"type": "string"}},
+		"Cache-Control": jsonObject{"description": "public, max-age for operations whose answers are cached, no-cache otherwise", "schema": jsonObject{"type": "string"}},
+	}
+
+	conditional := make(jsonObject, len(responses)+1)
+	for status, response := range responses {
+		conditional[status] = response
+	}
+	ok := make(jsonObject)
+	for key, value := range responses["200"].(jsonObject) {
+		ok[key] = value
+	}
+	ok["headers"] = headers
+	conditional["200"] = ok
+	conditional["304"] = jsonObject{"description": "the answer hasn't changed since the ETag in If-None-Match", "headers": headers}
+	return conditional
+}
+
+// paramSchema describes one of an operation's operands.  i is the param's index, or -1 for optional
+// params
+func paramSchema(operation *operation, i int, param string) jsonObject {
+	numberOrString := []interface{}{jsonObject{"type": "number"}, jsonObject{"type": "string"}}
+	integerOrString := jsonObject{
+		"oneOf":       []interface{}{jsonObject{"type": "integer"}, jsonObject{"type": "string"}},
+		"description": "an integer, as a string if it's too big for a JSON number",
+	}
+	numbers := jsonObject{"type": "array", "items": jsonObject{"type": "number"}}
+
+	switch operation.domain() {
+	case string(modeInteger):
+		return integerOrString
+	case string(modeBitwise):
+		switch param {
+		case "width":
+			return jsonObject{"type": "integer", "enum": []int{8, 16, 32, 64}, "default": defaultBitWidth}
+		case "signed":
+			return jsonObject{"type": "boolean"}
+		}
+		return integerOrString
+	case string(modeMatrix):
+		if i >= 0 && i < len(operation.shapes) && operation.shapes[i] == shapeMatrix {
+			return jsonObject{"type": "array", "items": numbers}
+		}
+		return numbers
+	case string(modeStatistics):
+		switch param {
+		case "sample":
+			return jsonObject{"type": "boolean", "default": true}
+		case "buckets":
+			return jsonObject{"type": "integer", "minimum": 1}
+		case "p":
+			return jsonObject{"oneOf": []interface{}{jsonObject{"type": "number"}, numbers}, "description": "a percentile from 0 to 100, or a list of them"}
+		}
+		return numbers
+	case string(modeSymbolic):
+		switch param {
+		case "expression", "method":
+			return jsonObject{"type": "string"}
+		case "at":
+			return jsonObject{"type": "object", "additionalProperties": jsonObject{"type": "number"}, "description": "values for the expression's variables"}
+		case "maxiter":
+			return jsonObject{"type": "integer", "minimum": 1}
+		case "timeout":
+			return jsonObject{"type": "string", "description": `a duration, like "500ms"`}
+		}
+		return jsonObject{"type": "number"}
+	case string(modeUnits):
+		if param == "value" {
+			return jsonObject{"type": "number"}
+		}
+		return jsonObject{"type": "string", "description": "a unit, like km"}
+	}
+
+	// arithmetic and complex operands can be anything their mode can read
+	kinds := numberOrString
+	if operation.complexFn != nil {
+		kinds = append(kinds, jsonObject{"$ref": "#/components/schemas/ComplexNumber"})
+	}
+	if operation.unitFn != nil {
+		kinds = append(kinds, jsonObject{"$ref": "#/components/schemas/Quantity"})
+	}
+	return jsonObject{
+		"oneOf":       kinds,
+		"description": "a number, or a decimal string in precise mode and a fraction in rational mode",
+	}
+}
+
+// requestContent is the request body in each of acceptedContentTypes
+func requestContent(body jsonObject) jsonObject {
+	content := make(jsonObject, len(acceptedContentTypes))
+	for contentType := range acceptedContentTypes {
+		if contentType == "text/csv" {
+			content[contentType] = jsonObject{
+				"schema": jsonObject{
+					"type":        "string",
+					"description": "numbers, one column for data or two for x and y, with an optional header naming each column",
+				},
+			}
+			continue
+		}
+		content[contentType] = jsonObject{"schema": body}
+	}
+	return content
+}
+
+// mathResponses are a MathOKResponse and a MathErrorResponse for each of statuses
+func mathResponses(statuses []int) jsonObject {
+	responses := jsonObject{"200": jsonResponse("the answer", "MathOKResponse")}
+	for _, status := range statuses {
+		responses[fmt.Sprint(status)] = jsonResponse(http.StatusText(status), "MathErrorResponse")
+	}
+	return responses
+}
+
+// answerResponses are responses with the 200's answer narrowed to answer, for operations whose
+// answer MathOKResponse doesn't describe.  A nil answer leaves responses alone
+func answerResponses(responses, answer jsonObject) jsonObject {
+	if answer == nil {
+		return responses
+	}
+
+	narrowed := make(jsonObject, len(responses))
+	for status, response := range responses {
+		narrowed[status] = response
+	}
+	narrowed["200"] = jsonObject{
+		"description": "the answer",
+		"content": jsonObject{
+			"application/json": jsonObject{"schema": jsonObject{"allOf": []jsonObject{
+				{"$ref": "#/components/schemas/MathOKResponse"},
+				{"type": "object", "properties": jsonObject{"answer": answer}},
+			}}},
+		},
+	}
+	return narrowed
+}
+
+// excludedStatuses are the statuses errors are sent with, except those of the given kinds
+func excludedStatuses(kinds ...errorKind) []int {
+	excluded := make(map[errorKind]bool, len(kinds))
+	for _, kind := range kinds {
+		excluded[kind] = true
+	}
+
+	seen := make(map[int]bool)
+	var statuses []int
+	for kind, status := range errorStatuses {
+		if !excluded[kind] && !seen[status] {
+			seen[status] = true
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Ints(statuses)
+	return statuses
+}
+
+func jsonResponse(description, model string) jsonObject {
+	return jsonObject{
+		"description": description,
+		"content": jsonObject{
+			"application/json": jsonObject{"schema": jsonObject{"$ref": "#/components/schemas/" + model}},
+		},
+	}
+}
+
+// evalOptionParameters are the query parameters that evalOptionsFrom reads, plus nocache.  Asking
+// evalOptionsFrom which ones it reads, rather than listing them, keeps them from drifting
+func evalOptionParameters() jsonObject {
+	parameters := make(jsonObject)
+	evalOptionsFrom(func(param, header string) string {
+		parameter := jsonObject{
+			"name":        param,
+			"in":          "query",
+			"description": fmt.Sprintf("%s, or the %s header", evalOptionSchemas[param]["description"], header),
+			"schema":      evalOptionSchemas[param]["schema"],
+		}
+		if parameter["schema"] == nil {
+			parameter["schema"] = jsonObject{"type": "string"}
+		}
+		parameters[param] = parameter
+		return ""
+	})
+
+	parameters["nocache"] = jsonObject{
+		"name":            "nocache",
+		"in":              "query",
+		"description":     "compute the answer even if it's cached, the same as Cache-Control: no-cache",
+		"schema":          jsonObject{"type": "string"},
+		"allowEmptyValue": true,
+	}
+	return parameters
+}
+
+// evalOptionRefs refers to each of evalOptionParameters
+func evalOptionRefs() []jsonObject {
+	var names []string
+	for name := range evalOptionParameters() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	refs := make([]jsonObject, len(names))
+	for i, name := range names {
+		refs[i] = jsonObject{"$ref": "#/components/parameters/" + name}
+	}
+	return refs
+}
+
+// routedPaths describes the paths that have handlers of their own
+func routedPaths() jsonObject {
+	var kinds, sequenceParams []string
+	seen := make(map[string]bool)
+	for kind, sequence := range sequenceKinds {
+		kinds = append(kinds, kind)
+		for _, param := range sequence.params {
+			if !seen[param] {
+				seen[param] = true
+				sequenceParams = append(sequenceParams, param)
+			}
+		}
+	}
+	sort.Strings(kinds)
+	sort.Strings(sequenceParams)
+
+	sequenceProperties := jsonObject{
+		"kind":   jsonObject{"type": "string", "enum": kinds},
+		"count":  jsonObject{"type": "integer", "minimum": 1, "maximum": maxSequenceCount, "default": defaultSequenceCount},
+		"limit":  jsonObject{"type": "integer", "minimum": 1, "maximum": maxPageSize, "default": defaultPageSize},
+		"cursor": jsonObject{"type": "string", "description": "the nextCursor of the previous page"},
+		"format": jsonObject{"type": "string", "enum": []string{"ndjson"}, "description": "stream every remaining term instead of a page"},
+	}
+	for _, param := range sequenceParams {
+		if param == "expression" {
+			sequenceProperties[param] = jsonObject{"type": "string", "description": "an expression in n"}
+			continue
+		}
+		sequenceProperties[param] = jsonObject{"type": "number"}
+	}
+	sequenceResponses := jsonObject{
+		"200": jsonObject{
+			"description": "a response whose answer is a SequencePage, or every remaining term as NDJSON followed by a SequenceEnd line.  An error partway through is sent as a MathErrorResponse line instead",
+			"content": jsonObject{
+				"application/json": jsonObject{"schema": jsonObject{"$ref": "#/components/schemas/MathOKResponse"}},
+				ndjsonContentType: jsonObject{"schema": jsonObject{"oneOf": []jsonObject{
+					{"$ref": "#/components/schemas/SequenceTerm"},
+					{"$ref": "#/components/schemas/SequenceEnd"},
+					{"$ref": "#/components/schemas/MathErrorResponse"},
+				}}},
+			},
+		},
+	}
+	for status, response := range mathResponses(excludedStatuses(kindRateLimited)) {
+		if status != "200" {
+			sequenceResponses[status] = response
+		}
+	}
+	sequence := func(series bool) jsonObject {
+		summary := "the terms of a sequence, a page at a time"
+		if series {
+			summary = "the partial sums of a sequence, a page at a time"
+		}
+		body := jsonObject{"type": "object", "properties": sequenceProperties, "required": sequenceParams}
+		return jsonObject{
+			"get": jsonObject{
+				"summary":    summary,
+				"tags":       []string{string(modeSequence)},
+				"parameters": conditionalParameters(queryParameters(sequenceProperties, sequenceParams)),
+				"responses":  conditionalResponses(sequenceResponses),
+			},
+			"post": jsonObject{
+				"summary":     summary,
+				"tags":        []string{string(modeSequence)},
+				"requestBody": jsonObject{"required": true, "content": requestContent(body)},
+				"responses":   sequenceResponses,
+			},
+		}
+	}
+
+	baseProperties := jsonObject{
+		"value": jsonObject{"type": "string", "description": "an integer, optionally with a 0x, 0o, or 0b prefix"},
+		"to":    jsonObject{"type": "integer", "minimum": minBase, "maximum": maxBase},
+		"from":  jsonObject{"type": "integer", "minimum": minBase, "maximum": maxBase, "default": 10},
+	}
+	baseBody := jsonObject{"type": "object", "properties": baseProperties, "required": baseParams}
+	baseSummary := "value written in base to"
+
+	return jsonObject{
+		"/sequence": sequence(false),
+		"/series":   sequence(true),
+		"/convert/base": jsonObject{
+			"get": jsonObject{
+				"summary":    baseSummary,
+				"tags":       []string{string(modeBase)},
+				"parameters": conditionalParameters(queryParameters(baseProperties, baseParams)),
+				"responses":  conditionalResponses(mathResponses(excludedStatuses(kindRateLimited))),
+			},
+			"post": jsonObject{
+				"summary":     baseSummary,
+				"tags":        []string{string(modeBase)},
+				"requestBody": jsonObject{"required": true, "content": requestContent(baseBody)},
+				"responses":   mathResponses(excludedStatuses(kindRateLimited)),
+			},
+		},
+		"/rpc": jsonObject{
+			"post": jsonObject{
+				"summary": "JSON-RPC 2.0, with each operation as a method and its operands as params",
+				"tags":    []string{"protocols"},
+				"requestBody": jsonObject{
+					"required": true,
+					"content":  jsonObject{"application/json": jsonObject{"schema": jsonObject{"oneOf": []interface{}{jsonObject{"type": "object"}, jsonObject{"type": "array", "items": jsonObject{"type": "object"}}}}}},
+				},
+				"responses": jsonObject{
+					"200": jsonObject{"description": "the response, or a list of them for a batch", "content": jsonObject{"application/json": jsonObject{"schema": jsonObject{}}}},
+					"204": jsonObject{"description": "the request was only notifications"},
+				},
+			},
+		},
+		"/graphql": jsonObject{
+			"get": jsonObject{
+				"summary": "a GraphQL query",
+				"tags":    []string{"protocols"},
+				"parameters": []jsonObject{
+					{"name": "query", "in": "query", "required": true, "schema": jsonObject{"type": "string"}},
+					{"name": "variables", "in": "query", "schema": jsonObject{"type": "string"}, "description": "a JSON object"},
+					{"name": "operationName", "in": "query", "schema": jsonObject{"type": "string"}},
+				},
+				"responses": jsonObject{"200": graphqlResponse},
+			},
+			"post": jsonObject{
+				"summary": "a GraphQL query",
+				"tags":    []string{"protocols"},
+				"requestBody": jsonObject{
+					"required": true,
+					"content": jsonObject{"application/json": jsonObject{"schema": jsonObject{
+						"type": "object",
+						"properties": jsonObject{
+							"query":         jsonObject{"type": "string"},
+							"variables":     jsonObject{"type": "object"},
+							"operationName": jsonObject{"type": "string"},
+						},
+						"required": []string{"query"},
+					}}},
+				},
+				"responses": jsonObject{"200": graphqlResponse},
+			},
+		},
+		"/ws": jsonObject{
+			"get": jsonObject{
+				"summary":   "a WebSocket calculation session, with variables and the last answer as ans",
+				"tags":      []string{"protocols"},
+				"responses": jsonObject{"101": jsonObject{"description": "switching to the WebSocket protocol"}},
+			},
+		},
+		"/events": jsonObject{
+			"get": jsonObject{
+				"summary": "a Server-Sent Events stream of ComputeEvents, as answers are computed",
+				"tags":    []string{"protocols"},
+				"parameters": []jsonObject{{
+					"name":        "op",
+					"in":          "query",
+					"description": "only events for these operations, repeated or comma separated",
+					"schema":      jsonObject{"type": "array", "items": jsonObject{"type": "string"}},
+					"explode":     true,
+				}},
+				"responses": jsonObject{
+					"200": jsonObject{
+						"description": "events whose data is a ComputeEvent",
+						"content":     jsonObject{"text/event-stream": jsonObject{"schema": jsonObject{"type": "string"}}},
+					},
+					"400": jsonResponse(http.StatusText(http.StatusBadRequest), "MathErrorResponse"),
+				},
+			},
+		},
+		"/openapi.json": jsonObject{
+			"get": jsonObject{
+				"summary":   "this document",
+				"tags":      []string{"docs"},
+				"responses": jsonObject{"200": jsonObject{"description": "an OpenAPI 3 document", "content": jsonObject{"application/json": jsonObject{"schema": jsonObject{"type": "object"}}}}},
+			},
+		},
+		"/docs": jsonObject{
+			"get": jsonObject{
+				"summary":   "Swagger UI for this document",
+				"tags":      []string{"docs"},
+				"responses": jsonObject{"200": jsonObject{"description": "an HTML page", "content": jsonObject{"text/html": jsonObject{"schema": jsonObject{"type": "string"}}}}},
+			},
+		},
+		"/docs/{asset}": jsonObject{
+			"get": jsonObject{
+				"summary": "Swagger UI's own files, when the server was given a copy of them to serve",
+				"tags":    []string{"docs"},
+				"parameters": []jsonObject{{
+					"name":     "asset",
+					"in":       "path",
+					"required": true,
+					"schema":   jsonObject{"type": "string", "enum": swaggerUIAssets},
+				}},
+				"responses": jsonObject{
+					"200": jsonObject{"description": "the file"},
+					"404": jsonObject{"description": "the server loads Swagger UI from unpkg instead"},
+				},
+			},
+		},
+	}
+}
+
+var graphqlResponse = jsonObject{
+	"description": "the query's data and errors",
+	"content":     jsonObject{"application/json": jsonObject{"schema": jsonObject{"type": "object"}}},
+}
+
+// queryParameters turns an object schema's properties into query parameters
+func queryParameters(properties jsonObject, required []string) []jsonObject {
+	isRequired := make(map[string]bool, len(required))
+	for _, name := range required {
+		isRequired[name] = true
+	}
+
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parameters := make([]jsonObject, len(names))
+	for i, name := range names {
+		parameters[i] = jsonObject{"name": name, "in": "query", "schema": properties[name]}
+		if isRequired[name] {
+			parameters[i]["required"] = true
+		}
+	}
+	return parameters
+}
+
+// enumSchema is a string schema whose values are the keys of set, which is a map with string keys
+func enumSchema(set interface{}) jsonObject {
+	var values []string
+	for _, key := range reflect.ValueOf(set).MapKeys() {
+		values = append(values, key.String())
+	}
+	sort.Strings(values)
+	return jsonObject{"type": "string", "enum": values}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// modelSchema returns the schema for t, adding the schemas of any structs it refers to to schemas
+// and referring to them by name
+func modelSchema(t reflect.Type, schemas jsonObject) jsonObject {
+	if t == timeType {
+		return jsonObject{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return modelSchema(t.Elem(), schemas)
+	case reflect.Struct:
+		ref := jsonObject{"$ref": "#/components/schemas/" + t.Name()}
+		if schemas[t.Name()] != nil {
+			return ref
+		}
+		schemas[t.Name()] = jsonObject{} // a placeholder, in case it refers to itself
+
+		properties := make(jsonObject)
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, omitEmpty := jsonFieldName(field)
+			if name == "" {
+				continue
+			}
+			properties[name] = modelSchema(field.Type, schemas)
+			if !omitEmpty {
+				required = append(required, name)
+			}
+		}
+
+		schema := jsonObject{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[t.Name()] = schema
+		return ref
+	case reflect.Slice, reflect.Array:
+		return jsonObject{"type": "array", "items": modelSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return jsonObject{"type": "object", "additionalProperties": modelSchema(t.Elem(), schemas)}
+	case reflect.Interface:
+		return jsonObject{} // anything at all, like an answer
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonObject{"type": "number"}
+	}
+	return jsonObject{}
+}
+
+// jsonFieldName is the name encoding/json gives field, or "" if it's left out
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false // unexported
+	}
+
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	omitEmpty := false
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty
+}
@@ -0,0 +1,440 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// getOpenAPI fetches /openapi.json from the router and decodes it
+func getOpenAPI(t *testing.T) map[string]interface{} {
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	GetRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status: (actual %d != expected %d)\n", rr.Code, http.StatusOK)
+	}
+
+	var doc map[string]interface{}
+	err := json.Unmarshal(rr.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+	return doc
+}
+
+// lookup follows keys down through nested JSON objects, returning nil if any of them is missing
+func lookup(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// sortedKeys returns the keys of a JSON object
+func sortedKeys(value interface{}) []string {
+	object, _ := value.(map[string]interface{})
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedStrings returns a JSON array of strings as a sorted []string
+func sortedStrings(value interface{}) []string {
+	array, _ := value.([]interface{})
+	strs := make([]string, 0, len(array))
+	for _, item := range array {
+		strs = append(strs, item.(string))
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+// TestOpenAPIOperations checks that every operation is documented with its params, description,
+// and the content types the server accepts
+func TestOpenAPIOperations(t *testing.T) {
+	doc := getOpenAPI(t)
+	if doc["openapi"] != openAPIVersion {
+		t.Logf("unexpected openapi version: (actual %v != expected %s)\n", doc["openapi"], openAPIVersion)
+		t.Fail()
+	}
+
+	var contentTypes []string
+	for contentType := range acceptedContentTypes {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Strings(contentTypes)
+
+	for name, operation := range supportedOperations {
+		post := lookup(doc, "paths", "/"+name, "post")
+		if post == nil {
+			t.Logf("expecting POST /%s, none found\n", name)
+			t.Fail()
+			continue
+		}
+
+		if lookup(post, "summary") != operation.description || lookup(post, "x-arity") != float64(len(operation.params)) {
+			t.Logf("unexpected summary or arity for %s: %v %v\n", name, lookup(post, "summary"), lookup(post, "x-arity"))
+			t.Fail()
+		}
+
+		actualTypes := sortedKeys(lookup(post, "requestBody", "content"))
+		if !reflect.DeepEqual(actualTypes, contentTypes) {
+			t.Logf("unexpected content types for %s: (actual %v != expected %v)\n", name, actualTypes, contentTypes)
+			t.Fail()
+		}
+
+		schema := lookup(post, "requestBody", "content", "application/json", "schema")
+		expectedParams := append(append([]string{}, operation.params...), operation.optional...)
+		sort.Strings(expectedParams)
+		actualParams := sortedKeys(lookup(schema, "properties"))
+		if !reflect.DeepEqual(actualParams, expectedParams) {
+			t.Logf("unexpected params for %s: (actual %v != expected %v)\n", name, actualParams, expectedParams)
+			t.Fail()
+		}
+
+		expectedRequired := append([]string{}, operation.params...)
+		sort.Strings(expectedRequired)
+		actualRequired := sortedStrings(lookup(schema, "required"))
+		if !reflect.DeepEqual(actualRequired, expectedRequired) {
+			t.Logf("unexpected required params for %s: (actual %v != expected %v)\n", name, actualRequired, expectedRequired)
+			t.Fail()
+		}
+
+		// a GET takes the same params in the query string, as many as fit, and can be conditional
+		get := lookup(doc, "paths", "/"+name, "get")
+		if get == nil {
+			continue
+		}
+		known := make(map[string]bool, len(expectedParams))
+		for _, param := range expectedParams {
+			known[param] = true
+		}
+		queryRequired := []string{}
+		ifNoneMatch := false
+		for _, parameter := range lookup(get, "parameters").([]interface{}) {
+			switch {
+			case lookup(parameter, "$ref") != nil:
+			case lookup(parameter, "in") == "header":
+				ifNoneMatch = ifNoneMatch || lookup(parameter, "name") == "If-None-Match"
+			case !known[lookup(parameter, "name").(string)]:
+				t.Logf("unexpected query param for %s: %v\n", name, lookup(parameter, "name"))
+				t.Fail()
+			case lookup(parameter, "required") == true:
+				queryRequired = append(queryRequired, lookup(parameter, "name").(string))
+			}
+		}
+		sort.Strings(queryRequired)
+		if !reflect.DeepEqual(queryRequired, expectedRequired) {
+			t.Logf("unexpected required query params for %s: (actual %v != expected %v)\n", name, queryRequired, expectedRequired)
+			t.Fail()
+		}
+		if !ifNoneMatch || lookup(get, "responses", "304") == nil || lookup(get, "responses", "200", "headers", "ETag") == nil {
+			t.Logf("expecting GET /%s to be conditional, with If-None-Match, a 304, and an ETag\n", name)
+			t.Fail()
+		}
+	}
+
+	for name, expected := range map[string]bool{"add": true, "mean": true, "factor": true, "eval": true, "matmul": false, "det": false} {
+		if actual := lookup(doc, "paths", "/"+name, "get") != nil; actual != expected {
+			t.Logf("unexpected GET /%s: (actual %t != expected %t)\n", name, actual, expected)
+			t.Fail()
+		}
+	}
+
+	for _, model := range openAPIModels {
+		name := reflect.TypeOf(model).Name()
+		if lookup(doc, "components", "schemas", name, "properties") == nil {
+			t.Logf("expecting a schema for %s, none found\n", name)
+			t.Fail()
+		}
+	}
+}
+
+// TestOpenAPIRoutes checks that the document's paths are exactly the router's routes, with /{op}
+// standing in for each of the operations
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := getOpenAPI(t)
+	paths := lookup(doc, "paths").(map[string]interface{})
+
+	routes := make(map[string]bool)
+	err := GetRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		routes[template] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk routes failed: %s\n", err)
+	}
+
+	for route := range routes {
+		if route == "/{op}" {
+			continue
+		}
+		if paths[route] == nil {
+			t.Logf("expecting path %s in the document, none found\n", route)
+			t.Fail()
+		}
+	}
+	for path := range paths {
+		if !routes[path] && supportedOperations[strings.TrimPrefix(path, "/")] == nil {
+			t.Logf("path %s in the document has no route\n", path)
+			t.Fail()
+		}
+	}
+}
+
+// TestOpenAPIResponses sends requests to the handlers and checks that what comes back is what the
+// document says will
+func TestOpenAPIResponses(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+	doc := getOpenAPI(t)
+	router := GetRouter()
+
+	// checkBody checks that body has every required property of the schema and nothing it doesn't
+	// describe
+	checkBody := func(request string, body []byte, model string) {
+		var fields map[string]interface{}
+		err := json.Unmarshal(body, &fields)
+		if err != nil {
+			t.Logf("unexpected body for %s: %s\n", request, body)
+			t.Fail()
+			return
+		}
+
+		schema := lookup(doc, "components", "schemas", model)
+		properties := lookup(schema, "properties").(map[string]interface{})
+		for name := range fields {
+			if properties[name] == nil {
+				t.Logf("unexpected %s field for %s: %q isn't in the schema\n", model, request, name)
+				t.Fail()
+			}
+		}
+		for _, name := range sortedStrings(lookup(schema, "required")) {
+			if _, ok := fields[name]; !ok {
+				t.Logf("missing %s field for %s: %q\n", model, request, name)
+				t.Fail()
+			}
+		}
+	}
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		// an empty body is missing every required param, so each operation has to turn it away
+		for name := range supportedOperations {
+			rr := post("/"+name, "{}")
+			if lookup(doc, "paths", "/"+name, "post", "responses", strconv.Itoa(rr.Code)) == nil {
+				t.Logf("undocumented status for %s: %d\n", name, rr.Code)
+				t.Fail()
+			}
+			if rr.Code != http.StatusOK {
+				checkBody(name, rr.Body.Bytes(), "MathErrorResponse")
+			}
+		}
+	})
+
+	t.Run("answers", func(t *testing.T) {
+		testCases := []struct {
+			path string
+			body string
+		}{
+			{"/add?mode=rational&decimal=true", `{"x": 1, "y": 3}`},
+			{"/divide?places=2&notation=scientific&locale=de-DE", `{"x": 2, "y": 3}`},
+			{"/factor", `{"n": 360}`},
+			{"/isprime", `{"n": 97}`},
+			{"/convert", `{"value": 5, "from": "km", "to": "m"}`},
+			{"/eval", `{"expression": "x^2", "at": {"x": 3}}`},
+			{"/mean", `{"data": [1, 2, 3]}`},
+			{"/dot", `{"x": [1, 2], "y": [3, 4]}`},
+			{"/and", `{"x": 12, "y": 10, "width": 8}`},
+			{"/convert/base", `{"value": "255", "to": 16}`},
+			{"/sequence", `{"kind": "fibonacci", "count": 5}`},
+		}
+
+		for _, testCase := range testCases {
+			rr := post(testCase.path, testCase.body)
+			if rr.Code != http.StatusOK {
+				t.Logf("unexpected status for %s: (actual %d != expected %d) %s\n", testCase.path, rr.Code, http.StatusOK, rr.Body.String())
+				t.Fail()
+				continue
+			}
+
+			checkBody(testCase.path, rr.Body.Bytes(), "MathOKResponse")
+
+			// operations that narrow the answer, like isprime, have to answer with what they say
+			path := strings.SplitN(testCase.path, "?", 2)[0]
+			narrowed := lookup(doc, "paths", path, "post", "responses", "200", "content", "application/json", "schema", "allOf")
+			if narrowed != nil {
+				var res MathOKResponse
+				json.Unmarshal(rr.Body.Bytes(), &res)
+				expectedType := lookup(narrowed.([]interface{})[1], "properties", "answer", "type")
+				if _, ok := res.Answer.(bool); expectedType != "boolean" || !ok {
+					t.Logf("unexpected answer for %s: (actual %T != expected %v)\n", testCase.path, res.Answer, expectedType)
+					t.Fail()
+				}
+			}
+			if strings.HasPrefix(testCase.path, "/sequence") {
+				// a page is the answer rather than the whole response
+				var res MathOKResponse
+				json.Unmarshal(rr.Body.Bytes(), &res)
+				answer, _ := json.Marshal(res.Answer)
+				checkBody(testCase.path, answer, "SequencePage")
+			}
+		}
+	})
+
+	t.Run("conditional", func(t *testing.T) {
+		get := func(path, etag string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// without the query, each GET has to turn the request away
+		for name := range supportedOperations {
+			if lookup(doc, "paths", "/"+name, "get") == nil {
+				continue
+			}
+			rr := get("/"+name, "")
+			if lookup(doc, "paths", "/"+name, "get", "responses", strconv.Itoa(rr.Code)) == nil {
+				t.Logf("undocumented GET status for %s: %d\n", name, rr.Code)
+				t.Fail()
+			}
+		}
+
+		targets := []string{
+			"/add?x=1&y=3",
+			"/pow?x=2&y=10&places=2",
+			"/mean?data=1&data=2&data=3",
+			"/factor?n=360",
+			"/and?x=12&y=10&width=8",
+			"/convert?value=5&from=km&to=m",
+			"/convert/base?value=255&to=16",
+			"/sequence?kind=fibonacci&count=5",
+		}
+		for _, target := range targets {
+			path := strings.SplitN(target, "?", 2)[0]
+			rr := get(target, "")
+			etag := rr.Header().Get("ETag")
+			if rr.Code != http.StatusOK || etag == "" || lookup(doc, "paths", path, "get", "responses", "200", "headers", "ETag") == nil {
+				t.Logf("unexpected GET %s response: %d %q %s\n", target, rr.Code, etag, rr.Body.String())
+				t.Fail()
+				continue
+			}
+			checkBody(target, rr.Body.Bytes(), "MathOKResponse")
+
+			rr = get(target, etag)
+			if rr.Code != http.StatusNotModified || lookup(doc, "paths", path, "get", "responses", "304") == nil {
+				t.Logf("unexpected conditional GET %s response: (actual %d != expected %d)\n", target, rr.Code, http.StatusNotModified)
+				t.Fail()
+			}
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		// every value an option's enum allows has to be one evalOptionsFrom accepts
+		for _, name := range sortedKeys(lookup(doc, "components", "parameters")) {
+			for _, value := range sortedStrings(lookup(doc, "components", "parameters", name, "schema", "enum")) {
+				_, err := evalOptionsFrom(func(param, header string) string {
+					if param == name {
+						return value
+					}
+					return ""
+				})
+				if err != nil {
+					t.Logf("unexpected error for %s=%s: %s\n", name, value, err)
+					t.Fail()
+				}
+			}
+		}
+	})
+}
+
+// TestDocs checks that /docs is a Swagger UI page for /openapi.json, and only answers GETs
+func TestDocs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	rr := httptest.NewRecorder()
+	GetRouter().ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "swagger-ui-dist@"+swaggerUIVersion) || !strings.Contains(body, `url: "/openapi.json"`) {
+		t.Logf("unexpected docs page: %d %s\n", rr.Code, body)
+		t.Fail()
+	}
+
+	// with a copy of swagger-ui-dist, nothing comes from unpkg
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "swagger-ui-bundle.js"), []byte("// bundle"), 0o644)
+	if err != nil {
+		t.Fatalf("write asset failed: %s\n", err)
+	}
+	ServeDocsAssets(dir)
+	defer ServeDocsAssets("")
+
+	rr = httptest.NewRecorder()
+	GetRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	body = rr.Body.String()
+	if strings.Contains(body, "unpkg") || !strings.Contains(body, `src="/docs/swagger-ui-bundle.js"`) {
+		t.Logf("unexpected vendored docs page: %s\n", body)
+		t.Fail()
+	}
+
+	assets := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/docs/swagger-ui-bundle.js", http.StatusOK},
+		{"/docs/swagger-ui.css", http.StatusNotFound}, // known, but not in dir
+		{"/docs/openapi_test.go", http.StatusNotFound},
+	}
+	for _, asset := range assets {
+		rr = httptest.NewRecorder()
+		GetRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, asset.path, nil))
+		if rr.Code != asset.expectedStatus {
+			t.Logf("unexpected status for %s: (actual %d != expected %d)\n", asset.path, rr.Code, asset.expectedStatus)
+			t.Fail()
+		}
+	}
+
+	for _, path := range []string{"/docs", "/openapi.json"} {
+		req = httptest.NewRequest(http.MethodPost, path, nil)
+		rr = httptest.NewRecorder()
+		GetRouter().ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest || rr.Header().Get("Allow") != http.MethodGet {
+			t.Logf("unexpected POST %s response: (actual %d != expected %d)\n", path, rr.Code, http.StatusBadRequest)
+			t.Fail()
+		}
+	}
+}
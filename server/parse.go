@@ -1,68 +1,455 @@
 package server
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
+// clientVars holds the client's variables exactly as they were sent, before an operation has decided
+// how to interpret them.  Hanging on to the original text is what lets the precise mode avoid float64
+// rounding.  Form values are converted to their JSON equivalent so everything downstream only has to
+// deal with one encoding
+type clientVars map[string]json.RawMessage
+
 // acceptedContentTypes maps content-types that we've written parsing logic for to the functions
 // that perform that parsing. This is also an O(1) way of checking if we support a given content-type
-var acceptedContentTypes = map[string]func(*http.Request) (float64, float64, error){
+var acceptedContentTypes = map[string]func(*http.Request) (clientVars, error){
 	"application/json":                  parseJSON,
 	"application/x-www-form-urlencoded": parseFormURLEncoded,
+	"text/csv":                          parseCSV,
+}
+
+// These headers are alternatives to the mode, precision, and rounding query parameters
+const (
+	modeHeader      = "X-Math-Mode"
+	precisionHeader = "X-Math-Precision"
+	roundingHeader  = "X-Math-Rounding"
+	decimalHeader   = "X-Math-Decimal"
+	placesHeader    = "X-Math-Places"
+	sigfigsHeader   = "X-Math-Sigfigs"
+	notationHeader  = "X-Math-Notation"
+	localeHeader    = "X-Math-Locale"
+)
+
+// jsonNumberRegexp matches the JSON number grammar, which is stricter than strconv.ParseFloat
+var jsonNumberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// literalPrefixes are the integer literal prefixes we accept alongside decimal numbers.  Neither JSON
+// nor strconv.ParseFloat understands them, so they're converted to decimal as soon as they're parsed
+var literalPrefixes = map[string]int{
+	"0x": 16,
+	"0b": 2,
+	"0o": 8,
+}
+
+// parsePrefixedLiteral parses an optionally signed 0x, 0b, or 0o integer literal.  The second return
+// value is false if str isn't one
+func parsePrefixedLiteral(str string) (*big.Int, bool) {
+	sign, digits := "", str
+	if len(digits) > 0 && (digits[0] == '-' || digits[0] == '+') {
+		sign, digits = digits[:1], digits[1:]
+	}
+	if len(digits) < 3 {
+		return nil, false
+	}
+
+	base, ok := literalPrefixes[strings.ToLower(digits[:2])]
+	if !ok || strings.ContainsAny(digits[2:], "+-") {
+		return nil, false
+	}
+
+	// big.Int's own prefix handling would also accept underscores and a bare leading 0 for octal,
+	// which is more than we want
+	n, ok := new(big.Int).SetString(sign+digits[2:], base)
+	return n, ok
 }
 
 // parseClientVars attempts to determine the request's content-type and parse the
 // variables 'x' and 'y' accordingly
 func parseClientVars(r *http.Request) (float64, float64, error) {
+	vars, err := parseRawVars(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	x, err := vars.float("x")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	y, err := vars.float("y")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return x, y, nil
+}
+
+// parseRawVars attempts to determine the request's content-type and parse its variables without
+// interpreting them
+func parseRawVars(r *http.Request) (clientVars, error) {
 	contentType := r.Header.Get("content-type")
 	if contentType == "" {
-		return 0, 0, fmt.Errorf("no content-type specified")
+		return nil, fmt.Errorf("no content-type specified")
 	}
 
 	if acceptedContentTypes[contentType] == nil {
-		return 0, 0, fmt.Errorf("unsupported content-type: %q", contentType)
+		return nil, fmt.Errorf("unsupported content-type: %q", contentType)
 	}
 
 	return acceptedContentTypes[contentType](r)
 }
 
-// parseJSON attempts to decode the request body into JSON and then returns
-// the X and Y fields (see MathRequest)
-func parseJSON(r *http.Request) (float64, float64, error) {
-	var mathReq MathRequest
+// parseEvalOptions reads the evaluation mode, precision (significant digits), rounding mode, decimal
+// expansion flag, and formatting options from the query parameters or their header equivalents.
+// Query parameters win if both are given
+func parseEvalOptions(r *http.Request) (evalOptions, error) {
+	query := r.URL.Query()
+	return evalOptionsFrom(func(param, header string) string {
+		if value := query.Get(param); value != "" {
+			return value
+		}
+		return r.Header.Get(header)
+	})
+}
+
+// evalOptionsFrom reads evaluation options with setting, which looks an option up by its query
+// parameter or header name.  This is what lets requests that don't come over HTTP have options
+func evalOptionsFrom(setting func(param, header string) string) (evalOptions, error) {
+	opts := defaultEvalOptions
+
+	if mode := setting("mode", modeHeader); mode != "" {
+		opts.mode = evalMode(mode)
+		if !evalModes[opts.mode] {
+			return opts, fmt.Errorf("unsupported mode: %q", mode)
+		}
+	}
+
+	if precision := setting("precision", precisionHeader); precision != "" {
+		digits, err := strconv.Atoi(precision)
+		if err != nil || digits < 1 || digits > maxPreciseDigits {
+			return opts, fmt.Errorf("precision must be between 1 and %d digits, got %q", maxPreciseDigits, precision)
+		}
+		opts.digits = digits
+	}
+
+	if rounding := setting("rounding", roundingHeader); rounding != "" {
+		opts.rounding = roundingMode(rounding)
+		if !roundingModes[opts.rounding] {
+			return opts, fmt.Errorf("unsupported rounding mode: %q", rounding)
+		}
+	}
+
+	if decimal := setting("decimal", decimalHeader); decimal != "" {
+		var err error
+		opts.decimal, err = strconv.ParseBool(decimal)
+		if err != nil {
+			return opts, fmt.Errorf("decimal must be true or false, got %q", decimal)
+		}
+	}
+
+	if places := setting("places", placesHeader); places != "" {
+		n, err := strconv.Atoi(places)
+		if err != nil || n < 0 || n > maxPreciseDigits {
+			return opts, fmt.Errorf("places must be between 0 and %d, got %q", maxPreciseDigits, places)
+		}
+		opts.format.places, opts.format.hasPlaces = n, true
+	}
+
+	if sigfigs := setting("sigfigs", sigfigsHeader); sigfigs != "" {
+		n, err := strconv.Atoi(sigfigs)
+		if err != nil || n < 1 || n > maxPreciseDigits {
+			return opts, fmt.Errorf("sigfigs must be between 1 and %d, got %q", maxPreciseDigits, sigfigs)
+		}
+		if opts.format.hasPlaces {
+			return opts, fmt.Errorf("places and sigfigs can't be used together")
+		}
+		opts.format.sigfigs = n
+	}
+
+	if name := setting("notation", notationHeader); name != "" {
+		opts.format.notation = notation(name)
+		if !notations[opts.format.notation] {
+			return opts, fmt.Errorf("unsupported notation: %q", name)
+		}
+	}
+
+	if locale := setting("locale", localeHeader); locale != "" {
+		if _, ok := lookupLocale(locale); !ok {
+			return opts, fmt.Errorf("unsupported locale: %q", locale)
+		}
+		opts.format.locale = locale
+	}
+	opts.format.rounding = opts.rounding
+
+	return opts, nil
+}
+
+// parseJSON attempts to decode the request body into a JSON object and returns its fields
+// (see MathRequest)
+func parseJSON(r *http.Request) (clientVars, error) {
+	var vars clientVars
 
 	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&mathReq)
+	err := decoder.Decode(&vars)
 	if err != nil {
-		return 0, 0, errors.Wrap(err, "json decode error")
+		return nil, errors.Wrap(err, "json decode error")
 	}
 
-	return mathReq.X, mathReq.Y, nil
+	return vars, nil
 }
 
-// parseFormURLEncoded parses the request form and returns the form values 'x' and 'y'
-func parseFormURLEncoded(r *http.Request) (float64, float64, error) {
+// parseFormURLEncoded parses the request form and returns its values.  Numbers are kept as JSON
+// number literals, anything else becomes a JSON string, and repeated values become an array
+func parseFormURLEncoded(r *http.Request) (clientVars, error) {
 	err := r.ParseForm()
 	if err != nil {
-		return 0, 0, errors.Wrap(err, "parse request form failed")
+		return nil, errors.Wrap(err, "parse request form failed")
 	}
 
-	xStr := r.Form.Get("x")
-	x, err := strconv.ParseFloat(xStr, 64)
+	vars := make(clientVars, len(r.Form))
+	for name, values := range r.Form {
+		literals := make([]json.RawMessage, len(values))
+		for i, value := range values {
+			literals[i] = formLiteral(value)
+		}
+
+		if len(literals) == 1 {
+			vars[name] = literals[0]
+			continue
+		}
+
+		vars[name], err = json.Marshal(literals)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode form value %q failed", name)
+		}
+	}
+
+	return vars, nil
+}
+
+// parseCSV reads a CSV body of numbers.  If the first record isn't numeric, it's a header that names
+// each column.  Otherwise a single row or column becomes 'data' and two columns become 'x' and 'y'.
+// Any other variables come from the query parameters
+func parseCSV(r *http.Request) (clientVars, error) {
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1 // checked below so we can give a better error
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
 	if err != nil {
-		return 0, 0, errors.Wrap(err, "parse x failed")
+		return nil, errors.Wrap(err, "csv decode error")
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("csv body is empty")
+	}
+
+	var names []string
+	if !jsonNumberRegexp.MatchString(strings.TrimSpace(records[0][0])) {
+		names, records = records[0], records[1:]
+	}
+
+	// a single row is transposed into a single column
+	if names == nil && len(records) == 1 {
+		transposed := make([][]string, len(records[0]))
+		for i, field := range records[0] {
+			transposed[i] = []string{field}
+		}
+		records = transposed
+	}
+
+	width := len(names)
+	if len(records) > 0 && names == nil {
+		width = len(records[0])
+	}
+	switch {
+	case names != nil:
+	case width == 1:
+		names = []string{"data"}
+	case width == 2:
+		names = []string{"x", "y"}
+	default:
+		return nil, fmt.Errorf("csv without a header must have one or two columns, got %d", width)
+	}
+
+	columns := make([][]json.RawMessage, len(names))
+	for i, record := range records {
+		if len(record) != len(names) {
+			return nil, fmt.Errorf("csv record %d has %d fields, expected %d", i+1, len(record), len(names))
+		}
+		for j, field := range record {
+			field = strings.TrimSpace(field)
+			if !jsonNumberRegexp.MatchString(field) {
+				return nil, fmt.Errorf("csv record %d: %q is not a number", i+1, field)
+			}
+			columns[j] = append(columns[j], json.RawMessage(field))
+		}
 	}
 
-	yStr := r.Form.Get("y")
-	y, err := strconv.ParseFloat(yStr, 64)
+	vars := make(clientVars, len(names))
+	for name, values := range r.URL.Query() {
+		vars[name] = formLiteral(values[0])
+	}
+	for i, name := range names {
+		vars[strings.TrimSpace(name)], err = json.Marshal(columns[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode csv column %q failed", name)
+		}
+	}
+
+	return vars, nil
+}
+
+// parseQueryOrRawVars is parseRawVars, except that a GET without a content-type reads its variables
+// from the query string.  That's the most natural way to call endpoints that are mostly paged or
+// linked to
+func parseQueryOrRawVars(r *http.Request) (clientVars, error) {
+	if r.Method == http.MethodGet && r.Header.Get("content-type") == "" {
+		return parseFormURLEncoded(r)
+	}
+	return parseRawVars(r)
+}
+
+// formLiteral converts a single form value into its JSON equivalent
+func formLiteral(value string) json.RawMessage {
+	if jsonNumberRegexp.MatchString(value) {
+		return json.RawMessage(value)
+	}
+
+	literal, _ := json.Marshal(value) // marshalling a string can't fail
+	return literal
+}
+
+// text returns the variable as it was written by the client, whether it was sent as a JSON number
+// or a string
+func (v clientVars) text(name string) (string, error) {
+	raw, ok := v[name]
+	if !ok {
+		return "", fmt.Errorf("missing %s", name)
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str, nil
+	}
+
+	var num json.Number
+	if err := json.Unmarshal(raw, &num); err != nil {
+		return "", fmt.Errorf("parse %s failed: expected a number, got %s", name, raw)
+	}
+
+	return num.String(), nil
+}
+
+// numberText is text with prefixed integer literals like "0x1f" converted to decimal.  Form values
+// that aren't JSON numbers end up as strings, so this covers both encodings.  The prefix isn't
+// converted any earlier because /convert/base needs to see it
+func (v clientVars) numberText(name string) (string, error) {
+	text, err := v.text(name)
 	if err != nil {
-		return 0, 0, errors.Wrap(err, "parse y failed")
+		return "", err
 	}
 
-	return x, y, nil
+	if n, ok := parsePrefixedLiteral(text); ok {
+		return n.String(), nil
+	}
+
+	return text, nil
+}
+
+// boolean returns the variable as a bool, whether it was sent as a JSON bool or a string
+func (v clientVars) boolean(name string) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(v[name], &b); err == nil {
+		return b, nil
+	}
+
+	str, err := v.text(name)
+	if err == nil {
+		b, err = strconv.ParseBool(str)
+	}
+	if err != nil {
+		return false, fmt.Errorf("parse %s failed: expected true or false, got %s", name, v[name])
+	}
+
+	return b, nil
+}
+
+// float returns the variable as a float64
+func (v clientVars) float(name string) (float64, error) {
+	text, err := v.numberText(name)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse %s failed", name)
+	}
+
+	return f, nil
+}
+
+// rat returns the variable as an exact rational number.  Decimal strings like "0.1" are exact, unlike
+// their float64 counterparts
+func (v clientVars) rat(name string) (*big.Rat, error) {
+	text, err := v.numberText(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, fmt.Errorf("parse %s failed: %q is not a decimal number", name, text)
+	}
+
+	return r, nil
+}
+
+// integer returns the variable as an integer.  Anything big.Rat can parse is accepted as long as it
+// has no fractional part, so "1e3" and "6/2" are fine but "1.5" isn't
+func (v clientVars) integer(name string) (*big.Int, error) {
+	r, err := v.rat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.IsInt() {
+		return nil, fmt.Errorf("%s must be an integer, got %s", name, r.RatString())
+	}
+
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// numbers returns the variable as a non-empty list of numbers, with at most limit elements.  A lone
+// number is treated as a list of one, since that's what a single form value looks like
+func (v clientVars) numbers(name string, limit int) ([]float64, error) {
+	raw, ok := v[name]
+	if !ok {
+		return nil, newMathError(kindInvalidArgument, "missing %s", name)
+	}
+
+	var nums []float64
+	if err := json.Unmarshal(raw, &nums); err != nil {
+		var num float64
+		if json.Unmarshal(raw, &num) != nil {
+			return nil, newMathError(kindInvalidArgument, "%s must be a non-empty array of numbers", name)
+		}
+		nums = []float64{num}
+	}
+	if len(nums) == 0 {
+		return nil, newMathError(kindInvalidArgument, "%s must be a non-empty array of numbers", name)
+	}
+	if len(nums) > limit {
+		return nil, newMathError(kindLimitExceeded, "%s is limited to %d elements", name, limit)
+	}
+
+	return nums, nil
 }
@@ -21,6 +21,49 @@ func TestParseClientVars(t *testing.T) {
 	t.Run("json with header", parseJSONWithHeader)
 	t.Run("json sans header", parseJSONWithoutHeader)
 	t.Run("unsupported type", parseUnsupportedContentType)
+	t.Run("prefixed literals", parsePrefixedLiterals)
+}
+
+func parsePrefixedLiterals(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		target      string
+		body        string
+		expectedX   float64
+		expectedY   float64
+	}{
+		{"application/x-www-form-urlencoded", "http://localhost:8080/add?x=0x1F&y=-0b101", "", 31, -5},
+		{"application/json", "http://localhost:8080/add", `{"x": "0o17", "y": "+0XFF"}`, 15, 255},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, testCase.target, bytes.NewBufferString(testCase.body))
+		req.Header.Set("Content-Type", testCase.contentType)
+
+		actualX, actualY, err := parseClientVars(req)
+		if err != nil {
+			t.Logf("unexpected error: %s\n", err)
+			t.Fail()
+			continue
+		}
+
+		if actualX != testCase.expectedX {
+			t.Logf("X value mismatch: (actual %f != expected %f)\n", actualX, testCase.expectedX)
+			t.Fail()
+		}
+		if actualY != testCase.expectedY {
+			t.Logf("Y value mismatch: (actual %f != expected %f)\n", actualY, testCase.expectedY)
+			t.Fail()
+		}
+	}
+
+	// only 0x, 0b, and 0o are prefixes, and they need digits after them
+	for _, literal := range []string{"0x", "0d12", "0b102", "0x-1", "0x_ff"} {
+		if n, ok := parsePrefixedLiteral(literal); ok {
+			t.Logf("unexpected literal %q parsed as %s\n", literal, n)
+			t.Fail()
+		}
+	}
 }
 
 func parseFormWithHeader(t *testing.T) {
@@ -0,0 +1,505 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// The precise mode trades speed for answers that are exact whenever they can be, and correct to a
+// requested number of significant digits when they can't.  Operands are parsed straight from their
+// decimal text into big.Rat, so "0.1" really means one tenth.  Each operation has an exact big.Rat
+// implementation that gives up with errInexact when the answer is irrational (root(2, 2), for
+// instance), at which point we fall back to a big.Float approximation
+
+const defaultPreciseDigits = 34 // same as IEEE 754 decimal128
+const maxPreciseDigits = 1000
+
+// maxExactBits limits the size of exact intermediate results so that something like
+// pow(123456789, 987654321) is rejected instead of eating all of our memory
+const maxExactBits = 1 << 16
+
+// maxLogDenominator is the largest denominator we'll try when looking for an exact logarithm.
+// log(8, 4) = 3/2 is found, log(2^(1/17), 2) is approximated
+const maxLogDenominator = 16
+
+// errInexact is returned by exact implementations when the answer is irrational
+var errInexact = newMathError(kindDomain, "answer can't be represented exactly")
+
+// roundingMode determines how answers are rounded to the requested number of digits
+type roundingMode string
+
+const (
+	roundHalfEven roundingMode = "half-even" // ties go to the even neighbor, the default
+	roundHalfUp   roundingMode = "half-up"   // ties go away from zero
+	roundHalfDown roundingMode = "half-down" // ties go toward zero
+	roundUp       roundingMode = "up"        // away from zero
+	roundDown     roundingMode = "down"      // toward zero (truncation)
+	roundCeil     roundingMode = "ceil"      // toward positive infinity
+	roundFloor    roundingMode = "floor"     // toward negative infinity
+)
+
+var roundingModes = map[roundingMode]bool{
+	roundHalfEven: true,
+	roundHalfUp:   true,
+	roundHalfDown: true,
+	roundUp:       true,
+	roundDown:     true,
+	roundCeil:     true,
+	roundFloor:    true,
+}
+
+// preciseBits returns the big.Float mantissa size needed for digits significant decimal digits, with
+// some guard bits so that the final decimal rounding isn't thrown off by binary rounding error
+func preciseBits(digits int) uint {
+	return uint(math.Ceil(float64(digits)*math.Log2(10))) + 64
+}
+
+// evaluatePrecise applies op to x and y, exactly if possible, and formats the answer to digits
+// significant digits
+func evaluatePrecise(op *operation, x, y *big.Rat, digits int, mode roundingMode) (string, error) {
+	ans, err := op.ratFn(x, y)
+	if err == errInexact && op.bigFn != nil {
+		prec := preciseBits(digits)
+		xf := new(big.Float).SetPrec(prec).SetRat(x)
+		yf := new(big.Float).SetPrec(prec).SetRat(y)
+
+		var f *big.Float
+		f, err = op.bigFn(xf, yf)
+		if err == nil {
+			if f.IsInf() {
+				return "", newMathError(kindDomain, "answer out of range")
+			}
+			ans, _ = f.Rat(nil)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return formatRat(ans, digits, mode), nil
+}
+
+// formatRat rounds r to digits significant digits and writes it as a decimal string.  Plain notation
+// is used unless it would need padding zeros beyond the significant digits (or lots of leading zeros)
+func formatRat(r *big.Rat, digits int, mode roundingMode) string {
+	if r.Sign() == 0 {
+		return "0"
+	}
+
+	exp := decimalExponent(r)
+
+	// scale so that the digits we want are left of the decimal point, then round off the rest
+	scale := digits - 1 - exp
+	scaled := new(big.Rat).Mul(r, pow10Rat(scale))
+	mantissa := roundRat(scaled, mode)
+	if new(big.Int).Abs(mantissa).Cmp(pow10Int(digits)) >= 0 {
+		// rounding carried into a new digit (9.99 -> 10.0)
+		mantissa.Quo(mantissa, big.NewInt(10))
+		scale--
+		exp++
+	}
+
+	sign := ""
+	if mantissa.Sign() < 0 {
+		sign = "-"
+	}
+	digitStr := strings.TrimRight(new(big.Int).Abs(mantissa).String(), "0")
+	if digitStr == "" {
+		return "0"
+	}
+
+	if exp < -7 || exp >= digits {
+		// d.ddde±x
+		str := digitStr[:1]
+		if len(digitStr) > 1 {
+			str += "." + digitStr[1:]
+		}
+		return fmt.Sprintf("%s%se%+d", sign, str, exp)
+	}
+
+	if exp < 0 {
+		return sign + "0." + strings.Repeat("0", -exp-1) + digitStr
+	}
+	if len(digitStr) <= exp+1 {
+		return sign + digitStr + strings.Repeat("0", exp+1-len(digitStr))
+	}
+	return sign + digitStr[:exp+1] + "." + digitStr[exp+1:]
+}
+
+// decimalExponent finds exp such that 10^exp <= |r| < 10^(exp+1) for a nonzero r, starting from an
+// estimate based on bit lengths
+func decimalExponent(r *big.Rat) int {
+	exp := int(math.Floor(ratLog2(r) / math.Log2(10)))
+	abs := new(big.Rat).Abs(r)
+	for abs.Cmp(pow10Rat(exp)) < 0 {
+		exp--
+	}
+	for abs.Cmp(pow10Rat(exp+1)) >= 0 {
+		exp++
+	}
+	return exp
+}
+
+// roundRat rounds r to an integer according to mode
+func roundRat(r *big.Rat, mode roundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int)) // truncates toward zero
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	sign := int64(r.Sign())
+	away := func() *big.Int { return quo.Add(quo, big.NewInt(sign)) }
+
+	// compare the remainder to half of the denominator
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	cmpHalf := half.Cmp(r.Denom())
+
+	switch mode {
+	case roundUp:
+		return away()
+	case roundDown:
+		return quo
+	case roundCeil:
+		if sign > 0 {
+			return away()
+		}
+		return quo
+	case roundFloor:
+		if sign < 0 {
+			return away()
+		}
+		return quo
+	case roundHalfUp:
+		if cmpHalf >= 0 {
+			return away()
+		}
+		return quo
+	case roundHalfDown:
+		if cmpHalf > 0 {
+			return away()
+		}
+		return quo
+	default: // roundHalfEven
+		if cmpHalf > 0 || (cmpHalf == 0 && quo.Bit(0) == 1) {
+			return away()
+		}
+		return quo
+	}
+}
+
+func pow10Int(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// pow10Rat returns 10^n for any integer n
+func pow10Rat(n int) *big.Rat {
+	if n < 0 {
+		return new(big.Rat).SetFrac(big.NewInt(1), pow10Int(-n))
+	}
+	return new(big.Rat).SetInt(pow10Int(n))
+}
+
+// ratLog2 approximates log2(|r|) for a nonzero r, even if r is far beyond float64's range
+func ratLog2(r *big.Rat) float64 {
+	return intLog2(r.Num()) - intLog2(r.Denom())
+}
+
+func intLog2(n *big.Int) float64 {
+	abs := new(big.Int).Abs(n)
+	shift := 0
+	if abs.BitLen() > 60 {
+		shift = abs.BitLen() - 60
+		abs.Rsh(abs, uint(shift))
+	}
+	f, _ := new(big.Float).SetInt(abs).Float64()
+	return math.Log2(f) + float64(shift)
+}
+
+// ratIsInt reports whether r is an integer that fits in an int
+func ratIsInt(r *big.Rat) (int, bool) {
+	if !r.IsInt() || !r.Num().IsInt64() {
+		return 0, false
+	}
+	n := r.Num().Int64()
+	if int64(int(n)) != n {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func ratDivide(x, y *big.Rat) (*big.Rat, error) {
+	if y.Sign() == 0 {
+		return nil, newMathError(kindDomain, "division by zero")
+	}
+	return new(big.Rat).Quo(x, y), nil
+}
+
+// ratMod returns x - y*trunc(x/y), which has the sign of x just like math.Mod
+func ratMod(x, y *big.Rat) (*big.Rat, error) {
+	if y.Sign() == 0 {
+		return nil, newMathError(kindDomain, "division by zero")
+	}
+
+	quo := new(big.Rat).Quo(x, y)
+	trunc := new(big.Int).Quo(quo.Num(), quo.Denom())
+	ans := new(big.Rat).SetInt(trunc)
+	ans.Mul(ans, y)
+	return ans.Sub(x, ans), nil
+}
+
+// ratPow returns x^y exactly.  y = p/q is computed as the qth root of x, raised to the p, so it's
+// only exact when that root is rational
+func ratPow(x, y *big.Rat) (*big.Rat, error) {
+	if x.Sign() == 0 {
+		if y.Sign() <= 0 {
+			return nil, newMathError(kindDomain, "zero can't be raised to a non-positive power")
+		}
+		return new(big.Rat), nil
+	}
+
+	if !y.Denom().IsInt64() {
+		return nil, errInexact
+	}
+	if !y.Num().IsInt64() {
+		return nil, newMathError(kindDomain, "exponent %s is too large", y.RatString())
+	}
+	p, q := y.Num().Int64(), y.Denom().Int64()
+
+	base := new(big.Rat).Set(x)
+	if q != 1 {
+		if x.Sign() < 0 && q%2 == 0 {
+			return nil, newMathError(kindDomain, "%s has no real root of degree %d", x.RatString(), q)
+		}
+		num, numExact := intRoot(new(big.Int).Abs(x.Num()), q)
+		den, denExact := intRoot(x.Denom(), q)
+		if !numExact || !denExact {
+			return nil, errInexact
+		}
+		if x.Sign() < 0 {
+			num.Neg(num)
+		}
+		base.SetFrac(num, den)
+	}
+
+	if p < 0 {
+		p = -p
+		base.Inv(base)
+	}
+
+	bits := float64(p) * float64(base.Num().BitLen()+base.Denom().BitLen())
+	if bits > maxExactBits {
+		return nil, newMathError(kindDomain, "answer is too large to compute exactly")
+	}
+
+	exp := big.NewInt(p)
+	num := new(big.Int).Exp(base.Num(), exp, nil)
+	den := new(big.Int).Exp(base.Denom(), exp, nil)
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// ratRoot returns x^(1/y) exactly
+func ratRoot(x, y *big.Rat) (*big.Rat, error) {
+	if y.Sign() == 0 {
+		return nil, newMathError(kindDomain, "root of degree zero")
+	}
+	return ratPow(x, new(big.Rat).Inv(y))
+}
+
+// ratLog returns log x base y when that's a rational number with a small denominator, which is
+// the case when x^q = y^p for some integers p and q
+func ratLog(x, y *big.Rat) (*big.Rat, error) {
+	if x.Sign() <= 0 || y.Sign() <= 0 {
+		return nil, newMathError(kindDomain, "log is only defined for positive numbers")
+	}
+	if y.Cmp(big.NewRat(1, 1)) == 0 {
+		return nil, newMathError(kindDomain, "log base one")
+	}
+
+	estimate := ratLog2(x) / ratLog2(y)
+	for q := int64(1); q <= maxLogDenominator; q++ {
+		p := int64(math.Round(estimate * float64(q)))
+		k := big.NewRat(p, q)
+
+		// if x^q = y^p, then y^(p/q) is x
+		candidate, err := ratPow(y, k)
+		if err != nil {
+			continue
+		}
+		if candidate.Cmp(x) == 0 {
+			return k, nil
+		}
+	}
+
+	return nil, errInexact
+}
+
+// intRoot returns the floor of the kth root of n (n >= 0, k >= 1) and whether it's exact
+func intRoot(n *big.Int, k int64) (*big.Int, bool) {
+	if n.Sign() == 0 || n.Cmp(big.NewInt(1)) == 0 || k == 1 {
+		return new(big.Int).Set(n), true
+	}
+	if k >= int64(n.BitLen()) {
+		// 1 < n < 2^k, so the root is somewhere between 1 and 2
+		return big.NewInt(1), false
+	}
+
+	// Newton's method from an overestimate, stopping when it stops decreasing
+	bigK := big.NewInt(k)
+	kMinusOne := big.NewInt(k - 1)
+	root := new(big.Int).Lsh(big.NewInt(1), uint((int64(n.BitLen())+k-1)/k))
+	for {
+		// next = ((k-1)*root + n/root^(k-1)) / k
+		next := new(big.Int).Exp(root, kMinusOne, nil)
+		next.Quo(n, next)
+		next.Add(next, new(big.Int).Mul(kMinusOne, root))
+		next.Quo(next, bigK)
+		if next.Cmp(root) >= 0 {
+			break
+		}
+		root = next
+	}
+
+	check := new(big.Int).Exp(root, bigK, nil)
+	return root, check.Cmp(n) == 0
+}
+
+// bigPow approximates x^y as e^(y ln x)
+func bigPow(x, y *big.Float) (*big.Float, error) {
+	prec := x.Prec()
+	if x.Sign() == 0 {
+		if y.Sign() <= 0 {
+			return nil, newMathError(kindDomain, "zero can't be raised to a non-positive power")
+		}
+		return new(big.Float).SetPrec(prec), nil
+	}
+
+	sign := 1
+	if x.Sign() < 0 {
+		// negative bases only have a real answer for exponents with an odd denominator
+		yRat, _ := y.Rat(nil)
+		if yRat.Denom().Bit(0) == 0 {
+			return nil, newMathError(kindDomain, "negative base with exponent %s has no real answer", y.Text('g', -1))
+		}
+		if yRat.Num().Bit(0) == 1 {
+			sign = -1
+		}
+	}
+
+	ln := bigLog(new(big.Float).Abs(x), prec)
+	ans := bigExp(ln.Mul(ln, y), prec)
+	if sign < 0 {
+		ans.Neg(ans)
+	}
+	return ans, nil
+}
+
+// bigRoot approximates x^(1/y)
+func bigRoot(x, y *big.Float) (*big.Float, error) {
+	if y.Sign() == 0 {
+		return nil, newMathError(kindDomain, "root of degree zero")
+	}
+
+	// 1/y is only exact as a big.Rat (root(-8, 3) needs the odd denominator to survive)
+	yRat, _ := y.Rat(nil)
+	if x.Sign() < 0 && yRat.Num().Bit(0) == 0 {
+		return nil, newMathError(kindDomain, "negative base with root degree %s has no real answer", y.Text('g', -1))
+	}
+
+	inverse := new(big.Float).SetPrec(x.Prec()).SetRat(new(big.Rat).Inv(yRat))
+	if x.Sign() >= 0 {
+		return bigPow(x, inverse)
+	}
+
+	ans, err := bigPow(new(big.Float).Neg(x), inverse)
+	if err != nil {
+		return nil, err
+	}
+	if yRat.Denom().Bit(0) == 1 {
+		// odd numerator (checked above) over odd denominator keeps the sign
+		ans.Neg(ans)
+	}
+	return ans, nil
+}
+
+// bigLogBase approximates log x base y as ln x / ln y
+func bigLogBase(x, y *big.Float) (*big.Float, error) {
+	if x.Sign() <= 0 || y.Sign() <= 0 {
+		return nil, newMathError(kindDomain, "log is only defined for positive numbers")
+	}
+	if y.Cmp(big.NewFloat(1)) == 0 {
+		return nil, newMathError(kindDomain, "log base one")
+	}
+
+	prec := x.Prec()
+	lnX := bigLog(x, prec)
+	return lnX.Quo(lnX, bigLog(y, prec)), nil
+}
+
+// bigExp returns e^z to prec bits.  z is scaled down by 2^k until the Taylor series converges quickly,
+// then the result is squared k times
+func bigExp(z *big.Float, prec uint) *big.Float {
+	k := 0
+	if z.Sign() != 0 {
+		k = z.MantExp(nil) + 8
+		if k < 0 {
+			k = 0
+		}
+	}
+
+	work := prec + uint(k) + 32
+	r := new(big.Float).SetPrec(work).SetMantExp(z, -k)
+
+	sum := new(big.Float).SetPrec(work).SetInt64(1)
+	term := new(big.Float).SetPrec(work).SetInt64(1)
+	for i := int64(1); ; i++ {
+		term.Mul(term, r)
+		term.Quo(term, new(big.Float).SetInt64(i))
+		if term.Sign() == 0 || term.MantExp(nil) < sum.MantExp(nil)-int(work) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+
+	for i := 0; i < k && !sum.IsInf(); i++ {
+		sum.Mul(sum, sum)
+	}
+
+	return sum.SetPrec(prec)
+}
+
+// bigLog returns ln x to prec bits for a positive x.  x = m * 2^e is split up so that math.Log can
+// provide a starting guess for ln m, which Halley's method then refines
+func bigLog(x *big.Float, prec uint) *big.Float {
+	work := prec + 32
+
+	m := new(big.Float).SetPrec(work)
+	exp := x.MantExp(m)
+	ln := halleyLog(m, work)
+	if exp != 0 {
+		ln2 := halleyLog(new(big.Float).SetPrec(work).SetInt64(2), work)
+		ln.Add(ln, ln2.Mul(ln2, new(big.Float).SetInt64(int64(exp))))
+	}
+
+	return ln.SetPrec(prec)
+}
+
+// halleyLog refines ln a by iterating y += 2(a - e^y) / (a + e^y), which triples the number of
+// correct bits each time.  a must be within float64 range
+func halleyLog(a *big.Float, prec uint) *big.Float {
+	guess, _ := a.Float64()
+	y := new(big.Float).SetPrec(prec).SetFloat64(math.Log(guess))
+
+	// one more iteration than we strictly need to be safe
+	for bits := uint(50); bits < prec*3; bits *= 3 {
+		ey := bigExp(y, prec)
+		num := new(big.Float).SetPrec(prec).Sub(a, ey)
+		den := new(big.Float).SetPrec(prec).Add(a, ey)
+		step := num.Quo(num, den)
+		y.Add(y, step.Mul(step, new(big.Float).SetInt64(2)))
+	}
+
+	return y
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestEvaluatePrecise runs each operation through the precise mode with operands that float64
+// can't represent exactly, along with a few that have no exact answer
+func TestEvaluatePrecise(t *testing.T) {
+	testCases := []struct {
+		op       string
+		x, y     string
+		digits   int
+		rounding roundingMode
+		expected string
+	}{
+		{"add", "0.1", "0.2", 34, roundHalfEven, "0.3"},
+		{"subtract", "1", "0.9", 34, roundHalfEven, "0.1"},
+		{"multiply", "1.1", "1.1", 34, roundHalfEven, "1.21"},
+		{"divide", "1", "3", 10, roundHalfEven, "0.3333333333"},
+		{"divide", "2", "3", 10, roundDown, "0.6666666666"},
+		{"divide", "2", "3", 10, roundHalfUp, "0.6666666667"},
+		{"divide", "-2", "3", 3, roundFloor, "-0.667"},
+		{"divide", "-2", "3", 3, roundCeil, "-0.666"},
+		{"mod", "10.5", "3", 34, roundHalfEven, "1.5"},
+		{"mod", "-10.5", "3", 34, roundHalfEven, "-1.5"},
+		{"pow", "2", "100", 34, roundHalfEven, "1267650600228229401496703205376"},
+		{"pow", "2", "-3", 34, roundHalfEven, "0.125"},
+		{"pow", "4", "1.5", 34, roundHalfEven, "8"},
+		{"pow", "2", "0.5", 20, roundHalfEven, "1.4142135623730950488"},
+		{"root", "-27", "3", 34, roundHalfEven, "-3"},
+		{"root", "2", "2", 30, roundHalfEven, "1.41421356237309504880168872421"},
+		{"root", "-32", "2.5", 20, roundHalfEven, "4"},
+		{"log", "8", "2", 34, roundHalfEven, "3"},
+		{"log", "8", "4", 34, roundHalfEven, "1.5"},
+		{"log", "0.01", "10", 34, roundHalfEven, "-2"},
+		{"log", "10", "2", 25, roundHalfEven, "3.321928094887362347870319"},
+		{"add", "1e30", "1e-10", 50, roundHalfEven, "1000000000000000000000000000000.0000000001"},
+		{"multiply", "1e30", "1e-10", 34, roundHalfEven, "100000000000000000000"},
+		{"multiply", "1e30", "1e10", 34, roundHalfEven, "1e+40"},
+		{"divide", "1", "3e10", 5, roundHalfEven, "3.3333e-11"},
+		{"add", "9.995", "0", 3, roundHalfEven, "10"},
+	}
+
+	for _, testCase := range testCases {
+		x, _ := new(big.Rat).SetString(testCase.x)
+		y, _ := new(big.Rat).SetString(testCase.y)
+		actual, err := evaluatePrecise(supportedOperations[testCase.op], x, y, testCase.digits, testCase.rounding)
+		if err != nil {
+			t.Logf("unexpected error for %s(%s, %s): %s\n", testCase.op, testCase.x, testCase.y, err)
+			t.Fail()
+			continue
+		}
+
+		if actual != testCase.expected {
+			t.Logf("unexpected answer for %s(%s, %s): (actual %s != expected %s)\n", testCase.op, testCase.x, testCase.y, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestEvaluatePreciseErrors checks that operations with no real answer are reported as domain errors
+func TestEvaluatePreciseErrors(t *testing.T) {
+	testCases := []struct {
+		op   string
+		x, y string
+	}{
+		{"divide", "1", "0"},
+		{"mod", "1", "0"},
+		{"pow", "0", "-1"},
+		{"pow", "-2", "0.5"},
+		{"root", "-4", "2"},
+		{"root", "4", "0"},
+		{"log", "-8", "2"},
+		{"log", "8", "1"},
+		{"pow", "10", "1e20"},
+	}
+
+	for _, testCase := range testCases {
+		x, _ := new(big.Rat).SetString(testCase.x)
+		y, _ := new(big.Rat).SetString(testCase.y)
+		_, err := evaluatePrecise(supportedOperations[testCase.op], x, y, defaultPreciseDigits, roundHalfEven)
+		if kindOf(err) != kindDomain {
+			t.Logf("unexpected error for %s(%s, %s): (actual %v != expected domain error)\n", testCase.op, testCase.x, testCase.y, err)
+			t.Fail()
+		}
+	}
+}
+
+// TestPreciseRequest goes through mathHandler to check that mode, precision, and rounding can be set
+// by both query parameters and headers, and that answers come back as strings
+func TestPreciseRequest(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	// query parameters with a JSON body, so that x and y are never float64s
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/divide?mode=precise&precision=5&rounding=up", strings.NewReader(`{"x": 0.1, "y": "0.3"}`))
+	req.Header.Set("Content-Type", "application/json")
+	preciseRequest(t, req, "0.33334")
+
+	// headers with a form body
+	req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/add?x=0.1&y=0.2", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(modeHeader, "precise")
+	preciseRequest(t, req, "0.3")
+
+	// bad options
+	for _, query := range []string{"mode=imaginary", "mode=precise&precision=0", "mode=precise&rounding=sideways"} {
+		req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/add?x=1&y=2&"+query, nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		errorRequest(t, http.StatusBadRequest, req)
+	}
+
+	// domain error
+	req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/divide?x=1&y=0&mode=precise", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	errorRequest(t, http.StatusUnprocessableEntity, req)
+}
+
+func preciseRequest(t *testing.T, req *http.Request, expectedAns string) {
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	var mathRes MathOKResponse
+	err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+
+	if mathRes.Mode != string(modePrecise) {
+		t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modePrecise)
+		t.Fail()
+	}
+
+	if fmt.Sprint(mathRes.Answer) != expectedAns {
+		t.Logf("unexpected ans value: (actual %v != expected %s)\n", mathRes.Answer, expectedAns)
+		t.Fail()
+	}
+}
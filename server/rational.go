@@ -0,0 +1,69 @@
+package server
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// The rational mode is the precise mode without the approximations.  Answers are exact fractions
+// like "7/12", and any operation whose answer is irrational (root(2, 2), for instance) is an error
+// rather than a rounded decimal.  The exact implementations are shared with the precise mode
+
+// maxDecimalDigits limits the decimal expansion of rational answers.  Repeating decimals have a period
+// of up to denominator - 1 digits, so 1/7919 would otherwise be several thousand digits long
+const maxDecimalDigits = 1000
+
+// evaluateRational applies op to x and y exactly and returns the answer as a reduced fraction
+func evaluateRational(op *operation, x, y *big.Rat) (string, error) {
+	ans, err := op.ratFn(x, y)
+	if err != nil {
+		return "", err
+	}
+
+	return ans.RatString(), nil
+}
+
+// ratDecimal writes r as a decimal with any repeating digits in parentheses, so 7/12 is "0.58(3)".
+// Expansions longer than maxDecimalDigits are cut off with "..."
+func ratDecimal(r *big.Rat) string {
+	return ratDigits(r, 10)
+}
+
+// ratDigits is ratDecimal in any base from 2 to 36, so 1/3 in base 2 is "0.(01)".  Digits past 9 are
+// lowercase letters, as they are in strconv
+func ratDigits(r *big.Rat, base int) string {
+	var b strings.Builder
+	if r.Sign() < 0 {
+		b.WriteString("-")
+	}
+
+	den := r.Denom()
+	quo, rem := new(big.Int).QuoRem(new(big.Int).Abs(r.Num()), den, new(big.Int))
+	b.WriteString(quo.Text(base))
+	if rem.Sign() == 0 {
+		return b.String()
+	}
+	b.WriteString(".")
+
+	// long division, remembering where each remainder first showed up so we can spot the repeat
+	bigBase := big.NewInt(int64(base))
+	seen := make(map[string]int)
+	var digits []byte
+	for rem.Sign() != 0 {
+		if start, ok := seen[rem.String()]; ok {
+			return b.String() + string(digits[:start]) + "(" + string(digits[start:]) + ")"
+		}
+		if len(digits) == maxDecimalDigits {
+			return b.String() + string(digits) + "..."
+		}
+		seen[rem.String()] = len(digits)
+
+		rem.Mul(rem, bigBase)
+		digit := new(big.Int)
+		digit.QuoRem(rem, den, rem)
+		digits = append(digits, strconv.FormatInt(digit.Int64(), base)[0])
+	}
+
+	return b.String() + string(digits)
+}
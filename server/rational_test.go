@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestEvaluateRational checks exact fraction answers for fraction, integer, and decimal operands
+func TestEvaluateRational(t *testing.T) {
+	testCases := []struct {
+		op       string
+		x, y     string
+		expected string
+	}{
+		{"add", "1/3", "1/4", "7/12"},
+		{"subtract", "0.5", "1/3", "1/6"},
+		{"multiply", "2/3", "9", "6"},
+		{"divide", "1", "0.3", "10/3"},
+		{"mod", "7/2", "1", "1/2"},
+		{"pow", "2/3", "3", "8/27"},
+		{"pow", "2/3", "-2", "9/4"},
+		{"root", "8/27", "3", "2/3"},
+		{"log", "1/8", "2", "-3"},
+	}
+
+	for _, testCase := range testCases {
+		x, _ := new(big.Rat).SetString(testCase.x)
+		y, _ := new(big.Rat).SetString(testCase.y)
+		actual, err := evaluateRational(supportedOperations[testCase.op], x, y)
+		if err != nil {
+			t.Logf("unexpected error for %s(%s, %s): %s\n", testCase.op, testCase.x, testCase.y, err)
+			t.Fail()
+			continue
+		}
+
+		if actual != testCase.expected {
+			t.Logf("unexpected answer for %s(%s, %s): (actual %s != expected %s)\n", testCase.op, testCase.x, testCase.y, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+
+	// irrational answers are errors rather than approximations
+	x, y := big.NewRat(2, 1), big.NewRat(2, 1)
+	_, err := evaluateRational(supportedOperations["root"], x, y)
+	if err != errInexact {
+		t.Logf("unexpected error for root(2, 2): (actual %v != expected %s)\n", err, errInexact)
+		t.Fail()
+	}
+}
+
+// TestRatDecimal checks terminating, repeating, and truncated decimal expansions
+func TestRatDecimal(t *testing.T) {
+	testCases := map[string]string{
+		"3":        "3",
+		"-1/8":     "-0.125",
+		"7/12":     "0.58(3)",
+		"1/7":      "0.(142857)",
+		"-22/7":    "-3.(142857)",
+		"1/3":      "0.(3)",
+		"100/1":    "100",
+		"123/1000": "0.123",
+	}
+
+	for ratStr, expected := range testCases {
+		r, _ := new(big.Rat).SetString(ratStr)
+		actual := ratDecimal(r)
+		if actual != expected {
+			t.Logf("unexpected decimal for %s: (actual %s != expected %s)\n", ratStr, actual, expected)
+			t.Fail()
+		}
+	}
+
+	// 1/7919 repeats every 7918 digits
+	truncated := ratDecimal(big.NewRat(1, 7919))
+	if len(truncated) != len("0.")+maxDecimalDigits+len("...") {
+		t.Logf("unexpected truncated length: (actual %d != expected %d)\n", len(truncated), len("0.")+maxDecimalDigits+len("..."))
+		t.Fail()
+	}
+}
+
+// TestRatDigits checks expansions in bases other than 10
+func TestRatDigits(t *testing.T) {
+	testCases := []struct {
+		rat      string
+		base     int
+		expected string
+	}{
+		{"255", 16, "ff"},
+		{"-5", 2, "-101"},
+		{"1/3", 2, "0.(01)"},
+		{"1/10", 2, "0.0(0011)"},
+		{"3/8", 8, "0.3"},
+		{"71/2", 36, "z.i"},
+	}
+
+	for _, testCase := range testCases {
+		r, _ := new(big.Rat).SetString(testCase.rat)
+		actual := ratDigits(r, testCase.base)
+		if actual != testCase.expected {
+			t.Logf("unexpected base %d digits for %s: (actual %s != expected %s)\n", testCase.base, testCase.rat, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+}
+
+// TestRationalRequest goes through mathHandler with a decimal expansion requested
+func TestRationalRequest(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/add?x=1/3&y=1/4&mode=rational&decimal=true", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	var mathRes MathOKResponse
+	err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+
+	if mathRes.Answer != "7/12" {
+		t.Logf("unexpected ans value: (actual %v != expected 7/12)\n", mathRes.Answer)
+		t.Fail()
+	}
+	if mathRes.Decimal != "0.58(3)" {
+		t.Logf("unexpected decimal value: (actual %s != expected 0.58(3))\n", mathRes.Decimal)
+		t.Fail()
+	}
+	if mathRes.X != "1/3" || mathRes.Y != "1/4" {
+		t.Logf("unexpected x, y values: (actual %v, %v != expected 1/3, 1/4)\n", mathRes.X, mathRes.Y)
+		t.Fail()
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "http://localhost:8080/log?x=10&y=2&mode=rational", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	errorRequest(t, http.StatusUnprocessableEntity, req)
+}
@@ -0,0 +1,629 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// /sequence generates the terms of a sequence and /series generates its partial sums.  Both take the
+// kind of sequence, its parameters, and the total number of terms, and return them a page at a time
+// along with a cursor for the next page.  Clients that want everything at once can ask for NDJSON
+// instead, which streams every remaining term without caching any of it
+
+const defaultSequenceCount = 100
+const maxSequenceCount = 1000000
+const defaultPageSize = 100
+const maxPageSize = 1000
+
+// ndjsonContentType is the content-type of streamed sequences
+const ndjsonContentType = "application/x-ndjson"
+
+// sequenceKind is a single entry in sequenceKinds.  terms returns limit terms starting from the
+// cursor's offset, as float64s or *big.Ints
+type sequenceKind struct {
+	params   []string // optional parameters, besides count, limit, and cursor
+	maxCount int
+	terms    func(s sequenceSpec, from sequenceCursor, limit int) ([]interface{}, error)
+	cache    cachePolicy
+
+	bigTerms bool // terms are *big.Ints rather than float64s
+	resumes  bool // terms can pick up from the cursor's last term rather than starting over
+}
+
+// sequenceKinds are the sequences that /sequence and /series can generate.  Every sequence starts at
+// index 0
+var sequenceKinds = map[string]*sequenceKind{
+	"arithmetic": {
+		params:   []string{"start", "step"},
+		maxCount: maxSequenceCount,
+		terms:    arithmeticTerms,
+		cache:    defaultCachePolicy,
+	},
+	"geometric": {
+		params:   []string{"start", "ratio"},
+		maxCount: maxSequenceCount,
+		terms:    geometricTerms,
+		cache:    defaultCachePolicy,
+	},
+	"fibonacci": {
+		maxCount: 10000, // the 10000th is already 2090 digits long
+		terms:    fibonacciTerms,
+		cache:    longCachePolicy,
+		bigTerms: true,
+	},
+	"prime": {
+		maxCount: maxSequenceCount,
+		terms:    primeTerms,
+		cache:    longCachePolicy,
+		bigTerms: true,
+		resumes:  true,
+	},
+	"expression": {
+		params:   []string{"expression"},
+		maxCount: maxSequenceCount,
+		terms:    expressionTerms,
+		cache:    defaultCachePolicy,
+	},
+}
+
+// sequenceParams and sequenceOptional are the variables every sequence reads, in the order they're
+// given positionally in protocols that do that.  Each kind's own params are only read by name
+var (
+	sequenceParams   = []string{"kind"}
+	sequenceOptional = []string{"count", "limit", "cursor"}
+)
+
+// sequenceDefaults are the values of parameters that weren't given
+var sequenceDefaults = map[string]float64{
+	"start": 0,
+	"step":  1,
+	"ratio": 2,
+}
+
+// sequenceCursor is where a page starts: the offset of its first term, along with what the page
+// before it worked out that this one would otherwise have to start over for.  Following cursors
+// from page to page, or streaming, is then linear in the number of terms rather than quadratic
+type sequenceCursor struct {
+	offset int
+	sum    interface{} // series, the float64 or *big.Int sum of every term before offset, if known
+	last   int         // kinds that resume, the term before offset, if known
+}
+
+// sequenceSpec is a parsed request for a sequence or series
+type sequenceSpec struct {
+	kind   string
+	series bool // partial sums rather than terms
+	params map[string]float64
+	expr   *exprNode // expression sequences only, in terms of n
+	count  int
+}
+
+// sequenceHandler serves both /sequence and /series
+func sequenceHandler(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if r.Body == nil {
+			return
+		}
+		err := r.Body.Close()
+		if err != nil {
+			log.Printf("req body close failed: %s\n", err)
+		}
+	}()
+
+	vars, err := parseQueryOrRawVars(r)
+	if err != nil {
+		log.Printf("parse client vars failed: %s\n", err)
+		writeErrorResponse(w, newMathError(kindInvalidArgument, "%s", err))
+		return
+	}
+
+	family := strings.TrimPrefix(r.URL.Path, "/")
+	if !wantsNDJSON(r, vars) {
+		serveEvaluation(w, r, family, vars)
+		return
+	}
+
+	spec, from, _, err := parseSequenceSpec(family, vars)
+	if err != nil {
+		log.Printf("%s\n", err)
+		writeErrorResponse(w, err)
+		return
+	}
+	streamSequence(w, spec, from)
+}
+
+// wantsNDJSON reports whether the client asked for a stream rather than pages, with a format of
+// "ndjson" or an Accept header
+func wantsNDJSON(r *http.Request, vars clientVars) bool {
+	format := r.URL.Query().Get("format")
+	if text, err := vars.text("format"); err == nil {
+		format = text
+	}
+	return format == "ndjson" || strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+}
+
+// parseSequenceSpec parses the sequence, the total count, and the page (cursor and limit) that was
+// requested.  family is either "sequence" or "series"
+func parseSequenceSpec(family string, vars clientVars) (sequenceSpec, sequenceCursor, int, error) {
+	var from sequenceCursor
+	spec := sequenceSpec{
+		series: family == "series",
+		params: make(map[string]float64),
+		count:  defaultSequenceCount,
+	}
+
+	var err error
+	spec.kind, err = vars.text("kind")
+	if err != nil {
+		return spec, from, 0, newMathError(kindInvalidArgument, "%s", err)
+	}
+	kind := sequenceKinds[spec.kind]
+	if kind == nil {
+		return spec, from, 0, newMathError(kindUnsupportedOperation, "unsupported sequence kind: %q", spec.kind)
+	}
+
+	for _, param := range kind.params {
+		if param == "expression" {
+			text, err := vars.text(param)
+			if err != nil {
+				return spec, from, 0, newMathError(kindInvalidArgument, "%s", err)
+			}
+			spec.expr, err = parseExpression(text)
+			if err != nil {
+				return spec, from, 0, err
+			}
+			for name := range spec.expr.variables(nil) {
+				if name != "n" {
+					return spec, from, 0, newMathError(kindInvalidArgument, "expression can only depend on n, found %s", name)
+				}
+			}
+			continue
+		}
+
+		spec.params[param] = sequenceDefaults[param]
+		if _, ok := vars[param]; ok {
+			spec.params[param], err = vars.float(param)
+			if err == nil {
+				err = checkFinite(spec.params[param])
+			}
+			if err != nil {
+				return spec, from, 0, newMathError(kindInvalidArgument, "%s", err)
+			}
+		}
+	}
+
+	spec.count, err = vars.optionalCount("count", defaultSequenceCount, kind.maxCount)
+	if err != nil {
+		return spec, from, 0, err
+	}
+	limit, err := vars.optionalCount("limit", defaultPageSize, maxPageSize)
+	if err != nil {
+		return spec, from, 0, err
+	}
+
+	if _, ok := vars["cursor"]; ok {
+		cursor, err := vars.text("cursor")
+		if err == nil {
+			from, err = decodeCursor(cursor, kind)
+		}
+		if err != nil || from.offset >= spec.count {
+			return spec, from, 0, newMathError(kindInvalidArgument, "invalid cursor: %s", vars["cursor"])
+		}
+	}
+
+	return spec, from, limit, nil
+}
+
+// optionalCount returns the variable as a positive integer no greater than max, or def if it
+// wasn't given
+func (v clientVars) optionalCount(name string, def, max int) (int, error) {
+	if _, ok := v[name]; !ok {
+		return def, nil
+	}
+
+	f, err := v.float(name)
+	if err != nil || f != math.Trunc(f) || f < 1 {
+		return 0, newMathError(kindInvalidArgument, "%s must be a positive integer, got %s", name, v[name])
+	}
+	if f > float64(max) {
+		return 0, newMathError(kindLimitExceeded, "%s must be at most %d, got %s", name, max, v[name])
+	}
+	return int(f), nil
+}
+
+// String writes the cursor as fields like "offset:100;sum:4950", which is also how it's keyed
+func (c sequenceCursor) String() string {
+	fields := []string{"offset:" + strconv.Itoa(c.offset)}
+	switch sum := c.sum.(type) {
+	case float64:
+		fields = append(fields, "sum:"+strconv.FormatFloat(sum, 'g', -1, 64))
+	case *big.Int:
+		fields = append(fields, "sum:"+sum.String())
+	}
+	if c.last > 0 {
+		fields = append(fields, "last:"+strconv.Itoa(c.last))
+	}
+	return strings.Join(fields, ";")
+}
+
+// Cursors are opaque to clients, but they're really just a sequenceCursor.  A cursor that's been
+// tampered with can only get wrong answers for itself, since every page is cached under its cursor
+func encodeCursor(c sequenceCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.String()))
+}
+
+func decodeCursor(cursor string, kind *sequenceKind) (sequenceCursor, error) {
+	var c sequenceCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, err
+	}
+
+	malformed := fmt.Errorf("malformed cursor")
+	hasOffset := false
+	for _, field := range strings.Split(string(decoded), ";") {
+		name, value, _ := strings.Cut(field, ":")
+		switch name {
+		case "offset":
+			c.offset, err = strconv.Atoi(value)
+			if err != nil || c.offset < 0 {
+				return c, malformed
+			}
+			hasOffset = true
+		case "sum":
+			if kind.bigTerms {
+				sum, ok := new(big.Int).SetString(value, 10)
+				if !ok {
+					return c, malformed
+				}
+				c.sum = sum
+				continue
+			}
+			sum, err := strconv.ParseFloat(value, 64)
+			if err != nil || checkFinite(sum) != nil {
+				return c, malformed
+			}
+			c.sum = sum
+		case "last":
+			c.last, err = strconv.Atoi(value)
+			if err != nil || c.last < 1 || !kind.resumes {
+				return c, malformed
+			}
+		default:
+			return c, malformed
+		}
+	}
+	// the term before offset can't be past where the offset-th prime could be, or a made up cursor
+	// could have us sieve as far as it likes
+	if !hasOffset || c.last > 0 && (c.offset == 0 || c.last > nthPrimeBound(c.offset)) {
+		return c, malformed
+	}
+	return c, nil
+}
+
+// newRoutedSequenceEvaluation builds the evaluation of the page a request to /sequence or /series
+// asks for.  Sequences aren't formatted, so opts don't matter beyond being valid
+func newRoutedSequenceEvaluation(family string, vars clientVars, opts evalOptions) (*evaluation, error) {
+	spec, from, limit, err := parseSequenceSpec(family, vars)
+	if err != nil {
+		return nil, err
+	}
+	return newSequenceEvaluation(spec, from, limit), nil
+}
+
+// newSequenceEvaluation builds an evaluation of a single page, so that each page is cached under
+// its own key
+func newSequenceEvaluation(spec sequenceSpec, from sequenceCursor, limit int) *evaluation {
+	if from.offset+limit > spec.count {
+		limit = spec.count - from.offset
+	}
+
+	op := "sequence"
+	if spec.series {
+		op = "series"
+	}
+
+	args := map[string]interface{}{
+		"kind":  spec.kind,
+		"count": spec.count,
+	}
+	keyArgs := []string{spec.kind, strconv.Itoa(spec.count)}
+	for param, value := range spec.params {
+		args[param] = value
+	}
+	for _, param := range sequenceKinds[spec.kind].params {
+		if param == "expression" {
+			args[param] = spec.expr.String()
+			keyArgs = append(keyArgs, spec.expr.String())
+			continue
+		}
+		keyArgs = append(keyArgs, strconv.FormatFloat(spec.params[param], 'g', -1, 64))
+	}
+	keyArgs = append(keyArgs, "cursor="+from.String(), "limit="+strconv.Itoa(limit))
+
+	return &evaluation{
+		op:     op,
+		mode:   modeSequence,
+		args:   args,
+		key:    createArgsCacheKey(string(modeSequence), op, keyArgs...),
+		policy: sequenceKinds[spec.kind].cache,
+		compute: func() (interface{}, error) {
+			values, next, err := spec.page(from, limit)
+			if err != nil {
+				return nil, err
+			}
+
+			page := SequencePage{
+				Offset: from.offset,
+				Count:  spec.count,
+				Values: values,
+			}
+			if next.offset < spec.count {
+				page.NextCursor = encodeCursor(next)
+			}
+			return page, nil
+		},
+	}
+}
+
+// page returns the terms or partial sums from the cursor's offset to offset+limit, ready to be
+// encoded, along with the cursor for the page after it
+func (s sequenceSpec) page(from sequenceCursor, limit int) ([]interface{}, sequenceCursor, error) {
+	kind := sequenceKinds[s.kind]
+	next := sequenceCursor{offset: from.offset + limit}
+
+	// partial sums need every term before the page too, unless the cursor has their sum
+	start := from
+	if s.series && from.sum == nil {
+		start = sequenceCursor{}
+	}
+	terms, err := kind.terms(s, start, next.offset-start.offset)
+	if err != nil {
+		return nil, next, err
+	}
+	if kind.resumes && len(terms) > 0 {
+		next.last = int(terms[len(terms)-1].(*big.Int).Int64())
+	}
+	if !s.series {
+		return encodeTerms(terms), next, nil
+	}
+
+	var floatSum float64
+	bigSum := new(big.Int)
+	switch sum := start.sum.(type) {
+	case float64:
+		floatSum = sum
+	case *big.Int:
+		bigSum.Set(sum)
+	}
+	for i, term := range terms {
+		switch term := term.(type) {
+		case float64:
+			floatSum += term
+			if err := checkFinite(floatSum); err != nil {
+				return nil, next, newMathError(kindDomain, "partial sum %d is not finite", start.offset+i)
+			}
+			terms[i] = floatSum
+		case *big.Int:
+			bigSum.Add(bigSum, term)
+			terms[i] = new(big.Int).Set(bigSum)
+		}
+	}
+
+	next.sum = floatSum
+	if kind.bigTerms {
+		next.sum = bigSum
+	}
+	return encodeTerms(terms[from.offset-start.offset:]), next, nil
+}
+
+// encodeTerms writes big integers as strings (like the integer operations do) so that JSON doesn't
+// truncate them
+func encodeTerms(terms []interface{}) []interface{} {
+	for i, term := range terms {
+		if n, ok := term.(*big.Int); ok {
+			terms[i] = n.String()
+		}
+	}
+	return terms
+}
+
+// streamSequence writes every term from offset onward as a line of NDJSON, a page at a time, and
+// then a SequenceEnd line
+func streamSequence(w http.ResponseWriter, spec sequenceSpec, from sequenceCursor) {
+	// a million terms can take longer than the server's write timeout allows an ordinary response
+	controller := http.NewResponseController(w)
+	err := controller.SetWriteDeadline(time.Time{})
+	if err != nil && err != http.ErrNotSupported {
+		log.Printf("clear write deadline failed: %s\n", err)
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for from.offset < spec.count {
+		limit := maxPageSize
+		if from.offset+limit > spec.count {
+			limit = spec.count - from.offset
+		}
+
+		values, next, err := spec.page(from, limit)
+		if err != nil {
+			// the status is already sent, so the error goes in the stream
+			_, errBytes := createErrorResponse(err)
+			log.Printf("stream sequence failed: %s\n", err)
+			if _, err := w.Write(append(errBytes, '\n')); err != nil {
+				log.Printf("response write failed: %s\n", err)
+			}
+			return
+		}
+
+		for i, value := range values {
+			if err := encoder.Encode(SequenceTerm{Index: from.offset + i, Value: value}); err != nil {
+				log.Printf("response write failed: %s\n", err)
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		from = next
+	}
+
+	if err := encoder.Encode(SequenceEnd{Done: true, Count: spec.count}); err != nil {
+		log.Printf("response write failed: %s\n", err)
+	}
+}
+
+func arithmeticTerms(s sequenceSpec, from sequenceCursor, limit int) ([]interface{}, error) {
+	terms := make([]interface{}, limit)
+	for i := range terms {
+		terms[i] = s.params["start"] + float64(from.offset+i)*s.params["step"]
+	}
+	return terms, nil
+}
+
+func geometricTerms(s sequenceSpec, from sequenceCursor, limit int) ([]interface{}, error) {
+	terms := make([]interface{}, limit)
+	for i := range terms {
+		term := s.params["start"] * math.Pow(s.params["ratio"], float64(from.offset+i))
+		if err := checkFinite(term); err != nil {
+			return nil, newMathError(kindDomain, "term %d is not finite", from.offset+i)
+		}
+		terms[i] = term
+	}
+	return terms, nil
+}
+
+// fibonacciTerms starts from F(0) = 0 and F(1) = 1
+func fibonacciTerms(s sequenceSpec, from sequenceCursor, limit int) ([]interface{}, error) {
+	a, b := fibonacciPair(from.offset)
+	terms := make([]interface{}, limit)
+	for i := range terms {
+		terms[i] = a
+		a, b = b, new(big.Int).Add(a, b)
+	}
+	return terms, nil
+}
+
+// fibonacciPair returns F(n) and F(n+1) by fast doubling, so pages don't need every term before them
+func fibonacciPair(n int) (*big.Int, *big.Int) {
+	if n == 0 {
+		return big.NewInt(0), big.NewInt(1)
+	}
+
+	a, b := fibonacciPair(n / 2)
+	// F(2k) = F(k) * (2F(k+1) - F(k)) and F(2k+1) = F(k)^2 + F(k+1)^2
+	c := new(big.Int).Lsh(b, 1)
+	c.Sub(c, a).Mul(c, a)
+	d := new(big.Int).Mul(a, a)
+	d.Add(d, new(big.Int).Mul(b, b))
+
+	if n%2 == 0 {
+		return c, d
+	}
+	return d, c.Add(c, d)
+}
+
+// primeTerms starts from 2.  With the prime before the page, only the primes after it are sieved,
+// otherwise every prime up to the end of the page is
+func primeTerms(s sequenceSpec, from sequenceCursor, limit int) ([]interface{}, error) {
+	var primes []int
+	switch {
+	case from.offset == 0:
+		primes = primesAfter(1, limit)
+	case from.last > 0:
+		primes = primesAfter(from.last, limit)
+	default:
+		primes = primesUpTo(nthPrimeBound(from.offset + limit))[from.offset:]
+	}
+
+	terms := make([]interface{}, limit)
+	for i := range terms {
+		terms[i] = big.NewInt(int64(primes[i]))
+	}
+	return terms, nil
+}
+
+// nthPrimeBound is an upper bound on the nth prime (counting 2 as the 1st), by Rosser's theorem
+func nthPrimeBound(n int) int {
+	if n < 6 {
+		return 13
+	}
+	ln := math.Log(float64(n))
+	return int(float64(n) * (ln + math.Log(ln)))
+}
+
+// primesUpTo is the sieve of Eratosthenes
+func primesUpTo(n int) []int {
+	composite := make([]bool, n+1)
+	var primes []int
+	for i := 2; i <= n; i++ {
+		if composite[i] {
+			continue
+		}
+		primes = append(primes, i)
+		for j := i * i; j <= n; j += i {
+			composite[j] = true
+		}
+	}
+	return primes
+}
+
+// primesAfter returns the first count primes greater than after, sieving a window at a time.  Each
+// window is sized to hold about as many primes as are still needed, going by their density
+func primesAfter(after, count int) []int {
+	primes := make([]int, 0, count)
+	lo := after + 1
+	if lo < 2 {
+		lo = 2
+	}
+
+	for len(primes) < count {
+		hi := lo + (count-len(primes))*(int(math.Log(float64(lo)))+2) + 64
+		composite := make([]bool, hi-lo)
+		for _, p := range primesUpTo(int(math.Sqrt(float64(hi)))) {
+			// multiples below p*p have a smaller factor that already crossed them off
+			first := (lo + p - 1) / p * p
+			if first < p*p {
+				first = p * p
+			}
+			for j := first; j < hi; j += p {
+				composite[j-lo] = true
+			}
+		}
+
+		for i, crossed := range composite {
+			if !crossed && len(primes) < count {
+				primes = append(primes, lo+i)
+			}
+		}
+		lo = hi
+	}
+	return primes
+}
+
+// expressionTerms evaluates an expression at n = offset, offset+1, ...
+func expressionTerms(s sequenceSpec, from sequenceCursor, limit int) ([]interface{}, error) {
+	vars := make(map[string]float64, 1)
+	terms := make([]interface{}, limit)
+	for i := range terms {
+		vars["n"] = float64(from.offset + i)
+		term, err := s.expr.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		terms[i] = term
+	}
+	return terms, nil
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// getSequencePage requests a page with a plain GET and decodes it
+func getSequencePage(t *testing.T, path string) (SequencePage, MathOKResponse) {
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+path, nil)
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	var page SequencePage
+	mathRes := MathOKResponse{Answer: &page}
+	err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+	if err != nil {
+		t.Fatalf("json decode failed: %s\n", err)
+	}
+	if resRecorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status value: (actual %d != expected %d)\n", resRecorder.Code, http.StatusOK)
+	}
+
+	return page, mathRes
+}
+
+// TestSequenceKinds checks the first page of each kind of sequence and series
+func TestSequenceKinds(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		name     string
+		path     string
+		expected []interface{}
+	}{
+		{"arithmetic", "/sequence?kind=arithmetic&start=3&step=-2&count=4", []interface{}{3.0, 1.0, -1.0, -3.0}},
+		{"geometric", "/sequence?kind=geometric&start=3&count=5", []interface{}{3.0, 6.0, 12.0, 24.0, 48.0}},
+		{"fibonacci", "/sequence?kind=fibonacci&count=10", []interface{}{"0", "1", "1", "2", "3", "5", "8", "13", "21", "34"}},
+		{"prime", "/sequence?kind=prime&count=8", []interface{}{"2", "3", "5", "7", "11", "13", "17", "19"}},
+		{"expression", "/sequence?kind=expression&expression=n%5E2%2B1&count=4", []interface{}{1.0, 2.0, 5.0, 10.0}},
+		{"arithmeticSeries", "/series?kind=arithmetic&start=1&count=5", []interface{}{1.0, 3.0, 6.0, 10.0, 15.0}},
+		{"geometricSeries", "/series?kind=geometric&start=1&ratio=0.5&count=4", []interface{}{1.0, 1.5, 1.75, 1.875}},
+		{"fibonacciSeries", "/series?kind=fibonacci&count=6", []interface{}{"0", "1", "2", "4", "7", "12"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			page, mathRes := getSequencePage(t, testCase.path)
+			if !reflect.DeepEqual(page.Values, testCase.expected) {
+				t.Logf("unexpected values: (actual %v != expected %v)\n", page.Values, testCase.expected)
+				t.Fail()
+			}
+			if page.NextCursor != "" || mathRes.Mode != string(modeSequence) {
+				t.Logf("unexpected page: %+v %s\n", page, mathRes.Mode)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// TestSequencePagination follows cursors to the end and checks that each page is cached separately
+func TestSequencePagination(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	var values []interface{}
+	var cursors []string
+	path := "/sequence?kind=prime&count=25&limit=10"
+	pages := 0
+	for {
+		page, mathRes := getSequencePage(t, path)
+		if page.Offset != len(values) || page.Count != 25 || mathRes.Cached {
+			t.Logf("unexpected page: %+v cached %t\n", page, mathRes.Cached)
+			t.Fail()
+		}
+
+		values = append(values, page.Values...)
+		pages++
+		if page.NextCursor == "" {
+			break
+		}
+		cursors = append(cursors, page.NextCursor)
+		path = "/sequence?kind=prime&count=25&limit=10&cursor=" + page.NextCursor
+	}
+
+	if pages != 3 || len(values) != 25 || values[24] != "97" {
+		t.Logf("unexpected pages: %d pages of %v\n", pages, values)
+		t.Fail()
+	}
+
+	// the series' second page still sums everything before it, whether or not the cursor has the sum
+	first, _ := getSequencePage(t, "/series?kind=arithmetic&count=10&limit=5")
+	expected := []interface{}{15.0, 21.0, 28.0, 36.0, 45.0}
+	for _, cursor := range []string{first.NextCursor, encodeCursor(sequenceCursor{offset: 5})} {
+		page, _ := getSequencePage(t, "/series?kind=arithmetic&count=10&limit=5&cursor="+cursor)
+		if !reflect.DeepEqual(page.Values, expected) {
+			t.Logf("unexpected values: (actual %v != expected %v)\n", page.Values, expected)
+			t.Fail()
+		}
+	}
+
+	_, mathRes := getSequencePage(t, "/sequence?kind=prime&count=25&limit=10&cursor="+cursors[0])
+	if !mathRes.Cached {
+		t.Logf("unexpected cached value: (actual %t != expected %t)\n", mathRes.Cached, true)
+		t.Fail()
+	}
+}
+
+// TestSequenceNDJSON streams a whole sequence, starting from a cursor
+func TestSequenceNDJSON(t *testing.T) {
+	body := `{"kind": "fibonacci", "count": 2500, "cursor": "` + encodeCursor(sequenceCursor{offset: 2490}) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/sequence?format=ndjson", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resRecorder := httptest.NewRecorder()
+	GetRouter().ServeHTTP(resRecorder, req)
+
+	if contentType := resRecorder.Header().Get("Content-Type"); contentType != ndjsonContentType {
+		t.Logf("unexpected content-type value: (actual %s != expected %s)\n", contentType, ndjsonContentType)
+		t.Fail()
+	}
+
+	scanner := bufio.NewScanner(resRecorder.Body)
+	scanner.Buffer(nil, 1<<20)
+	var lines [][]byte
+	for scanner.Scan() {
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
+	}
+	if len(lines) == 0 {
+		t.Fatal("expecting lines, none received")
+	}
+
+	// the stream ends with a line saying so
+	var end SequenceEnd
+	err := json.Unmarshal(lines[len(lines)-1], &end)
+	if err != nil || !end.Done || end.Count != 2500 {
+		t.Logf("unexpected last line: %s\n", lines[len(lines)-1])
+		t.Fail()
+	}
+
+	var terms []SequenceTerm
+	for _, line := range lines[:len(lines)-1] {
+		var term SequenceTerm
+		if err := json.Unmarshal(line, &term); err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+		terms = append(terms, term)
+	}
+
+	if len(terms) != 10 || terms[0].Index != 2490 || terms[9].Index != 2499 {
+		t.Fatalf("unexpected terms: %d terms\n", len(terms))
+	}
+	// F(2499) ends in ...0626 and has 522 digits
+	last := terms[9].Value.(string)
+	if len(last) != 522 || !strings.HasSuffix(last, "0626") {
+		t.Logf("unexpected last term: %s\n", last)
+		t.Fail()
+	}
+}
+
+// TestSequenceCursorState checks that pages picked up from the running sum or the last prime in a
+// cursor match the same pages worked out from the start
+func TestSequenceCursorState(t *testing.T) {
+	testCases := []sequenceSpec{
+		{kind: "prime", count: 3000},
+		{kind: "prime", count: 3000, series: true},
+		{kind: "fibonacci", count: 300, series: true},
+		{kind: "arithmetic", count: 3000, params: map[string]float64{"start": 0.5, "step": 3}, series: true},
+	}
+
+	for _, spec := range testCases {
+		var followed []interface{}
+		from := sequenceCursor{}
+		for from.offset < spec.count {
+			limit := 700
+			if from.offset+limit > spec.count {
+				limit = spec.count - from.offset
+			}
+			values, next, err := spec.page(from, limit)
+			if err != nil {
+				t.Fatalf("unexpected error: %s\n", err)
+			}
+			followed = append(followed, values...)
+			from = next
+		}
+
+		whole, _, err := spec.page(sequenceCursor{}, spec.count)
+		if err != nil {
+			t.Fatalf("unexpected error: %s\n", err)
+		}
+		if !reflect.DeepEqual(followed, whole) {
+			t.Logf("unexpected terms for %+v: (%d followed != %d whole)\n", spec, len(followed), len(whole))
+			t.Fail()
+		}
+	}
+
+	// sieving windows after a prime agrees with sieving everything
+	primes := primesUpTo(nthPrimeBound(20000))
+	for _, start := range []int{0, 1, 99, 5000, 17000} {
+		after := 1
+		if start > 0 {
+			after = primes[start-1]
+		}
+		actual := primesAfter(after, 3000)
+		if !reflect.DeepEqual(actual, primes[start:start+3000]) {
+			t.Logf("unexpected primes after %d: (actual %v... != expected %v...)\n", after, actual[:5], primes[start:start+5])
+			t.Fail()
+		}
+	}
+}
+
+// TestSequenceErrors checks parameter validation
+func TestSequenceErrors(t *testing.T) {
+	testCases := []struct {
+		path           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"/sequence", http.StatusBadRequest, "invalid_argument"},
+		{"/sequence?kind=triangular", http.StatusBadRequest, "unsupported_operation"},
+		{"/sequence?kind=arithmetic&count=0", http.StatusBadRequest, "invalid_argument"},
+		{"/sequence?kind=fibonacci&count=20000", http.StatusUnprocessableEntity, "limit_exceeded"},
+		{"/sequence?kind=arithmetic&limit=5000", http.StatusUnprocessableEntity, "limit_exceeded"},
+		{"/sequence?kind=arithmetic&cursor=bogus", http.StatusBadRequest, "invalid_argument"},
+		{"/sequence?kind=arithmetic&count=10&cursor=" + encodeCursor(sequenceCursor{offset: 10}), http.StatusBadRequest, "invalid_argument"},
+		{"/sequence?kind=arithmetic&count=10&cursor=" + encodeCursor(sequenceCursor{offset: 5, last: 7}), http.StatusBadRequest, "invalid_argument"},
+		{"/sequence?kind=prime&count=10&cursor=" + encodeCursor(sequenceCursor{offset: 5, last: 1 << 40}), http.StatusBadRequest, "invalid_argument"},
+		{"/series?kind=fibonacci&count=10&cursor=" + base64.RawURLEncoding.EncodeToString([]byte("offset:5;sum:1.5")), http.StatusBadRequest, "invalid_argument"},
+		{"/sequence?kind=expression&expression=x%2B1", http.StatusBadRequest, "invalid_argument"},
+		{"/sequence?kind=expression&expression=1%2Fn", http.StatusUnprocessableEntity, "domain_error"},
+		{"/series?kind=geometric&ratio=1e10&count=100", http.StatusUnprocessableEntity, "domain_error"},
+	}
+
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost:8080"+testCase.path, nil)
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != testCase.expectedStatus || errRes.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s: (actual %d %s != expected %d %s)\n", testCase.path, resRecorder.Code, errRes.Code, testCase.expectedStatus, testCase.expectedCode)
+			t.Fail()
+		}
+	}
+}
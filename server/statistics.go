@@ -0,0 +1,350 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// The statistics operations summarize a dataset, sent as a JSON array, a CSV body, or repeated form
+// values.  Every answer echoes the size of the dataset (and any options) in args rather than the
+// dataset itself, which could be quite large
+
+const maxDatasetLength = 100000
+const defaultHistogramBuckets = 10
+const maxHistogramBuckets = 1000
+
+// statsArgs are the parsed operands and options of a statistics operation
+type statsArgs struct {
+	data, x, y []float64
+	sample     bool      // sample rather than population statistics, true by default
+	p          []float64 // percentiles, 0 to 100
+	pIsList    bool      // whether p was sent as a list, so the answer should be a list too
+	buckets    int
+}
+
+// statsOptional are the optional params shared by the statistics operations that have a sample and
+// a population version
+var statsOptional = []string{"sample"}
+
+// statisticsOperations are merged into supportedOperations in init
+var statisticsOperations = map[string]*operation{
+	"mean":        {description: "the arithmetic mean of data", params: []string{"data"}, statsFn: statsMean, cache: noCachePolicy},
+	"median":      {description: "the median of data", params: []string{"data"}, statsFn: statsMedian, cache: noCachePolicy},
+	"mode":        {description: "the most common values in data", params: []string{"data"}, statsFn: statsMode, cache: noCachePolicy},
+	"variance":    {description: "the variance of data", params: []string{"data"}, optional: statsOptional, statsFn: statsVariance, cache: noCachePolicy},
+	"stddev":      {description: "the standard deviation of data", params: []string{"data"}, optional: statsOptional, statsFn: statsStddev, cache: noCachePolicy},
+	"percentile":  {description: "the pth percentiles of data", params: []string{"data", "p"}, statsFn: statsPercentile, cache: noCachePolicy},
+	"histogram":   {description: "counts of data in equal width buckets", params: []string{"data"}, optional: []string{"buckets"}, statsFn: statsHistogram, cache: noCachePolicy},
+	"skewness":    {description: "the skewness of data", params: []string{"data"}, optional: statsOptional, statsFn: statsSkewness, cache: noCachePolicy},
+	"kurtosis":    {description: "the excess kurtosis of data", params: []string{"data"}, optional: statsOptional, statsFn: statsKurtosis, cache: noCachePolicy},
+	"covariance":  {description: "the covariance of datasets x and y", params: binaryParams, optional: statsOptional, statsFn: statsCovariance, cache: noCachePolicy},
+	"correlation": {description: "the Pearson correlation of datasets x and y", params: binaryParams, statsFn: statsCorrelation, cache: noCachePolicy},
+}
+
+func init() {
+	for name, op := range statisticsOperations {
+		supportedOperations[name] = op
+	}
+}
+
+// newStatsEvaluation parses the dataset(s) and options of a statistics operation
+func newStatsEvaluation(op string, operation *operation, vars clientVars) (*evaluation, error) {
+	args := statsArgs{
+		sample:  true,
+		buckets: defaultHistogramBuckets,
+	}
+	echo := make(map[string]interface{})
+
+	for _, param := range append(append([]string{}, operation.params...), operation.optional...) {
+		if _, ok := vars[param]; !ok && contains(operation.optional, param) {
+			continue
+		}
+
+		var err error
+		switch param {
+		case "data":
+			args.data, err = vars.numbers(param, maxDatasetLength)
+			echo["n"] = len(args.data)
+		case "x":
+			args.x, err = vars.numbers(param, maxDatasetLength)
+			echo["n"] = len(args.x)
+		case "y":
+			args.y, err = vars.numbers(param, maxDatasetLength)
+		case "p":
+			args.p, err = vars.numbers(param, maxDatasetLength)
+			args.pIsList = len(vars[param]) > 0 && vars[param][0] == '['
+			echo[param] = vars[param]
+		case "sample":
+			args.sample, err = vars.boolean(param)
+			echo[param] = args.sample
+		case "buckets":
+			var buckets float64
+			buckets, err = vars.float(param)
+			if err == nil && (buckets != math.Trunc(buckets) || buckets < 1 || buckets > maxHistogramBuckets) {
+				err = newMathError(kindInvalidArgument, "buckets must be an integer between 1 and %d", maxHistogramBuckets)
+			}
+			args.buckets = int(buckets)
+			echo[param] = args.buckets
+		}
+		if err != nil {
+			if _, ok := err.(*mathError); !ok {
+				err = newMathError(kindInvalidArgument, "%s", err)
+			}
+			return nil, err
+		}
+	}
+
+	if args.x != nil && len(args.x) != len(args.y) {
+		return nil, newMathError(kindInvalidArgument, "x and y must be the same length, got %d and %d", len(args.x), len(args.y))
+	}
+
+	content, err := json.Marshal([]interface{}{args.data, args.x, args.y, args.p, args.sample, args.buckets})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+
+	return &evaluation{
+		op:     op,
+		mode:   modeStatistics,
+		args:   echo,
+		key:    createArgsCacheKey(string(modeStatistics), op, hex.EncodeToString(sum[:])),
+		policy: operation.cache,
+		compute: func() (interface{}, error) {
+			ans, err := operation.statsFn(args)
+			if f, ok := ans.(float64); ok && err == nil {
+				err = checkFinite(f)
+			}
+			return ans, err
+		},
+	}, nil
+}
+
+func contains(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
+// requireLength makes sure there's enough data for a statistic
+func requireLength(data []float64, n int, statistic string) error {
+	if len(data) < n {
+		return newMathError(kindDomain, "%s needs at least %d values, got %d", statistic, n, len(data))
+	}
+	return nil
+}
+
+func mean(data []float64) float64 {
+	var sum float64
+	for _, value := range data {
+		sum += value
+	}
+	return sum / float64(len(data))
+}
+
+// centralMoment returns the kth central moment of data, divided by n
+func centralMoment(data []float64, k float64) float64 {
+	m := mean(data)
+	var sum float64
+	for _, value := range data {
+		sum += math.Pow(value-m, k)
+	}
+	return sum / float64(len(data))
+}
+
+func sortedCopy(data []float64) []float64 {
+	sorted := append([]float64{}, data...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+func statsMean(args statsArgs) (interface{}, error) {
+	return mean(args.data), nil
+}
+
+func statsMedian(args statsArgs) (interface{}, error) {
+	return percentile(sortedCopy(args.data), 50), nil
+}
+
+// statsMode returns every value that occurs most often, in ascending order
+func statsMode(args statsArgs) (interface{}, error) {
+	counts := make(map[float64]int)
+	most := 0
+	for _, value := range args.data {
+		counts[value]++
+		if counts[value] > most {
+			most = counts[value]
+		}
+	}
+
+	modes := []float64{}
+	for value, count := range counts {
+		if count == most {
+			modes = append(modes, value)
+		}
+	}
+	sort.Float64s(modes)
+	return modes, nil
+}
+
+func variance(args statsArgs) (float64, error) {
+	n := float64(len(args.data))
+	if !args.sample {
+		return centralMoment(args.data, 2), nil
+	}
+
+	if err := requireLength(args.data, 2, "sample variance"); err != nil {
+		return 0, err
+	}
+	return centralMoment(args.data, 2) * n / (n - 1), nil
+}
+
+func statsVariance(args statsArgs) (interface{}, error) {
+	return variance(args)
+}
+
+func statsStddev(args statsArgs) (interface{}, error) {
+	v, err := variance(args)
+	return math.Sqrt(v), err
+}
+
+// percentile interpolates between the closest ranks of sorted data, like numpy's default
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := math.Floor(rank)
+	upper := math.Ceil(rank)
+	return sorted[int(lower)] + (rank-lower)*(sorted[int(upper)]-sorted[int(lower)])
+}
+
+func statsPercentile(args statsArgs) (interface{}, error) {
+	sorted := sortedCopy(args.data)
+	answers := make([]float64, len(args.p))
+	for i, p := range args.p {
+		if p < 0 || p > 100 {
+			return nil, newMathError(kindInvalidArgument, "p must be between 0 and 100, got %g", p)
+		}
+		answers[i] = percentile(sorted, p)
+	}
+
+	if !args.pIsList {
+		return answers[0], nil
+	}
+	return answers, nil
+}
+
+// statsHistogram splits the range of data into equal width buckets.  Each bucket includes its min
+// and excludes its max, except for the last bucket which includes both
+func statsHistogram(args statsArgs) (interface{}, error) {
+	sorted := sortedCopy(args.data)
+	min, max := sorted[0], sorted[len(sorted)-1]
+	width := (max - min) / float64(args.buckets)
+	if math.IsInf(max-min, 0) || math.IsInf(width, 0) || math.IsNaN(width) {
+		return nil, newMathError(kindDomain, "histogram range is too wide to split into buckets")
+	}
+
+	buckets := make([]HistogramBucket, args.buckets)
+	for i := range buckets {
+		buckets[i].Min = min + float64(i)*width
+		buckets[i].Max = min + float64(i+1)*width
+	}
+	buckets[len(buckets)-1].Max = max
+
+	for _, value := range sorted {
+		i := len(buckets) - 1
+		if width > 0 {
+			i = int((value - min) / width)
+		}
+		// rounding can put a value just outside the range, so keep it in the first or last bucket
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(buckets) {
+			i = len(buckets) - 1
+		}
+		buckets[i].Count++
+	}
+
+	return buckets, nil
+}
+
+// statsSkewness returns the adjusted Fisher-Pearson coefficient for samples, and the plain one for
+// populations
+func statsSkewness(args statsArgs) (interface{}, error) {
+	if err := requireLength(args.data, 3, "skewness"); err != nil {
+		return nil, err
+	}
+
+	m2 := centralMoment(args.data, 2)
+	if m2 == 0 {
+		return nil, newMathError(kindDomain, "skewness is undefined when every value is the same")
+	}
+	g1 := centralMoment(args.data, 3) / math.Pow(m2, 1.5)
+	if !args.sample {
+		return g1, nil
+	}
+
+	n := float64(len(args.data))
+	return g1 * math.Sqrt(n*(n-1)) / (n - 2), nil
+}
+
+// statsKurtosis returns excess kurtosis, adjusted for bias when sample is set
+func statsKurtosis(args statsArgs) (interface{}, error) {
+	if err := requireLength(args.data, 4, "kurtosis"); err != nil {
+		return nil, err
+	}
+
+	m2 := centralMoment(args.data, 2)
+	if m2 == 0 {
+		return nil, newMathError(kindDomain, "kurtosis is undefined when every value is the same")
+	}
+	g2 := centralMoment(args.data, 4)/(m2*m2) - 3
+	if !args.sample {
+		return g2, nil
+	}
+
+	n := float64(len(args.data))
+	return ((n+1)*g2 + 6) * (n - 1) / ((n - 2) * (n - 3)), nil
+}
+
+func covariance(x, y []float64, sample bool) float64 {
+	mx, my := mean(x), mean(y)
+	var sum float64
+	for i := range x {
+		sum += (x[i] - mx) * (y[i] - my)
+	}
+
+	if sample {
+		return sum / float64(len(x)-1)
+	}
+	return sum / float64(len(x))
+}
+
+func statsCovariance(args statsArgs) (interface{}, error) {
+	if args.sample {
+		if err := requireLength(args.x, 2, "sample covariance"); err != nil {
+			return nil, err
+		}
+	}
+	return covariance(args.x, args.y, args.sample), nil
+}
+
+// statsCorrelation returns Pearson's correlation coefficient, for which sample and population
+// versions are the same
+func statsCorrelation(args statsArgs) (interface{}, error) {
+	if err := requireLength(args.x, 2, "correlation"); err != nil {
+		return nil, err
+	}
+
+	sx := math.Sqrt(covariance(args.x, args.x, false))
+	sy := math.Sqrt(covariance(args.y, args.y, false))
+	if sx == 0 || sy == 0 {
+		return nil, newMathError(kindDomain, "correlation is undefined when either series is constant")
+	}
+	return covariance(args.x, args.y, false) / (sx * sy), nil
+}
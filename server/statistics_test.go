@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestStatisticsOperations runs each statistics operation through mathHandler with a JSON body
+func TestStatisticsOperations(t *testing.T) {
+	testCases := []struct {
+		op       string
+		body     string
+		expected interface{}
+	}{
+		{"mean", `{"data": [2, 4, 4, 4, 5, 5, 7, 9]}`, 5.0},
+		{"median", `{"data": [2, 4, 4, 4, 5, 5, 7, 9]}`, 4.5},
+		{"median", `{"data": 3}`, 3.0},
+		{"mode", `{"data": [1, 3, 3, 1, 2]}`, []interface{}{1.0, 3.0}},
+		{"variance", `{"data": [2, 4, 4, 4, 5, 5, 7, 9]}`, 4.571428571},
+		{"variance", `{"data": [2, 4, 4, 4, 5, 5, 7, 9], "sample": false}`, 4.0},
+		{"stddev", `{"data": [2, 4, 4, 4, 5, 5, 7, 9], "sample": "false"}`, 2.0},
+		{"percentile", `{"data": [2, 4, 4, 4, 5, 5, 7, 9], "p": 25}`, 4.0},
+		{"percentile", `{"data": [1, 2, 3, 4], "p": [0, 50, 100]}`, []interface{}{1.0, 2.5, 4.0}},
+		{"histogram", `{"data": [1, 2, 3, 4], "buckets": 2}`, []interface{}{
+			map[string]interface{}{"min": 1.0, "max": 2.5, "count": 2.0},
+			map[string]interface{}{"min": 2.5, "max": 4.0, "count": 2.0},
+		}},
+		{"histogram", `{"data": [5, 5], "buckets": 1}`, []interface{}{
+			map[string]interface{}{"min": 5.0, "max": 5.0, "count": 2.0},
+		}},
+		{"skewness", `{"data": [1, 2, 3, 4, 10]}`, 1.697056275},
+		{"skewness", `{"data": [1, 2, 3, 4, 10], "sample": false}`, 1.138419958},
+		{"kurtosis", `{"data": [1, 2, 3, 4, 10]}`, 3.152},
+		{"kurtosis", `{"data": [1, 2, 3, 4, 10], "sample": false}`, -0.212},
+		{"covariance", `{"x": [1, 2, 3], "y": [2, 4, 6]}`, 2.0},
+		{"correlation", `{"x": [1, 2, 3], "y": [6, 4, 2]}`, -1.0},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes MathOKResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if !reflect.DeepEqual(roundAnswer(mathRes.Answer), testCase.expected) {
+			t.Logf("unexpected answer for %s %s: (actual %v != expected %v)\n", testCase.op, testCase.body, mathRes.Answer, testCase.expected)
+			t.Fail()
+		}
+		if mathRes.Mode != string(modeStatistics) {
+			t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modeStatistics)
+			t.Fail()
+		}
+	}
+}
+
+// TestStatisticsContentTypes sends the same datasets as CSV bodies and repeated form values
+func TestStatisticsContentTypes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		op          string
+		contentType string
+		body        string
+		expected    float64
+	}{
+		{"csvColumn", "mean", "text/csv", "1\n2\n3\n", 2},
+		{"csvRow", "mean", "text/csv", "1,2,3,6\n", 3},
+		{"csvPairs", "covariance", "text/csv", "1,2\n2,4\n3,6\n", 2},
+		{"csvHeader", "correlation", "text/csv", "y,x\n2,1\n4,2\n6,3\n", 1},
+		{"csvHeaderWithQuery", "percentile?p=50", "text/csv", "data\n1\n2\n3\n4\n", 2.5},
+		{"form", "median", "application/x-www-form-urlencoded", url.Values{"data": {"3", "1", "2"}}.Encode(), 2},
+		{"formQuery", "variance?sample=false", "application/x-www-form-urlencoded", url.Values{"data": {"1", "3"}}.Encode(), 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+			req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+			req.Header.Set("Content-Type", testCase.contentType)
+			resRecorder := httptest.NewRecorder()
+			GetRouter().ServeHTTP(resRecorder, req)
+
+			var mathRes MathOKResponse
+			err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+			if err != nil {
+				t.Fatalf("json decode failed: %s\n", err)
+			}
+
+			if roundAnswer(mathRes.Answer) != testCase.expected {
+				t.Logf("unexpected answer value: (actual %v != expected %v)\n", mathRes.Answer, testCase.expected)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// TestStatisticsErrors checks dataset validation and undefined statistics
+func TestStatisticsErrors(t *testing.T) {
+	testCases := []struct {
+		op             string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"mean", "application/json", `{"data": []}`, http.StatusBadRequest, "invalid_argument"},
+		{"mean", "application/json", `{"data": [1, "two"]}`, http.StatusBadRequest, "invalid_argument"},
+		{"variance", "application/json", `{"data": [1]}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"variance", "application/json", `{"data": [1, 2], "sample": "maybe"}`, http.StatusBadRequest, "invalid_argument"},
+		{"percentile", "application/json", `{"data": [1, 2], "p": 101}`, http.StatusBadRequest, "invalid_argument"},
+		{"histogram", "application/json", `{"data": [1, 2], "buckets": 0}`, http.StatusBadRequest, "invalid_argument"},
+		{"histogram", "application/json", `{"data": [-1e308, 1e308], "buckets": 2}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"covariance", "application/json", `{"x": [1, 2], "y": [1, 2, 3]}`, http.StatusBadRequest, "invalid_argument"},
+		{"correlation", "application/json", `{"x": [1, 2], "y": [3, 3]}`, http.StatusUnprocessableEntity, "domain_error"},
+		{"mean", "text/csv", "1,2,3\n4,5,6\n", http.StatusBadRequest, "invalid_argument"},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", testCase.contentType)
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != testCase.expectedStatus || errRes.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s %s: (actual %d %s != expected %d %s)\n", testCase.op, testCase.body, resRecorder.Code, errRes.Code, testCase.expectedStatus, testCase.expectedCode)
+			t.Fail()
+		}
+	}
+}
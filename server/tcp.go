@@ -0,0 +1,268 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The line protocol is for talking to the server with nc, the way you'd use bc or dc.  Each line is
+// either an operation followed by its operands, like "add 3 4" or "convert 5 km m", or an infix
+// expression like "2^10 + 1", which is evaluated with eval.  Operands are matched up with the
+// operation's params and then its optional params, the same as JSON-RPC's positional params, and
+// each one is read as JSON if it can be and as a string otherwise, so [1, 2, 3] is a list and km is
+// "km".  Every line gets back exactly one line: the answer, or "ERR <code> <message>".  Blank lines
+// are ignored and "quit" closes the connection
+
+const (
+	defaultLineMaxConns    = 100
+	defaultLineIdleTimeout = 5 * time.Minute
+
+	// maxLineBytes limits the length of a single line, which mostly matters for expressions
+	maxLineBytes = 64 << 10
+)
+
+// LineServer serves the line protocol over TCP.  It shares supportedOperations and the answer cache
+// with the HTTP server
+type LineServer struct {
+	maxConns    int
+	idleTimeout time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+// NewLineServer creates a LineServer that handles at most maxConns connections at once and closes
+// connections that haven't sent a line in idleTimeout.  Zero values use the defaults
+func NewLineServer(maxConns int, idleTimeout time.Duration) *LineServer {
+	if maxConns <= 0 {
+		maxConns = defaultLineMaxConns
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = defaultLineIdleTimeout
+	}
+
+	return &LineServer{
+		maxConns:    maxConns,
+		idleTimeout: idleTimeout,
+		conns:       make(map[net.Conn]bool),
+	}
+}
+
+// Serve accepts connections on listener until Close is called, at which point it returns nil
+func (s *LineServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		full := len(s.conns) >= s.maxConns
+		if !full {
+			s.conns[conn] = true
+		}
+		s.mu.Unlock()
+
+		if full {
+			// the client at least deserves to know why, even if nobody reads it
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			writeLineError(conn, newMathError(kindLimitExceeded, "too many connections, the limit is %d", s.maxConns))
+			conn.Close()
+			continue
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections and closes the ones that are open
+func (s *LineServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// serveConn answers lines until the client quits, goes idle, or goes away
+func (s *LineServer) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineBytes)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		if !scanner.Scan() {
+			if scanner.Err() == bufio.ErrTooLong {
+				writeLineError(conn, newMathError(kindInvalidArgument, "lines are limited to %d bytes", maxLineBytes))
+			}
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "quit" {
+			return
+		}
+
+		answer, err := answerLine(line)
+		if err != nil {
+			log.Printf("line %q failed: %s\n", line, err)
+			writeLineError(writer, err)
+		} else {
+			fmt.Fprintln(writer, answer)
+		}
+		if writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+// answerLine is evaluateLine with a panic turned into an error, so that the connection can carry
+// on with its next line
+func answerLine(line string) (answer string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = panicError(recovered)
+		}
+	}()
+	return evaluateLine(line)
+}
+
+// evaluateLine evaluates a single line and writes its answer the way the line protocol sends it:
+// strings as they are and anything else as JSON
+func evaluateLine(line string) (string, error) {
+	fields, err := splitLine(line)
+	if err != nil {
+		return "", newMathError(kindInvalidArgument, "%s", err)
+	}
+
+	op := fields[0]
+	names, ok := OperationParams(op)
+	if !ok {
+		// anything that doesn't start with an operation is an expression
+		op, fields, names = "eval", []string{"eval", line}, []string{"expression"}
+	}
+
+	operands := fields[1:]
+	if len(operands) > len(names) {
+		return "", newMathError(kindInvalidArgument, "%s takes at most %d operands, got %d", op, len(names), len(operands))
+	}
+	vars := make(clientVars, len(operands))
+	for i, operand := range operands {
+		if op != "eval" && json.Valid([]byte(operand)) {
+			vars[names[i]] = json.RawMessage(operand)
+			continue
+		}
+		// can't fail, it's a string
+		vars[names[i]], _ = json.Marshal(operand)
+	}
+
+	res, err := computeRequest{op: op, vars: vars}.run()
+	if err != nil {
+		return "", err
+	}
+
+	if answer, ok := res.Answer.(string); ok {
+		return answer, nil
+	}
+	answer, err := json.Marshal(res.Answer)
+	if err != nil {
+		return "", err
+	}
+	return string(answer), nil
+}
+
+// splitLine splits a line on whitespace, except for whitespace inside quotes, brackets, or braces,
+// so that JSON operands like [1, 2, 3] stay in one piece
+func splitLine(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	depth := 0
+	quoted, escaped := false, false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted:
+			switch c {
+			case '\\':
+				escaped = true
+			case '"':
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced %c", c)
+			}
+		case depth == 0 && (c == ' ' || c == '\t'):
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+			continue
+		}
+		field.WriteRune(c)
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced brackets")
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// writeLineError writes err as "ERR <code> <message>" on a single line
+func writeLineError(w io.Writer, err error) {
+	message := strings.Join(strings.Fields(err.Error()), " ")
+	fmt.Fprintf(w, "ERR %s %s\n", errorCodes[kindOf(err)], message)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startLineServer serves the line protocol on a free local port and returns its address
+func startLineServer(t *testing.T, maxConns int, idleTimeout time.Duration) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s\n", err)
+	}
+
+	srv := NewLineServer(maxConns, idleTimeout)
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String()
+}
+
+// dialLineServer connects to addr, returning the connection and a reader for its lines
+func dialLineServer(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %s\n", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+// addPanicOperation registers an operation that always panics, for as long as the test runs
+func addPanicOperation(t *testing.T) {
+	supportedOperations["panic"] = &operation{
+		description: "always panics",
+		params:      []string{"x", "y"},
+		fn:          func(x, y float64) float64 { panic("boom") },
+	}
+	t.Cleanup(func() { delete(supportedOperations, "panic") })
+}
+
+// TestLineProtocol sends lines over a single connection and checks each reply line
+func TestLineProtocol(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+	conn, reader := dialLineServer(t, startLineServer(t, 0, 0))
+
+	testCases := []struct {
+		line     string
+		expected string
+	}{
+		{"add 3 4", "7"},
+		{"  divide 1 4  ", "0.25"},
+		{"2^10 + 1", "1025"},
+		{"sqrt(16) * pi / pi", "4"},
+		{"factor 360", `["2","2","2","3","3","5"]`},
+		{"percentile [1, 2, 3, 4] 50", "2.5"},
+		{"convert 5 km m", `{"value":5000,"unit":"m"}`},
+		{"convert/base 255 16", "ff"},
+		{"and 0xf0 0x3c 8", `{"value":"48","hex":"0x30","binary":"0b00110000"}`},
+		{"add 1", "ERR invalid_argument missing y"},
+		{"add 1 2 3", "ERR invalid_argument add takes at most 2 operands, got 3"},
+		{"factorial -1", "ERR domain_error factorial of a negative number"},
+		{"x + 1", "ERR invalid_argument no value given for x"},
+		{"mean [1, 2", "ERR invalid_argument unbalanced brackets"},
+	}
+
+	for _, testCase := range testCases {
+		fmt.Fprintf(conn, "%s\n\n", testCase.line) // the blank line shouldn't get a reply
+		actual, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed: %s\n", err)
+		}
+
+		actual = strings.TrimSuffix(actual, "\n")
+		if actual != testCase.expected {
+			t.Logf("unexpected reply for %q: (actual %s != expected %s)\n", testCase.line, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+
+	t.Run("panic", func(t *testing.T) {
+		addPanicOperation(t)
+		fmt.Fprintln(conn, "panic 1 2")
+		fmt.Fprintln(conn, "add 1 2")
+		for _, expected := range []string{"ERR internal internal error: boom\n", "3\n"} {
+			actual, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read failed: %s\n", err)
+			}
+			if actual != expected {
+				t.Logf("unexpected reply: (actual %q != expected %q)\n", actual, expected)
+				t.Fail()
+			}
+		}
+	})
+
+	t.Run("quit", func(t *testing.T) {
+		fmt.Fprintln(conn, "quit")
+		_, err := reader.ReadString('\n')
+		if err == nil {
+			t.Log("expecting the connection to close, it didn't")
+			t.Fail()
+		}
+	})
+}
+
+// TestLineServerLimits checks the connection limit and the idle timeout
+func TestLineServerLimits(t *testing.T) {
+	addr := startLineServer(t, 1, 100*time.Millisecond)
+
+	conn, reader := dialLineServer(t, addr)
+	fmt.Fprintln(conn, "add 1 1")
+	actual, _ := reader.ReadString('\n')
+	if actual != "2\n" {
+		t.Logf("unexpected reply: (actual %q != expected \"2\\n\")\n", actual)
+		t.Fail()
+	}
+
+	// the first connection is still open, so the second is turned away
+	_, secondReader := dialLineServer(t, addr)
+	actual, _ = secondReader.ReadString('\n')
+	expected := "ERR limit_exceeded too many connections, the limit is 1\n"
+	if actual != expected {
+		t.Logf("unexpected reply: (actual %q != expected %q)\n", actual, expected)
+		t.Fail()
+	}
+
+	// after the idle timeout the first connection is closed
+	_, err := reader.ReadString('\n')
+	if err == nil {
+		t.Log("expecting the idle connection to close, it didn't")
+		t.Fail()
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected []string
+	}{
+		{"add 3 4", []string{"add", "3", "4"}},
+		{"mean\t[1, 2, 3]", []string{"mean", "[1, 2, 3]"}},
+		{`derive "x ^ 2" {"x": 1}`, []string{"derive", `"x ^ 2"`, `{"x": 1}`}},
+		{`concat "a \" b"`, []string{"concat", `"a \" b"`}},
+		{"pi", []string{"pi"}},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := splitLine(testCase.line)
+		if err != nil {
+			t.Logf("unexpected error for %q: %s\n", testCase.line, err)
+			t.Fail()
+			continue
+		}
+		if !reflect.DeepEqual(actual, testCase.expected) {
+			t.Logf("unexpected fields for %q: (actual %q != expected %q)\n", testCase.line, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+
+	for _, line := range []string{`add "3`, "mean [1, 2", "mean 1]"} {
+		_, err := splitLine(line)
+		if err == nil {
+			t.Logf("expecting error for %q, none received\n", line)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,613 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unit-aware operands are written as {"value": 5, "unit": "km"}.  A unit is a product of symbols from
+// unitTable raised to integer powers, like "kg*m/s^2", so add(5 km, 300 m) is 5.3 km and
+// multiply(3 m, 2 s) is 6 m*s.  Temperatures with an offset (C and F) can only be used on their own
+
+// dimension is the exponent of each base dimension, in the order of baseDimensions
+type dimension [5]int
+
+var baseDimensions = [len(dimension{})]string{"length", "mass", "time", "temperature", "data"}
+
+var (
+	dimensionless = dimension{}
+	length        = dimension{1, 0, 0, 0, 0}
+	mass          = dimension{0, 1, 0, 0, 0}
+	duration      = dimension{0, 0, 1, 0, 0}
+	temperature   = dimension{0, 0, 0, 1, 0}
+	dataSize      = dimension{0, 0, 0, 0, 1}
+)
+
+// dimensionNames are the names of the derived dimensions that have one, used in error messages
+var dimensionNames = map[dimension]string{
+	dimensionless:     "dimensionless",
+	{2, 0, 0, 0, 0}:   "area",
+	{3, 0, 0, 0, 0}:   "volume",
+	{0, 0, -1, 0, 0}:  "frequency",
+	{1, 0, -1, 0, 0}:  "speed",
+	{1, 0, -2, 0, 0}:  "acceleration",
+	{1, 1, -2, 0, 0}:  "force",
+	{2, 1, -2, 0, 0}:  "energy",
+	{2, 1, -3, 0, 0}:  "power",
+	{-1, 1, -2, 0, 0}: "pressure",
+	{0, 0, -1, 0, 1}:  "data rate",
+	{-3, 1, 0, 0, 0}:  "density",
+	length:            "length",
+	mass:              "mass",
+	duration:          "time",
+	temperature:       "temperature",
+	dataSize:          "data size",
+}
+
+func (d dimension) String() string {
+	if name, ok := dimensionNames[d]; ok {
+		return name
+	}
+
+	var factors []string
+	for i, exp := range d {
+		switch exp {
+		case 0:
+		case 1:
+			factors = append(factors, baseDimensions[i])
+		default:
+			factors = append(factors, fmt.Sprintf("%s^%d", baseDimensions[i], exp))
+		}
+	}
+	return strings.Join(factors, "*")
+}
+
+func (d dimension) times(other dimension, exp int) dimension {
+	for i := range d {
+		d[i] += other[i] * exp
+	}
+	return d
+}
+
+// unitDefinition converts a unit to the base units (m, kg, s, K, and bit): base = (value + offset) * scale
+type unitDefinition struct {
+	dim    dimension
+	scale  float64
+	offset float64
+}
+
+// unitTable defines every unit symbol that can be used in a unit
+var unitTable = map[string]unitDefinition{
+	// length
+	"m":   {length, 1, 0},
+	"km":  {length, 1e3, 0},
+	"cm":  {length, 1e-2, 0},
+	"mm":  {length, 1e-3, 0},
+	"um":  {length, 1e-6, 0},
+	"nm":  {length, 1e-9, 0},
+	"in":  {length, 0.0254, 0},
+	"ft":  {length, 0.3048, 0},
+	"yd":  {length, 0.9144, 0},
+	"mi":  {length, 1609.344, 0},
+	"nmi": {length, 1852, 0},
+
+	// mass
+	"kg": {mass, 1, 0},
+	"g":  {mass, 1e-3, 0},
+	"mg": {mass, 1e-6, 0},
+	"t":  {mass, 1e3, 0},
+	"oz": {mass, 0.028349523125, 0},
+	"lb": {mass, 0.45359237, 0},
+
+	// time
+	"s":   {duration, 1, 0},
+	"ms":  {duration, 1e-3, 0},
+	"us":  {duration, 1e-6, 0},
+	"ns":  {duration, 1e-9, 0},
+	"min": {duration, 60, 0},
+	"h":   {duration, 3600, 0},
+	"d":   {duration, 86400, 0},
+	"wk":  {duration, 604800, 0},
+
+	// temperature
+	"K": {temperature, 1, 0},
+	"C": {temperature, 1, 273.15},
+	"F": {temperature, 5.0 / 9, 459.67},
+
+	// data size
+	"bit": {dataSize, 1, 0},
+	"B":   {dataSize, 8, 0},
+	"kB":  {dataSize, 8e3, 0},
+	"MB":  {dataSize, 8e6, 0},
+	"GB":  {dataSize, 8e9, 0},
+	"TB":  {dataSize, 8e12, 0},
+	"KiB": {dataSize, 8 << 10, 0},
+	"MiB": {dataSize, 8 << 20, 0},
+	"GiB": {dataSize, 8 << 30, 0},
+	"TiB": {dataSize, 8 << 40, 0},
+
+	// derived
+	"L":   {dimension{3, 0, 0, 0, 0}, 1e-3, 0},
+	"mL":  {dimension{3, 0, 0, 0, 0}, 1e-6, 0},
+	"ha":  {dimension{2, 0, 0, 0, 0}, 1e4, 0},
+	"Hz":  {dimension{0, 0, -1, 0, 0}, 1, 0},
+	"kph": {dimension{1, 0, -1, 0, 0}, 1e3 / 3600, 0},
+	"mph": {dimension{1, 0, -1, 0, 0}, 1609.344 / 3600, 0},
+	"N":   {dimension{1, 1, -2, 0, 0}, 1, 0},
+	"J":   {dimension{2, 1, -2, 0, 0}, 1, 0},
+	"kJ":  {dimension{2, 1, -2, 0, 0}, 1e3, 0},
+	"cal": {dimension{2, 1, -2, 0, 0}, 4.184, 0},
+	"kWh": {dimension{2, 1, -2, 0, 0}, 3.6e6, 0},
+	"W":   {dimension{2, 1, -3, 0, 0}, 1, 0},
+	"kW":  {dimension{2, 1, -3, 0, 0}, 1e3, 0},
+	"Pa":  {dimension{-1, 1, -2, 0, 0}, 1, 0},
+	"kPa": {dimension{-1, 1, -2, 0, 0}, 1e3, 0},
+	"bar": {dimension{-1, 1, -2, 0, 0}, 1e5, 0},
+	"psi": {dimension{-1, 1, -2, 0, 0}, 6894.757293168361, 0},
+}
+
+// unitSignificantDigits is how many digits the unitTable conversions are trusted for.  Answers
+// are rounded to it so that 212 F is 100 C rather than 100.00000000000003 C
+const unitSignificantDigits = 12
+
+// unitFactor is a single symbol of a unit raised to a power
+type unitFactor struct {
+	symbol string
+	exp    int
+}
+
+// unit is a product of unitFactors, with no symbol repeated.  The empty unit is dimensionless
+type unit []unitFactor
+
+// parseUnit parses units like "km", "m/s", "kg*m/s^2", and "1/s".  Every factor after a slash is
+// in the denominator, so "kg/m/s" is kg*m^-1*s^-1
+func parseUnit(str string) (unit, error) {
+	str = strings.TrimSpace(str)
+	if str == "" || str == "1" {
+		return unit{}, nil
+	}
+
+	var u unit
+	sign := 1
+	for str != "" {
+		end := strings.IndexAny(str, "*/")
+		if end < 0 {
+			end = len(str)
+		}
+
+		term := strings.TrimSpace(str[:end])
+		exp := 1
+		if caret := strings.Index(term, "^"); caret >= 0 {
+			var err error
+			exp, err = strconv.Atoi(strings.TrimSpace(term[caret+1:]))
+			if err != nil || exp == 0 {
+				return nil, fmt.Errorf("unit %q has an invalid exponent", term)
+			}
+			term = strings.TrimSpace(term[:caret])
+		}
+
+		switch _, ok := unitTable[term]; {
+		case term == "1" && exp == 1 && len(u) == 0:
+			// the numerator of "1/s"
+		case !ok:
+			return nil, fmt.Errorf("unknown unit %q", term)
+		default:
+			u = u.times(unit{{term, exp}}, sign)
+		}
+
+		if end == len(str) {
+			break
+		}
+		sign = 1
+		if str[end] == '/' {
+			sign = -1
+		}
+		if strings.TrimSpace(str[end+1:]) == "" {
+			return nil, fmt.Errorf("unit ends with %q", str[end])
+		}
+		str = str[end+1:]
+	}
+
+	if u.isCompound() && u.hasOffset() {
+		return nil, fmt.Errorf("unit %q can't include a temperature with an offset, use K instead", u)
+	}
+	return u, nil
+}
+
+// times returns the product of u and other raised to exp
+func (u unit) times(other unit, exp int) unit {
+	product := append(unit{}, u...)
+	for _, factor := range other {
+		found := false
+		for i := range product {
+			if product[i].symbol == factor.symbol {
+				product[i].exp += factor.exp * exp
+				found = true
+			}
+		}
+		if !found {
+			product = append(product, unitFactor{factor.symbol, factor.exp * exp})
+		}
+	}
+
+	// drop anything that cancelled out
+	reduced := product[:0]
+	for _, factor := range product {
+		if factor.exp != 0 {
+			reduced = append(reduced, factor)
+		}
+	}
+	return reduced
+}
+
+// String writes the numerator's factors joined by "*" followed by each of the denominator's
+func (u unit) String() string {
+	var b strings.Builder
+	for _, factor := range u {
+		if factor.exp < 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("*")
+		}
+		b.WriteString(factor.symbol)
+		if factor.exp != 1 {
+			fmt.Fprintf(&b, "^%d", factor.exp)
+		}
+	}
+
+	for _, factor := range u {
+		if factor.exp > 0 {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("1")
+		}
+		fmt.Fprintf(&b, "/%s", factor.symbol)
+		if factor.exp != -1 {
+			fmt.Fprintf(&b, "^%d", -factor.exp)
+		}
+	}
+
+	return b.String()
+}
+
+func (u unit) dimension() dimension {
+	var dim dimension
+	for _, factor := range u {
+		dim = dim.times(unitTable[factor.symbol].dim, factor.exp)
+	}
+	return dim
+}
+
+func (u unit) scale() float64 {
+	scale := 1.0
+	for _, factor := range u {
+		scale *= math.Pow(unitTable[factor.symbol].scale, float64(factor.exp))
+	}
+	return scale
+}
+
+// offset is only ever nonzero for a lone temperature like C or F (see parseUnit)
+func (u unit) offset() float64 {
+	if len(u) != 1 {
+		return 0
+	}
+	return unitTable[u[0].symbol].offset
+}
+
+func (u unit) isCompound() bool {
+	return len(u) > 1 || (len(u) == 1 && u[0].exp != 1)
+}
+
+func (u unit) hasOffset() bool {
+	for _, factor := range u {
+		if unitTable[factor.symbol].offset != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// quantity is a value with a unit
+type quantity struct {
+	value float64
+	unit  unit
+}
+
+// model returns the quantity as it's sent to the client
+func (q quantity) model() Quantity {
+	return Quantity{
+		Value: roundSignificant(q.value, unitSignificantDigits),
+		Unit:  q.unit.String(),
+	}
+}
+
+// in converts q to the unit to, which must have the same dimension
+func (q quantity) in(to unit) float64 {
+	base := (q.value + q.unit.offset()) * q.unit.scale()
+	return base/to.scale() - to.offset()
+}
+
+// scalar returns the value of a dimensionless quantity, like 3 m/km, as a plain number
+func (q quantity) scalar() float64 {
+	return q.value * q.unit.scale()
+}
+
+func roundSignificant(value float64, digits int) float64 {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(value, 'g', digits, 64), 64)
+	if err != nil {
+		return value
+	}
+	return rounded
+}
+
+// usesUnits reports whether any of operation's operands has a unit
+func usesUnits(operation *operation, vars clientVars) bool {
+	if operation.unitFn == nil {
+		return false
+	}
+	if operation.fn == nil {
+		return true // convert, which only works with units
+	}
+
+	for _, param := range operation.params {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(vars[param], &fields) == nil && fields["unit"] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// newUnitEvaluation parses the unit-aware operands of operation.  The convert operation is written
+// with value, from, and to, and is evaluated as the conversion of x = value from into y = 1 to
+func newUnitEvaluation(op string, operation *operation, vars clientVars) (*evaluation, error) {
+	eval := &evaluation{
+		op:     op,
+		mode:   modeUnits,
+		policy: operation.cache,
+	}
+
+	var x, y quantity
+	var err error
+	if operation.fn == nil {
+		x, y, err = vars.conversion()
+		eval.args = map[string]interface{}{
+			"value": x.value,
+			"from":  x.unit.String(),
+			"to":    y.unit.String(),
+		}
+	} else {
+		x, err = vars.quantity("x")
+		if err == nil {
+			y, err = vars.quantity("y")
+		}
+		eval.x, eval.y = x.model(), y.model()
+	}
+	if err != nil {
+		return nil, newMathError(kindInvalidArgument, "%s", err)
+	}
+
+	eval.key = createArgsCacheKey(string(modeUnits), op,
+		strconv.FormatFloat(x.value, 'g', -1, 64), x.unit.String(),
+		strconv.FormatFloat(y.value, 'g', -1, 64), y.unit.String())
+	eval.compute = func() (interface{}, error) {
+		ans, err := operation.unitFn(x, y)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFinite(ans.value); err != nil {
+			return nil, err
+		}
+		return ans.model(), nil
+	}
+
+	return eval, nil
+}
+
+// quantity returns the variable as a quantity.  Plain numbers are dimensionless
+func (v clientVars) quantity(name string) (quantity, error) {
+	raw, ok := v[name]
+	if !ok {
+		return quantity{}, fmt.Errorf("missing %s", name)
+	}
+
+	var value float64
+	if json.Unmarshal(raw, &value) == nil {
+		return quantity{value: value, unit: unit{}}, nil
+	}
+
+	var operand struct {
+		Value *float64 `json:"value"`
+		Unit  string   `json:"unit"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&operand); err != nil || operand.Value == nil {
+		return quantity{}, fmt.Errorf("parse %s failed: expected a number or {\"value\": ..., \"unit\": ...}, got %s", name, raw)
+	}
+
+	u, err := parseUnit(operand.Unit)
+	if err != nil {
+		return quantity{}, fmt.Errorf("parse %s failed: %s", name, err)
+	}
+	return quantity{value: *operand.Value, unit: u}, nil
+}
+
+// conversion returns the operands of the convert operation
+func (v clientVars) conversion() (quantity, quantity, error) {
+	value, err := v.float("value")
+	if err != nil {
+		return quantity{}, quantity{}, err
+	}
+
+	units := make([]unit, 2)
+	for i, name := range []string{"from", "to"} {
+		str, err := v.text(name)
+		if err != nil {
+			return quantity{}, quantity{}, err
+		}
+		units[i], err = parseUnit(str)
+		if err != nil {
+			return quantity{}, quantity{}, fmt.Errorf("parse %s failed: %s", name, err)
+		}
+	}
+
+	return quantity{value, units[0]}, quantity{1, units[1]}, nil
+}
+
+// newDimensionError reports that op can't combine the dimensions of x and y
+func newDimensionError(op string, x, y quantity) error {
+	err := newMathError(kindDimension, "%s: incompatible dimensions %s (%s) and %s (%s)",
+		op, x.unit.dimension(), x.unit, y.unit.dimension(), y.unit)
+	err.(*mathError).details = map[string]interface{}{
+		"x": unitDetails(x.unit),
+		"y": unitDetails(y.unit),
+	}
+	return err
+}
+
+func unitDetails(u unit) map[string]string {
+	return map[string]string{
+		"unit":      u.String(),
+		"dimension": u.dimension().String(),
+	}
+}
+
+// requireSameDimension makes sure x and y can be added, subtracted, or converted
+func requireSameDimension(op string, x, y quantity) error {
+	if x.unit.dimension() != y.unit.dimension() {
+		return newDimensionError(op, x, y)
+	}
+	return nil
+}
+
+// requireDimensionless makes sure q is a plain number in disguise
+func requireDimensionless(op, name string, q quantity) error {
+	if q.unit.dimension() != dimensionless {
+		err := newMathError(kindDimension, "%s: %s must be dimensionless, got %s (%s)", op, name, q.unit.dimension(), q.unit)
+		err.(*mathError).details = map[string]interface{}{name: unitDetails(q.unit)}
+		return err
+	}
+	return nil
+}
+
+// requireNoOffset makes sure neither operand is a temperature with an offset, which can't be
+// multiplied or divided meaningfully
+func requireNoOffset(op string, quantities ...quantity) error {
+	for _, q := range quantities {
+		if q.unit.hasOffset() {
+			return newMathError(kindDimension, "%s: %s has an offset and can't be multiplied or divided, use K instead", op, q.unit)
+		}
+	}
+	return nil
+}
+
+// yIn returns y's value in x's unit.  For temperatures y is treated as a difference, so 20 C + 9 F
+// is 25 C
+func yIn(x, y quantity) float64 {
+	return y.value * y.unit.scale() / x.unit.scale()
+}
+
+func unitAdd(x, y quantity) (quantity, error) {
+	if err := requireSameDimension("add", x, y); err != nil {
+		return quantity{}, err
+	}
+	return quantity{x.value + yIn(x, y), x.unit}, nil
+}
+
+func unitSubtract(x, y quantity) (quantity, error) {
+	if err := requireSameDimension("subtract", x, y); err != nil {
+		return quantity{}, err
+	}
+	return quantity{x.value - yIn(x, y), x.unit}, nil
+}
+
+func unitMod(x, y quantity) (quantity, error) {
+	if err := requireSameDimension("mod", x, y); err != nil {
+		return quantity{}, err
+	}
+	return quantity{math.Mod(x.value, yIn(x, y)), x.unit}, nil
+}
+
+func unitMultiply(x, y quantity) (quantity, error) {
+	if err := requireNoOffset("multiply", x, y); err != nil {
+		return quantity{}, err
+	}
+	return quantity{x.value * y.value, x.unit.times(y.unit, 1)}, nil
+}
+
+func unitDivide(x, y quantity) (quantity, error) {
+	if err := requireNoOffset("divide", x, y); err != nil {
+		return quantity{}, err
+	}
+	if y.value == 0 {
+		return quantity{}, newMathError(kindDomain, "division by zero")
+	}
+	return quantity{x.value / y.value, x.unit.times(y.unit, -1)}, nil
+}
+
+// unitPow raises x to a dimensionless power, which must be an integer unless x is dimensionless too
+func unitPow(x, y quantity) (quantity, error) {
+	if err := requireDimensionless("pow", "y", y); err != nil {
+		return quantity{}, err
+	}
+	exp := y.scalar()
+	if x.unit.dimension() == dimensionless {
+		return quantity{math.Pow(x.scalar(), exp), unit{}}, nil
+	}
+
+	if exp != math.Trunc(exp) {
+		return quantity{}, newMathError(kindDimension, "pow: %s can only be raised to an integer power, got %g", x.unit, exp)
+	}
+	if err := requireNoOffset("pow", x); err != nil {
+		return quantity{}, err
+	}
+	return quantity{math.Pow(x.value, exp), unit{}.times(x.unit, int(exp))}, nil
+}
+
+// unitRoot takes the yth root of x, which must leave whole powers of each of x's units
+func unitRoot(x, y quantity) (quantity, error) {
+	if err := requireDimensionless("root", "y", y); err != nil {
+		return quantity{}, err
+	}
+	k := y.scalar()
+	if x.unit.dimension() == dimensionless {
+		return quantity{math.Pow(x.scalar(), 1/k), unit{}}, nil
+	}
+
+	if err := requireNoOffset("root", x); err != nil {
+		return quantity{}, err
+	}
+	root := make(unit, len(x.unit))
+	for i, factor := range x.unit {
+		if k != math.Trunc(k) || k == 0 || factor.exp%int(k) != 0 {
+			return quantity{}, newMathError(kindDimension, "root: the %g root of %s isn't a whole unit", k, x.unit)
+		}
+		root[i] = unitFactor{factor.symbol, factor.exp / int(k)}
+	}
+	return quantity{math.Pow(x.value, 1/k), root}, nil
+}
+
+func unitLog(x, y quantity) (quantity, error) {
+	if err := requireDimensionless("log", "x", x); err != nil {
+		return quantity{}, err
+	}
+	if err := requireDimensionless("log", "y", y); err != nil {
+		return quantity{}, err
+	}
+	return quantity{math.Log(x.scalar()) / math.Log(y.scalar()), unit{}}, nil
+}
+
+// unitConvert expresses x in y's unit
+func unitConvert(x, y quantity) (quantity, error) {
+	if err := requireSameDimension("convert", x, y); err != nil {
+		return quantity{}, err
+	}
+	return quantity{x.in(y.unit), y.unit}, nil
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestUnitOperations runs unit-aware operands through mathHandler
+func TestUnitOperations(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+
+	testCases := []struct {
+		op       string
+		body     string
+		expected Quantity
+	}{
+		{"add", `{"x": {"value": 5, "unit": "km"}, "y": {"value": 300, "unit": "m"}}`, Quantity{5.3, "km"}},
+		{"subtract", `{"x": {"value": 1, "unit": "h"}, "y": {"value": 15, "unit": "min"}}`, Quantity{0.75, "h"}},
+		{"add", `{"x": {"value": 20, "unit": "C"}, "y": {"value": 9, "unit": "F"}}`, Quantity{25, "C"}},
+		{"mod", `{"x": {"value": 130, "unit": "min"}, "y": {"value": 1, "unit": "h"}}`, Quantity{10, "min"}},
+		{"multiply", `{"x": {"value": 3, "unit": "m"}, "y": {"value": 2, "unit": "s"}}`, Quantity{6, "m*s"}},
+		{"multiply", `{"x": {"value": 3, "unit": "m"}, "y": 2}`, Quantity{6, "m"}},
+		{"divide", `{"x": {"value": 100, "unit": "km"}, "y": {"value": 2, "unit": "h"}}`, Quantity{50, "km/h"}},
+		{"divide", `{"x": {"value": 6, "unit": "m*s"}, "y": {"value": 2, "unit": "s"}}`, Quantity{3, "m"}},
+		{"divide", `{"x": 1, "y": {"value": 4, "unit": "s"}}`, Quantity{0.25, "1/s"}},
+		{"pow", `{"x": {"value": 3, "unit": "m"}, "y": 2}`, Quantity{9, "m^2"}},
+		{"root", `{"x": {"value": 16, "unit": "m^2"}, "y": 2}`, Quantity{4, "m"}},
+		{"log", `{"x": {"value": 1000, "unit": "m/mm"}, "y": 10}`, Quantity{6, ""}},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var mathRes struct {
+			Mode   string   `json:"mode"`
+			Answer Quantity `json:"answer"`
+		}
+		err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if mathRes.Answer != testCase.expected {
+			t.Logf("unexpected answer for %s %s: (actual %v != expected %v)\n", testCase.op, testCase.body, mathRes.Answer, testCase.expected)
+			t.Fail()
+		}
+		if mathRes.Mode != string(modeUnits) {
+			t.Logf("unexpected mode value: (actual %s != expected %s)\n", mathRes.Mode, modeUnits)
+			t.Fail()
+		}
+	}
+}
+
+// TestConvert checks conversions within each kind of unit in the unit table
+func TestConvert(t *testing.T) {
+	testCases := []struct {
+		value    string
+		from, to string
+		expected float64
+	}{
+		{"1", "mi", "km", 1.609344},
+		{"2.5", "kg", "lb", 5.51155655462},
+		{"90", "min", "h", 1.5},
+		{"212", "F", "C", 100},
+		{"0", "C", "K", 273.15},
+		{"-40", "C", "F", -40},
+		{"1", "GiB", "MB", 1073.741824},
+		{"1", "B", "bit", 8},
+		{"36", "km/h", "m/s", 10},
+		{"1", "kWh", "J", 3.6e6},
+		{"1", "N", "kg*m/s^2", 1},
+		{"2", "L", "cm^3", 2000},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(fmt.Sprintf("%s%sTo%s", testCase.value, testCase.from, testCase.to), func(t *testing.T) {
+			form := url.Values{"value": {testCase.value}, "from": {testCase.from}, "to": {testCase.to}}
+			req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/convert", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			resRecorder := httptest.NewRecorder()
+			GetRouter().ServeHTTP(resRecorder, req)
+
+			var mathRes struct {
+				Answer Quantity `json:"answer"`
+			}
+			err := json.NewDecoder(resRecorder.Body).Decode(&mathRes)
+			if err != nil {
+				t.Fatalf("json decode failed: %s\n", err)
+			}
+
+			expected := Quantity{testCase.expected, testCase.to}
+			if mathRes.Answer != expected {
+				t.Logf("unexpected answer value: (actual %v != expected %v)\n", mathRes.Answer, expected)
+				t.Fail()
+			}
+		})
+	}
+}
+
+// TestUnitErrors checks that dimensional errors come back as structured 422s
+func TestUnitErrors(t *testing.T) {
+	testCases := []struct {
+		op              string
+		body            string
+		expectedStatus  int
+		expectedCode    string
+		expectedDetails map[string]interface{}
+	}{
+		{"add", `{"x": {"value": 5, "unit": "km"}, "y": {"value": 3, "unit": "s"}}`, http.StatusUnprocessableEntity, "dimension_mismatch", map[string]interface{}{
+			"x": map[string]interface{}{"unit": "km", "dimension": "length"},
+			"y": map[string]interface{}{"unit": "s", "dimension": "time"},
+		}},
+		{"convert", `{"value": 1, "from": "J", "to": "W"}`, http.StatusUnprocessableEntity, "dimension_mismatch", map[string]interface{}{
+			"x": map[string]interface{}{"unit": "J", "dimension": "energy"},
+			"y": map[string]interface{}{"unit": "W", "dimension": "power"},
+		}},
+		{"pow", `{"x": {"value": 2, "unit": "m"}, "y": {"value": 2, "unit": "s"}}`, http.StatusUnprocessableEntity, "dimension_mismatch", map[string]interface{}{
+			"y": map[string]interface{}{"unit": "s", "dimension": "time"},
+		}},
+		{"multiply", `{"x": {"value": 20, "unit": "C"}, "y": 2}`, http.StatusUnprocessableEntity, "dimension_mismatch", nil},
+		{"pow", `{"x": {"value": 4, "unit": "m"}, "y": 0.5}`, http.StatusUnprocessableEntity, "dimension_mismatch", nil},
+		{"root", `{"x": {"value": 8, "unit": "m"}, "y": 2}`, http.StatusUnprocessableEntity, "dimension_mismatch", nil},
+		{"divide", `{"x": {"value": 8, "unit": "m"}, "y": {"value": 0, "unit": "s"}}`, http.StatusUnprocessableEntity, "domain_error", nil},
+		{"add", `{"x": {"value": 5, "unit": "furlong"}, "y": 1}`, http.StatusBadRequest, "invalid_argument", nil},
+		{"add", `{"x": {"value": 5, "unit": "C/s"}, "y": 1}`, http.StatusBadRequest, "invalid_argument", nil},
+		{"convert", `{"value": 5, "from": "m/", "to": "m"}`, http.StatusBadRequest, "invalid_argument", nil},
+	}
+
+	for _, testCase := range testCases {
+		reqURL := fmt.Sprintf("http://localhost:8080/%s", testCase.op)
+		req := httptest.NewRequest(http.MethodPost, reqURL, strings.NewReader(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		resRecorder := httptest.NewRecorder()
+		GetRouter().ServeHTTP(resRecorder, req)
+
+		var errRes MathErrorResponse
+		err := json.NewDecoder(resRecorder.Body).Decode(&errRes)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+
+		if resRecorder.Code != testCase.expectedStatus || errRes.Code != testCase.expectedCode {
+			t.Logf("unexpected error for %s %s: (actual %d %s != expected %d %s)\n", testCase.op, testCase.body, resRecorder.Code, errRes.Code, testCase.expectedStatus, testCase.expectedCode)
+			t.Fail()
+		}
+		if testCase.expectedDetails != nil && !reflect.DeepEqual(errRes.Details, testCase.expectedDetails) {
+			t.Logf("unexpected details value: (actual %v != expected %v)\n", errRes.Details, testCase.expectedDetails)
+			t.Fail()
+		}
+	}
+}
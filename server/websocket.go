@@ -0,0 +1,347 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// /ws holds interactive sessions over a WebSocket, for calculator UIs that would rather keep one
+// connection open than make a request per keypress.  Each message is a JSON object with an id that's
+// echoed back in its reply, so replies can be matched up with requests.  Messages are handled in the
+// order they arrive, and each session remembers the last answer as "ans" along with any variables the
+// client sets.  Operands refer to them as "$ans", "$total", etc
+//
+// The message types are:
+//   - compute (the default): evaluates op with args and options, like a gRPC ComputeRequest, and
+//     replies with a result.  store, if set, also saves the answer under that name
+//   - set: saves each of vars, replying with every variable in the session
+//   - unset: forgets each of names, replying the same way
+//   - vars: just replies with every variable in the session
+
+const (
+	// wsWriteWait is how long a single write may take before the connection is given up on
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is how long the client has to answer a ping
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod must be less than wsPongWait so that a pong can arrive before the deadline
+	wsPingPeriod = wsPongWait * 9 / 10
+
+	// wsMaxMessageBytes limits the size of a single message from the client
+	wsMaxMessageBytes = 64 << 10
+	// wsSendBuffer is the number of replies that can be waiting to be written
+	wsSendBuffer = 16
+
+	// maxSessionVars limits the number of variables a session can hold, ans included
+	maxSessionVars = 100
+)
+
+// wsRateLimit is how many messages per second a single connection may send, and wsRateBurst is how
+// many it can send at once after being quiet for a while.  They're variables so that tests can
+// lower them
+var (
+	wsRateLimit = 20.0
+	wsRateBurst = 40.0
+)
+
+// sessionVarPattern is what variable names look like, both when they're set and in "$name" operands
+var sessionVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const ansVar = "ans"
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsMessage is a message from the client.  Which fields are read depends on Type
+type wsMessage struct {
+	ID      json.RawMessage            `json:"id"`
+	Type    string                     `json:"type"`
+	Op      string                     `json:"op"`
+	Args    map[string]json.RawMessage `json:"args"`
+	Options map[string]string          `json:"options"`
+	Store   string                     `json:"store"`
+	Vars    map[string]json.RawMessage `json:"vars"`
+	Names   []string                   `json:"names"`
+}
+
+// wsReply is a message to the client.  Exactly one of Result, Vars, and Error is set, according to
+// Type
+type wsReply struct {
+	ID     json.RawMessage            `json:"id,omitempty"`
+	Type   string                     `json:"type"` // one of "result", "vars", or "error"
+	Result *MathOKResponse            `json:"result,omitempty"`
+	Vars   map[string]json.RawMessage `json:"vars,omitempty"`
+	Error  *MathErrorResponse         `json:"error,omitempty"`
+}
+
+// session is a single WebSocket connection and its state
+type session struct {
+	conn *websocket.Conn
+	send chan *wsReply
+	done chan struct{} // closed when writeReplies stops, so that nothing waits on send forever
+	vars map[string]json.RawMessage
+
+	limiter tokenBucket
+}
+
+// sessions are the open sessions, so that CloseSessions can find them
+var sessions = struct {
+	sync.Mutex
+	open map[*session]bool
+}{open: make(map[*session]bool)}
+
+// wsHandler upgrades the connection and runs a session on it until either side closes it
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		log.Printf("websocket upgrade failed: %s\n", err)
+		return
+	}
+
+	s := &session{
+		conn:    conn,
+		send:    make(chan *wsReply, wsSendBuffer),
+		done:    make(chan struct{}),
+		vars:    make(map[string]json.RawMessage),
+		limiter: newTokenBucket(wsRateLimit, wsRateBurst),
+	}
+
+	sessions.Lock()
+	sessions.open[s] = true
+	sessions.Unlock()
+	defer func() {
+		sessions.Lock()
+		delete(sessions.open, s)
+		sessions.Unlock()
+	}()
+
+	go s.writeReplies()
+	s.readMessages()
+}
+
+// CloseSessions tells every open WebSocket session that the server is going away and closes it.
+// http.Server.Shutdown doesn't know about hijacked connections, so it's meant to be passed to
+// http.Server.RegisterOnShutdown
+func CloseSessions() {
+	sessions.Lock()
+	defer sessions.Unlock()
+
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for s := range sessions.open {
+		// WriteControl and Close are safe to call alongside the session's own reads and writes
+		err := s.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteWait))
+		if err != nil {
+			log.Printf("websocket close message failed: %s\n", err)
+		}
+		s.conn.Close()
+	}
+}
+
+// readMessages handles messages until the connection fails or is closed, then tells writeReplies
+// to stop
+func (s *session) readMessages() {
+	defer close(s.send)
+
+	s.conn.SetReadLimit(wsMaxMessageBytes)
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("websocket read failed: %s\n", err)
+			}
+			return
+		}
+
+		var reply *wsReply
+		var msg wsMessage
+		err = json.Unmarshal(data, &msg)
+		switch {
+		case err != nil:
+			reply = newWSError(nil, newMathError(kindInvalidArgument, "json decode failed: %s", err))
+		case !s.limiter.allow(time.Now()):
+			reply = newWSError(msg.ID, newMathError(kindRateLimited, "rate limit exceeded: at most %g messages per second", wsRateLimit))
+		default:
+			reply = s.handle(msg)
+		}
+
+		select {
+		case s.send <- reply:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// writeReplies writes every reply sent to it, along with periodic pings, and closes the connection
+// once readMessages is done
+func (s *session) writeReplies() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		s.conn.Close()
+		close(s.done)
+	}()
+
+	for {
+		select {
+		case reply, ok := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			err := s.conn.WriteJSON(reply)
+			if err != nil {
+				log.Printf("websocket write failed: %s\n", err)
+				return
+			}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err := s.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle carries out a single message and builds its reply
+func (s *session) handle(msg wsMessage) *wsReply {
+	switch msg.Type {
+	case "", "compute":
+		res, err := s.compute(msg)
+		if err != nil {
+			log.Printf("websocket %s failed: %s\n", msg.Op, err)
+			return newWSError(msg.ID, err)
+		}
+		return &wsReply{ID: msg.ID, Type: "result", Result: &res}
+	case "set":
+		for name, value := range msg.Vars {
+			err := s.setVar(name, value)
+			if err != nil {
+				return newWSError(msg.ID, err)
+			}
+		}
+	case "unset":
+		for _, name := range msg.Names {
+			delete(s.vars, name)
+		}
+	case "vars":
+	default:
+		return newWSError(msg.ID, newMathError(kindInvalidArgument, "unknown message type: %q", msg.Type))
+	}
+
+	// writeReplies marshals the reply on its own goroutine, so it gets a copy
+	vars := make(map[string]json.RawMessage, len(s.vars))
+	for name, value := range s.vars {
+		vars[name] = value
+	}
+	return &wsReply{ID: msg.ID, Type: "vars", Vars: vars}
+}
+
+// compute substitutes session variables into the message's args and evaluates it.  The answer
+// becomes ans, and msg.Store if it's set
+func (s *session) compute(msg wsMessage) (MathOKResponse, error) {
+	vars := make(clientVars, len(msg.Args))
+	for name, value := range msg.Args {
+		var ref string
+		if json.Unmarshal(value, &ref) == nil && len(ref) > 1 && ref[0] == '$' {
+			stored, ok := s.vars[ref[1:]]
+			if !ok {
+				return MathOKResponse{}, newMathError(kindInvalidArgument, "undefined variable: %q", ref[1:])
+			}
+			value = stored
+		}
+		vars[name] = value
+	}
+
+	res, err := computeRequest{op: msg.Op, vars: vars, options: msg.Options}.run()
+	if err != nil {
+		return MathOKResponse{}, err
+	}
+
+	answer, err := json.Marshal(res.Answer)
+	if err != nil {
+		return MathOKResponse{}, err
+	}
+	s.vars[ansVar] = answer
+	if msg.Store != "" {
+		err = s.setVar(msg.Store, answer)
+		if err != nil {
+			return MathOKResponse{}, err
+		}
+	}
+	return res, nil
+}
+
+// setVar saves a variable.  ans can only be set by computing something
+func (s *session) setVar(name string, value json.RawMessage) error {
+	if !sessionVarPattern.MatchString(name) || name == ansVar {
+		return newMathError(kindInvalidArgument, "invalid variable name: %q", name)
+	}
+	if _, ok := s.vars[name]; !ok && len(s.vars) >= maxSessionVars {
+		return newMathError(kindLimitExceeded, "sessions are limited to %d variables", maxSessionVars)
+	}
+	s.vars[name] = value
+	return nil
+}
+
+// newWSError builds an error reply with the same fields as an HTTP error response
+func newWSError(id json.RawMessage, err error) *wsReply {
+	kind := kindOf(err)
+	return &wsReply{
+		ID:   id,
+		Type: "error",
+		Error: &MathErrorResponse{
+			Status:  errorStatuses[kind],
+			Code:    errorCodes[kind],
+			Error:   err.Error(),
+			Details: detailsOf(err),
+		},
+	}
+}
+
+// tokenBucket is a simple rate limiter.  It holds up to burst tokens, refilled at rate tokens per
+// second, and each allowed event takes one.  It isn't safe for concurrent use
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+func newTokenBucket(rate, burst float64) tokenBucket {
+	return tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// allow takes a token if there is one
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestSession serves the router and opens a WebSocket session on it
+func dialTestSession(t *testing.T) *websocket.Conn {
+	srv := httptest.NewServer(GetRouter())
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("websocket dial failed: %s\n", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// exchange sends message and returns the reply as JSON
+func exchange(t *testing.T, conn *websocket.Conn, message string) string {
+	err := conn.WriteMessage(websocket.TextMessage, []byte(message))
+	if err != nil {
+		t.Fatalf("websocket write failed: %s\n", err)
+	}
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("websocket read failed: %s\n", err)
+	}
+	return strings.TrimSpace(string(reply))
+}
+
+// TestWebSocketSession runs through a calculator session, using ans and variables along the way
+func TestWebSocketSession(t *testing.T) {
+	cleanUpCache()
+	defer cleanUpCache()
+	conn := dialTestSession(t)
+
+	testCases := []struct {
+		message  string
+		expected string
+	}{
+		{`{"id": 1, "op": "add", "args": {"x": 3, "y": 4}}`, `{"id":1,"type":"result","result":{"action":"add","mode":"float","x":3,"y":4,"answer":7,"cached":false,"source":"computed"}}`},
+		{`{"id": 2, "op": "multiply", "args": {"x": "$ans", "y": 6}, "store": "total"}`, `{"id":2,"type":"result","result":{"action":"multiply","mode":"float","x":7,"y":6,"answer":42,"cached":false,"source":"computed"}}`},
+		{`{"id": "a", "type": "set", "vars": {"rate": 0.5}}`, `{"id":"a","type":"vars","vars":{"ans":42,"rate":0.5,"total":42}}`},
+		{`{"id": 3, "op": "multiply", "args": {"x": "$total", "y": "$rate"}}`, `{"id":3,"type":"result","result":{"action":"multiply","mode":"float","x":42,"y":0.5,"answer":21,"cached":false,"source":"computed"}}`},
+		{`{"id": 4, "op": "divide", "args": {"x": "$ans", "y": 9}, "options": {"mode": "rational"}}`, `{"id":4,"type":"result","result":{"action":"divide","mode":"rational","x":"21","y":"9","answer":"7/3","cached":false,"source":"computed"}}`},
+		{`{"id": 5, "type": "unset", "names": ["rate", "total"]}`, `{"id":5,"type":"vars","vars":{"ans":"7/3"}}`},
+		{`{"id": 6, "op": "add", "args": {"x": "$rate", "y": 1}}`, `{"id":6,"type":"error","error":{"status":400,"code":"invalid_argument","error":"undefined variable: \"rate\""}}`},
+		{`{"id": 7, "op": "factorial", "args": {"n": -1}}`, `{"id":7,"type":"error","error":{"status":422,"code":"domain_error","error":"factorial of a negative number"}}`},
+		{`{"id": 8, "type": "set", "vars": {"ans": 1}}`, `{"id":8,"type":"error","error":{"status":400,"code":"invalid_argument","error":"invalid variable name: \"ans\""}}`},
+		{`{"id": 9, "type": "shout"}`, `{"id":9,"type":"error","error":{"status":400,"code":"invalid_argument","error":"unknown message type: \"shout\""}}`},
+		{`{"id": 10, "type": "vars"}`, `{"id":10,"type":"vars","vars":{"ans":"7/3"}}`},
+	}
+
+	for _, testCase := range testCases {
+		actual := exchange(t, conn, testCase.message)
+		if actual != testCase.expected {
+			t.Logf("unexpected reply for %s: (actual %s != expected %s)\n", testCase.message, actual, testCase.expected)
+			t.Fail()
+		}
+	}
+
+	t.Run("invalidJSON", func(t *testing.T) {
+		actual := exchange(t, conn, `{"id": 1,`)
+		var reply wsReply
+		err := json.Unmarshal([]byte(actual), &reply)
+		if err != nil || reply.Type != "error" || reply.Error.Code != "invalid_argument" {
+			t.Logf("unexpected reply: %s\n", actual)
+			t.Fail()
+		}
+	})
+}
+
+// TestWebSocketRateLimit checks that messages beyond the burst are refused without closing the
+// session
+func TestWebSocketRateLimit(t *testing.T) {
+	defer func(rate, burst float64) {
+		wsRateLimit, wsRateBurst = rate, burst
+	}(wsRateLimit, wsRateBurst)
+	wsRateLimit, wsRateBurst = 0.001, 2
+	conn := dialTestSession(t)
+
+	expected := []string{"vars", "vars", "error"}
+	for i, expectedType := range expected {
+		var reply wsReply
+		err := json.Unmarshal([]byte(exchange(t, conn, `{"type": "vars"}`)), &reply)
+		if err != nil {
+			t.Fatalf("json decode failed: %s\n", err)
+		}
+		if reply.Type != expectedType {
+			t.Logf("unexpected reply type for message %d: (actual %s != expected %s)\n", i, reply.Type, expectedType)
+			t.Fail()
+		}
+		if reply.Error != nil && reply.Error.Code != "rate_limited" {
+			t.Logf("unexpected error code: (actual %s != expected rate_limited)\n", reply.Error.Code)
+			t.Fail()
+		}
+	}
+}
+
+// TestCloseSessions checks that open sessions are told the server is going away
+func TestCloseSessions(t *testing.T) {
+	conn := dialTestSession(t)
+	exchange(t, conn, `{"type": "vars"}`) // makes sure the session is registered
+
+	CloseSessions()
+
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Logf("unexpected read error: (actual %v != expected close %d)\n", err, websocket.CloseGoingAway)
+		t.Fail()
+	}
+}
+
+// TestTokenBucket checks that tokens refill at the given rate and never past the burst
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(2, 3)
+	now := bucket.last
+
+	steps := []struct {
+		elapsed  time.Duration
+		expected bool
+	}{
+		{0, true},
+		{0, true},
+		{0, true},
+		{0, false},
+		{time.Second / 2, true},
+		{0, false},
+		{time.Hour, true},
+		{0, true},
+		{0, true},
+		{0, false},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.elapsed)
+		actual := bucket.allow(now)
+		if actual != step.expected {
+			t.Logf("unexpected allow at step %d: (actual %t != expected %t)\n", i, actual, step.expected)
+			t.Fail()
+		}
+	}
+}